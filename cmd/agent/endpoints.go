@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/mikeysoft/flotilla/internal/agent/commands"
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// endpointStatusTimeout bounds the probe of each additional endpoint made for a heartbeat
+const endpointStatusTimeout = 5 * time.Second
+
+// dockerEndpoint is an additional Docker daemon managed by the agent. The server lists it as
+// a host of its own and targets commands at it by name.
+type dockerEndpoint struct {
+	name    string
+	docker  *client.Client
+	handler *commands.Handler
+}
+
+// configureCommandHandler applies the agent's limits to the command handler of a Docker daemon
+func configureCommandHandler(cfg *config.Config, handler *commands.Handler) *commands.Handler {
+	handler.SetDefaultStopTimeout(cfg.StopTimeout)
+	handler.SetMaxConcurrentCommands(cfg.MaxConcurrentCommands)
+	handler.SetMaxQueuedCommands(cfg.MaxQueuedCommands)
+	handler.SetMaxConcurrentStreams(cfg.MaxConcurrentStreams)
+	handler.SetComposeImportRoot(cfg.ComposeImportRoot)
+	handler.SetAgentConfig(cfg)
+	return handler
+}
+
+// newDockerEndpoints creates clients and command handlers for the additional Docker
+// endpoints. A daemon that cannot be reached is not fatal; it is reported as unhealthy in
+// heartbeats until it answers.
+func newDockerEndpoints(cfg *config.Config) (map[string]*dockerEndpoint, error) {
+	configured, err := cfg.DockerEndpointList()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]*dockerEndpoint, len(configured))
+	for _, ep := range configured {
+		cli, err := client.NewClientWithOpts(client.WithHost(ep.Host), client.WithAPIVersionNegotiation())
+		if err != nil {
+			closeDockerEndpoints(endpoints)
+			return nil, fmt.Errorf("failed to create Docker client for endpoint %s: %w", ep.Name, err)
+		}
+		endpoints[ep.Name] = &dockerEndpoint{
+			name:    ep.Name,
+			docker:  cli,
+			handler: configureCommandHandler(cfg, commands.NewEndpointHandler(docker.NewClient(cli), ep.Name, ep.Host)),
+		}
+		logrus.Infof("Managing Docker endpoint %s at %s", ep.Name, ep.Host)
+	}
+	return endpoints, nil
+}
+
+// closeDockerEndpoints closes the Docker clients of the additional endpoints
+func closeDockerEndpoints(endpoints map[string]*dockerEndpoint) {
+	for _, endpoint := range endpoints {
+		if err := endpoint.docker.Close(); err != nil {
+			logrus.WithError(err).Debugf("Failed to close Docker client for endpoint %s", endpoint.name)
+		}
+	}
+}
+
+// endpointStatuses probes the additional endpoints for a heartbeat, in parallel so one slow
+// daemon delays the heartbeat by at most endpointStatusTimeout
+func (a *Agent) endpointStatuses() []protocol.EndpointStatus {
+	if len(a.Endpoints) == 0 {
+		return nil
+	}
+
+	statuses := make([]protocol.EndpointStatus, 0, len(a.Endpoints))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, endpoint := range a.Endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), endpointStatusTimeout)
+			defer cancel()
+
+			status := protocol.EndpointStatus{Name: endpoint.name, Status: "healthy"}
+			running, err := endpoint.docker.ContainerList(ctx, types.ContainerListOptions{})
+			if err != nil {
+				status.Status = "unhealthy"
+				status.Error = err.Error()
+			} else {
+				status.ContainersRunning = len(running)
+			}
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// commandHandler returns the handler for the Docker endpoint a command targets
+func (a *Agent) commandHandler(endpoint string) (*commands.Handler, error) {
+	if endpoint == "" {
+		return a.Handler, nil
+	}
+	target, ok := a.Endpoints[endpoint]
+	if !ok {
+		return nil, fmt.Errorf("unknown Docker endpoint %q", endpoint)
+	}
+	return target.handler, nil
+}
+
+// agentCapabilities lists the capabilities the agent advertises in the handshake
+func (a *Agent) agentCapabilities() []string {
+	capabilities := append([]string(nil), protocol.AgentCapabilities...)
+	if len(a.Endpoints) > 0 {
+		capabilities = append(capabilities, protocol.CapabilityMultiEndpoint)
+	}
+	if a.Handler != nil {
+		if err := a.Handler.ComposeAvailable(); err != nil {
+			logrus.WithError(err).Warn("Compose is unavailable; stack commands are disabled")
+		} else {
+			capabilities = append(capabilities, protocol.CapabilityCompose)
+		}
+	}
+	return capabilities
+}
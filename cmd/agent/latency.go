@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pingRTTWindow is how many recent ping round trips the reported latency averages
+const pingRTTWindow = 10
+
+// rttTracker keeps the round trips of the latest websocket pings. Each ping carries its send
+// time, which the server echoes in the pong, so no per-ping state is needed. The zero value
+// is ready to use.
+type rttTracker struct {
+	mu      sync.Mutex
+	samples [pingRTTWindow]time.Duration
+	count   int
+	next    int
+}
+
+// pingPayload returns the application data for a ping sent at now.
+func pingPayload(now time.Time) []byte {
+	return []byte(strconv.FormatInt(now.UnixNano(), 10))
+}
+
+// ObservePong records the round trip of the ping whose payload a pong echoed. Pongs that do
+// not carry a send time, such as unsolicited ones, are ignored.
+func (t *rttTracker) ObservePong(appData string, now time.Time) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := now.Sub(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = rtt
+	t.next = (t.next + 1) % pingRTTWindow
+	if t.count < pingRTTWindow {
+		t.count++
+	}
+}
+
+// Average returns the mean of the recorded round trips, or false when there are none.
+func (t *rttTracker) Average() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.count == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, rtt := range t.samples[:t.count] {
+		total += rtt
+	}
+	return total / time.Duration(t.count), true
+}
+
+// Reset forgets the recorded round trips, so a new connection reports its own latency.
+func (t *rttTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count, t.next = 0, 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTTTrackerAveragesRecentPongs(t *testing.T) {
+	var tracker rttTracker
+	if _, ok := tracker.Average(); ok {
+		t.Fatal("expected no average before any pong")
+	}
+
+	base := time.Unix(1700000000, 0)
+	tracker.ObservePong(string(pingPayload(base)), base.Add(10*time.Millisecond))
+	tracker.ObservePong(string(pingPayload(base)), base.Add(30*time.Millisecond))
+	if avg, ok := tracker.Average(); !ok || avg != 20*time.Millisecond {
+		t.Fatalf("expected 20ms average, got %s (ok=%v)", avg, ok)
+	}
+
+	// Unsolicited pongs and clock jumps are ignored
+	tracker.ObservePong("", base)
+	tracker.ObservePong("not-a-time", base)
+	tracker.ObservePong(string(pingPayload(base)), base.Add(-time.Second))
+	if avg, _ := tracker.Average(); avg != 20*time.Millisecond {
+		t.Fatalf("expected ignored pongs to leave the average alone, got %s", avg)
+	}
+
+	// Only the latest window of pings counts
+	for i := 0; i < pingRTTWindow; i++ {
+		tracker.ObservePong(string(pingPayload(base)), base.Add(5*time.Millisecond))
+	}
+	if avg, _ := tracker.Average(); avg != 5*time.Millisecond {
+		t.Fatalf("expected old samples to roll off, got %s", avg)
+	}
+
+	tracker.Reset()
+	if _, ok := tracker.Average(); ok {
+		t.Fatal("expected reset to clear the samples")
+	}
+}
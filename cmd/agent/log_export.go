@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/mikeysoft/flotilla/internal/agent/logexport"
+	"github.com/sirupsen/logrus"
+)
+
+// startLogExport forwards the logs of the selected containers to the configured sink until
+// ctx is cancelled. It runs independently of the server connection, so logs keep flowing
+// while the agent reconnects. It does nothing when log export is disabled.
+func startLogExport(ctx context.Context, cfg *config.Config, api docker.DockerAPI, host string) error {
+	target, selector, err := cfg.LogExport()
+	if err != nil || target == nil {
+		return err
+	}
+	sink, err := logexport.NewSink(target)
+	if err != nil {
+		return err
+	}
+	exporter := logexport.NewExporter(sink, cfg.LogExportBufferSize)
+	go exporter.Run(ctx)
+	go logexport.NewFollower(api, selector, exporter, host).Run(ctx)
+	logrus.Infof("Exporting logs of containers matching %s to a %s sink", cfg.LogExportLabels, target.Kind)
+	return nil
+}
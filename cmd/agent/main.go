@@ -34,6 +34,9 @@ const (
 	agentIDFileHome = ".flotilla/agent-id"
 )
 
+// errAuthenticationFailed is returned by connectAndRun when the server rejected the API key.
+var errAuthenticationFailed = errors.New("authentication failed")
+
 type Agent struct {
 	ID               string
 	Name             string
@@ -43,8 +46,14 @@ type Agent struct {
 	StartTime        time.Time
 	Conn             *websocket.Conn
 	Handler          *commands.Handler
+	Endpoints        map[string]*dockerEndpoint // Additional Docker daemons keyed by name
 	MetricsCollector *metrics.Collector
-	writeMu          sync.Mutex // Protects concurrent writes to websocket
+	DaemonHealth     *docker.HealthMonitor
+	connectedAt      time.Time    // When the current or last connection was established
+	pingRTT          rttTracker   // Round trips of recent pings on the current connection
+	outbox           *outbox      // Metrics waiting for the server while disconnected
+	writeMu          sync.Mutex   // Protects concurrent writes to websocket
+	nameMu           sync.RWMutex // Protects Name, which the server may change at runtime
 }
 
 func main() {
@@ -85,26 +94,64 @@ func main() {
 	dockerWrapper := docker.NewClient(dockerClient)
 
 	// Create command handler
-	commandHandler := commands.NewHandler(dockerWrapper)
+	commandHandler := configureCommandHandler(cfg, commands.NewHandler(dockerWrapper))
+
+	// Additional Docker daemons are reported to the server as hosts of their own
+	endpoints, err := newDockerEndpoints(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up Docker endpoints: %v", err)
+	}
+	defer closeDockerEndpoints(endpoints)
+
+	// Sandbox deployments do not survive a restart; remove any left running
+	go func() {
+		cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cleanupCancel()
+		commandHandler.TeardownStaleSandboxes(cleanupCtx)
+		for _, endpoint := range endpoints {
+			endpoint.handler.TeardownStaleSandboxes(cleanupCtx)
+		}
+	}()
 
 	// Create metrics collector (use agentID as hostID for now, will be updated after connection)
 	metricsCollector := metrics.NewCollector(cfg, dockerWrapper, agentID, agentID)
+	commandHandler.SetMetricsReporter(metricsCollector)
+
+	// A name set from the server overrides the configured one
+	agentName := cfg.AgentName
+	if persisted := loadAgentNameFromFile(agentID); persisted != "" {
+		agentName = persisted
+	}
 
 	// Create agent instance
 	agent := &Agent{
 		ID:               agentID,
-		Name:             cfg.AgentName,
+		Name:             agentName,
 		Hostname:         hostname,
 		Docker:           dockerClient,
 		Config:           cfg,
 		StartTime:        time.Now(),
 		Handler:          commandHandler,
+		Endpoints:        endpoints,
 		MetricsCollector: metricsCollector,
+		DaemonHealth:     docker.NewHealthMonitor(dockerWrapper),
+		outbox:           newOutbox(cfg.OutboundBufferSize),
 	}
 
 	// Set up WebSocket client wrapper for command handler
 	wsWrapper := &WebSocketWrapper{agent: agent}
 	commandHandler.SetWebSocketClient(wsWrapper)
+	commandHandler.SetAgentNamer(agent)
+	for _, endpoint := range endpoints {
+		endpoint.handler.SetWebSocketClient(&WebSocketWrapper{agent: agent, endpoint: endpoint.name})
+	}
+
+	// Container logs are exported whether or not the server is reachable
+	exportCtx, stopExport := context.WithCancel(context.Background())
+	defer stopExport()
+	if err := startLogExport(exportCtx, cfg, dockerClient, agent.Name); err != nil {
+		log.Fatalf("Failed to set up log export: %v", err)
+	}
 
 	// Set up metrics sender wrapper
 	metricsSender := &MetricsSenderWrapper{agent: agent}
@@ -120,9 +167,12 @@ func main() {
 	// Main connection loop with exponential backoff
 	backoff := time.Second
 	maxBackoff := 30 * time.Second
+	failures := 0
+	disconnectedSince := time.Now()
 
 	for {
 		// Attempt to connect and run
+		attemptStart := time.Now()
 		if err := agent.connectAndRun(); err != nil {
 			// Check if this was a shutdown request
 			if err.Error() == "shutdown requested" {
@@ -130,7 +180,30 @@ func main() {
 				return
 			}
 
-			logrus.Errorf("Connection lost: %v", err)
+			authFailed := errors.Is(err, errAuthenticationFailed)
+			if authFailed {
+				logrus.Errorf("Server rejected the agent: %v; check API_KEY", err)
+				if cfg.ExitOnAuthFailure {
+					log.Fatalf("Giving up on connecting to the server: %v", err)
+				}
+			}
+
+			// A connection that was established and later lost starts a fresh retry sequence;
+			// one the server dropped for bad credentials still counts as a failed attempt
+			if agent.connectedAt.After(attemptStart) && !authFailed {
+				failures = 0
+				backoff = time.Second
+				disconnectedSince = time.Now()
+			} else {
+				failures++
+			}
+			if reason := cfg.ReconnectExhausted(failures, time.Since(disconnectedSince)); reason != nil {
+				log.Fatalf("Giving up on connecting to the server: %v (last error: %v)", reason, err)
+			}
+
+			if !authFailed {
+				logrus.Errorf("Connection lost: %v", err)
+			}
 			logrus.Infof("Retrying in %v...", backoff)
 
 			select {
@@ -173,14 +246,27 @@ func (a *Agent) connectAndRun() error {
 		dialer.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
 	}
 
+	// Offer the protocol version and capabilities; the server echoes the version it accepts
+	dialer.Subprotocols = protocol.AgentSubprotocols(a.agentCapabilities())
+
 	conn, _, err := dialer.Dial(wsURL.String(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
 	defer conn.Close()
 
+	// Deliver what was buffered while disconnected before anything new is written
+	a.writeMu.Lock()
 	a.Conn = conn
-	logrus.Info("Connected to server successfully")
+	a.flushOutbox(conn)
+	a.writeMu.Unlock()
+	a.connectedAt = time.Now()
+	a.pingRTT.Reset()
+	if selected := conn.Subprotocol(); selected != "" {
+		logrus.Infof("Connected to server successfully using protocol %s", selected)
+	} else {
+		logrus.Info("Connected to server successfully; server did not negotiate a protocol version")
+	}
 
 	// Update metrics collector with the correct host ID (same as agent ID in testing mode)
 	a.MetricsCollector.SetHostID(a.ID)
@@ -206,7 +292,11 @@ func (a *Agent) connectAndRun() error {
 
 	// Start message reading goroutine
 	messageCh := make(chan *protocol.Message, 100)
-	go a.readMessages(conn, messageCh)
+	var readErr error
+	go func() {
+		readErr = a.readMessages(conn, messageCh)
+		close(messageCh)
+	}()
 
 	// Start ping/pong goroutine to keep connection alive
 	go a.pingPongLoop(conn)
@@ -217,6 +307,9 @@ func (a *Agent) connectAndRun() error {
 		case msg, ok := <-messageCh:
 			if !ok {
 				// Channel closed, connection lost
+				if err := authenticationError(readErr); err != nil {
+					return err
+				}
 				logrus.Info("Message channel closed, connection lost")
 				return fmt.Errorf("connection lost")
 			}
@@ -226,7 +319,8 @@ func (a *Agent) connectAndRun() error {
 			}
 			logrus.Infof("Received message: type=%s, id=%s", msg.Type, msg.ID)
 			if msg.Type == protocol.MessageTypeCommand {
-				a.handleCommand(msg)
+				// Commands run concurrently; the handler queues them beyond its concurrency limit
+				go a.handleCommand(msg)
 			} else {
 				logrus.Debugf("Received message type: %s", msg.Type)
 			}
@@ -267,16 +361,22 @@ func loadOrGenerateAgentID(envAgentID string) string {
 	return agentID
 }
 
-// loadAgentIDFromFile loads agent ID from the persistence file
-func loadAgentIDFromFile() string {
+// agentIdentity is the content of the agent ID file. Name is a display name set from the
+// server and overrides AGENT_NAME while it belongs to the same agent ID.
+type agentIdentity struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"agent_name,omitempty"`
+}
+
+// loadAgentIdentityFromFile loads the agent identity from the persistence file
+func loadAgentIdentityFromFile() agentIdentity {
+	var identity agentIdentity
+
 	// Try system path first
 	// #nosec G304 -- fixed agent ID path under /var/lib
 	if data, err := os.ReadFile(agentIDFile); err == nil {
-		var idData struct {
-			AgentID string `json:"agent_id"`
-		}
-		if json.Unmarshal(data, &idData) == nil && idData.AgentID != "" {
-			return idData.AgentID
+		if json.Unmarshal(data, &identity) == nil && identity.AgentID != "" {
+			return identity
 		}
 	}
 
@@ -286,27 +386,38 @@ func loadAgentIDFromFile() string {
 		homePath := filepath.Join(homeDir, agentIDFileHome)
 		// #nosec G304 -- path within user home .flotilla directory
 		if data, err := os.ReadFile(homePath); err == nil {
-			var idData struct {
-				AgentID string `json:"agent_id"`
-			}
-			if json.Unmarshal(data, &idData) == nil && idData.AgentID != "" {
-				return idData.AgentID
+			identity = agentIdentity{}
+			if json.Unmarshal(data, &identity) == nil && identity.AgentID != "" {
+				return identity
 			}
 		}
 	}
 
-	return ""
+	return agentIdentity{}
+}
+
+// loadAgentIDFromFile loads agent ID from the persistence file
+func loadAgentIDFromFile() string {
+	return loadAgentIdentityFromFile().AgentID
+}
+
+// loadAgentNameFromFile returns the display name persisted for agentID, if any
+func loadAgentNameFromFile(agentID string) string {
+	identity := loadAgentIdentityFromFile()
+	if identity.AgentID != agentID {
+		return ""
+	}
+	return identity.Name
 }
 
 // saveAgentIDToFile saves agent ID to the persistence file
 func saveAgentIDToFile(agentID string) error {
-	idData := struct {
-		AgentID string `json:"agent_id"`
-	}{
-		AgentID: agentID,
-	}
+	return saveAgentIdentityToFile(agentIdentity{AgentID: agentID})
+}
 
-	data, err := json.Marshal(idData)
+// saveAgentIdentityToFile saves the agent identity to the persistence file
+func saveAgentIdentityToFile(identity agentIdentity) error {
+	data, err := json.Marshal(identity)
 	if err != nil {
 		return err
 	}
@@ -332,6 +443,33 @@ func saveAgentIDToFile(agentID string) error {
 	return os.WriteFile(homePath, data, 0o600)
 }
 
+// SetAgentName renames the agent at runtime. The name is persisted next to the agent ID so
+// it survives restarts, and is reported from the next heartbeat on. An agent running under an
+// AGENT_ID other than the persisted one leaves the file alone, so the persisted ID is never
+// replaced, and keeps the name only until it restarts.
+func (a *Agent) SetAgentName(name string) error {
+	if identity := loadAgentIdentityFromFile(); identity.AgentID == a.ID {
+		identity.Name = name
+		if err := saveAgentIdentityToFile(identity); err != nil {
+			return err
+		}
+	} else {
+		logrus.Warnf("Agent ID %s is not the persisted agent ID; the new name is kept until restart", a.ID)
+	}
+	a.nameMu.Lock()
+	a.Name = name
+	a.nameMu.Unlock()
+	logrus.Infof("Agent renamed to %s", name)
+	return nil
+}
+
+// agentName returns the agent's current display name
+func (a *Agent) agentName() string {
+	a.nameMu.RLock()
+	defer a.nameMu.RUnlock()
+	return a.Name
+}
+
 // setupLogging configures the logging system
 func setupLogging(level, format string) {
 	// Set log level
@@ -358,16 +496,25 @@ func setupLogging(level, format string) {
 	}
 }
 
-// monitorDockerEvents monitors Docker events and sends them to the server
+// monitorDockerEvents watches the Docker event stream and probes the daemon periodically;
+// together they feed the daemon health reported in heartbeats
 func (a *Agent) monitorDockerEvents(ctx context.Context) {
-	// This is a placeholder for Docker event monitoring
-	// In a full implementation, this would:
-	// 1. Subscribe to Docker events
-	// 2. Filter relevant events (container start/stop/die, etc.)
-	// 3. Send events to the server via WebSocket
 	logrus.Debug("Docker event monitoring started")
-	<-ctx.Done()
-	logrus.Debug("Docker event monitoring stopped")
+	go a.DaemonHealth.WatchEvents(ctx)
+
+	// Probe responsiveness off the main loop so a slow daemon cannot delay heartbeats
+	a.DaemonHealth.Probe(ctx)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Debug("Docker event monitoring stopped")
+			return
+		case <-ticker.C:
+			a.DaemonHealth.Probe(ctx)
+		}
+	}
 }
 
 // handleResponse handles responses from the server
@@ -398,18 +545,24 @@ func (a *Agent) handleCommand(command *protocol.Message) {
 
 	logrus.Debugf("Command action: %s, params: %+v", cmd.Action, cmd.Params)
 
-	// Use the command handler to process the command
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Responses name the endpoint so the server can attribute them to the endpoint's host
+	handler, err := a.commandHandler(cmd.Endpoint)
+	if err != nil {
+		response := protocol.NewResponse(command.ID, "error", nil, err)
+		protocol.SetResponseEndpoint(response, cmd.Endpoint)
+		a.sendResponse(response)
+		return
+	}
 
-	response, err := a.Handler.HandleCommand(ctx, command)
+	// The handler bounds each command by how long its action may take
+	response, err := handler.HandleCommand(context.Background(), command)
 	if err != nil {
 		logrus.Errorf("Failed to handle command: %v", err)
-		a.sendErrorResponse(command.ID, fmt.Sprintf("Failed to handle command: %v", err))
-		return
+		response = protocol.NewResponse(command.ID, "error", nil, fmt.Errorf("Failed to handle command: %v", err))
 	}
 
 	// Send the response back to the server
+	protocol.SetResponseEndpoint(response, cmd.Endpoint)
 	a.sendResponse(response)
 }
 
@@ -530,7 +683,7 @@ func (a *Agent) sendResponse(response *protocol.Message) {
 	a.writeMu.Lock()
 	defer a.writeMu.Unlock()
 
-	if err := a.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+	if err := a.Conn.SetWriteDeadline(time.Now().Add(a.Config.WriteDeadline())); err != nil {
 		logrus.WithError(err).Warn("Failed to set write deadline for response")
 		return
 	}
@@ -563,36 +716,49 @@ func (a *Agent) getUptime() int64 {
 	return int64(time.Since(a.StartTime).Seconds())
 }
 
+// authenticationError turns the error that ended the read loop into errAuthenticationFailed,
+// carrying the server's reason, when the server closed the connection over bad credentials.
+func authenticationError(readErr error) error {
+	var closeErr *websocket.CloseError
+	if !errors.As(readErr, &closeErr) || closeErr.Code != protocol.CloseAuthenticationFailed {
+		return nil
+	}
+	if closeErr.Text == "" {
+		return errAuthenticationFailed
+	}
+	return fmt.Errorf("%w: %s", errAuthenticationFailed, strings.TrimPrefix(closeErr.Text, "authentication failed: "))
+}
+
 // readMessages reads messages from the WebSocket connection
-func (a *Agent) readMessages(conn *websocket.Conn, messageCh chan<- *protocol.Message) {
-	defer close(messageCh)
+func (a *Agent) readMessages(conn *websocket.Conn, messageCh chan<- *protocol.Message) error {
 
 	// Set up pong handler
-	conn.SetPongHandler(func(string) error {
-		if err := conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+	conn.SetPongHandler(func(appData string) error {
+		a.pingRTT.ObservePong(appData, time.Now())
+		if err := conn.SetReadDeadline(time.Now().Add(a.Config.ReadDeadline())); err != nil {
 			logrus.WithError(err).Warn("Failed to extend read deadline after pong")
 		}
 		return nil
 	})
 
 	// Set initial read deadline
-	if err := conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+	if err := conn.SetReadDeadline(time.Now().Add(a.Config.ReadDeadline())); err != nil {
 		logrus.WithError(err).Warn("Failed to set initial read deadline")
 	}
 
 	for {
 		_, messageData, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, protocol.CloseAuthenticationFailed) {
 				logrus.Errorf("WebSocket read error: %v", err)
 			} else {
 				logrus.Info("WebSocket connection closed")
 			}
-			return
+			return err
 		}
 
 		// Update read deadline after successful read
-		if err := conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+		if err := conn.SetReadDeadline(time.Now().Add(a.Config.ReadDeadline())); err != nil {
 			logrus.WithError(err).Warn("Failed to extend read deadline after message")
 		}
 
@@ -613,53 +779,23 @@ func (a *Agent) readMessages(conn *websocket.Conn, messageCh chan<- *protocol.Me
 	}
 }
 
-// writeMessages handles writing messages to the WebSocket connection
-func (a *Agent) writeMessages(conn *websocket.Conn, writeCh <-chan []byte) {
-	ticker := time.NewTicker(54 * time.Second) // Ping period
-	defer ticker.Stop()
-
-	for {
-		select {
-		case message, ok := <-writeCh:
-			if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-				logrus.WithError(err).Warn("Failed to set write deadline for outgoing message")
-				return
-			}
-			if !ok {
-				if err := conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
-					logrus.WithError(err).Debug("Failed to send close message")
-				}
-				return
-			}
-
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				logrus.Errorf("Failed to write message: %v", err)
-				return
-			}
-
-		case <-ticker.C:
-			if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-				logrus.WithError(err).Warn("Failed to set write deadline for ping")
-				return
-			}
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				logrus.Errorf("Failed to send ping: %v", err)
-				return
-			}
-		}
-	}
-}
-
 // sendHeartbeat sends a heartbeat to the server
 func (a *Agent) sendHeartbeat(conn *websocket.Conn) {
 	heartbeat := protocol.NewHeartbeat(
 		a.ID,
-		a.Name,
+		a.agentName(),
 		a.Hostname,
 		"healthy",
 		a.getUptime(),
 		a.getContainerCount(),
 	)
+	if a.DaemonHealth != nil {
+		protocol.SetDockerHealth(heartbeat, a.DaemonHealth.Snapshot())
+	}
+	protocol.SetEndpoints(heartbeat, a.endpointStatuses())
+	if latency, ok := a.pingRTT.Average(); ok {
+		protocol.SetPingLatency(heartbeat, latency)
+	}
 
 	data, err := heartbeat.Serialize()
 	if err != nil {
@@ -671,7 +807,7 @@ func (a *Agent) sendHeartbeat(conn *websocket.Conn) {
 	a.writeMu.Lock()
 	defer a.writeMu.Unlock()
 
-	if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+	if err := conn.SetWriteDeadline(time.Now().Add(a.Config.WriteDeadline())); err != nil {
 		logrus.WithError(err).Warn("Failed to set write deadline for heartbeat")
 		return
 	}
@@ -680,17 +816,19 @@ func (a *Agent) sendHeartbeat(conn *websocket.Conn) {
 	}
 }
 
-// pingPongLoop handles ping/pong to keep the connection alive
+// pingPongLoop is the agent's only ping source. Pings go out every PingInterval, half the read
+// deadline that readMessages extends on each pong, so one delayed pong does not drop the link.
+// Each ping carries its send time so the pong yields the round trip reported in heartbeats.
 func (a *Agent) pingPongLoop(conn *websocket.Conn) {
-	ticker := time.NewTicker(30 * time.Second) // Send pings every 30 seconds
+	ticker := time.NewTicker(a.Config.PingInterval())
 	defer ticker.Stop()
 
 	for range ticker.C {
 		// Lock mutex to prevent concurrent writes to websocket
 		a.writeMu.Lock()
-		err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		err := conn.SetWriteDeadline(time.Now().Add(a.Config.WriteDeadline()))
 		if err == nil {
-			err = conn.WriteMessage(websocket.PingMessage, nil)
+			err = conn.WriteMessage(websocket.PingMessage, pingPayload(time.Now()))
 		}
 		a.writeMu.Unlock()
 
@@ -704,35 +842,55 @@ func (a *Agent) pingPongLoop(conn *websocket.Conn) {
 // WebSocketWrapper wraps the agent's WebSocket connection to implement the WebSocketClient interface
 type WebSocketWrapper struct {
 	agent *Agent
+	// endpoint names the additional Docker endpoint the events come from, if any
+	endpoint string
 }
 
-// SendLogEvent sends a log event via the agent's WebSocket connection
+// SendLogEvent sends a log event via the agent's WebSocket connection. Log chunks are not
+// buffered while disconnected: the server drops the stream when the agent goes away, and a
+// chatty container would otherwise push the buffered metrics out of the outbox.
 func (w *WebSocketWrapper) SendLogEvent(containerID, data, stream string, timestamp time.Time) error {
-	if w.agent.Conn == nil {
-		return fmt.Errorf("no WebSocket connection available")
-	}
-
-	event := protocol.NewEvent("log_data", map[string]interface{}{
+	fields := map[string]interface{}{
 		"container_id": containerID,
 		"data":         data,
-		"timestamp":    timestamp.Format(time.RFC3339),
+		"timestamp":    timestamp.UTC().Format(time.RFC3339Nano),
 		"stream":       stream,
-	})
+	}
+	if w.endpoint != "" {
+		fields["endpoint"] = w.endpoint
+	}
+	event := protocol.NewEvent("log_data", fields)
 
 	eventData, err := event.Serialize()
 	if err != nil {
 		return fmt.Errorf("failed to serialize log event: %v", err)
 	}
+	if err := w.agent.write(eventData); err != nil {
+		return fmt.Errorf("failed to send log event: %w", err)
+	}
+	return nil
+}
+
+// SendProgress reports the progress of a running command via the agent's WebSocket connection
+func (w *WebSocketWrapper) SendProgress(progress protocol.Progress) error {
+	if w.agent.Conn == nil {
+		return fmt.Errorf("no WebSocket connection available")
+	}
+
+	data, err := protocol.NewProgress(progress).Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize progress event: %v", err)
+	}
 
 	// Lock mutex to prevent concurrent writes to websocket
 	w.agent.writeMu.Lock()
 	defer w.agent.writeMu.Unlock()
 
-	if err := w.agent.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-		return fmt.Errorf("failed to set log event write deadline: %w", err)
+	if err := w.agent.Conn.SetWriteDeadline(time.Now().Add(w.agent.Config.WriteDeadline())); err != nil {
+		return fmt.Errorf("failed to set progress write deadline: %w", err)
 	}
-	if err := w.agent.Conn.WriteMessage(websocket.TextMessage, eventData); err != nil {
-		return fmt.Errorf("failed to send log event: %w", err)
+	if err := w.agent.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("failed to send progress event: %w", err)
 	}
 	return nil
 }
@@ -742,26 +900,73 @@ type MetricsSenderWrapper struct {
 	agent *Agent
 }
 
-// SendMetrics sends metrics via the agent's WebSocket connection
+// SendMetrics sends metrics via the agent's WebSocket connection, buffering them while the
+// agent is disconnected
 func (m *MetricsSenderWrapper) SendMetrics(message *protocol.Message) error {
-	if m.agent.Conn == nil {
-		return fmt.Errorf("no WebSocket connection available")
-	}
-
 	data, err := message.Serialize()
 	if err != nil {
 		return fmt.Errorf("failed to serialize metrics message: %v", err)
 	}
+	if err := m.agent.writeBuffered(data); err != nil {
+		return fmt.Errorf("failed to send metrics message: %w", err)
+	}
+	return nil
+}
+
+// write writes a message to the server over the current connection
+func (a *Agent) write(data []byte) error {
+	// Lock mutex to prevent concurrent writes to websocket
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	return a.writeTo(a.Conn, data)
+}
 
+// writeBuffered writes a metrics message to the server. When there is no usable connection
+// the message is kept in the outbox and delivered after reconnecting, and an error is
+// returned only when buffering is disabled.
+func (a *Agent) writeBuffered(data []byte) error {
 	// Lock mutex to prevent concurrent writes to websocket
-	m.agent.writeMu.Lock()
-	defer m.agent.writeMu.Unlock()
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
 
-	if err := m.agent.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-		return fmt.Errorf("failed to set metrics write deadline: %w", err)
+	err := a.writeTo(a.Conn, data)
+	if err != nil && a.outbox.Add(data) {
+		logrus.Debugf("Buffering outbound message until the server is reachable: %v", err)
+		return nil
 	}
-	if err := m.agent.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return fmt.Errorf("failed to send metrics message: %w", err)
+	return err
+}
+
+// writeTo writes a message to conn with the configured write deadline. The caller must hold
+// writeMu.
+func (a *Agent) writeTo(conn *websocket.Conn, data []byte) error {
+	if conn == nil {
+		return fmt.Errorf("no WebSocket connection available")
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(a.Config.WriteDeadline())); err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// flushOutbox delivers the messages buffered while the agent was disconnected, oldest first.
+// Messages that still cannot be written are kept for the next connection. The caller must
+// hold writeMu.
+func (a *Agent) flushOutbox(conn *websocket.Conn) {
+	messages, dropped := a.outbox.Drain()
+	if dropped > 0 {
+		logrus.Warnf("Dropped %d metrics messages while disconnected because the outbound buffer was full", dropped)
+	}
+	for i, data := range messages {
+		if err := a.writeTo(conn, data); err != nil {
+			logrus.WithError(err).Warnf("Failed to deliver buffered messages; keeping %d for the next connection", len(messages)-i)
+			for _, pending := range messages[i:] {
+				a.outbox.Add(pending)
+			}
+			return
+		}
+	}
+	if len(messages) > 0 {
+		logrus.Infof("Delivered %d metrics messages buffered while disconnected", len(messages))
 	}
-	return nil
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/websocket"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	"github.com/sirupsen/logrus"
 )
 
@@ -40,3 +44,34 @@ func TestSetupLoggingAppliesLevel(t *testing.T) {
 		t.Fatalf("expected debug level, got %s", logrus.GetLevel())
 	}
 }
+
+func TestAuthenticationError(t *testing.T) {
+	err := authenticationError(&websocket.CloseError{Code: protocol.CloseAuthenticationFailed, Text: "authentication failed: invalid or revoked API key"})
+	if !errors.Is(err, errAuthenticationFailed) || !strings.HasSuffix(err.Error(), ": invalid or revoked API key") {
+		t.Fatalf("expected authentication failure with reason, got %v", err)
+	}
+	if err := authenticationError(&websocket.CloseError{Code: websocket.CloseGoingAway}); err != nil {
+		t.Fatalf("expected other close codes to be ignored, got %v", err)
+	}
+	if err := authenticationError(errors.New("read timeout")); err != nil {
+		t.Fatalf("expected network errors to be ignored, got %v", err)
+	}
+}
+
+func TestCommandHandlerSelectsEndpoint(t *testing.T) {
+	agent := &Agent{Endpoints: map[string]*dockerEndpoint{"build": {name: "build"}}}
+	if handler, err := agent.commandHandler(""); err != nil || handler != agent.Handler {
+		t.Fatalf("expected the agent's own handler, got %v (err %v)", handler, err)
+	}
+	if _, err := agent.commandHandler("edge"); err == nil {
+		t.Fatal("expected an unknown endpoint to be rejected")
+	}
+
+	capabilities := agent.agentCapabilities()
+	if capabilities[len(capabilities)-1] != protocol.CapabilityMultiEndpoint {
+		t.Fatalf("expected the multi-endpoint capability to be advertised, got %v", capabilities)
+	}
+	if len(protocol.AgentCapabilities) == len(capabilities) {
+		t.Fatal("expected the shared capability list to be left alone")
+	}
+}
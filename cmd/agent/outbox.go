@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// outbox holds serialized metrics messages that could not be written while the agent was
+// disconnected, so they can be delivered once it reconnects. It keeps only the most recent
+// messages: when full, the oldest is dropped to make room.
+type outbox struct {
+	mu       sync.Mutex
+	limit    int
+	messages [][]byte
+	// dropped counts messages discarded since the outbox was last drained
+	dropped int
+}
+
+// newOutbox creates an outbox holding up to limit messages. A non-positive limit disables
+// buffering.
+func newOutbox(limit int) *outbox {
+	return &outbox{limit: limit}
+}
+
+// Add queues a message, dropping the oldest queued one when the outbox is full. It reports
+// whether the message was queued.
+func (o *outbox) Add(data []byte) bool {
+	if o == nil || o.limit <= 0 {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) >= o.limit {
+		o.messages = o.messages[1:]
+		o.dropped++
+	}
+	o.messages = append(o.messages, data)
+	return true
+}
+
+// Drain removes and returns the queued messages, oldest first, together with how many were
+// dropped since the last drain.
+func (o *outbox) Drain() ([][]byte, int) {
+	if o == nil {
+		return nil, 0
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages, dropped := o.messages, o.dropped
+	o.messages, o.dropped = nil, 0
+	return messages, dropped
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestOutboxDropsOldestWhenFull(t *testing.T) {
+	box := newOutbox(2)
+	for _, msg := range []string{"one", "two", "three"} {
+		if !box.Add([]byte(msg)) {
+			t.Fatalf("expected %s to be queued", msg)
+		}
+	}
+
+	messages, dropped := box.Drain()
+	if dropped != 1 || len(messages) != 2 || string(messages[0]) != "two" || string(messages[1]) != "three" {
+		t.Fatalf("expected the two newest messages and one drop, got %q (dropped=%d)", messages, dropped)
+	}
+	if messages, dropped := box.Drain(); len(messages) != 0 || dropped != 0 {
+		t.Fatalf("expected drain to empty the outbox, got %q (dropped=%d)", messages, dropped)
+	}
+
+	if newOutbox(0).Add([]byte("ignored")) {
+		t.Fatal("expected a zero-sized outbox to refuse messages")
+	}
+}
+
+func TestAgentLogStreamDoesNotEvictBufferedMetrics(t *testing.T) {
+	agent := &Agent{Config: &config.Config{}, outbox: newOutbox(2)}
+	metrics := &MetricsSenderWrapper{agent: agent}
+	if err := metrics.SendMetrics(protocol.NewEvent("metrics", map[string]any{"sample": 1})); err != nil {
+		t.Fatalf("expected the metrics to be buffered, got %v", err)
+	}
+
+	logs := &WebSocketWrapper{agent: agent}
+	for i := 0; i < 10; i++ {
+		if err := logs.SendLogEvent("web", "line", "stdout", time.Now()); err == nil {
+			t.Fatal("expected a log chunk to fail while disconnected")
+		}
+	}
+
+	messages, dropped := agent.outbox.Drain()
+	if dropped != 0 || len(messages) != 1 || !strings.Contains(string(messages[0]), `"metrics"`) {
+		t.Fatalf("expected only the metrics message to be buffered, got %q (dropped=%d)", messages, dropped)
+	}
+}
+
+func TestAgentBuffersWhileDisconnectedAndFlushesOnReconnect(t *testing.T) {
+	agent := &Agent{Config: &config.Config{}, outbox: newOutbox(10)}
+	if err := agent.writeBuffered([]byte("first")); err != nil {
+		t.Fatalf("expected the message to be buffered, got %v", err)
+	}
+	if err := agent.writeBuffered([]byte("second")); err != nil {
+		t.Fatalf("expected the message to be buffered, got %v", err)
+	}
+
+	received := make(chan string, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	agent.writeMu.Lock()
+	agent.Conn = conn
+	agent.flushOutbox(conn)
+	agent.writeMu.Unlock()
+	if err := agent.writeBuffered([]byte("third")); err != nil {
+		t.Fatalf("failed to write on the new connection: %v", err)
+	}
+
+	for _, want := range []string{"first", "second", "third"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	// Without buffering the write failure is reported to the caller
+	unbuffered := &Agent{Config: &config.Config{}, outbox: newOutbox(0)}
+	if err := unbuffered.writeBuffered([]byte("lost")); err == nil {
+		t.Fatal("expected an error when buffering is disabled")
+	}
+}
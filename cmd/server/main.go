@@ -18,6 +18,7 @@ import (
 	appLogs "github.com/mikeysoft/flotilla/internal/server/logs"
 	"github.com/mikeysoft/flotilla/internal/server/metrics"
 	"github.com/mikeysoft/flotilla/internal/server/middleware"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
 	"github.com/mikeysoft/flotilla/internal/server/topology"
 	"github.com/mikeysoft/flotilla/internal/server/websocket"
 	"github.com/sirupsen/logrus"
@@ -30,6 +31,10 @@ func main() {
 	// Setup logging
 	setupLogging(cfg.LogLevel, cfg.LogFormat)
 
+	if err := cfg.Validate(); err != nil {
+		logrus.Fatalf("Invalid configuration: %v", err)
+	}
+
 	logrus.Info("Starting Flotilla Management Server...")
 
 	// Connect to database
@@ -60,6 +65,17 @@ func main() {
 	hub := websocket.NewHub()
 	hub.SetMetricsClient(metricsClient)
 	hub.Mode = cfg.Mode
+	hub.SetAgentSendQueue(cfg.WSAgentSendQueueSize, cfg.WSAgentSendTimeout)
+	// Validate has already parsed the policy
+	allowedCommands, deniedCommands, _ := cfg.CommandPolicy()
+	hub.SetCommandPolicy(websocket.NewCommandPolicy(allowedCommands, deniedCommands))
+	hub.SetReadOnly(cfg.ReadOnly)
+	if cfg.ReadOnly {
+		logrus.Warn(middleware.ReadOnlyMessage)
+	}
+	if len(allowedCommands) > 0 || len(deniedCommands) > 0 {
+		logrus.Infof("Agent command policy active (allowed: %v, denied: %v)", allowedCommands, deniedCommands)
+	}
 
 	// Start WebSocket hub in background
 	ctx, cancel := context.WithCancel(context.Background())
@@ -67,7 +83,7 @@ func main() {
 	go hub.Run(ctx)
 
 	// Application log manager
-	logManager := appLogs.NewManager(1000)
+	logManager := appLogs.NewManager(cfg.LogBufferSize)
 
 	// Topology manager
 	topologyManager := topology.NewManager(hub, database.DB, cfg.TopologyRefreshInterval, cfg.TopologyStaleAfter, cfg.TopologyBatchSize)
@@ -78,11 +94,13 @@ func main() {
 		logrus.WithError(err).Warn("failed to prime dashboard summary")
 	}
 
-	dashboardScanner := dashboard.NewScanner(database.DB, hub, dashboardManager, topologyManager, metricsClient, nil)
+	stackHistory := stacks.NewHistory(database.DB, cfg.StackHistoryLimit)
+
+	dashboardScanner := dashboard.NewScanner(database.DB, hub, dashboardManager, topologyManager, metricsClient, stackHistory, nil)
 	dashboardScanner.Start(ctx)
 
 	// Setup Gin router
-	router := setupRouter(cfg, hub, logManager, topologyManager, dashboardManager)
+	router := setupRouter(cfg, hub, logManager, topologyManager, dashboardManager, stackHistory)
 
 	// Start server
 	serverAddr := cfg.GetServerAddress()
@@ -157,7 +175,7 @@ func errorOnlyLogger() gin.HandlerFunc {
 	}
 }
 
-func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Manager, topologyManager *topology.Manager, dashboardManager *dashboard.Manager) *gin.Engine {
+func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Manager, topologyManager *topology.Manager, dashboardManager *dashboard.Manager, stackHistory *stacks.History) *gin.Engine {
 	// Set Gin mode based on MODE
 	if strings.EqualFold(cfg.Mode, "DEV") {
 		gin.SetMode(gin.DebugMode)
@@ -181,14 +199,17 @@ func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Man
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "flotilla-server",
+			"status":    "healthy",
+			"service":   "flotilla-server",
+			"read_only": cfg.ReadOnly,
 		})
 	})
 
 	// Create API handlers
-	hostsHandler := api.NewHostsHandler(hub, logManager, topologyManager)
+	hostsHandler := api.NewHostsHandler(hub, logManager, topologyManager, stackHistory)
+	hostsHandler.SetMaxStackPayloadSize(cfg.MaxStackPayloadSize)
 	containersHandler := api.NewContainersHandler(hub, logManager, topologyManager)
+	containersHandler.SetPublishedURLScheme(cfg.PublishedURLScheme)
 	metricsHandler := api.NewMetricsHandler(hub)
 	apiKeysHandler := api.NewAPIKeysHandler()
 	authHandler := api.NewAuthHandler()
@@ -206,6 +227,13 @@ func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Man
 		apiGroup.POST("/auth/refresh", middleware.RateLimitMiddleware(20, time.Minute), authHandler.Refresh)
 		apiGroup.POST("/auth/logout", authHandler.Logout)
 
+		// Refuses the routes that change hosts, stacks, tasks, API keys or users when the
+		// server is read-only; signing in and out keeps working
+		readOnlyGuard := middleware.ReadOnlyMiddleware(cfg.ReadOnly)
+
+		// CI deploy webhook (authenticated by a deploy-scoped API key)
+		apiGroup.POST("/webhooks/deploy", readOnlyGuard, middleware.RateLimitMiddleware(30, time.Minute), hostsHandler.DeployWebhook)
+
 		// Auth middleware
 		authRequired := func(c *gin.Context) {
 			header := c.GetHeader("Authorization")
@@ -224,6 +252,17 @@ func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Man
 			c.Next()
 		}
 
+		// Browsers cannot set headers on EventSource requests, so event streams also accept
+		// the access token as a token query parameter
+		streamAuthRequired := func(c *gin.Context) {
+			if c.GetHeader("Authorization") == "" {
+				if tok := c.Query("token"); tok != "" {
+					c.Request.Header.Set("Authorization", "Bearer "+tok)
+				}
+			}
+			authRequired(c)
+		}
+
 		adminRequired := func(c *gin.Context) {
 			roleValue, exists := c.Get("role")
 			if !exists {
@@ -240,60 +279,90 @@ func setupRouter(cfg *config.Config, hub *websocket.Hub, logManager *appLogs.Man
 		// Host routes
 		apiGroup.GET("/hosts", authRequired, hostsHandler.ListHosts)
 		apiGroup.GET("/hosts/:id", authRequired, hostsHandler.GetHost)
-		apiGroup.DELETE("/hosts/:id", authRequired, hostsHandler.DeleteHost)
+		apiGroup.DELETE("/hosts/:id", authRequired, readOnlyGuard, hostsHandler.DeleteHost)
 		apiGroup.GET("/hosts/:id/info", authRequired, hostsHandler.GetHostInfo)
+		apiGroup.GET("/hosts/:id/runtime", authRequired, hostsHandler.GetHostRuntime)
+		apiGroup.GET("/hosts/:id/agent/config", authRequired, hostsHandler.GetAgentConfig)
+		apiGroup.PUT("/hosts/:id/agent/name", authRequired, readOnlyGuard, adminRequired, hostsHandler.SetAgentName)
 		apiGroup.GET("/hosts/:id/containers", authRequired, hostsHandler.ListContainers)
+		apiGroup.GET("/hosts/:id/containers/unmanaged", authRequired, hostsHandler.ListUnmanagedContainers)
 		apiGroup.GET("/hosts/:id/stacks", authRequired, hostsHandler.ListStacks)
-		apiGroup.POST("/hosts/:id/stacks", authRequired, hostsHandler.DeployStack)
-		apiGroup.POST("/hosts/:id/stacks/import", authRequired, hostsHandler.ImportStack)
+		apiGroup.POST("/hosts/:id/stacks", authRequired, readOnlyGuard, hostsHandler.DeployStack)
+		apiGroup.GET("/hosts/:id/stacks/discover", authRequired, hostsHandler.DiscoverStacks)
+		apiGroup.POST("/hosts/:id/stacks/import", authRequired, readOnlyGuard, hostsHandler.ImportStack)
+		apiGroup.POST("/hosts/:id/stacks/cleanup", authRequired, readOnlyGuard, hostsHandler.CleanupStacks)
+		apiGroup.POST("/hosts/:id/stacks/batch", authRequired, readOnlyGuard, hostsHandler.BatchStackAction)
+		apiGroup.GET("/hosts/:id/sandboxes", authRequired, hostsHandler.ListSandboxes)
+		apiGroup.DELETE("/hosts/:id/sandboxes/:sandbox_name", authRequired, readOnlyGuard, hostsHandler.EndSandbox)
 		apiGroup.GET("/hosts/:id/stacks/:stack_name/containers", authRequired, hostsHandler.GetStackContainers)
-		apiGroup.POST("/hosts/:id/stacks/:stack_name/containers/:container_id/:action", authRequired, hostsHandler.StackContainerAction)
-		apiGroup.POST("/hosts/:id/stacks/:stack_name/:action", authRequired, hostsHandler.StackAction)
-		apiGroup.POST("/hosts/:id/containers", authRequired, hostsHandler.CreateContainer)
-		apiGroup.POST("/hosts/:id/containers/:container_id/:action", authRequired, hostsHandler.ContainerAction)
+		apiGroup.POST("/hosts/:id/stacks/:stack_name/containers/:container_id/:action", authRequired, readOnlyGuard, hostsHandler.StackContainerAction)
+		apiGroup.GET("/hosts/:id/stacks/:stack_name/usage", authRequired, hostsHandler.GetStackUsage)
+		apiGroup.GET("/hosts/:id/stacks/:stack_name/history", authRequired, hostsHandler.GetStackHistory)
+		apiGroup.GET("/hosts/:id/stacks/:stack_name/diff", authRequired, hostsHandler.GetStackDiff)
+		apiGroup.GET("/hosts/:id/stacks/:stack_name/env/:key/reveal", authRequired, hostsHandler.RevealStackEnvVar)
+		apiGroup.POST("/hosts/:id/stacks/:stack_name/rollback", authRequired, readOnlyGuard, hostsHandler.RollbackStack)
+		apiGroup.POST("/hosts/:id/stacks/:stack_name/refresh", authRequired, hostsHandler.RefreshStack)
+		apiGroup.POST("/hosts/:id/stacks/:stack_name/:action", authRequired, readOnlyGuard, hostsHandler.StackAction)
+		apiGroup.POST("/hosts/:id/containers", authRequired, readOnlyGuard, hostsHandler.CreateContainer)
+		apiGroup.POST("/hosts/:id/containers/:container_id/refresh", authRequired, containersHandler.RefreshContainer)
+		apiGroup.POST("/hosts/:id/containers/:container_id/update", authRequired, readOnlyGuard, hostsHandler.RollingUpdateContainer)
+		apiGroup.POST("/hosts/:id/containers/:container_id/:action", authRequired, readOnlyGuard, hostsHandler.ContainerAction)
 
 		// Container routes
 		apiGroup.GET("/containers", authRequired, hostsHandler.ListAllContainers)
 		apiGroup.GET("/stacks", authRequired, hostsHandler.ListAllStacks)
+		apiGroup.POST("/containers/update-outdated", authRequired, readOnlyGuard, adminRequired, hostsHandler.UpdateOutdatedContainers)
+		apiGroup.POST("/images/pull", authRequired, readOnlyGuard, adminRequired, containersHandler.PullImagesFleet)
 		apiGroup.GET("/hosts/:id/containers/:container_id", authRequired, containersHandler.GetContainer)
 		apiGroup.GET("/hosts/:id/containers/:container_id/logs", authRequired, containersHandler.GetContainerLogs)
 		apiGroup.GET("/hosts/:id/containers/:container_id/stats", authRequired, containersHandler.GetContainerStats)
+		apiGroup.GET("/hosts/:id/containers/:container_id/logs/stream", streamAuthRequired, containersHandler.StreamContainerLogs)
+		apiGroup.GET("/hosts/:id/containers/:container_id/stats/stream", streamAuthRequired, containersHandler.StreamContainerStats)
+		apiGroup.GET("/hosts/:id/containers/:container_id/detail", authRequired, containersHandler.GetContainerDetail)
 		apiGroup.GET("/hosts/:id/images", authRequired, containersHandler.ListImages)
-		apiGroup.POST("/hosts/:id/images/remove", authRequired, containersHandler.RemoveImages)
-		apiGroup.POST("/hosts/:id/images/prune", authRequired, containersHandler.PruneDanglingImages)
+		apiGroup.POST("/hosts/:id/images/remove", authRequired, readOnlyGuard, containersHandler.RemoveImages)
+		apiGroup.POST("/hosts/:id/images/prune", authRequired, readOnlyGuard, containersHandler.PruneDanglingImages)
+		apiGroup.POST("/hosts/:id/images/pull", authRequired, readOnlyGuard, containersHandler.PullImages)
+		apiGroup.POST("/hosts/:id/images/pull/stream", authRequired, readOnlyGuard, containersHandler.PullImagesStream)
+		apiGroup.POST("/hosts/:id/images/:image_id/refresh", authRequired, containersHandler.RefreshImage)
 		apiGroup.GET("/hosts/:id/networks", authRequired, containersHandler.ListNetworks)
 		apiGroup.GET("/hosts/:id/networks/:network_id", authRequired, containersHandler.InspectNetwork)
-		apiGroup.DELETE("/hosts/:id/networks/:network_id", authRequired, containersHandler.RemoveNetwork)
+		apiGroup.GET("/hosts/:id/networks/:network_id/containers", authRequired, containersHandler.ListNetworkContainers)
+		apiGroup.DELETE("/hosts/:id/networks/:network_id", authRequired, readOnlyGuard, containersHandler.RemoveNetwork)
 		apiGroup.POST("/hosts/:id/networks/refresh", authRequired, containersHandler.RefreshNetworks)
 		apiGroup.GET("/hosts/:id/volumes", authRequired, containersHandler.ListVolumes)
 		apiGroup.GET("/hosts/:id/volumes/:volume_name", authRequired, containersHandler.InspectVolume)
-		apiGroup.DELETE("/hosts/:id/volumes/:volume_name", authRequired, containersHandler.RemoveVolume)
+		apiGroup.GET("/hosts/:id/volumes/:volume_name/containers", authRequired, containersHandler.ListVolumeContainers)
+		apiGroup.DELETE("/hosts/:id/volumes/:volume_name", authRequired, readOnlyGuard, containersHandler.RemoveVolume)
 		apiGroup.POST("/hosts/:id/volumes/refresh", authRequired, containersHandler.RefreshVolumes)
 		apiGroup.GET("/logs", authRequired, logsHandler.ListLogs)
 
 		// Dashboard routes
 		apiGroup.GET("/dashboard/summary", authRequired, dashboardHandler.GetSummary)
 		apiGroup.GET("/dashboard/tasks", authRequired, dashboardHandler.ListTasks)
-		apiGroup.POST("/dashboard/tasks", authRequired, dashboardHandler.CreateTask)
-		apiGroup.PATCH("/dashboard/tasks/:id", authRequired, dashboardHandler.UpdateTask)
-		apiGroup.POST("/dashboard/tasks/:id/status", authRequired, dashboardHandler.UpdateTaskStatus)
+		apiGroup.POST("/dashboard/tasks", authRequired, readOnlyGuard, dashboardHandler.CreateTask)
+		apiGroup.PATCH("/dashboard/tasks/:id", authRequired, readOnlyGuard, dashboardHandler.UpdateTask)
+		apiGroup.POST("/dashboard/tasks/:id/status", authRequired, readOnlyGuard, dashboardHandler.UpdateTaskStatus)
 
 		// Metrics routes
+		apiGroup.GET("/metrics/fleet", authRequired, metricsHandler.GetFleetMetrics)
+		apiGroup.GET("/metrics/send-queues", authRequired, metricsHandler.GetSendQueues)
 		apiGroup.GET("/hosts/:id/metrics", authRequired, metricsHandler.GetHostMetrics)
+		apiGroup.GET("/hosts/:id/metrics/live", authRequired, hostsHandler.GetLiveMetrics)
 		apiGroup.GET("/hosts/:id/containers/:container_id/metrics", authRequired, metricsHandler.GetContainerMetrics)
 
 		// API Key routes
-		apiGroup.POST("/api-keys", authRequired, adminRequired, apiKeysHandler.CreateAPIKey)
+		apiGroup.POST("/api-keys", authRequired, readOnlyGuard, adminRequired, apiKeysHandler.CreateAPIKey)
 		apiGroup.GET("/api-keys", authRequired, adminRequired, apiKeysHandler.ListAPIKeys)
-		apiGroup.DELETE("/api-keys/:id", authRequired, adminRequired, apiKeysHandler.RevokeAPIKey)
-		apiGroup.DELETE("/api-keys/:id/permanent", authRequired, adminRequired, apiKeysHandler.DeleteAPIKeyPermanently)
+		apiGroup.DELETE("/api-keys/:id", authRequired, readOnlyGuard, adminRequired, apiKeysHandler.RevokeAPIKey)
+		apiGroup.DELETE("/api-keys/:id/permanent", authRequired, readOnlyGuard, adminRequired, apiKeysHandler.DeleteAPIKeyPermanently)
 
 		// Users (admin-only; minimal check)
 		apiGroup.GET("/users", authRequired, adminRequired, usersHandler.List)
-		apiGroup.POST("/users", authRequired, adminRequired, usersHandler.Create)
-		apiGroup.PUT("/users/:id", authRequired, adminRequired, usersHandler.Update)
-		apiGroup.POST("/users/:id/reset-password", authRequired, adminRequired, usersHandler.ResetPassword)
-		apiGroup.DELETE("/users/:id/permanent", authRequired, adminRequired, usersHandler.DeleteUserPermanently)
+		apiGroup.POST("/users", authRequired, readOnlyGuard, adminRequired, usersHandler.Create)
+		apiGroup.PUT("/users/:id", authRequired, readOnlyGuard, adminRequired, usersHandler.Update)
+		apiGroup.POST("/users/:id/reset-password", authRequired, readOnlyGuard, adminRequired, usersHandler.ResetPassword)
+		apiGroup.DELETE("/users/:id/permanent", authRequired, readOnlyGuard, adminRequired, usersHandler.DeleteUserPermanently)
 	}
 
 	// WebSocket routes
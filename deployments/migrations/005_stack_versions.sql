@@ -0,0 +1,14 @@
+-- Stack version snapshots used to roll back stack updates
+
+CREATE TABLE IF NOT EXISTS stack_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    host_id UUID NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    stack_name VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    compose_content TEXT NOT NULL,
+    env_vars JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stack_versions_host_stack ON stack_versions(host_id, stack_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stack_versions_host_stack_version ON stack_versions(host_id, stack_name, version);
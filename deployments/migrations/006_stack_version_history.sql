@@ -0,0 +1,10 @@
+-- Track who changed a stack, how, and which compose revision was deployed
+
+ALTER TABLE stack_versions ADD COLUMN IF NOT EXISTS action VARCHAR(32) NOT NULL DEFAULT 'deploy';
+ALTER TABLE stack_versions ADD COLUMN IF NOT EXISTS compose_hash VARCHAR(64);
+ALTER TABLE stack_versions ADD COLUMN IF NOT EXISTS restored_from INTEGER;
+ALTER TABLE stack_versions ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN stack_versions.action IS 'Operation that produced this version: deploy, update, rollback or snapshot';
+COMMENT ON COLUMN stack_versions.compose_hash IS 'SHA-256 of the compose file content';
+COMMENT ON COLUMN stack_versions.restored_from IS 'Version restored by a rollback';
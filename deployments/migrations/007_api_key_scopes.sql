@@ -0,0 +1,5 @@
+-- Scope API keys so deploy webhook keys cannot be used to register agents (and vice versa)
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scope VARCHAR(32) NOT NULL DEFAULT 'agent';
+
+COMMENT ON COLUMN api_keys.scope IS 'Permission scope of the key: agent or deploy';
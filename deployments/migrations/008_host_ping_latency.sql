@@ -0,0 +1,5 @@
+-- Record the agent's WebSocket ping round trip reported in its heartbeats
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS ping_latency_ms DOUBLE PRECISION;
+
+COMMENT ON COLUMN hosts.ping_latency_ms IS 'Average WebSocket ping round trip of the host agent in milliseconds, from its last heartbeat';
@@ -0,0 +1,717 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+)
+
+// gpuCapability is the device capability Docker uses to select GPU drivers.
+const gpuCapability = "gpu"
+
+// dnsLabelPattern matches a single RFC 1123 DNS label.
+var dnsLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// linuxCapabilities is the set of capability names accepted by cap_add and cap_drop.
+var linuxCapabilities = map[string]struct{}{
+	"ALL": {}, "AUDIT_CONTROL": {}, "AUDIT_READ": {}, "AUDIT_WRITE": {}, "BLOCK_SUSPEND": {},
+	"BPF": {}, "CHECKPOINT_RESTORE": {}, "CHOWN": {}, "DAC_OVERRIDE": {}, "DAC_READ_SEARCH": {},
+	"FOWNER": {}, "FSETID": {}, "IPC_LOCK": {}, "IPC_OWNER": {}, "KILL": {}, "LEASE": {},
+	"LINUX_IMMUTABLE": {}, "MAC_ADMIN": {}, "MAC_OVERRIDE": {}, "MKNOD": {}, "NET_ADMIN": {},
+	"NET_BIND_SERVICE": {}, "NET_BROADCAST": {}, "NET_RAW": {}, "PERFMON": {}, "SETFCAP": {},
+	"SETGID": {}, "SETPCAP": {}, "SETUID": {}, "SYSLOG": {}, "SYS_ADMIN": {}, "SYS_BOOT": {},
+	"SYS_CHROOT": {}, "SYS_MODULE": {}, "SYS_NICE": {}, "SYS_PACCT": {}, "SYS_PTRACE": {},
+	"SYS_RAWIO": {}, "SYS_RESOURCE": {}, "SYS_TIME": {}, "SYS_TTY_CONFIG": {}, "WAKE_ALARM": {},
+}
+
+// parseCapabilities validates a cap_add or cap_drop list and returns the normalised names.
+// Names are accepted with or without the CAP_ prefix and in any case.
+func parseCapabilities(value any, key string) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	names, err := normalizeStringList(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an array of strings", key)
+	}
+	caps := make([]string, 0, len(names))
+	for _, name := range names {
+		normalized := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CAP_")
+		if _, ok := linuxCapabilities[normalized]; !ok {
+			return nil, fmt.Errorf("unknown capability %q in %s", name, key)
+		}
+		caps = append(caps, normalized)
+	}
+	return caps, nil
+}
+
+// parseCommandLine converts the create_container command or entrypoint parameter into an
+// argument list. A string is split like a POSIX shell would, honouring single and double
+// quotes and backslash escapes but without expansions; an array of strings is the exec form
+// and is used as is, so an empty array clears an image's entrypoint. Absent or blank values
+// leave the image default in place.
+func parseCommandLine(value any, key string) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		args, err := splitShellWords(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if len(args) == 0 {
+			return nil, nil
+		}
+		return args, nil
+	case []interface{}:
+		args := make([]string, 0, len(v))
+		for _, item := range v {
+			arg, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string or an array of strings", key)
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("%s must be a string or an array of strings", key)
+	}
+}
+
+// splitShellWords splits a command line into words. Single quotes preserve everything up to
+// the closing quote; within double quotes a backslash only escapes ", \, $ and `.
+func splitShellWords(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\\\"$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseDeviceMappings converts the create_container devices parameter into Docker device
+// mappings. Each entry uses the docker CLI form host_path[:container_path[:permissions]], where
+// the host path must be under /dev and permissions is a combination of r, w and m.
+func parseDeviceMappings(value any) ([]container.DeviceMapping, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, err := normalizeStringList(value)
+	if err != nil {
+		return nil, fmt.Errorf("devices must be an array of strings")
+	}
+
+	mappings := make([]container.DeviceMapping, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid device mapping %q", entry)
+		}
+		mapping := container.DeviceMapping{
+			PathOnHost:        parts[0],
+			PathInContainer:   parts[0],
+			CgroupPermissions: "rwm",
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			mapping.PathInContainer = parts[1]
+		}
+		if len(parts) > 2 {
+			mapping.CgroupPermissions = parts[2]
+		}
+
+		if mapping.PathOnHost != path.Clean(mapping.PathOnHost) || !strings.HasPrefix(mapping.PathOnHost, "/dev/") {
+			return nil, fmt.Errorf("invalid device %q: host path must be a device under /dev", entry)
+		}
+		if !path.IsAbs(mapping.PathInContainer) || mapping.PathInContainer != path.Clean(mapping.PathInContainer) {
+			return nil, fmt.Errorf("invalid device %q: container path must be absolute", entry)
+		}
+		if !validCgroupPermissions(mapping.CgroupPermissions) {
+			return nil, fmt.Errorf("invalid device %q: permissions must combine r, w and m", entry)
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+func validCgroupPermissions(perms string) bool {
+	if perms == "" || len(perms) > 3 {
+		return false
+	}
+	seen := map[rune]bool{}
+	for _, p := range perms {
+		if !strings.ContainsRune("rwm", p) || seen[p] {
+			return false
+		}
+		seen[p] = true
+	}
+	return true
+}
+
+// validDNSName reports whether name is a valid RFC 1123 host name made of dot-separated labels.
+func validDNSName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !dnsLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNetworkingConfig builds the endpoint settings that attach a new container to the
+// network named by the create_container network parameter, with the DNS aliases it should be
+// reachable under. Aliases are only resolvable on user-defined networks.
+func parseNetworkingConfig(networkName string, aliasesValue any) (*network.NetworkingConfig, error) {
+	var aliases []string
+	if aliasesValue != nil {
+		names, err := normalizeStringList(aliasesValue)
+		if err != nil {
+			return nil, fmt.Errorf("aliases must be an array of strings")
+		}
+		for _, alias := range names {
+			alias = strings.TrimSpace(alias)
+			if !validDNSName(alias) {
+				return nil, fmt.Errorf("invalid network alias %q: must be a valid DNS name", alias)
+			}
+			aliases = append(aliases, alias)
+		}
+	}
+
+	networkName = strings.TrimSpace(networkName)
+	if networkName == "" {
+		if len(aliases) > 0 {
+			return nil, fmt.Errorf("aliases require a network parameter")
+		}
+		return nil, nil
+	}
+	switch networkName {
+	case "bridge", "host", "none", "default":
+		if len(aliases) > 0 {
+			return nil, fmt.Errorf("aliases are only supported on user-defined networks, not %q", networkName)
+		}
+	}
+
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: uniqueStrings(aliases)},
+		},
+	}, nil
+}
+
+// tmpfsFlags are the value-less mount options accepted for tmpfs mounts.
+var tmpfsFlags = map[string]struct{}{
+	"rw": {}, "ro": {}, "exec": {}, "noexec": {}, "suid": {}, "nosuid": {}, "dev": {}, "nodev": {},
+	"atime": {}, "noatime": {}, "diratime": {}, "nodiratime": {}, "relatime": {}, "norelatime": {},
+	"strictatime": {}, "nostrictatime": {}, "sync": {}, "async": {}, "dirsync": {},
+}
+
+var (
+	tmpfsSizePattern  = regexp.MustCompile(`^[0-9]+[kKmMgG%]?$`)
+	tmpfsModePattern  = regexp.MustCompile(`^[0-7]{3,4}$`)
+	tmpfsCountPattern = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+)
+
+// minShmSize is the smallest /dev/shm size accepted by shm_size.
+const minShmSize = 4 * 1024
+
+// sysctlKeyPattern matches dotted sysctl names such as net.ipv4.ip_forward. Later segments
+// may hold interface names, which allow upper case and dashes.
+var sysctlKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-zA-Z0-9_-]+)+$`)
+
+// ipcSysctls are the kernel.* sysctls namespaced by the IPC namespace.
+var ipcSysctls = map[string]struct{}{
+	"kernel.msgmax": {}, "kernel.msgmnb": {}, "kernel.msgmni": {}, "kernel.sem": {},
+	"kernel.shmall": {}, "kernel.shmmax": {}, "kernel.shmmni": {}, "kernel.shm_rmid_forced": {},
+}
+
+// ulimitNames is the set of resource names accepted by the ulimits parameter.
+var ulimitNames = map[string]struct{}{
+	"core": {}, "cpu": {}, "data": {}, "fsize": {}, "locks": {}, "memlock": {}, "msgqueue": {},
+	"nice": {}, "nofile": {}, "nproc": {}, "rss": {}, "rtprio": {}, "rttime": {},
+	"sigpending": {}, "stack": {},
+}
+
+// parseTmpfsMounts converts the create_container tmpfs parameter into the host config tmpfs
+// map. Each entry uses the docker CLI form container_path[:options], where options is a
+// comma-separated list of tmpfs mount options such as size=64m,mode=1777,noexec.
+func parseTmpfsMounts(value any) (map[string]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, err := normalizeStringList(value)
+	if err != nil {
+		return nil, fmt.Errorf("tmpfs must be an array of strings")
+	}
+
+	mounts := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		target, options, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if !path.IsAbs(target) || target != path.Clean(target) || target == "/" {
+			return nil, fmt.Errorf("invalid tmpfs mount %q: target must be an absolute path other than /", entry)
+		}
+		if _, dup := mounts[target]; dup {
+			return nil, fmt.Errorf("duplicate tmpfs mount target %q", target)
+		}
+		if options != "" {
+			for _, option := range strings.Split(options, ",") {
+				if err := validateTmpfsOption(option); err != nil {
+					return nil, fmt.Errorf("invalid tmpfs mount %q: %w", entry, err)
+				}
+			}
+		}
+		mounts[target] = options
+	}
+	return mounts, nil
+}
+
+func validateTmpfsOption(option string) error {
+	key, val, hasValue := strings.Cut(option, "=")
+	if !hasValue {
+		if _, ok := tmpfsFlags[key]; ok {
+			return nil
+		}
+		return fmt.Errorf("unknown option %q", option)
+	}
+	switch key {
+	case "size":
+		if !tmpfsSizePattern.MatchString(val) {
+			return fmt.Errorf("size must be a byte count with an optional k, m, g or %% suffix")
+		}
+	case "mode":
+		if !tmpfsModePattern.MatchString(val) {
+			return fmt.Errorf("mode must be an octal permission such as 1777")
+		}
+	case "uid", "gid":
+		if _, err := strconv.ParseUint(val, 10, 32); err != nil {
+			return fmt.Errorf("%s must be a numeric ID", key)
+		}
+	case "nr_inodes", "nr_blocks":
+		if !tmpfsCountPattern.MatchString(val) {
+			return fmt.Errorf("%s must be a count with an optional k, m or g suffix", key)
+		}
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// parseUlimits converts the create_container ulimits parameter into Docker ulimits. It is an
+// object keyed by resource name whose values are either a single limit used as both the
+// soft and hard limit, or an object with soft and hard fields. -1 means unlimited.
+func parseUlimits(value any) ([]*units.Ulimit, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ulimits must be an object keyed by resource name")
+	}
+
+	limits := make([]*units.Ulimit, 0, len(entries))
+	for name, raw := range entries {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := ulimitNames[name]; !ok {
+			return nil, fmt.Errorf("unknown ulimit %q", name)
+		}
+		limit := &units.Ulimit{Name: name}
+		switch v := raw.(type) {
+		case float64:
+			n, err := ulimitValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ulimit %s: %w", name, err)
+			}
+			limit.Soft, limit.Hard = n, n
+		case map[string]interface{}:
+			soft, softOK := v["soft"].(float64)
+			hard, hardOK := v["hard"].(float64)
+			if !softOK || !hardOK {
+				return nil, fmt.Errorf("invalid ulimit %s: soft and hard must both be numbers", name)
+			}
+			var err error
+			if limit.Soft, err = ulimitValue(soft); err != nil {
+				return nil, fmt.Errorf("invalid ulimit %s: %w", name, err)
+			}
+			if limit.Hard, err = ulimitValue(hard); err != nil {
+				return nil, fmt.Errorf("invalid ulimit %s: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid ulimit %s: must be a number or an object with soft and hard", name)
+		}
+		if limit.Hard != -1 && (limit.Soft == -1 || limit.Soft > limit.Hard) {
+			return nil, fmt.Errorf("invalid ulimit %s: soft limit %d exceeds hard limit %d", name, limit.Soft, limit.Hard)
+		}
+		limits = append(limits, limit)
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Name < limits[j].Name })
+	return limits, nil
+}
+
+func ulimitValue(v float64) (int64, error) {
+	if v != float64(int64(v)) || v < -1 {
+		return 0, fmt.Errorf("limit %v must be a non-negative whole number or -1 for unlimited", v)
+	}
+	return int64(v), nil
+}
+
+// parseShmSize converts the create_container shm_size parameter into a byte count for the
+// size of /dev/shm. It is either a number of bytes or a size string such as 256m or 1g. Zero
+// or absent leaves the Docker default of 64m.
+func parseShmSize(value any) (int64, error) {
+	var size int64
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v != float64(int64(v)) || v < 0 {
+			return 0, fmt.Errorf("shm_size must be a non-negative whole number of bytes")
+		}
+		size = int64(v)
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0, nil
+		}
+		parsed, err := units.RAMInBytes(strings.TrimSpace(v))
+		if err != nil || parsed < 0 {
+			return 0, fmt.Errorf("invalid shm_size %q: must be a size such as 256m or 1g", v)
+		}
+		size = parsed
+	default:
+		return 0, fmt.Errorf("shm_size must be a number of bytes or a size string")
+	}
+	if size > 0 && size < minShmSize {
+		return 0, fmt.Errorf("shm_size must be at least 4k")
+	}
+	return size, nil
+}
+
+// parseSysctls converts the create_container sysctls parameter into the host config sysctl
+// map. It is an object keyed by sysctl name with string or numeric values. Only sysctls that
+// are namespaced per container are accepted; Docker rejects the others at start.
+func parseSysctls(value any) (map[string]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sysctls must be an object keyed by sysctl name")
+	}
+
+	sysctls := make(map[string]string, len(entries))
+	for key, raw := range entries {
+		key = strings.TrimSpace(key)
+		if !sysctlKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid sysctl name %q", key)
+		}
+		if !namespacedSysctl(key) {
+			return nil, fmt.Errorf("sysctl %q is not namespaced and cannot be set per container", key)
+		}
+		var val string
+		switch v := raw.(type) {
+		case string:
+			val = strings.TrimSpace(v)
+		case float64:
+			val = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("invalid sysctl %s: value must be a string or a number", key)
+		}
+		if val == "" || strings.ContainsAny(val, "\r\n") {
+			return nil, fmt.Errorf("invalid sysctl %s: value must be a non-empty single line", key)
+		}
+		sysctls[key] = val
+	}
+	return sysctls, nil
+}
+
+// namespacedSysctl reports whether a sysctl belongs to the IPC or network namespace, following
+// the list Docker accepts for containers.
+func namespacedSysctl(key string) bool {
+	if _, ok := ipcSysctls[key]; ok {
+		return true
+	}
+	for _, prefix := range []string{"fs.mqueue.", "net."} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishExposedPorts binds each exposed port without a binding in bindings to the same port
+// number on the host, skipping ports whose host port an explicit binding already uses. It
+// returns the added bindings keyed by container port, or nil when none were added.
+func publishExposedPorts(exposed nat.PortSet, bindings nat.PortMap) map[string]string {
+	used := make(map[string]bool)
+	for port, portBindings := range bindings {
+		for _, binding := range portBindings {
+			used[binding.HostPort+"/"+port.Proto()] = true
+		}
+	}
+
+	var published map[string]string
+	for port := range exposed {
+		if _, ok := bindings[port]; ok || used[port.Port()+"/"+port.Proto()] {
+			continue
+		}
+		bindings[port] = []nat.PortBinding{{HostPort: port.Port()}}
+		if published == nil {
+			published = make(map[string]string)
+		}
+		published[string(port)] = port.Port()
+	}
+	return published
+}
+
+// parseRestartPolicy validates a restart policy of the form no, always, unless-stopped or
+// on-failure[:max-retries]. An empty policy means no.
+func parseRestartPolicy(value string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(strings.TrimSpace(value), ":")
+	switch name {
+	case "", "no":
+		name = "no"
+	case "always", "unless-stopped":
+	case "on-failure":
+		if hasRetries {
+			count, err := strconv.Atoi(retries)
+			if err != nil || count < 0 {
+				return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %q: max retries must be a non-negative integer", value)
+			}
+			return container.RestartPolicy{Name: name, MaximumRetryCount: count}, nil
+		}
+		return container.RestartPolicy{Name: name}, nil
+	default:
+		return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %q: must be one of no, always, unless-stopped, on-failure[:max-retries]", value)
+	}
+	if hasRetries {
+		return container.RestartPolicy{}, fmt.Errorf("invalid restart policy %q: max retries are only supported with on-failure", value)
+	}
+	return container.RestartPolicy{Name: name}, nil
+}
+
+// parseGPURequest converts the create_container gpus parameter into Docker device requests.
+// It accepts "all", a GPU count, a list of device IDs, or an object with count, device_ids,
+// capabilities and driver fields.
+func parseGPURequest(value any) ([]container.DeviceRequest, error) {
+	request := container.DeviceRequest{}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		count, err := parseGPUCount(v)
+		if err != nil {
+			return nil, err
+		}
+		request.Count = count
+	case float64:
+		count, err := parseGPUCount(v)
+		if err != nil {
+			return nil, err
+		}
+		request.Count = count
+	case []interface{}:
+		ids, err := normalizeStringList(v)
+		if err != nil {
+			return nil, fmt.Errorf("gpus device list must contain only strings")
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("gpus device list must not be empty")
+		}
+		request.DeviceIDs = ids
+	case map[string]interface{}:
+		if driver, ok := v["driver"].(string); ok {
+			request.Driver = driver
+		}
+		if rawIDs, ok := v["device_ids"]; ok {
+			ids, err := normalizeStringList(rawIDs)
+			if err != nil {
+				return nil, fmt.Errorf("gpus device_ids must be an array of strings")
+			}
+			request.DeviceIDs = ids
+		}
+		if rawCount, ok := v["count"]; ok {
+			if len(request.DeviceIDs) > 0 {
+				return nil, fmt.Errorf("gpus count and device_ids cannot be combined")
+			}
+			count, err := parseGPUCount(rawCount)
+			if err != nil {
+				return nil, err
+			}
+			request.Count = count
+		}
+		if request.Count == 0 && len(request.DeviceIDs) == 0 {
+			request.Count = -1
+		}
+		if rawCaps, ok := v["capabilities"]; ok {
+			caps, err := normalizeStringList(rawCaps)
+			if err != nil {
+				return nil, fmt.Errorf("gpus capabilities must be an array of strings")
+			}
+			request.Capabilities = [][]string{withGPUCapability(caps)}
+		}
+	default:
+		return nil, fmt.Errorf("gpus must be \"all\", a count, a list of device IDs or an object")
+	}
+
+	if len(request.Capabilities) == 0 {
+		request.Capabilities = [][]string{{gpuCapability}}
+	}
+	return []container.DeviceRequest{request}, nil
+}
+
+// parseGPUCount parses a GPU count, where "all" (or -1) requests every GPU on the host.
+func parseGPUCount(value any) (int, error) {
+	switch v := value.(type) {
+	case string:
+		if strings.EqualFold(strings.TrimSpace(v), "all") {
+			return -1, nil
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid gpus value %q: expected \"all\" or a count", v)
+		}
+		return parseGPUCount(float64(count))
+	case float64:
+		if v == -1 {
+			return -1, nil
+		}
+		if v < 1 || v != float64(int(v)) {
+			return 0, fmt.Errorf("invalid gpus count %v: must be a positive whole number", v)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("gpus count must be a number or \"all\"")
+	}
+}
+
+func withGPUCapability(caps []string) []string {
+	for _, c := range caps {
+		if c == gpuCapability {
+			return caps
+		}
+	}
+	return append([]string{gpuCapability}, caps...)
+}
+
+// explainGPUCreateError rewrites the daemon's device driver error into a hint about the
+// missing NVIDIA runtime.
+func explainGPUCreateError(err error) error {
+	if err == nil || !strings.Contains(err.Error(), "could not select device driver") {
+		return err
+	}
+	return fmt.Errorf("host cannot provide GPUs: the NVIDIA container runtime is not installed or configured (install nvidia-container-toolkit and restart Docker): %w", err)
+}
+
+// findNameConflict reports an existing container, running or not, that already uses name.
+func findNameConflict(containers []types.Container, name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, existing := range containers {
+		for _, existingName := range existing.Names {
+			if strings.TrimPrefix(existingName, "/") != name {
+				continue
+			}
+			id := existing.ID
+			if len(id) > 12 {
+				id = id[:12]
+			}
+			return fmt.Errorf("container name %q is already in use by container %s", name, id)
+		}
+	}
+	return nil
+}
+
+// findPortConflict reports the first requested host port that is already published by one of
+// the given containers, naming the container that holds it.
+func findPortConflict(containers []types.Container, bindings nat.PortMap) error {
+	for port, hostBindings := range bindings {
+		for _, binding := range hostBindings {
+			hostPort, err := strconv.ParseUint(binding.HostPort, 10, 16)
+			if err != nil || hostPort == 0 {
+				// Empty or ranged host ports are assigned by Docker and cannot conflict
+				continue
+			}
+			for _, existing := range containers {
+				for _, published := range existing.Ports {
+					if uint64(published.PublicPort) != hostPort || published.Type != port.Proto() {
+						continue
+					}
+					if !hostIPsOverlap(binding.HostIP, published.IP) {
+						continue
+					}
+					name := existing.ID
+					if len(existing.Names) > 0 {
+						name = strings.TrimPrefix(existing.Names[0], "/")
+					}
+					return fmt.Errorf("host port %d/%s is already published by container %s", hostPort, port.Proto(), name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hostIPsOverlap(a, b string) bool {
+	wildcard := func(ip string) bool { return ip == "" || ip == "0.0.0.0" || ip == "::" }
+	return wildcard(a) || wildcard(b) || a == b
+}
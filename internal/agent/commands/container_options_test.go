@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParseGPURequest(t *testing.T) {
+	requests, err := parseGPURequest("all")
+	if err != nil {
+		t.Fatalf("parseGPURequest(all) returned error: %v", err)
+	}
+	if len(requests) != 1 || requests[0].Count != -1 || requests[0].Capabilities[0][0] != "gpu" {
+		t.Fatalf("unexpected request for all: %#v", requests)
+	}
+
+	requests, err = parseGPURequest(float64(2))
+	if err != nil || requests[0].Count != 2 {
+		t.Fatalf("unexpected request for count: %#v err=%v", requests, err)
+	}
+
+	requests, err = parseGPURequest([]interface{}{"0", "GPU-abc"})
+	if err != nil || len(requests[0].DeviceIDs) != 2 || requests[0].Count != 0 {
+		t.Fatalf("unexpected request for device ids: %#v err=%v", requests, err)
+	}
+
+	requests, err = parseGPURequest(map[string]interface{}{
+		"count":        float64(1),
+		"capabilities": []interface{}{"compute", "utility"},
+	})
+	if err != nil {
+		t.Fatalf("parseGPURequest(object) returned error: %v", err)
+	}
+	if caps := requests[0].Capabilities[0]; len(caps) != 3 || caps[0] != "gpu" {
+		t.Fatalf("expected gpu capability to be included, got %#v", caps)
+	}
+
+	if requests, err := parseGPURequest(nil); err != nil || requests != nil {
+		t.Fatalf("expected no device requests when gpus is absent")
+	}
+}
+
+func TestParseGPURequestInvalid(t *testing.T) {
+	invalid := []any{
+		"some",
+		float64(0),
+		float64(1.5),
+		[]interface{}{},
+		map[string]interface{}{"count": float64(1), "device_ids": []interface{}{"0"}},
+		true,
+	}
+	for _, value := range invalid {
+		if _, err := parseGPURequest(value); err == nil {
+			t.Fatalf("expected error for gpus value %#v", value)
+		}
+	}
+}
+
+func TestExplainGPUCreateError(t *testing.T) {
+	err := explainGPUCreateError(errors.New(`could not select device driver "" with capabilities: [[gpu]]`))
+	if !strings.Contains(err.Error(), "NVIDIA container runtime") {
+		t.Fatalf("expected NVIDIA runtime hint, got %v", err)
+	}
+
+	other := errors.New("image not found")
+	if explainGPUCreateError(other) != other {
+		t.Fatalf("expected unrelated errors to be returned unchanged")
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	caps, err := parseCapabilities([]interface{}{"net_admin", "CAP_SYS_TIME"}, "cap_add")
+	if err != nil {
+		t.Fatalf("parseCapabilities returned error: %v", err)
+	}
+	if len(caps) != 2 || caps[0] != "NET_ADMIN" || caps[1] != "SYS_TIME" {
+		t.Fatalf("unexpected capabilities: %#v", caps)
+	}
+
+	if _, err := parseCapabilities([]interface{}{"NET_ADMIN", "MAKE_COFFEE"}, "cap_add"); err == nil {
+		t.Fatal("expected error for unknown capability")
+	}
+	if _, err := parseCapabilities("NET_ADMIN", "cap_drop"); err == nil {
+		t.Fatal("expected error for non-list capabilities")
+	}
+}
+
+func TestParseDeviceMappings(t *testing.T) {
+	devices, err := parseDeviceMappings([]interface{}{"/dev/ttyUSB0", "/dev/snd:/dev/audio:rw"})
+	if err != nil {
+		t.Fatalf("parseDeviceMappings returned error: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected two devices, got %d", len(devices))
+	}
+	if devices[0].PathInContainer != "/dev/ttyUSB0" || devices[0].CgroupPermissions != "rwm" {
+		t.Fatalf("unexpected default mapping: %#v", devices[0])
+	}
+	if devices[1].PathInContainer != "/dev/audio" || devices[1].CgroupPermissions != "rw" {
+		t.Fatalf("unexpected explicit mapping: %#v", devices[1])
+	}
+
+	invalid := []string{"/etc/passwd", "/dev/../etc/shadow", "/dev/sda:relative", "/dev/sda:/dev/sda:rx", "/dev/a:/b:r:extra"}
+	for _, entry := range invalid {
+		if _, err := parseDeviceMappings([]interface{}{entry}); err == nil {
+			t.Fatalf("expected error for device %q", entry)
+		}
+	}
+}
+
+func TestFindPortConflict(t *testing.T) {
+	running := []types.Container{{
+		ID:    "abc",
+		Names: []string{"/web"},
+		Ports: []types.Port{{IP: "0.0.0.0", PrivatePort: 80, PublicPort: 8080, Type: "tcp"}},
+	}}
+
+	err := findPortConflict(running, nat.PortMap{"80/tcp": {{HostPort: "8080"}}})
+	if err == nil || !strings.Contains(err.Error(), "web") {
+		t.Fatalf("expected conflict naming web, got %v", err)
+	}
+
+	free := nat.PortMap{
+		"80/tcp": {{HostPort: "8081"}},
+		"53/udp": {{HostPort: "8080"}},
+		"90/tcp": {{HostPort: ""}},
+	}
+	if err := findPortConflict(running, free); err != nil {
+		t.Fatalf("expected no conflict, got %v", err)
+	}
+
+	otherIP := []types.Container{{
+		ID:    "def",
+		Ports: []types.Port{{IP: "127.0.0.1", PublicPort: 9000, Type: "tcp"}},
+	}}
+	if err := findPortConflict(otherIP, nat.PortMap{"9000/tcp": {{HostIP: "10.0.0.5", HostPort: "9000"}}}); err != nil {
+		t.Fatalf("expected no conflict on distinct host IPs, got %v", err)
+	}
+}
+
+func TestFindNameConflict(t *testing.T) {
+	existing := []types.Container{{ID: "0123456789abcdef", Names: []string{"/web"}}}
+
+	err := findNameConflict(existing, "web")
+	if err == nil || !strings.Contains(err.Error(), "0123456789ab") {
+		t.Fatalf("expected conflict naming the short container ID, got %v", err)
+	}
+	if err := findNameConflict(existing, "api"); err != nil {
+		t.Fatalf("expected no conflict, got %v", err)
+	}
+	if err := findNameConflict(existing, ""); err != nil {
+		t.Fatalf("expected an unnamed container never to conflict, got %v", err)
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	valid := map[string]struct {
+		name    string
+		retries int
+	}{
+		"":               {"no", 0},
+		"no":             {"no", 0},
+		"always":         {"always", 0},
+		"unless-stopped": {"unless-stopped", 0},
+		"on-failure":     {"on-failure", 0},
+		"on-failure:5":   {"on-failure", 5},
+	}
+	for input, want := range valid {
+		policy, err := parseRestartPolicy(input)
+		if err != nil {
+			t.Fatalf("parseRestartPolicy(%q) returned error: %v", input, err)
+		}
+		if policy.Name != want.name || policy.MaximumRetryCount != want.retries {
+			t.Fatalf("parseRestartPolicy(%q) = %#v, want %v", input, policy, want)
+		}
+	}
+
+	for _, input := range []string{"sometimes", "always:3", "on-failure:-1", "on-failure:x"} {
+		if _, err := parseRestartPolicy(input); err == nil {
+			t.Fatalf("expected error for restart policy %q", input)
+		}
+	}
+}
+
+func TestValidDNSName(t *testing.T) {
+	for _, name := range []string{"db", "api-v2", "cache.internal", "a1"} {
+		if !validDNSName(name) {
+			t.Fatalf("expected %q to be valid", name)
+		}
+	}
+	for _, name := range []string{"", "-db", "db-", "under_score", "two..dots", strings.Repeat("a", 64)} {
+		if validDNSName(name) {
+			t.Fatalf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestParseNetworkingConfig(t *testing.T) {
+	cfg, err := parseNetworkingConfig("backend", []interface{}{"db", "postgres", "db"})
+	if err != nil {
+		t.Fatalf("parseNetworkingConfig returned error: %v", err)
+	}
+	endpoint, ok := cfg.EndpointsConfig["backend"]
+	if !ok || len(endpoint.Aliases) != 2 || endpoint.Aliases[0] != "db" || endpoint.Aliases[1] != "postgres" {
+		t.Fatalf("unexpected endpoint config: %#v", cfg.EndpointsConfig)
+	}
+
+	if cfg, err := parseNetworkingConfig("", nil); err != nil || cfg != nil {
+		t.Fatalf("expected no networking config without a network, got %#v err=%v", cfg, err)
+	}
+
+	for _, tc := range []struct {
+		network string
+		aliases any
+	}{
+		{"", []interface{}{"db"}},
+		{"bridge", []interface{}{"db"}},
+		{"backend", []interface{}{"bad_alias"}},
+		{"backend", "db"},
+	} {
+		if _, err := parseNetworkingConfig(tc.network, tc.aliases); err == nil {
+			t.Fatalf("expected error for network %q aliases %#v", tc.network, tc.aliases)
+		}
+	}
+}
+
+func TestParseTmpfsMounts(t *testing.T) {
+	mounts, err := parseTmpfsMounts([]interface{}{"/tmp", "/cache:size=10%,uid=1000,nr_inodes=4k,ro"})
+	if err != nil {
+		t.Fatalf("parseTmpfsMounts returned error: %v", err)
+	}
+	if len(mounts) != 2 || mounts["/tmp"] != "" || mounts["/cache"] != "size=10%,uid=1000,nr_inodes=4k,ro" {
+		t.Fatalf("unexpected mounts: %#v", mounts)
+	}
+
+	for _, value := range []any{
+		"/tmp",
+		[]interface{}{"tmp"},
+		[]interface{}{"/"},
+		[]interface{}{"/data/../etc"},
+		[]interface{}{"/tmp", "/tmp:size=1m"},
+		[]interface{}{"/tmp:size=big"},
+		[]interface{}{"/tmp:mode=999"},
+		[]interface{}{"/tmp:bind"},
+	} {
+		if _, err := parseTmpfsMounts(value); err == nil {
+			t.Fatalf("expected error for tmpfs %#v", value)
+		}
+	}
+}
+
+func TestParseUlimits(t *testing.T) {
+	limits, err := parseUlimits(map[string]interface{}{"NOFILE": float64(4096)})
+	if err != nil || len(limits) != 1 || limits[0].Name != "nofile" || limits[0].Soft != 4096 || limits[0].Hard != 4096 {
+		t.Fatalf("unexpected ulimits: %#v err=%v", limits, err)
+	}
+
+	for _, value := range []any{
+		[]interface{}{"nofile=1024"},
+		map[string]interface{}{"files": float64(1)},
+		map[string]interface{}{"nofile": "1024"},
+		map[string]interface{}{"nofile": float64(1.5)},
+		map[string]interface{}{"nofile": float64(-2)},
+		map[string]interface{}{"nofile": map[string]interface{}{"soft": float64(2048), "hard": float64(1024)}},
+		map[string]interface{}{"nofile": map[string]interface{}{"soft": float64(-1), "hard": float64(1024)}},
+		map[string]interface{}{"nofile": map[string]interface{}{"soft": float64(1024)}},
+	} {
+		if _, err := parseUlimits(value); err == nil {
+			t.Fatalf("expected error for ulimits %#v", value)
+		}
+	}
+}
+
+func TestParseShmSize(t *testing.T) {
+	cases := []struct {
+		value any
+		want  int64
+	}{
+		{nil, 0},
+		{"", 0},
+		{"64m", 64 * 1024 * 1024},
+		{"1G", 1024 * 1024 * 1024},
+		{float64(134217728), 134217728},
+	}
+	for _, tc := range cases {
+		got, err := parseShmSize(tc.value)
+		if err != nil || got != tc.want {
+			t.Fatalf("parseShmSize(%#v) = %d, %v; want %d", tc.value, got, err, tc.want)
+		}
+	}
+
+	for _, value := range []any{"lots", "-1m", "1k", float64(-1), float64(1.5), true} {
+		if _, err := parseShmSize(value); err == nil {
+			t.Fatalf("expected shm_size %#v to be rejected", value)
+		}
+	}
+}
+
+func TestParseSysctls(t *testing.T) {
+	sysctls, err := parseSysctls(map[string]interface{}{
+		"net.ipv4.ip_forward":              float64(1),
+		"net.ipv6.conf.eth-0.disable_ipv6": "1",
+		"fs.mqueue.msg_max":                " 100 ",
+		"kernel.sem":                       "250 32000 100 128",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sysctls["net.ipv4.ip_forward"] != "1" || sysctls["net.ipv6.conf.eth-0.disable_ipv6"] != "1" ||
+		sysctls["fs.mqueue.msg_max"] != "100" || sysctls["kernel.sem"] != "250 32000 100 128" {
+		t.Fatalf("unexpected sysctls: %#v", sysctls)
+	}
+
+	for _, value := range []any{
+		[]interface{}{"net.ipv4.ip_forward=1"},
+		map[string]interface{}{"ip_forward": "1"},
+		map[string]interface{}{"net..ip_forward": "1"},
+		map[string]interface{}{"net.ipv4.ip forward": "1"},
+		map[string]interface{}{"kernel.hostname": "box"},
+		map[string]interface{}{"vm.max_map_count": float64(262144)},
+		map[string]interface{}{"net.ipv4.ip_forward": ""},
+		map[string]interface{}{"net.ipv4.ip_forward": "1\nkernel.panic=1"},
+		map[string]interface{}{"net.ipv4.ip_forward": true},
+	} {
+		if _, err := parseSysctls(value); err == nil {
+			t.Fatalf("expected error for sysctls %#v", value)
+		}
+	}
+}
+
+func TestPublishExposedPorts(t *testing.T) {
+	bindings := nat.PortMap{
+		"80/tcp": []nat.PortBinding{{HostPort: "8080"}},
+	}
+	exposed := nat.PortSet{"80/tcp": {}, "443/tcp": {}, "53/udp": {}, "8080/tcp": {}}
+
+	published := publishExposedPorts(exposed, bindings)
+	if len(published) != 2 || published["443/tcp"] != "443" || published["53/udp"] != "53" {
+		t.Fatalf("unexpected published ports: %#v", published)
+	}
+	if bindings["80/tcp"][0].HostPort != "8080" {
+		t.Fatalf("explicit binding was replaced: %#v", bindings["80/tcp"])
+	}
+	if _, ok := bindings["8080/tcp"]; ok {
+		t.Fatal("expected exposed port clashing with an explicit host port to be skipped")
+	}
+	if bindings["443/tcp"][0].HostPort != "443" || bindings["53/udp"][0].HostPort != "53" {
+		t.Fatalf("unexpected bindings: %#v", bindings)
+	}
+
+	if published := publishExposedPorts(nil, nat.PortMap{}); published != nil {
+		t.Fatalf("expected nothing published without exposed ports, got %#v", published)
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	cases := []struct {
+		value any
+		want  []string
+	}{
+		{nil, nil},
+		{"   ", nil},
+		{"nginx -g 'daemon off;'", []string{"nginx", "-g", "daemon off;"}},
+		{`echo "a \"quoted\" word" plain\ space`, []string{"echo", `a "quoted" word`, "plain space"}},
+		{`printf "%s\n" ''`, []string{"printf", `%s\n`, ""}},
+		{[]interface{}{"sh", "-c", "echo $HOME", ""}, []string{"sh", "-c", "echo $HOME", ""}},
+		{[]interface{}{}, []string{}},
+	}
+	for _, tc := range cases {
+		got, err := parseCommandLine(tc.value, "command")
+		if err != nil {
+			t.Fatalf("parseCommandLine(%#v) returned error: %v", tc.value, err)
+		}
+		if (got == nil) != (tc.want == nil) || strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+			t.Fatalf("parseCommandLine(%#v) = %#v, want %#v", tc.value, got, tc.want)
+		}
+	}
+
+	for _, value := range []any{`echo "open`, "echo 'open", `trailing\`, 42, []interface{}{"ok", 1}} {
+		if _, err := parseCommandLine(value, "command"); err == nil {
+			t.Fatalf("expected %#v to be rejected", value)
+		}
+	}
+}
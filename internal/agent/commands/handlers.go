@@ -5,18 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
+	"github.com/mikeysoft/flotilla/internal/agent/config"
 	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/mikeysoft/flotilla/internal/agent/metrics"
 	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	"github.com/sirupsen/logrus"
 )
@@ -26,10 +31,52 @@ type Handler struct {
 	dockerClient  *docker.Client
 	composeClient *docker.ComposeClient
 	wsClient      WebSocketClient
+	namer         AgentNamer
+	metrics       MetricsReporter
+	stopTimeout   int // seconds, used when a command does not pass its own timeout
+
+	// commandSlots bounds how many commands run against the Docker daemon at once
+	commandSlots chan struct{}
+	// maxQueued bounds how many commands may wait for a slot; queued counts those waiting
+	maxQueued int32
+	queued    atomic.Int32
+
+	// sandboxes tracks sandbox stack deployments until they are torn down
+	sandboxes *sandboxTracker
+	// streams tracks open log streams and caps how many may run at once
+	streams *streamRegistry
+
+	// agentConfig is reported by get_agent_config; nil when the handler runs without one
+	agentConfig *config.Config
+
+	// imagePlatforms caches inspected image platforms by image ID; image IDs are content addressed
+	imagePlatforms sync.Map
+	// lastStats keeps each container's most recent stats sample by container ID, reported
+	// once the container has stopped. Entries are dropped when the container is removed or
+	// a full container list no longer includes it.
+	lastStats sync.Map
+}
+
+// statsSample is a container stats sample and when it was taken.
+type statsSample struct {
+	stats *types.Stats
+	at    time.Time
+}
+
+// imagePlatform is the OS and architecture an image was built for.
+type imagePlatform struct {
+	OS           string
+	Architecture string
+	Variant      string
 }
 
 const (
 	maxConcurrentInspectJobs        = 4
+	maxConcurrentPullJobs           = 3
+	defaultStopTimeoutSeconds       = 30
+	defaultMaxConcurrentCommands    = 8
+	defaultMaxQueuedCommands        = 32
+	maxImagePlatformInspects        = 64
 	nameParameterRequiredMsg        = "name parameter required"
 	containerIDParameterRequiredMsg = "container_id parameter required"
 	imagesParameterArrayMsg         = "images parameter must be an array of strings"
@@ -40,6 +87,14 @@ var (
 	errContainerIDParameterRequired = errors.New(containerIDParameterRequiredMsg)
 )
 
+// composeActions are the stack commands that run compose or write stack files. They are
+// refused while compose is unavailable; stack listings keep working from container labels.
+var composeActions = map[string]bool{
+	"deploy_stack": true, "end_sandbox": true, "update_stack": true, "remove_stack": true,
+	"start_stack": true, "stop_stack": true, "restart_stack": true, "import_stack": true,
+	"import_stack_from_path": true, "relabel_stack": true, "cleanup_stacks": true,
+}
+
 // handleGetDockerInfo returns docker version and host capacity
 func (h *Handler) handleGetDockerInfo(ctx context.Context, commandID string) (*protocol.Message, error) {
 	info, err := h.dockerClient.GetSystemInfo(ctx)
@@ -55,39 +110,293 @@ func (h *Handler) handleGetDockerInfo(ctx context.Context, commandID string) (*p
 	}, nil), nil
 }
 
-// WebSocketClient interface for sending log events
+// handleGetRuntimeInfo reports the Docker endpoint and the daemon's runtime details, along
+// with the cgroup version and disk I/O source seen by the metrics collector
+func (h *Handler) handleGetRuntimeInfo(ctx context.Context, commandID string) (*protocol.Message, error) {
+	info, err := h.dockerClient.GetRuntimeInfo(ctx)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	data := map[string]any{
+		"runtime": info,
+	}
+	if h.metrics != nil {
+		data["metrics_io"] = h.metrics.IOStatus()
+	}
+	return protocol.NewResponse(commandID, "success", data, nil), nil
+}
+
+// handleGetLiveMetrics returns the collector's most recent metrics sample, so current usage
+// can be shown for hosts whose metrics are not stored by the server
+func (h *Handler) handleGetLiveMetrics(ctx context.Context, commandID string) (*protocol.Message, error) {
+	if h.metrics == nil {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("agent does not collect metrics")), nil
+	}
+	sample, err := h.metrics.LatestMetrics(ctx)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("failed to collect metrics: %w", err)), nil
+	}
+	return protocol.NewResponse(commandID, "success", map[string]any{"metrics": sample}, nil), nil
+}
+
+// handleGetAgentConfig reports the agent's effective configuration together with the runtime
+// facts it depends on, such as compose availability and the Docker endpoint in use
+func (h *Handler) handleGetAgentConfig(commandID string) (*protocol.Message, error) {
+	report := map[string]any{}
+	if h.agentConfig != nil {
+		report = h.agentConfig.Report()
+	}
+	report["effective_stop_timeout"] = h.stopTimeout
+	report["effective_max_concurrent_commands"] = cap(h.commandSlots)
+	report["effective_max_queued_commands"] = h.maxQueued
+	report["effective_max_concurrent_streams"] = h.streams.limit
+	report["active_streams"] = h.streams.count()
+
+	if api, ok := h.dockerClient.GetDockerClient().(interface{ DaemonHost() string }); ok {
+		report["docker_host"] = api.DaemonHost()
+	}
+
+	report["compose_available"] = true
+	if err := h.ComposeAvailable(); err != nil {
+		report["compose_available"] = false
+		report["compose_error"] = err.Error()
+	}
+
+	return protocol.NewResponse(commandID, "success", report, nil), nil
+}
+
+// ComposeAvailable returns nil when stack commands can run: the compose working directory was
+// set up and a compose CLI is installed.
+func (h *Handler) ComposeAvailable() error {
+	if err := h.composeClient.Available(); err != nil {
+		return err
+	}
+	return h.composeClient.CheckDockerCompose()
+}
+
+// handleSetAgentName changes the display name the agent reports in its heartbeats
+func (h *Handler) handleSetAgentName(commandID string, params map[string]any) (*protocol.Message, error) {
+	if h.namer == nil {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("agent does not support renaming")), nil
+	}
+	raw, _ := params["name"].(string)
+	name, err := protocol.NormalizeAgentName(raw)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	if err := h.namer.SetAgentName(name); err != nil {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("failed to rename agent: %w", err)), nil
+	}
+	return protocol.NewResponse(commandID, "success", map[string]any{"agent_name": name}, nil), nil
+}
+
+// WebSocketClient interface for sending log events and command progress
 type WebSocketClient interface {
 	SendLogEvent(containerID, data, stream string, timestamp time.Time) error
+	SendProgress(progress protocol.Progress) error
+}
+
+// progressFunc reports a step of a long running command
+type progressFunc func(stage, message string, current, total int)
+
+// progressReporter returns how a command reports its progress. Progress is only sent when
+// the server asked for it with stream_progress; otherwise reports are discarded. Each report
+// restarts the command's idle timeout.
+func (h *Handler) progressReporter(ctx context.Context, commandID string, params map[string]any) progressFunc {
+	if !h.streamsProgress(params) {
+		return func(string, string, int, int) {}
+	}
+	return func(stage, message string, current, total int) {
+		markProgress(ctx)
+		err := h.wsClient.SendProgress(protocol.Progress{
+			CommandID: commandID,
+			Stage:     stage,
+			Message:   message,
+			Current:   current,
+			Total:     total,
+		})
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to send progress for command %s", commandID)
+		}
+	}
+}
+
+func (h *Handler) streamsProgress(params map[string]any) bool {
+	return h.wsClient != nil && boolParam(params, protocol.ParamStreamProgress, false)
+}
+
+// composeProgressContext streams the compose output of a command as progress when the
+// server asked for it.
+func (h *Handler) composeProgressContext(ctx context.Context, commandID string, params map[string]any) context.Context {
+	if !h.streamsProgress(params) {
+		return ctx
+	}
+	report := h.progressReporter(ctx, commandID, params)
+	return docker.WithOutputHandler(ctx, func(line string) {
+		report("compose", line, 0, 0)
+	})
+}
+
+// AgentNamer renames the running agent; the new name must survive restarts
+type AgentNamer interface {
+	SetAgentName(name string) error
+}
+
+// MetricsReporter exposes the metrics collector: where container disk I/O metrics come
+// from and the most recent sample
+type MetricsReporter interface {
+	IOStatus() metrics.IOStatus
+	LatestMetrics(ctx context.Context) (*protocol.MetricsPayload, error)
 }
 
 // NewHandler creates a new command handler
 func NewHandler(dockerClient *docker.Client) *Handler {
+	return newHandler(dockerClient, docker.NewComposeClient(dockerClient))
+}
+
+// NewEndpointHandler creates a command handler for an additional Docker endpoint, whose
+// stacks are deployed with compose against the endpoint's daemon at dockerHost
+func NewEndpointHandler(dockerClient *docker.Client, endpoint, dockerHost string) *Handler {
+	return newHandler(dockerClient, docker.NewEndpointComposeClient(dockerClient, endpoint, dockerHost))
+}
+
+func newHandler(dockerClient *docker.Client, composeClient *docker.ComposeClient) *Handler {
 	return &Handler{
 		dockerClient:  dockerClient,
-		composeClient: docker.NewComposeClient(dockerClient),
+		composeClient: composeClient,
 		wsClient:      nil, // Will be set later
+		stopTimeout:   defaultStopTimeoutSeconds,
+		commandSlots:  make(chan struct{}, defaultMaxConcurrentCommands),
+		maxQueued:     defaultMaxQueuedCommands,
+		sandboxes:     newSandboxTracker(composeClient.RemoveStack),
+		streams:       newStreamRegistry(defaultMaxConcurrentStreams),
+	}
+}
+
+// SetMaxConcurrentCommands limits how many commands are executed at once; excess commands
+// wait for a free slot. It must be called before any command is handled. Non-positive
+// limits keep the current one.
+func (h *Handler) SetMaxConcurrentCommands(limit int) {
+	if limit > 0 {
+		h.commandSlots = make(chan struct{}, limit)
+	}
+}
+
+// SetMaxQueuedCommands limits how many commands may wait for a free slot; once the queue is
+// full further commands are answered with a busy response instead of waiting. Zero rejects
+// every command that cannot start immediately, negative limits keep the current one. It
+// must be called before any command is handled.
+func (h *Handler) SetMaxQueuedCommands(limit int) {
+	if limit >= 0 {
+		h.maxQueued = int32(limit)
+	}
+}
+
+// SetDefaultStopTimeout sets the grace period used when stopping or restarting containers
+// without an explicit timeout. Non-positive durations keep the current default.
+func (h *Handler) SetDefaultStopTimeout(timeout time.Duration) {
+	if seconds := int(timeout / time.Second); seconds > 0 {
+		h.stopTimeout = seconds
 	}
 }
 
+// SetComposeImportRoot sets the host directory, besides the compose working directory, whose
+// compose projects import_stack_from_path may read
+func (h *Handler) SetComposeImportRoot(root string) {
+	h.composeClient.SetImportRoot(root)
+}
+
+// SetAgentConfig sets the configuration reported by the get_agent_config command
+func (h *Handler) SetAgentConfig(cfg *config.Config) {
+	h.agentConfig = cfg
+}
+
+// SetAgentNamer sets the agent renamed by the set_agent_name command
+func (h *Handler) SetAgentNamer(namer AgentNamer) {
+	h.namer = namer
+}
+
+// SetMetricsReporter sets the metrics collector reported by get_runtime_info and
+// get_live_metrics
+func (h *Handler) SetMetricsReporter(reporter MetricsReporter) {
+	h.metrics = reporter
+}
+
 // SetWebSocketClient sets the WebSocket client for sending log events
 func (h *Handler) SetWebSocketClient(wsClient WebSocketClient) {
 	h.wsClient = wsClient
 }
 
-// HandleCommand processes a command and returns a response
-func (h *Handler) HandleCommand(ctx context.Context, command *protocol.Message) (*protocol.Message, error) {
+// acquireCommandSlot waits for a free command slot. Commands queue behind those already
+// running so bulk operations cannot overwhelm the daemon, but only up to maxQueued of them;
+// the rest, and any whose context ends while queued, are rejected with a busy error so the
+// server can retry later rather than wait on an unbounded backlog.
+func (h *Handler) acquireCommandSlot(ctx context.Context, action string) error {
+	select {
+	case h.commandSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if h.queued.Add(1) > h.maxQueued {
+		h.queued.Add(-1)
+		return fmt.Errorf("command %s was not started, retry later: %w", action, protocol.ErrAgentBusy)
+	}
+	defer h.queued.Add(-1)
+
+	select {
+	case h.commandSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("command %s was not started, agent is busy: %w", action, ctx.Err())
+	}
+}
+
+// HandleCommand processes a command and returns a response. A panic in a command handler
+// is recovered and answered with an error response for the command, so the caller is told
+// instead of waiting for its timeout.
+func (h *Handler) HandleCommand(ctx context.Context, command *protocol.Message) (response *protocol.Message, err error) {
 	cmd, err := command.GetCommand()
 	if err != nil {
 		return protocol.NewResponse(command.ID, "error", nil, err), nil
 	}
 
+	ctx, cancel := h.commandContext(ctx, cmd.Action, cmd.Params)
+	defer cancel()
+
+	if busy := h.acquireCommandSlot(ctx, cmd.Action); busy != nil {
+		return protocol.NewBusyResponse(command.ID, busy), nil
+	}
+	defer func() { <-h.commandSlots }()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logrus.WithField("command_id", command.ID).Errorf("Command %s panicked: %v\n%s", cmd.Action, recovered, debug.Stack())
+			response = protocol.NewPanicResponse(command.ID, fmt.Errorf("command %s failed: internal agent error: %v", cmd.Action, recovered))
+			err = nil
+		}
+	}()
+
 	logrus.Debugf("Handling command: %s", cmd.Action)
 
+	if composeActions[cmd.Action] {
+		if err := h.composeClient.Available(); err != nil {
+			return protocol.NewResponse(command.ID, "error", nil, err), nil
+		}
+	}
+
 	switch cmd.Action {
 	case "list_containers":
 		return h.handleListContainers(ctx, command.ID, cmd.Params)
 	case "get_docker_info":
 		return h.handleGetDockerInfo(ctx, command.ID)
+	case "get_agent_config":
+		return h.handleGetAgentConfig(command.ID)
+	case "get_runtime_info":
+		return h.handleGetRuntimeInfo(ctx, command.ID)
+	case "get_live_metrics":
+		return h.handleGetLiveMetrics(ctx, command.ID)
+	case "set_agent_name":
+		return h.handleSetAgentName(command.ID, cmd.Params)
 	case "get_container":
 		return h.handleGetContainer(ctx, command.ID, cmd.Params)
 	case "create_container":
@@ -100,6 +409,8 @@ func (h *Handler) HandleCommand(ctx context.Context, command *protocol.Message)
 		return h.handleRestartContainer(ctx, command.ID, cmd.Params)
 	case "remove_container":
 		return h.handleRemoveContainer(ctx, command.ID, cmd.Params)
+	case "rolling_update_container":
+		return h.handleRollingUpdateContainer(ctx, command.ID, cmd.Params)
 	case "list_images":
 		return h.handleListImages(ctx, command.ID, cmd.Params)
 	case "list_networks":
@@ -116,16 +427,26 @@ func (h *Handler) HandleCommand(ctx context.Context, command *protocol.Message)
 		return h.handleRemoveVolumes(ctx, command.ID, cmd.Params)
 	case "remove_images":
 		return h.handleRemoveImages(ctx, command.ID, cmd.Params)
+	case "pull_images":
+		return h.handlePullImages(ctx, command.ID, cmd.Params)
 	case "prune_dangling_images":
 		return h.handlePruneDanglingImages(ctx, command.ID, cmd.Params)
 	case "get_container_logs":
 		return h.handleGetContainerLogs(ctx, command.ID, cmd.Params)
 	case "stream_container_logs":
 		return h.handleStreamContainerLogs(ctx, command.ID, cmd.Params)
+	case "stop_stream":
+		return h.handleStopStream(command.ID, cmd.Params)
+	case "list_streams":
+		return h.handleListStreams(command.ID)
 	case "get_container_stats":
 		return h.handleGetContainerStats(ctx, command.ID, cmd.Params)
 	case "deploy_stack":
 		return h.handleDeployStack(ctx, command.ID, cmd.Params)
+	case "end_sandbox":
+		return h.handleEndSandbox(ctx, command.ID, cmd.Params)
+	case "list_sandboxes":
+		return h.handleListSandboxes(command.ID)
 	case "list_stacks":
 		return h.handleListStacks(ctx, command.ID, cmd.Params)
 	case "get_stack":
@@ -142,10 +463,18 @@ func (h *Handler) HandleCommand(ctx context.Context, command *protocol.Message)
 		return h.handleRestartStack(ctx, command.ID, cmd.Params)
 	case "import_stack":
 		return h.handleImportStack(ctx, command.ID, cmd.Params)
+	case "import_stack_from_path":
+		return h.handleImportStackFromPath(ctx, command.ID, cmd.Params)
 	case "get_stack_containers":
 		return h.handleGetStackContainers(ctx, command.ID, cmd.Params)
 	case "stack_container_action":
 		return h.handleStackContainerAction(ctx, command.ID, cmd.Params)
+	case "relabel_stack":
+		return h.handleRelabelStack(ctx, command.ID, cmd.Params)
+	case "cleanup_stacks":
+		return h.handleCleanupStacks(ctx, command.ID, cmd.Params)
+	case "discover_stacks":
+		return h.handleDiscoverStacks(ctx, command.ID)
 	default:
 		return protocol.NewResponse(command.ID, "error", nil, fmt.Errorf("unknown command: %s", cmd.Action)), nil
 	}
@@ -162,6 +491,10 @@ func (h *Handler) handleListContainers(ctx context.Context, commandID string, pa
 	if err != nil {
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
+	// Only a list that includes stopped containers shows which ones are gone
+	if all {
+		h.pruneLastStats(containers)
+	}
 
 	// Convert containers to a more friendly format
 	containerList := make([]map[string]any, len(containers))
@@ -229,9 +562,13 @@ func (h *Handler) handleCreateContainer(ctx context.Context, commandID string, p
 	}
 
 	// Parse optional parameters
-	command := ""
-	if cmd, ok := params["command"].(string); ok {
-		command = cmd
+	cmd, err := parseCommandLine(params["command"], "command")
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	entrypoint, err := parseCommandLine(params["entrypoint"], "entrypoint")
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
 	env := []string{}
@@ -267,9 +604,10 @@ func (h *Handler) handleCreateContainer(ctx context.Context, commandID string, p
 	}
 
 	// Parse restart policy
-	restartPolicy := "no"
-	if restart, ok := params["restart"].(string); ok {
-		restartPolicy = restart
+	restart, _ := params["restart"].(string)
+	restartPolicy, err := parseRestartPolicy(restart)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
 	// Parse auto-start flag
@@ -278,42 +616,134 @@ func (h *Handler) handleCreateContainer(ctx context.Context, commandID string, p
 		autoStart = start
 	}
 
+	// Parse GPU requests
+	deviceRequests, err := parseGPURequest(params["gpus"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	// Parse device access and capabilities
+	devices, err := parseDeviceMappings(params["devices"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	capAdd, err := parseCapabilities(params["cap_add"], "cap_add")
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	capDrop, err := parseCapabilities(params["cap_drop"], "cap_drop")
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	privileged := boolParam(params, "privileged", false)
+
+	// Parse hostname, domain name and network attachment
+	hostname, _ := params["hostname"].(string)
+	if hostname != "" && !validDNSName(hostname) {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("invalid hostname %q: must be a valid DNS name", hostname)), nil
+	}
+	domainname, _ := params["domainname"].(string)
+	if domainname != "" && !validDNSName(domainname) {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("invalid domainname %q: must be a valid DNS name", domainname)), nil
+	}
+	networkName, _ := params["network"].(string)
+	networkingConfig, err := parseNetworkingConfig(networkName, params["aliases"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	// Parse tmpfs mounts and resource limits
+	tmpfs, err := parseTmpfsMounts(params["tmpfs"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	ulimits, err := parseUlimits(params["ulimits"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	shmSize, err := parseShmSize(params["shm_size"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	sysctls, err := parseSysctls(params["sysctls"])
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
 	// Create container configuration
 	containerConfig := &container.Config{
-		Image:  image,
-		Cmd:    strings.Fields(command),
-		Env:    env,
-		Labels: labels,
+		Image:      image,
+		Cmd:        cmd,
+		Entrypoint: entrypoint,
+		Env:        env,
+		Labels:     labels,
+		Hostname:   hostname,
+		Domainname: domainname,
 	}
 
 	// Create host configuration
 	hostConfig := &container.HostConfig{
-		RestartPolicy: container.RestartPolicy{
-			Name: restartPolicy,
+		RestartPolicy: restartPolicy,
+		CapAdd:        capAdd,
+		CapDrop:       capDrop,
+		Privileged:    privileged,
+		Tmpfs:         tmpfs,
+		ShmSize:       shmSize,
+		Sysctls:       sysctls,
+		Resources: container.Resources{
+			Devices:        devices,
+			DeviceRequests: deviceRequests,
+			Ulimits:        ulimits,
 		},
 	}
+	if networkingConfig != nil {
+		hostConfig.NetworkMode = container.NetworkMode(strings.TrimSpace(networkName))
+	}
 
 	// Add port bindings
-	if len(ports) > 0 {
-		portBindings := make(nat.PortMap)
-		exposedPorts := make(nat.PortSet)
+	portBindings := make(nat.PortMap)
+	for containerPort, hostPort := range ports {
+		port, err := nat.NewPort("tcp", containerPort)
+		if err != nil {
+			// If parsing fails, try with the port as-is
+			port = nat.Port(containerPort)
+		}
+		portBindings[port] = []nat.PortBinding{
+			{
+				HostPort: fmt.Sprintf("%v", hostPort),
+			},
+		}
+	}
 
-		for containerPort, hostPort := range ports {
-			port, err := nat.NewPort("tcp", containerPort)
-			if err != nil {
-				// If parsing fails, try with the port as-is
-				port = nat.Port(containerPort)
-			}
+	// With publish_all, every port the image exposes is published on the same host port
+	var publishedPorts map[string]string
+	if boolParam(params, "publish_all", false) {
+		imageInfo, err := h.dockerClient.InspectImage(ctx, image)
+		if err != nil {
+			return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("failed to inspect image %s for its exposed ports: %w", image, err)), nil
+		}
+		if imageInfo.Config != nil {
+			publishedPorts = publishExposedPorts(imageInfo.Config.ExposedPorts, portBindings)
+		}
+	}
+
+	if len(portBindings) > 0 {
+		exposedPorts := make(nat.PortSet, len(portBindings))
+		for port := range portBindings {
 			exposedPorts[port] = struct{}{}
-			portBindings[port] = []nat.PortBinding{
-				{
-					HostPort: fmt.Sprintf("%v", hostPort),
-				},
-			}
 		}
 
 		containerConfig.ExposedPorts = exposedPorts
 		hostConfig.PortBindings = portBindings
+
+		// Name the container holding a requested port instead of surfacing Docker's allocation error
+		running, err := h.dockerClient.ListContainers(ctx, false)
+		if err != nil {
+			return protocol.NewResponse(commandID, "error", nil, err), nil
+		}
+		if err := findPortConflict(running, portBindings); err != nil {
+			return protocol.NewResponse(commandID, "error", nil, err), nil
+		}
 	}
 
 	// Add volume bindings
@@ -321,25 +751,50 @@ func (h *Handler) handleCreateContainer(ctx context.Context, commandID string, p
 		hostConfig.Binds = volumes
 	}
 
+	// A dry run stops here and returns the resolved configuration after the checks Docker
+	// would otherwise fail the create with
+	if boolParam(params, "dry_run", false) {
+		existing, err := h.dockerClient.ListContainers(ctx, true)
+		if err != nil {
+			return protocol.NewResponse(commandID, "error", nil, err), nil
+		}
+		if err := findNameConflict(existing, name); err != nil {
+			return protocol.NewResponse(commandID, "error", nil, err), nil
+		}
+		return protocol.NewResponse(commandID, "success", map[string]any{
+			"message":           "Container configuration is valid",
+			"dry_run":           true,
+			"name":              name,
+			"auto_start":        autoStart,
+			"config":            containerConfig,
+			"host_config":       hostConfig,
+			"networking_config": networkingConfig,
+			"published_ports":   publishedPorts,
+		}, nil), nil
+	}
+
 	// Create the container
 	var response *container.CreateResponse
-	var err error
 
 	if autoStart {
-		response, err = h.dockerClient.RunContainer(ctx, containerConfig, hostConfig, nil, nil, name)
+		response, err = h.dockerClient.RunContainer(ctx, containerConfig, hostConfig, networkingConfig, nil, name)
 	} else {
-		response, err = h.dockerClient.CreateContainer(ctx, containerConfig, hostConfig, nil, nil, name)
+		response, err = h.dockerClient.CreateContainer(ctx, containerConfig, hostConfig, networkingConfig, nil, name)
 	}
 
 	if err != nil {
+		if len(deviceRequests) > 0 {
+			err = explainGPUCreateError(err)
+		}
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
 	return protocol.NewResponse(commandID, "success", map[string]any{
-		"message":      "Container created successfully",
-		"container_id": response.ID,
-		"name":         name,
-		"auto_started": autoStart,
+		"message":         "Container created successfully",
+		"container_id":    response.ID,
+		"name":            name,
+		"auto_started":    autoStart,
+		"published_ports": publishedPorts,
 	}, nil), nil
 }
 
@@ -350,8 +805,16 @@ func (h *Handler) handleStartContainer(ctx context.Context, commandID string, pa
 		return protocol.NewResponse(commandID, "error", nil, errContainerIDParameterRequired), nil
 	}
 
+	// A retried or repeated start finds the container already running
+	if state := h.containerState(ctx, containerID); state != nil && state.Running && !state.Paused {
+		return alreadyInStateResponse(commandID, containerID, "Container is already running"), nil
+	}
+
 	err := h.dockerClient.StartContainer(ctx, containerID)
 	if err != nil {
+		if state := h.containerState(ctx, containerID); state != nil && state.Running && !state.Paused {
+			return alreadyInStateResponse(commandID, containerID, "Container is already running"), nil
+		}
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
@@ -361,6 +824,33 @@ func (h *Handler) handleStartContainer(ctx context.Context, commandID string, pa
 	}, nil), nil
 }
 
+// containerState returns the state of a container, or nil when it could not be inspected, in
+// which case the caller goes ahead and leaves Docker to report the problem.
+func (h *Handler) containerState(ctx context.Context, containerID string) *types.ContainerState {
+	info, err := h.dockerClient.GetContainer(ctx, containerID)
+	if err != nil || info.ContainerJSONBase == nil {
+		return nil
+	}
+	return info.State
+}
+
+// startedSince reports whether a container was last started at or after t
+func startedSince(state *types.ContainerState, t time.Time) bool {
+	started, err := time.Parse(time.RFC3339Nano, state.StartedAt)
+	return err == nil && !started.Before(t)
+}
+
+// alreadyInStateResponse answers a start, stop or restart that found the container in the
+// requested state already; it succeeds so retries and double clicks are not reported as
+// failures.
+func alreadyInStateResponse(commandID, containerID, message string) *protocol.Message {
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":      message,
+		"container_id": containerID,
+		"unchanged":    true,
+	}, nil)
+}
+
 // handleStopContainer handles the stop_container command
 func (h *Handler) handleStopContainer(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	containerID, ok := params["container_id"].(string)
@@ -368,13 +858,24 @@ func (h *Handler) handleStopContainer(ctx context.Context, commandID string, par
 		return protocol.NewResponse(commandID, "error", nil, errContainerIDParameterRequired), nil
 	}
 
-	timeout := 30
-	if timeoutParam, ok := params["timeout"].(float64); ok {
-		timeout = int(timeoutParam)
+	timeout := h.stopTimeoutParam(params)
+
+	// A retried or repeated stop finds the container already stopped
+	if state := h.containerState(ctx, containerID); state != nil && !state.Running {
+		return alreadyInStateResponse(commandID, containerID, "Container is already stopped"), nil
+	}
+
+	if safe, _ := params["safe"].(bool); safe {
+		if resp := h.checkSafeStop(ctx, commandID, containerID, "stop"); resp != nil {
+			return resp, nil
+		}
 	}
 
 	err := h.dockerClient.StopContainer(ctx, containerID, &timeout)
 	if err != nil {
+		if state := h.containerState(ctx, containerID); state != nil && !state.Running {
+			return alreadyInStateResponse(commandID, containerID, "Container is already stopped"), nil
+		}
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
@@ -391,13 +892,26 @@ func (h *Handler) handleRestartContainer(ctx context.Context, commandID string,
 		return protocol.NewResponse(commandID, "error", nil, errContainerIDParameterRequired), nil
 	}
 
-	timeout := 30
-	if timeoutParam, ok := params["timeout"].(float64); ok {
-		timeout = int(timeoutParam)
+	timeout := h.stopTimeoutParam(params)
+
+	// A retried or repeated restart finds the first one still under way
+	if state := h.containerState(ctx, containerID); state != nil && state.Restarting {
+		return alreadyInStateResponse(commandID, containerID, "Container is already restarting"), nil
+	}
+
+	if safe, _ := params["safe"].(bool); safe {
+		if resp := h.checkSafeStop(ctx, commandID, containerID, "restart"); resp != nil {
+			return resp, nil
+		}
 	}
 
+	began := time.Now()
 	err := h.dockerClient.RestartContainer(ctx, containerID, &timeout)
 	if err != nil {
+		// A concurrent attempt of the same command may have restarted the container meanwhile
+		if state := h.containerState(ctx, containerID); state != nil && state.Running && startedSince(state, began) {
+			return alreadyInStateResponse(commandID, containerID, "Container was restarted by another attempt"), nil
+		}
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
@@ -407,6 +921,106 @@ func (h *Handler) handleRestartContainer(ctx context.Context, commandID string,
 	}, nil), nil
 }
 
+// handleRollingUpdateContainer handles the rolling_update_container command. It pulls the
+// container's image and recreates the container only when the pulled image differs from the
+// one it runs, so an unchanged image never causes a restart. With dry_run nothing is pulled:
+// the registry digest of the image is compared with the digests of the image the container
+// runs.
+func (h *Handler) handleRollingUpdateContainer(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	containerID, ok := params["container_id"].(string)
+	if !ok {
+		return protocol.NewResponse(commandID, "error", nil, errContainerIDParameterRequired), nil
+	}
+
+	timeout := h.stopTimeoutParam(params)
+	report := h.progressReporter(ctx, commandID, params)
+
+	current, err := h.dockerClient.GetContainer(ctx, containerID)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	imageRef := current.Config.Image
+	if imageRef == "" || strings.HasPrefix(imageRef, "sha256:") {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("container %s was created from an image ID and cannot be updated by pulling", containerID)), nil
+	}
+
+	if boolParam(params, "dry_run", false) {
+		return h.checkContainerImageUpdate(ctx, commandID, current, imageRef), nil
+	}
+
+	report("pull", fmt.Sprintf("Pulling %s", imageRef), 1, 3)
+	pulled, err := h.dockerClient.PullImage(ctx, imageRef)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	image, err := h.dockerClient.InspectImage(ctx, imageRef)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	result := map[string]any{
+		"container_id":      current.ID,
+		"image":             imageRef,
+		"image_id":          image.ID,
+		"previous_image_id": current.Image,
+	}
+	if pulled.Digest != "" {
+		result["digest"] = pulled.Digest
+	}
+	// The image ID is the content digest of the image config, so an equal ID means the
+	// container already runs exactly the pulled image
+	if image.ID == current.Image {
+		result["status"] = "up_to_date"
+		result["message"] = "Container is already up to date"
+		return protocol.NewResponse(commandID, "success", result, nil), nil
+	}
+
+	report("recreate", fmt.Sprintf("Recreating %s", strings.TrimPrefix(current.Name, "/")), 2, 3)
+	newID, err := h.dockerClient.RecreateContainer(ctx, current, imageRef, &timeout)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	report("done", "Container updated", 3, 3)
+
+	result["status"] = "updated"
+	result["message"] = "Container updated to the latest image"
+	result["container_id"] = newID
+	result["previous_container_id"] = current.ID
+	return protocol.NewResponse(commandID, "success", result, nil), nil
+}
+
+// checkContainerImageUpdate reports whether the registry has a newer image for a container
+// without pulling it. The image the container runs is up to date when one of its repo
+// digests matches the digest the registry returns for imageRef.
+func (h *Handler) checkContainerImageUpdate(ctx context.Context, commandID string, current *types.ContainerJSON, imageRef string) *protocol.Message {
+	remoteDigest, err := h.dockerClient.RemoteImageDigest(ctx, imageRef)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err)
+	}
+	image, err := h.dockerClient.InspectImage(ctx, current.Image)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err)
+	}
+
+	result := map[string]any{
+		"container_id":      current.ID,
+		"image":             imageRef,
+		"image_id":          image.ID,
+		"previous_image_id": current.Image,
+		"digest":            remoteDigest,
+	}
+	for _, repoDigest := range image.RepoDigests {
+		if _, digest, ok := strings.Cut(repoDigest, "@"); ok && digest == remoteDigest {
+			result["status"] = "up_to_date"
+			result["message"] = "Container is already up to date"
+			return protocol.NewResponse(commandID, "success", result, nil)
+		}
+	}
+	result["status"] = "update_available"
+	result["message"] = "A newer image is available; the container was not recreated"
+	return protocol.NewResponse(commandID, "success", result, nil)
+}
+
 // handleRemoveContainer handles the remove_container command
 func (h *Handler) handleRemoveContainer(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	containerID, ok := params["container_id"].(string)
@@ -436,6 +1050,7 @@ func (h *Handler) handleRemoveContainer(ctx context.Context, commandID string, p
 	if err != nil {
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
+	h.lastStats.Delete(containerID)
 
 	return protocol.NewResponse(commandID, "success", map[string]any{
 		"message":      "Container removed successfully",
@@ -450,6 +1065,12 @@ func (h *Handler) handleListImages(ctx context.Context, commandID string, params
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
 
+	platforms := h.resolveImagePlatforms(ctx, images)
+	hostOS, hostArch, platformErr := h.dockerClient.ServerPlatform(ctx)
+	if platformErr != nil {
+		logrus.Debugf("handleListImages: unable to determine host platform: %v", platformErr)
+	}
+
 	// Convert images to a more friendly format
 	imageList := make([]map[string]any, len(images))
 	for i, image := range images {
@@ -496,13 +1117,86 @@ func (h *Handler) handleListImages(ctx context.Context, commandID string, params
 			"dangling_str": danglingStr,
 			"shared_size":  image.SharedSize,
 		}
+
+		if platform, ok := platforms[image.ID]; ok {
+			entry := imageList[i]
+			entry["os"] = platform.OS
+			entry["architecture"] = platform.Architecture
+			entry["variant"] = platform.Variant
+			entry["platform"] = formatPlatform(platform)
+			if hostArch != "" && platform.Architecture != "" {
+				entry["platform_mismatch"] = platform.Architecture != hostArch || (hostOS != "" && platform.OS != "" && platform.OS != hostOS)
+			}
+		}
 	}
 
 	return protocol.NewResponse(commandID, "success", map[string]any{
-		"images": imageList,
+		"images":        imageList,
+		"host_platform": strings.Trim(hostOS+"/"+hostArch, "/"),
 	}, nil), nil
 }
 
+// resolveImagePlatforms returns the platform of each listed image. Platforms are cached by image
+// ID; uncached images are inspected with bounded concurrency and at most
+// maxImagePlatformInspects inspections per call, so large hosts fill the cache over a few listings.
+func (h *Handler) resolveImagePlatforms(ctx context.Context, images []types.ImageSummary) map[string]imagePlatform {
+	platforms := make(map[string]imagePlatform, len(images))
+	pending := make([]string, 0)
+	for _, image := range images {
+		if cached, ok := h.imagePlatforms.Load(image.ID); ok {
+			platforms[image.ID] = cached.(imagePlatform)
+			continue
+		}
+		if len(pending) < maxImagePlatformInspects {
+			pending = append(pending, image.ID)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentInspectJobs)
+	for _, id := range pending {
+		wg.Add(1)
+		go func(imageID string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			inspect, err := h.dockerClient.InspectImage(ctx, imageID)
+			if err != nil {
+				logrus.Debugf("resolveImagePlatforms: failed to inspect image %s: %v", imageID, err)
+				return
+			}
+			platform := imagePlatform{
+				OS:           inspect.Os,
+				Architecture: inspect.Architecture,
+				Variant:      inspect.Variant,
+			}
+			h.imagePlatforms.Store(imageID, platform)
+			mu.Lock()
+			platforms[imageID] = platform
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	return platforms
+}
+
+func formatPlatform(p imagePlatform) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{p.OS, p.Architecture, p.Variant} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
 // handleListNetworks handles the list_networks command
 func (h *Handler) handleListNetworks(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	networks, err := h.dockerClient.ListNetworks(ctx)
@@ -926,6 +1620,8 @@ func normalizeNetworkInspect(network types.NetworkResource, meta map[string]cont
 	}
 	sort.Strings(stacks)
 
+	ipamConfigs := summarizeIPAM(network.IPAM)
+
 	payload := map[string]any{
 		"id":                network.ID,
 		"name":              network.Name,
@@ -939,6 +1635,7 @@ func normalizeNetworkInspect(network types.NetworkResource, meta map[string]cont
 		"options":           network.Options,
 		"containers":        len(attachments),
 		"ipam":              network.IPAM,
+		"ipam_configs":      ipamConfigs,
 		"config_only":       network.ConfigOnly,
 		"config_from":       network.ConfigFrom,
 		"containers_detail": attachments,
@@ -950,10 +1647,33 @@ func normalizeNetworkInspect(network types.NetworkResource, meta map[string]cont
 	if !network.Created.IsZero() {
 		payload["created"] = network.Created.Format(time.RFC3339)
 	}
+	// The first address pool is what users recognise as the network's subnet
+	if len(ipamConfigs) > 0 {
+		payload["subnet"] = ipamConfigs[0]["subnet"]
+		payload["gateway"] = ipamConfigs[0]["gateway"]
+		payload["ip_range"] = ipamConfigs[0]["ip_range"]
+	}
 
 	return payload
 }
 
+// summarizeIPAM flattens a network's IPAM pools into subnet, gateway and IP range entries.
+// Pools without a subnet carry no addressing and are skipped.
+func summarizeIPAM(ipam network.IPAM) []map[string]any {
+	configs := make([]map[string]any, 0, len(ipam.Config))
+	for _, cfg := range ipam.Config {
+		if cfg.Subnet == "" {
+			continue
+		}
+		configs = append(configs, map[string]any{
+			"subnet":   cfg.Subnet,
+			"gateway":  cfg.Gateway,
+			"ip_range": cfg.IPRange,
+		})
+	}
+	return configs
+}
+
 func normalizeVolumeInspect(vol *volume.Volume, consumers []map[string]any) map[string]any {
 	var size, refCount int64
 	if vol.UsageData != nil {
@@ -1409,6 +2129,107 @@ func filterEmptyStrings(values []string) []string {
 	return result
 }
 
+// handlePullImages pulls a set of images concurrently. With in_use set, every image referenced
+// by the host's containers is re-pulled in addition to the listed images.
+func (h *Handler) handlePullImages(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	refs := []string{}
+	if raw, ok := params["images"]; ok {
+		list, err := normalizeStringList(raw)
+		if err != nil {
+			return protocol.NewResponse(commandID, "error", nil, errors.New(imagesParameterArrayMsg)), nil
+		}
+		refs = append(refs, list...)
+	}
+
+	if boolParam(params, "in_use", false) {
+		containers, err := h.dockerClient.ListContainers(ctx, true)
+		if err != nil {
+			return protocol.NewResponse(commandID, "error", nil, err), nil
+		}
+		for _, ctr := range containers {
+			// Containers created from an image ID cannot be re-pulled by reference
+			if ctr.Image != "" && !strings.HasPrefix(ctr.Image, "sha256:") {
+				refs = append(refs, ctr.Image)
+			}
+		}
+	}
+
+	refs = uniqueStrings(refs)
+	if len(refs) == 0 {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("no images to pull")), nil
+	}
+
+	results := make([]map[string]any, len(refs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPullJobs)
+	report := h.progressReporter(ctx, commandID, params)
+	var done atomic.Int32
+
+	for idx, ref := range refs {
+		wg.Add(1)
+		go func(index int, imageRef string) {
+			defer wg.Done()
+			result := map[string]any{"image": imageRef}
+			results[index] = result
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				result["status"] = "error"
+				result["error"] = ctx.Err().Error()
+				return
+			}
+			defer func() { <-sem }()
+
+			started := time.Now()
+			pulled, err := h.dockerClient.PullImage(ctx, imageRef)
+			result["duration_ms"] = time.Since(started).Milliseconds()
+			if err != nil {
+				logrus.WithError(err).Warnf("handlePullImages: failed to pull %s", imageRef)
+				result["status"] = "error"
+				result["error"] = err.Error()
+				report("pull", fmt.Sprintf("Failed to pull %s", imageRef), int(done.Add(1)), len(refs))
+				return
+			}
+			result["status"] = "up_to_date"
+			if pulled.Updated {
+				result["status"] = "pulled"
+			}
+			report("pull", fmt.Sprintf("Pulled %s (%s)", imageRef, result["status"]), int(done.Add(1)), len(refs))
+			if pulled.Digest != "" {
+				result["digest"] = pulled.Digest
+			}
+		}(idx, ref)
+	}
+	wg.Wait()
+
+	summary := map[string]int{"pulled": 0, "up_to_date": 0, "error": 0}
+	for _, result := range results {
+		summary[result["status"].(string)]++
+	}
+
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"results":    results,
+		"total":      len(results),
+		"pulled":     summary["pulled"],
+		"up_to_date": summary["up_to_date"],
+		"failed":     summary["error"],
+	}, nil), nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
+
 // handlePruneDanglingImages removes all dangling images
 func (h *Handler) handlePruneDanglingImages(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	report, err := h.dockerClient.PruneDanglingImages(ctx)
@@ -1509,13 +2330,17 @@ func (h *Handler) handleStreamContainerLogs(ctx context.Context, commandID strin
 		options.Until = until
 	}
 
+	streamID, streamCtx, release, err := h.streams.start("logs", containerID)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
 	// Create log streamer
 	logStreamer := docker.NewLogStreamer(h.dockerClient.GetDockerClient())
 
 	// Start streaming logs in a goroutine
 	go func() {
-		streamCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+		defer release()
 
 		// Send log chunks via WebSocket to server
 		err := logStreamer.StreamLogs(streamCtx, containerID, options, func(chunk docker.LogChunk) error {
@@ -1531,17 +2356,17 @@ func (h *Handler) handleStreamContainerLogs(ctx context.Context, commandID strin
 			return nil
 		})
 
-		if err != nil {
+		if err != nil && streamCtx.Err() == nil {
 			logrus.Errorf("Log streaming error for container %s: %v", containerID, err)
 		}
 	}()
 
-	logrus.Infof("Started log stream for container %s", containerID)
+	logrus.Infof("Started log stream %s for container %s", streamID, containerID)
 
 	return protocol.NewResponse(commandID, "success", map[string]any{
 		"message":      "Log streaming started",
 		"container_id": containerID,
-		"stream_id":    fmt.Sprintf("%s-%d", containerID, time.Now().Unix()),
+		"stream_id":    streamID,
 	}, nil), nil
 }
 
@@ -1556,13 +2381,73 @@ func (h *Handler) handleGetContainerStats(ctx context.Context, commandID string,
 	if err != nil {
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
+	// Docker answers with an empty sample for a container that is not running
+	if docker.IsEmptyStats(stats) {
+		return h.stoppedContainerStats(ctx, commandID, containerID)
+	}
+	h.lastStats.Store(containerID, statsSample{stats: stats, at: time.Now()})
 
 	return protocol.NewResponse(commandID, "success", map[string]any{
 		"stats":        stats,
 		"container_id": containerID,
+		"running":      true,
 	}, nil), nil
 }
 
+// stoppedContainerStats answers a stats request for a container that is not running with its
+// state and, when the agent saw it running, the last stats sample taken.
+func (h *Handler) stoppedContainerStats(ctx context.Context, commandID, containerID string) (*protocol.Message, error) {
+	payload := map[string]any{
+		"container_id": containerID,
+		"running":      false,
+		"message":      "container not running",
+	}
+
+	ctr, err := h.dockerClient.GetContainer(ctx, containerID)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	if ctr.State != nil {
+		state := map[string]any{
+			"status":    ctr.State.Status,
+			"exit_code": ctr.State.ExitCode,
+		}
+		if ctr.State.FinishedAt != "" && !strings.HasPrefix(ctr.State.FinishedAt, "0001-") {
+			state["finished_at"] = ctr.State.FinishedAt
+		}
+		payload["state"] = state
+	}
+
+	if sample, ok := h.lastStats.Load(containerID); ok {
+		last := sample.(statsSample)
+		payload["last_stats"] = last.stats
+		payload["last_stats_at"] = last.at.UTC().Format(time.RFC3339)
+	}
+
+	return protocol.NewResponse(commandID, "success", payload, nil), nil
+}
+
+// pruneLastStats drops the stats samples of containers missing from a full container list,
+// which were removed outside the agent. Samples may be keyed by a container's ID, a prefix
+// of it or its name, as requested.
+func (h *Handler) pruneLastStats(containers []types.Container) {
+	h.lastStats.Range(func(key, _ any) bool {
+		ref := key.(string)
+		for _, ctr := range containers {
+			if strings.HasPrefix(ctr.ID, ref) {
+				return true
+			}
+			for _, name := range ctr.Names {
+				if strings.TrimPrefix(name, "/") == strings.TrimPrefix(ref, "/") {
+					return true
+				}
+			}
+		}
+		h.lastStats.Delete(key)
+		return true
+	})
+}
+
 // normalizeContainerStatus converts Docker status strings to frontend-friendly values
 func normalizeContainerStatus(status, state string) string {
 	// Docker status can be things like "Up 2 hours", "Exited (0) 2 hours ago", etc.
@@ -1619,7 +2504,11 @@ func (h *Handler) handleDeployStack(ctx context.Context, commandID string, param
 		envVars = envVarsParam
 	}
 
-	err := h.composeClient.DeployStack(ctx, name, compose, envVars)
+	if boolParam(params, "sandbox", false) {
+		return h.deploySandbox(ctx, commandID, name, compose, envVars, params)
+	}
+
+	err := h.composeClient.DeployStack(h.composeProgressContext(ctx, commandID, params), name, compose, envVars)
 	if err != nil {
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
@@ -1676,7 +2565,7 @@ func (h *Handler) handleUpdateStack(ctx context.Context, commandID string, param
 		envVars = envVarsParam
 	}
 
-	err := h.composeClient.UpdateStack(ctx, name, compose, envVars)
+	err := h.composeClient.UpdateStack(h.composeProgressContext(ctx, commandID, params), name, compose, envVars)
 	if err != nil {
 		return protocol.NewResponse(commandID, "error", nil, err), nil
 	}
@@ -1789,6 +2678,39 @@ func (h *Handler) handleImportStack(ctx context.Context, commandID string, param
 	}, nil), nil
 }
 
+// handleImportStackFromPath adopts an existing compose project using the compose file it was
+// deployed from on the host, so the content does not have to be uploaded
+func (h *Handler) handleImportStackFromPath(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	name, ok := params["name"].(string)
+	if !ok {
+		return protocol.NewResponse(commandID, "error", nil, errNameParameterRequired), nil
+	}
+	path, _ := params["path"].(string)
+
+	file, err := h.composeClient.ReadProjectComposeFile(ctx, name, strings.TrimSpace(path))
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	envVars := file.EnvVars
+	if envVarsParam, ok := params["env_vars"].(map[string]interface{}); ok {
+		envVars = envVarsParam
+	}
+
+	if err := h.composeClient.ImportStack(ctx, name, file.Content, envVars); err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":       fmt.Sprintf("Stack '%s' imported successfully from %s", name, file.Path),
+		"name":          name,
+		"imported":      true,
+		"path":          file.Path,
+		"compose":       file.Content,
+		"env_sensitive": len(envVars) > 0,
+	}, nil), nil
+}
+
 // handleGetStackContainers gets containers for a stack
 func (h *Handler) handleGetStackContainers(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	stackName, ok := params["stack_name"].(string)
@@ -1806,6 +2728,73 @@ func (h *Handler) handleGetStackContainers(ctx context.Context, commandID string
 	}, nil), nil
 }
 
+// handleRelabelStack handles the relabel_stack command
+func (h *Handler) handleRelabelStack(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	name, ok := params["name"].(string)
+	if !ok {
+		return protocol.NewResponse(commandID, "error", nil, errNameParameterRequired), nil
+	}
+	dryRun := boolParam(params, "dry_run", false)
+
+	mislabeled, err := h.composeClient.RelabelStack(ctx, name, dryRun)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	message := fmt.Sprintf("Stack '%s' labels are up to date", name)
+	switch {
+	case len(mislabeled) > 0 && dryRun:
+		message = fmt.Sprintf("%d container(s) in stack '%s' need relabeling; Docker cannot change labels in place, so relabeling recreates them", len(mislabeled), name)
+	case len(mislabeled) > 0:
+		message = fmt.Sprintf("Recreated %d container(s) in stack '%s' with Flotilla labels", len(mislabeled), name)
+	}
+
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":             message,
+		"name":                name,
+		"dry_run":             dryRun,
+		"mislabeled":          mislabeled,
+		"requires_recreation": len(mislabeled) > 0,
+	}, nil), nil
+}
+
+// handleDiscoverStacks handles the discover_stacks command
+func (h *Handler) handleDiscoverStacks(ctx context.Context, commandID string) (*protocol.Message, error) {
+	stacks, err := h.composeClient.DiscoverStacks(ctx)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"stacks": stacks,
+		"count":  len(stacks),
+	}, nil), nil
+}
+
+// handleCleanupStacks handles the cleanup_stacks command
+func (h *Handler) handleCleanupStacks(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	dryRun := boolParam(params, "dry_run", false)
+
+	stacks, err := h.composeClient.CleanupStaleStacks(ctx, dryRun)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	data := map[string]any{
+		"dry_run": dryRun,
+		"count":   len(stacks),
+	}
+	if dryRun {
+		data["orphaned"] = stacks
+		data["message"] = fmt.Sprintf("Found %d orphaned stack directories", len(stacks))
+	} else {
+		data["removed"] = stacks
+		data["message"] = fmt.Sprintf("Removed %d orphaned stack directories", len(stacks))
+	}
+
+	return protocol.NewResponse(commandID, "success", data, nil), nil
+}
+
 // handleStackContainerAction handles start/stop/restart for individual containers
 func (h *Handler) handleStackContainerAction(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
 	containerID, ok := params["container_id"].(string)
@@ -1826,12 +2815,14 @@ func (h *Handler) handleStackContainerAction(ctx context.Context, commandID stri
 			return protocol.NewResponse(commandID, "error", nil, err), nil
 		}
 	case "stop":
-		err := h.dockerClient.StopContainer(ctx, containerID, nil)
+		timeout := h.stopTimeout
+		err := h.dockerClient.StopContainer(ctx, containerID, &timeout)
 		if err != nil {
 			return protocol.NewResponse(commandID, "error", nil, err), nil
 		}
 	case "restart":
-		err := h.dockerClient.RestartContainer(ctx, containerID, nil)
+		timeout := h.stopTimeout
+		err := h.dockerClient.RestartContainer(ctx, containerID, &timeout)
 		if err != nil {
 			return protocol.NewResponse(commandID, "error", nil, err), nil
 		}
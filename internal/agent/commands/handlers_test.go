@@ -3,17 +3,24 @@ package commands
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/go-connections/nat"
 	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/mikeysoft/flotilla/internal/agent/metrics"
 	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -303,6 +310,83 @@ func TestHandleCommandGetDockerInfo(t *testing.T) {
 	}
 }
 
+func TestHandleCommandGetRuntimeInfo(t *testing.T) {
+	stub := &commandDockerStub{
+		infoFn: func(ctx context.Context) (types.Info, error) {
+			return types.Info{
+				Driver:         "overlay2",
+				CgroupDriver:   "systemd",
+				CgroupVersion:  "2",
+				DefaultRuntime: "runc",
+				Runtimes:       map[string]types.Runtime{"runc": {}, "io.containerd.runc.v2": {}},
+			}, nil
+		},
+	}
+
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetMetricsReporter(metricsStub{ioStatus: metrics.IOStatus{CgroupVersion: "2", Source: metrics.IOSourceCgroupFallback}})
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-runtime", "get_runtime_info", nil))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.Payload["status"] != "success" {
+		t.Fatalf("expected success status, got %#v", resp.Payload)
+	}
+	info, ok := resp.Payload["data"].(map[string]any)["runtime"].(*docker.RuntimeInfo)
+	if !ok {
+		t.Fatalf("expected runtime info in response, got %#v", resp.Payload["data"])
+	}
+	if info.StorageDriver != "overlay2" || info.CgroupVersion != "2" || info.DefaultRuntime != "runc" {
+		t.Fatalf("unexpected runtime info: %+v", info)
+	}
+	if len(info.Runtimes) != 2 || info.Runtimes[0] != "io.containerd.runc.v2" {
+		t.Fatalf("expected sorted runtimes, got %v", info.Runtimes)
+	}
+	ioStatus, ok := resp.Payload["data"].(map[string]any)["metrics_io"].(metrics.IOStatus)
+	if !ok || ioStatus.Source != metrics.IOSourceCgroupFallback {
+		t.Fatalf("expected the collector's I/O status, got %#v", resp.Payload["data"])
+	}
+}
+
+func TestHandleCommandGetLiveMetrics(t *testing.T) {
+	handler := NewHandler(docker.NewClient(&commandDockerStub{}))
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-live", "get_live_metrics", nil))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.Payload["status"] != "error" {
+		t.Fatalf("expected error without a collector, got %#v", resp.Payload)
+	}
+
+	sample := &protocol.MetricsPayload{
+		ContainerMetrics: []protocol.ContainerMetric{{ContainerID: "abc", CPUPercent: 12.5}},
+	}
+	handler.SetMetricsReporter(metricsStub{sample: sample})
+	resp, err = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-live", "get_live_metrics", nil))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.Payload["status"] != "success" {
+		t.Fatalf("expected success status, got %#v", resp.Payload)
+	}
+	if got := resp.Payload["data"].(map[string]any)["metrics"]; got != sample {
+		t.Fatalf("expected the collector's latest sample, got %#v", got)
+	}
+}
+
+type metricsStub struct {
+	ioStatus metrics.IOStatus
+	sample   *protocol.MetricsPayload
+}
+
+func (s metricsStub) IOStatus() metrics.IOStatus {
+	return s.ioStatus
+}
+
+func (s metricsStub) LatestMetrics(ctx context.Context) (*protocol.MetricsPayload, error) {
+	return s.sample, nil
+}
+
 func TestHandleCommandGetContainerLogs(t *testing.T) {
 	stub := &commandDockerStub{
 		containerLogsFn: func(ctx context.Context, id string, opts types.ContainerLogsOptions) (io.ReadCloser, error) {
@@ -374,6 +458,758 @@ func TestHandleCommandPruneDanglingImages(t *testing.T) {
 	}
 }
 
+func TestHandleCommandStopContainerDefaultTimeout(t *testing.T) {
+	var got *int
+	stub := &commandDockerStub{
+		containerStopFn: func(ctx context.Context, id string, opts container.StopOptions) error {
+			got = opts.Timeout
+			return nil
+		},
+	}
+
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetDefaultStopTimeout(90 * time.Second)
+	if _, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-stop", "stop_container", map[string]any{
+		"container_id": "db",
+	})); err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if got == nil || *got != 90 {
+		t.Fatalf("expected configured stop timeout of 90s, got %v", got)
+	}
+
+	if _, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-stop", "stop_container", map[string]any{
+		"container_id": "db",
+		"timeout":      float64(5),
+	})); err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if got == nil || *got != 5 {
+		t.Fatalf("expected explicit stop timeout of 5s, got %v", got)
+	}
+}
+
+func TestHandleCommandSafeStopAsksForConfirmationWhenBusy(t *testing.T) {
+	exitCode := 1
+	stopped := false
+	var probe []string
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: &types.ContainerState{Running: true}},
+				Config:            &container.Config{Labels: map[string]string{stopProbeLabel: "test ! -e /tmp/busy"}},
+				NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{
+					Ports: nat.PortMap{"80/tcp": []nat.PortBinding{{HostPort: "8080"}}},
+				}},
+			}, nil
+		},
+		execCreateFn: func(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+			probe = config.Cmd
+			return types.IDResponse{ID: "exec"}, nil
+		},
+		execInspectFn: func(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+			return types.ContainerExecInspect{ExecID: execID, ExitCode: exitCode}, nil
+		},
+		containerStopFn: func(ctx context.Context, id string, opts container.StopOptions) error {
+			stopped = true
+			return nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-stop", "stop_container", map[string]any{
+		"container_id": "web",
+		"safe":         true,
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected a confirmation response, got %#v err=%v", resp.Payload, err)
+	}
+	data := resp.Payload["data"].(map[string]any)
+	if data["confirmation_required"] != true || stopped {
+		t.Fatalf("expected busy container to be left running, got %#v stopped=%v", data, stopped)
+	}
+	if len(probe) != 3 || probe[2] != "test ! -e /tmp/busy" {
+		t.Fatalf("expected stop probe to run in the container, got %v", probe)
+	}
+
+	exitCode = 0
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-stop", "stop_container", map[string]any{
+		"container_id": "web",
+		"safe":         true,
+	}))
+	if data := resp.Payload["data"].(map[string]any); data["confirmation_required"] != nil || !stopped {
+		t.Fatalf("expected idle container to be stopped, got %#v", data)
+	}
+}
+
+func TestHandleCommandSafeStopSkipsContainersWithoutPublishedPorts(t *testing.T) {
+	stopped := false
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: &types.ContainerState{Running: true}},
+				Config:            &container.Config{Labels: map[string]string{stopProbeLabel: "false"}},
+				NetworkSettings:   &types.NetworkSettings{},
+			}, nil
+		},
+		execCreateFn: func(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+			t.Fatal("probe should not run for a container without published ports")
+			return types.IDResponse{}, nil
+		},
+		containerRestartFn: func(ctx context.Context, id string, opts container.StopOptions) error {
+			stopped = true
+			return nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-restart", "restart_container", map[string]any{
+		"container_id": "worker",
+		"safe":         true,
+	}))
+	if err != nil || resp.Payload["status"] != "success" || !stopped {
+		t.Fatalf("expected restart to go ahead, got %#v err=%v", resp.Payload, err)
+	}
+}
+
+func TestHandleCommandStartStopAlreadyInState(t *testing.T) {
+	state := &types.ContainerState{Running: true}
+	var calls []string
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: state}}, nil
+		},
+		containerStartFn: func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+			calls = append(calls, "start")
+			return nil
+		},
+		containerStopFn: func(ctx context.Context, id string, opts container.StopOptions) error {
+			calls = append(calls, "stop")
+			return nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	run := func(action string) map[string]any {
+		t.Helper()
+		resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-"+action, action, map[string]any{"container_id": "web"}))
+		if err != nil || resp.Payload["status"] != "success" {
+			t.Fatalf("expected %s to succeed, got %#v err=%v", action, resp.Payload, err)
+		}
+		return resp.Payload["data"].(map[string]any)
+	}
+
+	if data := run("start_container"); data["unchanged"] != true || data["message"] != "Container is already running" {
+		t.Fatalf("expected start of a running container to be a no-op, got %#v", data)
+	}
+	state.Paused = true
+	if data := run("start_container"); data["unchanged"] != nil {
+		t.Fatalf("expected a paused container to be started, got %#v", data)
+	}
+	if data := run("stop_container"); data["unchanged"] != nil {
+		t.Fatalf("expected a paused container to be stopped, got %#v", data)
+	}
+	state.Running, state.Paused = false, false
+	if data := run("stop_container"); data["unchanged"] != true || data["message"] != "Container is already stopped" {
+		t.Fatalf("expected stop of a stopped container to be a no-op, got %#v", data)
+	}
+	if strings.Join(calls, ",") != "start,stop" {
+		t.Fatalf("expected Docker to be called only when the state differs, got %v", calls)
+	}
+}
+
+func TestHandleCommandRestartToleratesRetry(t *testing.T) {
+	state := &types.ContainerState{Running: true, Restarting: true}
+	restarts := 0
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: state}}, nil
+		},
+		containerRestartFn: func(ctx context.Context, id string, opts container.StopOptions) error {
+			restarts++
+			// The first attempt of a retried command restarted the container meanwhile
+			state.StartedAt = time.Now().Add(time.Second).Format(time.RFC3339Nano)
+			return errors.New("cannot restart container: conflict")
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	run := func() *protocol.Message {
+		t.Helper()
+		resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-restart", "restart_container", map[string]any{"container_id": "web"}))
+		if err != nil {
+			t.Fatalf("HandleCommand returned error: %v", err)
+		}
+		return resp
+	}
+
+	if resp := run(); resp.Payload["status"] != "success" || resp.Payload["data"].(map[string]any)["message"] != "Container is already restarting" || restarts != 0 {
+		t.Fatalf("expected a restart under way to be a no-op, got %#v (restarts=%d)", resp.Payload, restarts)
+	}
+
+	state.Restarting = false
+	if resp := run(); resp.Payload["status"] != "success" || resp.Payload["data"].(map[string]any)["unchanged"] != true {
+		t.Fatalf("expected a restart done by another attempt to succeed, got %#v", resp.Payload)
+	}
+
+	// A failure that left the container as it was is still reported
+	stub.containerRestartFn = func(ctx context.Context, id string, opts container.StopOptions) error {
+		return errors.New("no such container")
+	}
+	state.StartedAt = time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	if resp := run(); resp.Payload["status"] != "error" {
+		t.Fatalf("expected the restart failure to be reported, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandStartToleratesRaceWithRetry(t *testing.T) {
+	state := &types.ContainerState{}
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: state}}, nil
+		},
+		containerStartFn: func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+			// The first attempt of a retried command started the container meanwhile
+			state.Running = true
+			return errors.New("container is already running")
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-start", "start_container", map[string]any{"container_id": "web"}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected start to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if data := resp.Payload["data"].(map[string]any); data["unchanged"] != true {
+		t.Fatalf("expected the start to be reported as unchanged, got %#v", data)
+	}
+
+	state.Running = false
+	stub.containerStartFn = func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+		return errors.New("no such image")
+	}
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-start", "start_container", map[string]any{"container_id": "web"}))
+	if resp.Payload["status"] != "error" {
+		t.Fatalf("expected a real start failure to be reported, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandQueuesBeyondConcurrencyLimit(t *testing.T) {
+	var active, peak int32
+	release := make(chan struct{})
+	stub := &commandDockerStub{
+		containerStartFn: func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&active, -1)
+			return nil
+		},
+	}
+
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetMaxConcurrentCommands(2)
+
+	done := make(chan *protocol.Message, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			resp, _ := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-start", "start_container", map[string]any{"container_id": "c"}))
+			done <- resp
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 4; i++ {
+		if resp := <-done; resp.Payload["status"] != "success" {
+			t.Fatalf("expected queued command to succeed, got %#v", resp.Payload)
+		}
+	}
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent commands, got %d", peak)
+	}
+
+	// A command whose context expires while queued is rejected without running
+	handler.commandSlots <- struct{}{}
+	handler.commandSlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp, err := handler.HandleCommand(ctx, protocol.NewCommand("cmd-start", "start_container", map[string]any{"container_id": "c"}))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.Payload["status"] != "error" || resp.Payload["code"] != protocol.ErrorCodeAgentBusy {
+		t.Fatalf("expected busy error, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandRecoversPanic(t *testing.T) {
+	stub := &commandDockerStub{
+		containerStartFn: func(context.Context, string, types.ContainerStartOptions) error {
+			panic("boom")
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetMaxConcurrentCommands(1)
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-panic", "start_container", map[string]any{"container_id": "c"}))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.ID != "cmd-panic" || resp.Payload["status"] != "error" || resp.Payload["code"] != protocol.ErrorCodeCommandPanic {
+		t.Fatalf("expected panic error response, got %#v", resp.Payload)
+	}
+
+	// The slot held by the panicking command is released
+	select {
+	case handler.commandSlots <- struct{}{}:
+	default:
+		t.Fatal("expected command slot to be released after panic")
+	}
+}
+
+func TestHandleCommandRejectsWhenQueueFull(t *testing.T) {
+	handler := NewHandler(docker.NewClient(&commandDockerStub{}))
+	handler.SetMaxConcurrentCommands(1)
+	handler.SetMaxQueuedCommands(1)
+	handler.commandSlots <- struct{}{}
+
+	// One command may wait for the busy slot
+	queued := make(chan *protocol.Message, 1)
+	go func() {
+		resp, _ := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-queued", "start_container", map[string]any{"container_id": "c"}))
+		queued <- resp
+	}()
+	for handler.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The next is answered immediately instead of waiting behind it
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-rejected", "start_container", map[string]any{"container_id": "c"}))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if resp.Payload["status"] != "error" || resp.Payload["code"] != protocol.ErrorCodeAgentBusy {
+		t.Fatalf("expected busy response, got %#v", resp.Payload)
+	}
+
+	<-handler.commandSlots
+	if resp := <-queued; resp.Payload["status"] != "success" {
+		t.Fatalf("expected queued command to run once a slot freed, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandCreateContainerTmpfsAndUlimits(t *testing.T) {
+	var captured *container.HostConfig
+	stub := &commandDockerStub{
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			captured = hostCfg
+			return container.CreateResponse{ID: "new"}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":      "redis:7",
+		"name":       "cache",
+		"auto_start": false,
+		"tmpfs":      []interface{}{"/run", "/scratch:size=64m,mode=1777,noexec"},
+		"ulimits": map[string]interface{}{
+			"nofile":  map[string]interface{}{"soft": float64(1024), "hard": float64(65536)},
+			"memlock": float64(-1),
+		},
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected create to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if captured.Tmpfs["/run"] != "" || captured.Tmpfs["/scratch"] != "size=64m,mode=1777,noexec" {
+		t.Fatalf("unexpected tmpfs mounts: %#v", captured.Tmpfs)
+	}
+	ulimits := captured.Ulimits
+	if len(ulimits) != 2 || ulimits[0].Name != "memlock" || ulimits[0].Soft != -1 || ulimits[1].Name != "nofile" || ulimits[1].Soft != 1024 || ulimits[1].Hard != 65536 {
+		t.Fatalf("unexpected ulimits: %+v %+v", ulimits[0], ulimits[1])
+	}
+
+	captured = nil
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":   "redis:7",
+		"name":    "cache",
+		"ulimits": map[string]interface{}{"files": float64(10)},
+	}))
+	if resp.Payload["status"] != "error" || captured != nil {
+		t.Fatalf("expected invalid ulimit to be rejected before create, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandCreateContainerShmSizeAndSysctls(t *testing.T) {
+	var captured *container.HostConfig
+	stub := &commandDockerStub{
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			captured = hostCfg
+			return container.CreateResponse{ID: "new"}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":      "postgres:16",
+		"name":       "db",
+		"auto_start": false,
+		"shm_size":   "256m",
+		"sysctls": map[string]interface{}{
+			"net.core.somaxconn": float64(1024),
+			"kernel.shmmax":      "68719476736",
+		},
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected create to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if captured.ShmSize != 256*1024*1024 {
+		t.Fatalf("expected shm size of 256m, got %d", captured.ShmSize)
+	}
+	if len(captured.Sysctls) != 2 || captured.Sysctls["net.core.somaxconn"] != "1024" || captured.Sysctls["kernel.shmmax"] != "68719476736" {
+		t.Fatalf("unexpected sysctls: %#v", captured.Sysctls)
+	}
+
+	captured = nil
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":   "postgres:16",
+		"name":    "db",
+		"sysctls": map[string]interface{}{"vm.swappiness": float64(10)},
+	}))
+	if resp.Payload["status"] != "error" || captured != nil {
+		t.Fatalf("expected non-namespaced sysctl to be rejected before create, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandCreateContainerEntrypoint(t *testing.T) {
+	var captured *container.Config
+	stub := &commandDockerStub{
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			captured = cfg
+			return container.CreateResponse{ID: "new"}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":      "alpine:3",
+		"name":       "greeter",
+		"auto_start": false,
+		"entrypoint": "/bin/sh -c",
+		"command":    `'echo "hello world" && sleep 5'`,
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected create to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if len(captured.Entrypoint) != 2 || captured.Entrypoint[0] != "/bin/sh" || captured.Entrypoint[1] != "-c" {
+		t.Fatalf("unexpected entrypoint: %#v", captured.Entrypoint)
+	}
+	if len(captured.Cmd) != 1 || captured.Cmd[0] != `echo "hello world" && sleep 5` {
+		t.Fatalf("unexpected command: %#v", captured.Cmd)
+	}
+
+	captured = nil
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":   "alpine:3",
+		"name":    "greeter",
+		"command": `echo "unterminated`,
+	}))
+	if resp.Payload["status"] != "error" || captured != nil {
+		t.Fatalf("expected an unterminated quote to be rejected before create, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandCreateContainerDryRun(t *testing.T) {
+	created := false
+	stub := &commandDockerStub{
+		containerListFn: func(ctx context.Context, opts types.ContainerListOptions) ([]types.Container, error) {
+			return []types.Container{{ID: "0123456789abcdef", Names: []string{"/taken"}}}, nil
+		},
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			created = true
+			return container.CreateResponse{ID: "new"}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":   "alpine:3",
+		"name":    "greeter",
+		"command": "sleep 5",
+		"dry_run": true,
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected dry run to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if created {
+		t.Fatal("dry run must not create the container")
+	}
+	data, _ := resp.Payload["data"].(map[string]any)
+	cfg, _ := data["config"].(*container.Config)
+	if data["dry_run"] != true || cfg == nil || cfg.Image != "alpine:3" || len(cfg.Cmd) != 2 {
+		t.Fatalf("expected the resolved config, got %#v", data)
+	}
+
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":   "alpine:3",
+		"name":    "taken",
+		"dry_run": true,
+	}))
+	if resp.Payload["status"] != "error" || created {
+		t.Fatalf("expected a name conflict to be reported, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandCreateContainerPublishAll(t *testing.T) {
+	var captured *container.HostConfig
+	stub := &commandDockerStub{
+		imageInspectWithRawFn: func(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+			return types.ImageInspect{ID: "sha256:web", Config: &container.Config{
+				ExposedPorts: nat.PortSet{"80/tcp": {}, "443/tcp": {}},
+			}}, nil, nil
+		},
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			captured = hostCfg
+			return container.CreateResponse{ID: "new"}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":       "nginx:latest",
+		"name":        "web",
+		"auto_start":  false,
+		"ports":       map[string]interface{}{"80": "8080"},
+		"publish_all": true,
+	}))
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected create to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	if len(captured.PortBindings) != 2 || captured.PortBindings["80/tcp"][0].HostPort != "8080" || captured.PortBindings["443/tcp"][0].HostPort != "443" {
+		t.Fatalf("unexpected port bindings: %#v", captured.PortBindings)
+	}
+	data := resp.Payload["data"].(map[string]any)
+	published, _ := data["published_ports"].(map[string]string)
+	if len(published) != 1 || published["443/tcp"] != "443" {
+		t.Fatalf("expected the published port to be reported, got %#v", data["published_ports"])
+	}
+
+	stub.imageInspectWithRawFn = func(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+		return types.ImageInspect{}, nil, errors.New("No such image")
+	}
+	captured = nil
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-create", "create_container", map[string]any{
+		"image":       "missing:latest",
+		"name":        "web",
+		"publish_all": true,
+	}))
+	if resp.Payload["status"] != "error" || captured != nil {
+		t.Fatalf("expected a missing image to fail before create, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandRollingUpdateContainer(t *testing.T) {
+	pulledID := "sha256:old"
+	remote := v1.Descriptor{Digest: "sha256:remote-old"}
+	var created, renamed, pulled []string
+	stub := &commandDockerStub{
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:         "0123456789abcdef",
+					Name:       "/web",
+					Image:      "sha256:old",
+					State:      &types.ContainerState{Running: true},
+					HostConfig: &container.HostConfig{},
+				},
+				Config: &container.Config{Image: "nginx:latest"},
+			}, nil
+		},
+		imagePullFn: func(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+			pulled = append(pulled, ref)
+			return io.NopCloser(strings.NewReader(`{"status":"Status: Downloaded newer image for ` + ref + `"}`)), nil
+		},
+		imageInspectWithRawFn: func(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+			if ref == "sha256:old" {
+				return types.ImageInspect{ID: ref, RepoDigests: []string{"nginx@sha256:remote-old"}}, nil, nil
+			}
+			return types.ImageInspect{ID: pulledID}, nil, nil
+		},
+		distributionInspectFn: func(ctx context.Context, ref string) (registry.DistributionInspect, error) {
+			return registry.DistributionInspect{Descriptor: remote}, nil
+		},
+		containerCreateFn: func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+			created = append(created, name)
+			return container.CreateResponse{ID: "new"}, nil
+		},
+		containerRenameFn: func(ctx context.Context, id, name string) error {
+			renamed = append(renamed, name)
+			return nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	command := protocol.NewCommand("cmd-update", "rolling_update_container", map[string]any{"container_id": "web"})
+
+	resp, err := handler.HandleCommand(context.Background(), command)
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected update check to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	data := resp.Payload["data"].(map[string]any)
+	if data["status"] != "up_to_date" || len(created) != 0 {
+		t.Fatalf("expected the container to be left alone, got %#v (created %v)", data, created)
+	}
+
+	// A dry run asks the registry instead of pulling
+	dryRun := protocol.NewCommand("cmd-update", "rolling_update_container", map[string]any{
+		"container_id": "web",
+		"dry_run":      true,
+	})
+	pulled = nil
+	resp, _ = handler.HandleCommand(context.Background(), dryRun)
+	data, _ = resp.Payload["data"].(map[string]any)
+	if data["status"] != "up_to_date" || len(pulled) != 0 {
+		t.Fatalf("expected a dry run to find the container up to date without pulling, got %#v (pulled %v)", resp.Payload, pulled)
+	}
+
+	pulledID = "sha256:new"
+	remote = v1.Descriptor{Digest: "sha256:remote-new"}
+	resp, _ = handler.HandleCommand(context.Background(), dryRun)
+	data, _ = resp.Payload["data"].(map[string]any)
+	if data["status"] != "update_available" || data["digest"] != "sha256:remote-new" || len(created) != 0 || len(pulled) != 0 {
+		t.Fatalf("expected a dry run to only report the update, got %#v (created %v, pulled %v)", resp.Payload, created, pulled)
+	}
+
+	resp, err = handler.HandleCommand(context.Background(), command)
+	if err != nil || resp.Payload["status"] != "success" {
+		t.Fatalf("expected update to succeed, got %#v err=%v", resp.Payload, err)
+	}
+	data = resp.Payload["data"].(map[string]any)
+	if data["status"] != "updated" || data["container_id"] != "new" || data["previous_container_id"] != "0123456789abcdef" {
+		t.Fatalf("unexpected update result: %#v", data)
+	}
+	if len(created) != 1 || created[0] != "web" || len(renamed) != 1 || renamed[0] != "web-flotilla-replaced" {
+		t.Fatalf("expected the container to be recreated under its name, created %v renamed %v", created, renamed)
+	}
+}
+
+type recordingNamer struct {
+	name string
+}
+
+func (n *recordingNamer) SetAgentName(name string) error {
+	n.name = name
+	return nil
+}
+
+func TestHandleCommandSetAgentName(t *testing.T) {
+	handler := NewHandler(docker.NewClient(&commandDockerStub{}))
+	resp, _ := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-name", "set_agent_name", map[string]any{"name": "edge"}))
+	if resp.Payload["status"] != "error" {
+		t.Fatalf("expected error without a namer, got %#v", resp.Payload)
+	}
+
+	namer := &recordingNamer{}
+	handler.SetAgentNamer(namer)
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-name", "set_agent_name", map[string]any{"name": " edge-01 "}))
+	if resp.Payload["status"] != "success" || namer.name != "edge-01" {
+		t.Fatalf("expected agent to be renamed, got %#v (name %q)", resp.Payload, namer.name)
+	}
+
+	resp, _ = handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-name", "set_agent_name", map[string]any{"name": ""}))
+	if resp.Payload["status"] != "error" || namer.name != "edge-01" {
+		t.Fatalf("expected empty name to be rejected, got %#v", resp.Payload)
+	}
+}
+
+func TestHandleCommandPullImages(t *testing.T) {
+	stub := &commandDockerStub{
+		containerListFn: func(ctx context.Context, opts types.ContainerListOptions) ([]types.Container, error) {
+			return []types.Container{{Image: "redis:7"}, {Image: "nginx:latest"}, {Image: "sha256:abc"}}, nil
+		},
+		imagePullFn: func(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+			switch ref {
+			case "nginx:latest":
+				return io.NopCloser(strings.NewReader(`{"status":"Status: Downloaded newer image for nginx:latest"}`)), nil
+			case "redis:7":
+				return io.NopCloser(strings.NewReader(`{"status":"Status: Image is up to date for redis:7"}`)), nil
+			default:
+				return io.NopCloser(strings.NewReader(`{"error":"manifest unknown"}`)), nil
+			}
+		},
+	}
+
+	handler := NewHandler(docker.NewClient(stub))
+	resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-pull", "pull_images", map[string]any{
+		"images": []any{"nginx:latest", "missing:1"},
+		"in_use": true,
+	}))
+	if err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	data := resp.Payload["data"].(map[string]any)
+	if data["total"].(int) != 3 || data["pulled"].(int) != 1 || data["up_to_date"].(int) != 1 || data["failed"].(int) != 1 {
+		t.Fatalf("unexpected pull summary: %#v", data)
+	}
+	results := data["results"].([]map[string]any)
+	if results[0]["image"] != "nginx:latest" || results[0]["status"] != "pulled" {
+		t.Fatalf("unexpected first result: %#v", results[0])
+	}
+	if results[1]["status"] != "error" || results[1]["error"] == nil {
+		t.Fatalf("expected failed pull for missing image: %#v", results[1])
+	}
+}
+
+func TestHandleCommandPullImagesStreamsProgress(t *testing.T) {
+	stub := &commandDockerStub{
+		imagePullFn: func(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(`{"status":"Status: Image is up to date for ` + ref + `"}`)), nil
+		},
+	}
+
+	ws := &progressRecorder{}
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetWebSocketClient(ws)
+	params := map[string]any{"images": []any{"nginx:latest", "redis:7"}}
+	if _, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-pull", "pull_images", params)); err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if len(ws.progress) != 0 {
+		t.Fatalf("expected no progress unless requested, got %#v", ws.progress)
+	}
+
+	params[protocol.ParamStreamProgress] = true
+	if _, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-pull", "pull_images", params)); err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if len(ws.progress) != 2 {
+		t.Fatalf("expected a progress report per image, got %#v", ws.progress)
+	}
+	for _, progress := range ws.progress {
+		if progress.CommandID != "cmd-pull" || progress.Stage != "pull" || progress.Total != 2 {
+			t.Fatalf("unexpected progress: %#v", progress)
+		}
+	}
+}
+
+type progressRecorder struct {
+	mu       sync.Mutex
+	progress []protocol.Progress
+}
+
+func (r *progressRecorder) SendLogEvent(containerID, data, stream string, timestamp time.Time) error {
+	return nil
+}
+
+func (r *progressRecorder) SendProgress(progress protocol.Progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress = append(r.progress, progress)
+	return nil
+}
+
 func TestHandleCommandGetContainerStats(t *testing.T) {
 	statsPayload := types.Stats{
 		CPUStats: types.CPUStats{
@@ -404,6 +1240,98 @@ func TestHandleCommandGetContainerStats(t *testing.T) {
 	}
 }
 
+func TestHandleCommandGetContainerStatsStoppedContainer(t *testing.T) {
+	running, _ := json.Marshal(types.Stats{
+		Read:     time.Now(),
+		CPUStats: types.CPUStats{CPUUsage: types.CPUUsage{TotalUsage: 42}},
+	})
+	stopped, _ := json.Marshal(types.Stats{})
+	samples := [][]byte{running, stopped}
+
+	stub := &commandDockerStub{
+		containerStatsFn: func(ctx context.Context, id string, stream bool) (types.ContainerStats, error) {
+			sample := samples[0]
+			samples = samples[1:]
+			return types.ContainerStats{Body: io.NopCloser(strings.NewReader(string(sample)))}, nil
+		},
+		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    id,
+					State: &types.ContainerState{Status: "exited", ExitCode: 137, FinishedAt: "2024-01-02T03:04:05Z"},
+				},
+			}, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+
+	for _, want := range []bool{true, false} {
+		resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-stats", "get_container_stats", map[string]any{
+			"container_id": "cid",
+		}))
+		if err != nil {
+			t.Fatalf("HandleCommand returned error: %v", err)
+		}
+		if resp.Payload["status"] != "success" {
+			t.Fatalf("expected success status, got %#v", resp.Payload)
+		}
+		data := resp.Payload["data"].(map[string]any)
+		if data["running"] != want {
+			t.Fatalf("expected running=%v, got %#v", want, data)
+		}
+		if want {
+			continue
+		}
+		state := data["state"].(map[string]any)
+		if state["status"] != "exited" || state["exit_code"] != 137 {
+			t.Fatalf("unexpected state: %#v", state)
+		}
+		last, ok := data["last_stats"].(*types.Stats)
+		if !ok || last.CPUStats.CPUUsage.TotalUsage != 42 || data["last_stats_at"] == nil {
+			t.Fatalf("expected last known stats, got %#v", data)
+		}
+	}
+}
+
+func TestHandleCommandListContainersPrunesLastStats(t *testing.T) {
+	var listed []types.Container
+	stub := &commandDockerStub{
+		containerListFn: func(ctx context.Context, opts types.ContainerListOptions) ([]types.Container, error) {
+			return listed, nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	for _, ref := range []string{"abc123", "web", "gone"} {
+		handler.lastStats.Store(ref, statsSample{stats: &types.Stats{}, at: time.Now()})
+	}
+	listed = []types.Container{{ID: "abc123def456", Names: []string{"/other"}}, {ID: "fff000", Names: []string{"/web"}}}
+
+	list := func(all bool) {
+		resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-list", "list_containers", map[string]any{"all": all}))
+		if err != nil || resp.Payload["status"] != "success" {
+			t.Fatalf("list_containers failed: %v %#v", err, resp)
+		}
+	}
+	stored := func() map[string]bool {
+		keys := map[string]bool{}
+		handler.lastStats.Range(func(key, _ any) bool {
+			keys[key.(string)] = true
+			return true
+		})
+		return keys
+	}
+
+	// Stopped containers are missing from a list of running ones, so nothing is dropped
+	list(false)
+	if len(stored()) != 3 {
+		t.Fatalf("expected a partial list to keep every sample, got %v", stored())
+	}
+	list(true)
+	if keys := stored(); len(keys) != 2 || !keys["abc123"] || !keys["web"] {
+		t.Fatalf("expected only the removed container's sample to be dropped, got %v", keys)
+	}
+}
+
 func TestHandleCommandStopContainerHonorsTimeout(t *testing.T) {
 	stub := &commandDockerStub{
 		containerStopFn: func(ctx context.Context, id string, opts container.StopOptions) error {
@@ -491,6 +1419,50 @@ func TestHandleCommandListImagesFormatsResponse(t *testing.T) {
 	}
 }
 
+func TestHandleCommandListImagesPlatform(t *testing.T) {
+	var inspects int32
+	stub := &commandDockerStub{
+		imageListFn: func(ctx context.Context, opts types.ImageListOptions) ([]types.ImageSummary, error) {
+			return []types.ImageSummary{
+				{ID: "sha256:amd", RepoTags: []string{"app:amd64"}},
+				{ID: "sha256:arm", RepoTags: []string{"app:arm64"}},
+			}, nil
+		},
+		imageInspectWithRawFn: func(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+			atomic.AddInt32(&inspects, 1)
+			if ref == "sha256:arm" {
+				return types.ImageInspect{Os: "linux", Architecture: "arm64", Variant: "v8"}, nil, nil
+			}
+			return types.ImageInspect{Os: "linux", Architecture: "amd64"}, nil, nil
+		},
+		serverVersionFn: func(ctx context.Context) (types.Version, error) {
+			return types.Version{Os: "linux", Arch: "amd64"}, nil
+		},
+	}
+
+	handler := NewHandler(docker.NewClient(stub))
+	for i := 0; i < 2; i++ {
+		resp, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-images", "list_images", map[string]any{}))
+		if err != nil {
+			t.Fatalf("HandleCommand returned error: %v", err)
+		}
+		data := resp.Payload["data"].(map[string]any)
+		images := data["images"].([]map[string]any)
+		if images[0]["platform"] != "linux/amd64" || images[0]["platform_mismatch"] != false {
+			t.Fatalf("unexpected amd64 image platform: %#v", images[0])
+		}
+		if images[1]["platform"] != "linux/arm64/v8" || images[1]["platform_mismatch"] != true {
+			t.Fatalf("unexpected arm64 image platform: %#v", images[1])
+		}
+		if data["host_platform"] != "linux/amd64" {
+			t.Fatalf("unexpected host platform: %v", data["host_platform"])
+		}
+	}
+	if atomic.LoadInt32(&inspects) != 2 {
+		t.Fatalf("expected image platforms to be cached after first listing, got %d inspects", inspects)
+	}
+}
+
 func TestHandleCommandGetContainer(t *testing.T) {
 	stub := &commandDockerStub{
 		containerInspectFn: func(ctx context.Context, id string) (types.ContainerJSON, error) {
@@ -525,6 +1497,10 @@ func TestHandleCommandListNetworks(t *testing.T) {
 					ID:     "net1",
 					Name:   "bridge",
 					Driver: "bridge",
+					IPAM: network.IPAM{Config: []network.IPAMConfig{
+						{Subnet: "172.18.0.0/16", Gateway: "172.18.0.1", IPRange: "172.18.5.0/24"},
+						{Gateway: "fe80::1"},
+					}},
 					Containers: map[string]types.EndpointResource{
 						"ctr-1": {Name: "svc", IPv4Address: "172.18.0.2/16"},
 					},
@@ -557,6 +1533,12 @@ func TestHandleCommandListNetworks(t *testing.T) {
 	if networks[0]["containers"].(int) != 1 {
 		t.Fatalf("expected network to report one container")
 	}
+	if networks[0]["subnet"] != "172.18.0.0/16" || networks[0]["gateway"] != "172.18.0.1" || networks[0]["ip_range"] != "172.18.5.0/24" {
+		t.Fatalf("unexpected addressing summary: %#v", networks[0])
+	}
+	if configs := networks[0]["ipam_configs"].([]map[string]any); len(configs) != 1 {
+		t.Fatalf("expected pools without a subnet to be skipped, got %#v", configs)
+	}
 }
 
 func TestHandleCommandInspectNetworks(t *testing.T) {
@@ -699,13 +1681,19 @@ type commandDockerStub struct {
 	containerLogsFn       func(context.Context, string, types.ContainerLogsOptions) (io.ReadCloser, error)
 	containerStatsFn      func(context.Context, string, bool) (types.ContainerStats, error)
 	containerCreateFn     func(context.Context, *container.Config, *container.HostConfig, *network.NetworkingConfig, *v1.Platform, string) (container.CreateResponse, error)
+	containerRenameFn     func(context.Context, string, string) error
+	execCreateFn          func(context.Context, string, types.ExecConfig) (types.IDResponse, error)
+	execInspectFn         func(context.Context, string) (types.ContainerExecInspect, error)
 	imageListFn           func(context.Context, types.ImageListOptions) ([]types.ImageSummary, error)
 	imageRemoveFn         func(context.Context, string, types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
 	imageInspectWithRawFn func(context.Context, string) (types.ImageInspect, []byte, error)
 	imagesPruneFn         func(context.Context, filters.Args) (types.ImagesPruneReport, error)
+	imagePullFn           func(context.Context, string, types.ImagePullOptions) (io.ReadCloser, error)
+	distributionInspectFn func(context.Context, string) (registry.DistributionInspect, error)
 	networkListFn         func(context.Context, types.NetworkListOptions) ([]types.NetworkResource, error)
 	networkInspectFn      func(context.Context, string, types.NetworkInspectOptions) (types.NetworkResource, error)
 	networkRemoveFn       func(context.Context, string) error
+	networkConnectFn      func(context.Context, string, string, *network.EndpointSettings) error
 	volumeListFn          func(context.Context, volume.ListOptions) (volume.ListResponse, error)
 	volumeInspectFn       func(context.Context, string) (volume.Volume, error)
 	volumeRemoveFn        func(context.Context, string, bool) error
@@ -764,6 +1752,13 @@ func (s *commandDockerStub) ContainerLogs(ctx context.Context, id string, opts t
 	return io.NopCloser(strings.NewReader("")), nil
 }
 
+func (s *commandDockerStub) DistributionInspect(ctx context.Context, ref, auth string) (registry.DistributionInspect, error) {
+	if s.distributionInspectFn != nil {
+		return s.distributionInspectFn(ctx, ref)
+	}
+	return registry.DistributionInspect{}, nil
+}
+
 func (s *commandDockerStub) ContainerStats(ctx context.Context, id string, stream bool) (types.ContainerStats, error) {
 	if s.containerStatsFn != nil {
 		return s.containerStatsFn(ctx, id, stream)
@@ -778,6 +1773,31 @@ func (s *commandDockerStub) ContainerCreate(ctx context.Context, cfg *container.
 	return container.CreateResponse{}, nil
 }
 
+func (s *commandDockerStub) ContainerRename(ctx context.Context, id, name string) error {
+	if s.containerRenameFn != nil {
+		return s.containerRenameFn(ctx, id, name)
+	}
+	return nil
+}
+
+func (s *commandDockerStub) ContainerExecCreate(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+	if s.execCreateFn != nil {
+		return s.execCreateFn(ctx, id, config)
+	}
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+func (s *commandDockerStub) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	return nil
+}
+
+func (s *commandDockerStub) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	if s.execInspectFn != nil {
+		return s.execInspectFn(ctx, execID)
+	}
+	return types.ContainerExecInspect{ExecID: execID}, nil
+}
+
 func (s *commandDockerStub) ImageList(ctx context.Context, opts types.ImageListOptions) ([]types.ImageSummary, error) {
 	if s.imageListFn != nil {
 		return s.imageListFn(ctx, opts)
@@ -827,6 +1847,13 @@ func (s *commandDockerStub) NetworkRemove(ctx context.Context, id string) error
 	return nil
 }
 
+func (s *commandDockerStub) NetworkConnect(ctx context.Context, networkID, containerID string, cfg *network.EndpointSettings) error {
+	if s.networkConnectFn != nil {
+		return s.networkConnectFn(ctx, networkID, containerID, cfg)
+	}
+	return nil
+}
+
 func (s *commandDockerStub) VolumeList(ctx context.Context, opts volume.ListOptions) (volume.ListResponse, error) {
 	if s.volumeListFn != nil {
 		return s.volumeListFn(ctx, opts)
@@ -875,3 +1902,10 @@ func (s *commandDockerStub) ServerVersion(ctx context.Context) (types.Version, e
 	}
 	return types.Version{}, nil
 }
+
+func (s *commandDockerStub) ImagePull(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+	if s.imagePullFn != nil {
+		return s.imagePullFn(ctx, ref, opts)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// stopProbeLabel holds a shell command run inside a container before a safe stop or
+	// restart. It exits zero when the container is idle and non-zero while it has active work.
+	stopProbeLabel   = "io.flotilla.stop-probe"
+	stopProbeTimeout = 10 * time.Second
+)
+
+// checkSafeStop runs the pre-stop check requested with safe on stop_container and
+// restart_container. It returns a response asking for confirmation when the container looks
+// busy, an error response when the container cannot be inspected, and nil when the action
+// may go ahead.
+func (h *Handler) checkSafeStop(ctx context.Context, commandID, containerID, action string) *protocol.Message {
+	info, err := h.dockerClient.GetContainer(ctx, containerID)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err)
+	}
+	reason := h.busyReason(ctx, info)
+	if reason == "" {
+		return nil
+	}
+	logrus.Infof("Holding %s of container %s for confirmation: %s", action, containerID, reason)
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":               fmt.Sprintf("Container appears busy; repeat the %s without safe to go ahead", action),
+		"container_id":          containerID,
+		"confirmation_required": true,
+		"reason":                reason,
+	}, nil)
+}
+
+// busyReason reports why a container looks busy, or "" when it looks idle. Only running
+// containers that publish ports are checked, using the command in their stop probe label;
+// containers without a probe are treated as idle. A probe that cannot be run counts as busy
+// so a broken probe never lets a stop through unnoticed.
+func (h *Handler) busyReason(ctx context.Context, info *types.ContainerJSON) string {
+	if info.State == nil || !info.State.Running || !publishesPorts(info) || info.Config == nil {
+		return ""
+	}
+	probe := strings.TrimSpace(info.Config.Labels[stopProbeLabel])
+	if probe == "" {
+		return ""
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, stopProbeTimeout)
+	defer cancel()
+	code, err := h.dockerClient.RunProbe(probeCtx, info.ID, probe)
+	if err != nil {
+		return fmt.Sprintf("stop probe failed: %v", err)
+	}
+	if code != 0 {
+		return fmt.Sprintf("stop probe reported active work (exit code %d)", code)
+	}
+	return ""
+}
+
+// publishesPorts reports whether any of a container's ports are bound on the host.
+func publishesPorts(info *types.ContainerJSON) bool {
+	if info.NetworkSettings == nil {
+		return false
+	}
+	for _, bindings := range info.NetworkSettings.Ports {
+		if len(bindings) > 0 {
+			return true
+		}
+	}
+	return false
+}
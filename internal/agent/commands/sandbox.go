@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSandboxTTL = 10 * time.Minute
+	minSandboxTTL     = 30 * time.Second
+	maxSandboxTTL     = 6 * time.Hour
+	// sandboxTeardownTimeout bounds the compose down run when a sandbox expires
+	sandboxTeardownTimeout = 2 * time.Minute
+	sandboxNameInfix       = "-sandbox-"
+)
+
+// sandboxNamePattern matches the temporary project names given to sandbox deployments.
+var sandboxNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*-sandbox-[0-9a-f]{8}$`)
+
+// sandboxDeployment is a sandbox stack awaiting teardown.
+type sandboxDeployment struct {
+	stack     string
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// sandboxTracker tears sandbox deployments down when their TTL expires or when they are
+// ended explicitly. Sandboxes live in memory only; ones left behind by an agent restart are
+// removed by TeardownStaleSandboxes.
+type sandboxTracker struct {
+	mu       sync.Mutex
+	entries  map[string]*sandboxDeployment
+	teardown func(ctx context.Context, name string) error
+}
+
+func newSandboxTracker(teardown func(ctx context.Context, name string) error) *sandboxTracker {
+	return &sandboxTracker{
+		entries:  make(map[string]*sandboxDeployment),
+		teardown: teardown,
+	}
+}
+
+// track schedules the teardown of a deployed sandbox and returns when it expires.
+func (t *sandboxTracker) track(name, stack string, ttl time.Duration) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := &sandboxDeployment{stack: stack, expiresAt: time.Now().Add(ttl)}
+	entry.timer = time.AfterFunc(ttl, func() { t.expire(name) })
+	t.entries[name] = entry
+	return entry.expiresAt
+}
+
+// take removes a sandbox from tracking and stops its timer. It reports false when the
+// sandbox is unknown or already being torn down.
+func (t *sandboxTracker) take(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[name]
+	if !ok {
+		return false
+	}
+	entry.timer.Stop()
+	delete(t.entries, name)
+	return true
+}
+
+func (t *sandboxTracker) expire(name string) {
+	if !t.take(name) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sandboxTeardownTimeout)
+	defer cancel()
+	if err := t.teardown(ctx, name); err != nil {
+		logrus.WithError(err).Errorf("Failed to tear down expired sandbox %s", name)
+		return
+	}
+	logrus.Infof("Tore down expired sandbox %s", name)
+}
+
+// end tears a sandbox down ahead of its TTL.
+func (t *sandboxTracker) end(ctx context.Context, name string) error {
+	if !t.take(name) {
+		return fmt.Errorf("sandbox %s not found", name)
+	}
+	return t.teardown(ctx, name)
+}
+
+func (t *sandboxTracker) tracked(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.entries[name]
+	return ok
+}
+
+// list returns the tracked sandboxes ordered by expiry.
+func (t *sandboxTracker) list() []map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.entries))
+	for name := range t.entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return t.entries[names[i]].expiresAt.Before(t.entries[names[j]].expiresAt)
+	})
+	out := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		entry := t.entries[name]
+		out = append(out, map[string]any{
+			"name":       name,
+			"stack_name": entry.stack,
+			"expires_at": entry.expiresAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+// sandboxName derives a unique temporary project name from the requested stack name.
+func sandboxName(stack string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate sandbox name: %w", err)
+	}
+	return strings.ToLower(strings.TrimSpace(stack)) + sandboxNameInfix + hex.EncodeToString(suffix), nil
+}
+
+// parseSandboxTTL reads the sandbox_ttl parameter, in seconds.
+func parseSandboxTTL(params map[string]any) (time.Duration, error) {
+	raw, ok := params["sandbox_ttl"]
+	if !ok || raw == nil {
+		return defaultSandboxTTL, nil
+	}
+	seconds, ok := raw.(float64)
+	if !ok || seconds != float64(int64(seconds)) {
+		return 0, fmt.Errorf("sandbox_ttl must be a whole number of seconds")
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if ttl < minSandboxTTL || ttl > maxSandboxTTL {
+		return 0, fmt.Errorf("sandbox_ttl must be between %s and %s", minSandboxTTL, maxSandboxTTL)
+	}
+	return ttl, nil
+}
+
+// deploySandbox deploys a compose file under a temporary project name and schedules its
+// teardown, so a compose file can be validated against the real host without leaving it
+// running. A failed deploy is torn down straight away.
+func (h *Handler) deploySandbox(ctx context.Context, commandID, stack, compose string, envVars map[string]interface{}, params map[string]any) (*protocol.Message, error) {
+	ttl, err := parseSandboxTTL(params)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	name, err := sandboxName(stack)
+	if err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	if err := h.composeClient.DeploySandboxStack(ctx, name, compose, envVars); err != nil {
+		if downErr := h.composeClient.RemoveStack(ctx, name); downErr != nil {
+			logrus.WithError(downErr).Warnf("Failed to clean up failed sandbox %s", name)
+		}
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+
+	expiresAt := h.sandboxes.track(name, stack, ttl)
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":    fmt.Sprintf("Sandbox for stack '%s' deployed as '%s'", stack, name),
+		"name":       name,
+		"stack_name": stack,
+		"sandbox":    true,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	}, nil), nil
+}
+
+// handleEndSandbox tears a sandbox deployment down before its TTL expires
+func (h *Handler) handleEndSandbox(ctx context.Context, commandID string, params map[string]any) (*protocol.Message, error) {
+	name, ok := params["name"].(string)
+	if !ok {
+		return protocol.NewResponse(commandID, "error", nil, errNameParameterRequired), nil
+	}
+	if err := h.sandboxes.end(ctx, name); err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message": fmt.Sprintf("Sandbox '%s' torn down", name),
+		"name":    name,
+	}, nil), nil
+}
+
+// handleListSandboxes lists sandbox deployments awaiting teardown
+func (h *Handler) handleListSandboxes(commandID string) (*protocol.Message, error) {
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"sandboxes": h.sandboxes.list(),
+	}, nil), nil
+}
+
+// TeardownStaleSandboxes removes sandbox stacks that are still running but no longer
+// tracked, which happens when the agent restarts before their TTL expires. A stack is only
+// removed when its containers carry the sandbox label as well as a sandbox name, so a
+// regular stack that happens to be named like one is left alone.
+func (h *Handler) TeardownStaleSandboxes(ctx context.Context) {
+	names, err := h.composeClient.ListSandboxStacks(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to list stacks for sandbox cleanup")
+		return
+	}
+	for _, name := range names {
+		if !sandboxNamePattern.MatchString(name) || h.sandboxes.tracked(name) {
+			continue
+		}
+		if err := h.composeClient.RemoveStack(ctx, name); err != nil {
+			logrus.WithError(err).Warnf("Failed to tear down stale sandbox %s", name)
+			continue
+		}
+		logrus.Infof("Tore down stale sandbox %s", name)
+	}
+}
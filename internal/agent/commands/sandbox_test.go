@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSandboxTrackerExpires(t *testing.T) {
+	torn := make(chan string, 1)
+	tracker := newSandboxTracker(func(ctx context.Context, name string) error {
+		torn <- name
+		return nil
+	})
+
+	tracker.track("web-sandbox-0011aabb", "web", 10*time.Millisecond)
+	if len(tracker.list()) != 1 {
+		t.Fatalf("expected sandbox to be listed, got %v", tracker.list())
+	}
+	select {
+	case name := <-torn:
+		if name != "web-sandbox-0011aabb" {
+			t.Fatalf("unexpected sandbox torn down: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected sandbox to be torn down after its TTL")
+	}
+	if tracker.tracked("web-sandbox-0011aabb") {
+		t.Fatal("expected expired sandbox to be untracked")
+	}
+}
+
+func TestSandboxTrackerEnd(t *testing.T) {
+	calls := 0
+	tracker := newSandboxTracker(func(ctx context.Context, name string) error {
+		calls++
+		return nil
+	})
+
+	tracker.track("web-sandbox-0011aabb", "web", time.Hour)
+	if err := tracker.end(context.Background(), "web-sandbox-0011aabb"); err != nil {
+		t.Fatalf("end returned error: %v", err)
+	}
+	if err := tracker.end(context.Background(), "web-sandbox-0011aabb"); err == nil {
+		t.Fatal("expected ending an unknown sandbox to fail")
+	}
+	if calls != 1 {
+		t.Fatalf("expected one teardown, got %d", calls)
+	}
+}
+
+func TestSandboxNameAndTTL(t *testing.T) {
+	name, err := sandboxName("My.App")
+	if err != nil || !sandboxNamePattern.MatchString(name) {
+		t.Fatalf("unexpected sandbox name %q err=%v", name, err)
+	}
+
+	if ttl, err := parseSandboxTTL(map[string]any{}); err != nil || ttl != defaultSandboxTTL {
+		t.Fatalf("expected default ttl, got %s err=%v", ttl, err)
+	}
+	if ttl, err := parseSandboxTTL(map[string]any{"sandbox_ttl": float64(120)}); err != nil || ttl != 2*time.Minute {
+		t.Fatalf("expected 2m ttl, got %s err=%v", ttl, err)
+	}
+	for _, raw := range []any{float64(5), float64(7 * 3600), "60", float64(90.5)} {
+		if _, err := parseSandboxTTL(map[string]any{"sandbox_ttl": raw}); err == nil {
+			t.Fatalf("expected sandbox_ttl %v to be rejected", raw)
+		}
+	}
+}
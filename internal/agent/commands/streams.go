@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+const defaultMaxConcurrentStreams = 16
+
+// activeStream is a stream running against the Docker daemon.
+type activeStream struct {
+	kind        string
+	containerID string
+	startedAt   time.Time
+	cancel      context.CancelFunc
+}
+
+// streamRegistry tracks the streams an agent has open. Each holds a goroutine and a Docker
+// connection until it ends, so their number is capped; requests beyond the cap are rejected
+// rather than queued since a stream may never finish.
+//
+// Only log streams are registered. The server relays a stats stream as one get_container_stats
+// command per sample, which takes an ordinary command slot and ends, so a stats stream holds
+// nothing on the agent between samples.
+type streamRegistry struct {
+	mu     sync.Mutex
+	limit  int
+	next   uint64
+	active map[string]*activeStream
+}
+
+func newStreamRegistry(limit int) *streamRegistry {
+	return &streamRegistry{
+		limit:  limit,
+		active: make(map[string]*activeStream),
+	}
+}
+
+// start registers a new stream and returns its ID with a context that is cancelled when the
+// stream is stopped. The returned release func must be called once the stream ends.
+func (r *streamRegistry) start(kind, containerID string) (string, context.Context, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.active) >= r.limit {
+		return "", nil, nil, fmt.Errorf("stream limit of %d reached; stop an open stream before starting another", r.limit)
+	}
+
+	r.next++
+	id := fmt.Sprintf("%s-%s-%d", kind, shortContainerID(containerID), r.next)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.active[id] = &activeStream{
+		kind:        kind,
+		containerID: containerID,
+		startedAt:   time.Now(),
+		cancel:      cancel,
+	}
+	release := func() {
+		cancel()
+		r.mu.Lock()
+		delete(r.active, id)
+		r.mu.Unlock()
+	}
+	return id, ctx, release, nil
+}
+
+// stop cancels a running stream; its slot is freed once the stream goroutine exits.
+func (r *streamRegistry) stop(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stream, ok := r.active[id]
+	if !ok {
+		return fmt.Errorf("stream %s not found", id)
+	}
+	stream.cancel()
+	return nil
+}
+
+func (r *streamRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.active)
+}
+
+// list returns the open streams, oldest first.
+func (r *streamRegistry) list() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.active))
+	for id := range r.active {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return r.active[ids[i]].startedAt.Before(r.active[ids[j]].startedAt)
+	})
+	out := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		stream := r.active[id]
+		out = append(out, map[string]any{
+			"stream_id":    id,
+			"kind":         stream.kind,
+			"container_id": stream.containerID,
+			"started_at":   stream.startedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// SetMaxConcurrentStreams limits how many log streams may be open at once. It must be called
+// before any command is handled. Non-positive limits keep the current one.
+func (h *Handler) SetMaxConcurrentStreams(limit int) {
+	if limit > 0 {
+		h.streams = newStreamRegistry(limit)
+	}
+}
+
+// handleStopStream stops an open stream
+func (h *Handler) handleStopStream(commandID string, params map[string]any) (*protocol.Message, error) {
+	id, ok := params["stream_id"].(string)
+	if !ok || id == "" {
+		return protocol.NewResponse(commandID, "error", nil, fmt.Errorf("stream_id parameter required")), nil
+	}
+	if err := h.streams.stop(id); err != nil {
+		return protocol.NewResponse(commandID, "error", nil, err), nil
+	}
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"message":   fmt.Sprintf("Stream '%s' stopped", id),
+		"stream_id": id,
+	}, nil), nil
+}
+
+// handleListStreams lists the streams the agent has open
+func (h *Handler) handleListStreams(commandID string) (*protocol.Message, error) {
+	return protocol.NewResponse(commandID, "success", map[string]any{
+		"streams": h.streams.list(),
+		"limit":   h.streams.limit,
+	}, nil), nil
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestStreamRegistryEnforcesLimit(t *testing.T) {
+	registry := newStreamRegistry(2)
+
+	first, firstCtx, releaseFirst, err := registry.start("logs", "0123456789abcdef")
+	if err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if _, _, _, err := registry.start("logs", "other"); err != nil {
+		t.Fatalf("start returned error: %v", err)
+	}
+	if _, _, _, err := registry.start("logs", "third"); err == nil {
+		t.Fatal("expected a stream beyond the limit to be rejected")
+	}
+
+	if err := registry.stop(first); err != nil {
+		t.Fatalf("stop returned error: %v", err)
+	}
+	if firstCtx.Err() == nil {
+		t.Fatal("expected stopping a stream to cancel its context")
+	}
+	// The slot is only freed once the stream goroutine has exited
+	if registry.count() != 2 {
+		t.Fatalf("expected stopped stream to hold its slot until released, got %d", registry.count())
+	}
+	releaseFirst()
+	if registry.count() != 1 {
+		t.Fatalf("expected 1 open stream after release, got %d", registry.count())
+	}
+	if _, _, _, err := registry.start("logs", "third"); err != nil {
+		t.Fatalf("expected a freed slot to be reusable: %v", err)
+	}
+
+	if err := registry.stop("missing"); err == nil {
+		t.Fatal("expected stopping an unknown stream to fail")
+	}
+	if streams := registry.list(); len(streams) != 2 || streams[0]["kind"] != "logs" {
+		t.Fatalf("unexpected stream list: %v", streams)
+	}
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCommandTimeout bounds queries and quick container operations
+	defaultCommandTimeout = 30 * time.Second
+	// longCommandTimeout bounds commands that pull images or run compose when the server did
+	// not ask for progress, since nothing then shows they are still making headway
+	longCommandTimeout = 30 * time.Minute
+	// progressIdleTimeout cancels a long command that streams progress once it has gone this
+	// long without reporting. It matches the longest idle timeout the server waits with.
+	progressIdleTimeout = 10 * time.Minute
+	// stopTimeoutMargin is allowed on top of a stop's grace period for the safe stop probe and
+	// for Docker to kill and reap the container
+	stopTimeoutMargin = 30 * time.Second
+)
+
+// longRunningActions pull images or run compose, which can take many minutes
+var longRunningActions = map[string]bool{
+	"deploy_stack":             true,
+	"update_stack":             true,
+	"remove_stack":             true,
+	"start_stack":              true,
+	"stop_stack":               true,
+	"restart_stack":            true,
+	"import_stack":             true,
+	"import_stack_from_path":   true,
+	"relabel_stack":            true,
+	"end_sandbox":              true,
+	"pull_images":              true,
+	"rolling_update_container": true,
+}
+
+type progressActivityKey struct{}
+
+// commandContext derives the context a command runs under from its action. Long running
+// actions that stream progress run until they stop reporting for progressIdleTimeout, and
+// for at most longCommandTimeout otherwise; stops and restarts get their grace period plus
+// stopTimeoutMargin; everything else gets defaultCommandTimeout.
+func (h *Handler) commandContext(parent context.Context, action string, params map[string]any) (context.Context, context.CancelFunc) {
+	if longRunningActions[action] {
+		if !h.streamsProgress(params) {
+			return context.WithTimeout(parent, longCommandTimeout)
+		}
+		ctx, cancel := context.WithCancel(parent)
+		idle := time.AfterFunc(progressIdleTimeout, cancel)
+		var mu sync.Mutex
+		ctx = context.WithValue(ctx, progressActivityKey{}, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			idle.Reset(progressIdleTimeout)
+		})
+		return ctx, func() {
+			idle.Stop()
+			cancel()
+		}
+	}
+
+	timeout := defaultCommandTimeout
+	if stopsContainer(action, params) {
+		if grace := time.Duration(h.stopTimeoutParam(params))*time.Second + stopTimeoutMargin; grace > timeout {
+			timeout = grace
+		}
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// stopsContainer reports whether a command stops a container and so waits for its grace period
+func stopsContainer(action string, params map[string]any) bool {
+	switch action {
+	case "stop_container", "restart_container":
+		return true
+	case "stack_container_action":
+		nested, _ := params["action"].(string)
+		return nested == "stop" || nested == "restart"
+	}
+	return false
+}
+
+// stopTimeoutParam returns the grace period, in seconds, requested with a command's timeout
+// parameter, or the default stop timeout
+func (h *Handler) stopTimeoutParam(params map[string]any) int {
+	if timeout, ok := params["timeout"].(float64); ok {
+		return int(timeout)
+	}
+	return h.stopTimeout
+}
+
+// markProgress records that a command reported progress, restarting its idle timeout
+func markProgress(ctx context.Context) {
+	if touch, ok := ctx.Value(progressActivityKey{}).(func()); ok {
+		touch()
+	}
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestCommandContextDeadlines(t *testing.T) {
+	handler := NewHandler(docker.NewClient(&commandDockerStub{}))
+	handler.SetDefaultStopTimeout(90 * time.Second)
+	handler.SetWebSocketClient(&progressRecorder{})
+
+	tests := []struct {
+		name   string
+		action string
+		params map[string]any
+		want   time.Duration
+	}{
+		{name: "query", action: "list_containers", want: defaultCommandTimeout},
+		{name: "stop with default grace", action: "stop_container", want: 90*time.Second + stopTimeoutMargin},
+		{name: "stop with explicit grace", action: "stop_container", params: map[string]any{"timeout": float64(5)}, want: 5*time.Second + stopTimeoutMargin},
+		{name: "stack container restart", action: "stack_container_action", params: map[string]any{"action": "restart"}, want: 90*time.Second + stopTimeoutMargin},
+		{name: "pull without progress", action: "pull_images", want: longCommandTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := handler.commandContext(context.Background(), tt.action, tt.params)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("expected a deadline")
+			}
+			if remaining := time.Until(deadline); remaining > tt.want || remaining < tt.want-5*time.Second {
+				t.Fatalf("expected a deadline about %s away, got %s", tt.want, remaining)
+			}
+		})
+	}
+
+	// Streaming commands run until they stop reporting progress
+	ctx, cancel := handler.commandContext(context.Background(), "deploy_stack", map[string]any{protocol.ParamStreamProgress: true})
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("expected no fixed deadline for a command that streams progress")
+	}
+	markProgress(ctx)
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatal("expected cancel to end the command context")
+	}
+}
+
+func TestHandleCommandPullImagesOutlivesQueryTimeout(t *testing.T) {
+	var hasDeadline bool
+	stub := &commandDockerStub{
+		imagePullFn: func(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+			_, hasDeadline = ctx.Deadline()
+			return io.NopCloser(strings.NewReader(`{"status":"Status: Image is up to date for ` + ref + `"}`)), nil
+		},
+	}
+	handler := NewHandler(docker.NewClient(stub))
+	handler.SetWebSocketClient(&progressRecorder{})
+
+	params := map[string]any{"images": []any{"nginx:latest"}, protocol.ParamStreamProgress: true}
+	if _, err := handler.HandleCommand(context.Background(), protocol.NewCommand("cmd-pull", "pull_images", params)); err != nil {
+		t.Fatalf("HandleCommand returned error: %v", err)
+	}
+	if hasDeadline {
+		t.Fatal("expected a streamed pull to be bounded by its progress, not a fixed deadline")
+	}
+}
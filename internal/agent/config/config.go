@@ -2,10 +2,18 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"time"
 
 	"github.com/mikeysoft/flotilla/internal/shared/config"
 )
 
+const (
+	defaultReadDeadline  = 60 * time.Second
+	defaultWriteDeadline = 10 * time.Second
+	minReadDeadline      = 2 * time.Second
+)
+
 // Config extends the shared agent configuration with agent-specific fields
 type Config struct {
 	config.AgentConfig
@@ -37,5 +45,141 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("agent name is required")
 	}
 
+	// A zero stop timeout keeps the built-in default
+	if c.StopTimeout != 0 && (c.StopTimeout < time.Second || c.StopTimeout > time.Hour || c.StopTimeout%time.Second != 0) {
+		return fmt.Errorf("stop timeout must be a whole number of seconds between 1s and 1h")
+	}
+
+	// A zero command limit keeps the built-in default
+	if c.MaxConcurrentCommands < 0 {
+		return fmt.Errorf("max concurrent commands must not be negative")
+	}
+	if c.MaxQueuedCommands < 0 {
+		return fmt.Errorf("max queued commands must not be negative")
+	}
+	if c.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("max concurrent streams must not be negative")
+	}
+	if c.OutboundBufferSize < 0 {
+		return fmt.Errorf("outbound buffer size must not be negative")
+	}
+	if c.ComposeImportRoot != "" && !filepath.IsAbs(c.ComposeImportRoot) {
+		return fmt.Errorf("compose import root must be an absolute path")
+	}
+
+	// Zero reconnect limits retry forever
+	if c.MaxReconnectAttempts < 0 || c.MaxReconnectDuration < 0 {
+		return fmt.Errorf("reconnect limits must not be negative")
+	}
+
+	if c.WSReadTimeout < 0 || c.WSWriteTimeout < 0 {
+		return fmt.Errorf("websocket read and write timeouts must not be negative")
+	}
+	switch c.MetricsMode {
+	case "", config.MetricsModeBoth, config.MetricsModeHost, config.MetricsModeContainers:
+	default:
+		return fmt.Errorf("metrics mode must be one of %s, %s or %s", config.MetricsModeBoth, config.MetricsModeHost, config.MetricsModeContainers)
+	}
+	if _, _, err := c.MetricsLabelSelectors(); err != nil {
+		return err
+	}
+	if _, err := c.DockerEndpointList(); err != nil {
+		return err
+	}
+	if _, _, err := c.LogExport(); err != nil {
+		return err
+	}
+	if c.LogExportBufferSize < 0 {
+		return fmt.Errorf("log export buffer size must not be negative")
+	}
+
+	if c.WSReadTimeout != 0 && c.WSReadTimeout < minReadDeadline {
+		return fmt.Errorf("websocket read timeout must be at least %s", minReadDeadline)
+	}
+
 	return nil
 }
+
+// ReadDeadline returns how long the agent waits for a message or pong from the server.
+func (c *Config) ReadDeadline() time.Duration {
+	if c.WSReadTimeout > 0 {
+		return c.WSReadTimeout
+	}
+	return defaultReadDeadline
+}
+
+// WriteDeadline returns how long a single WebSocket write may block.
+func (c *Config) WriteDeadline() time.Duration {
+	if c.WSWriteTimeout > 0 {
+		return c.WSWriteTimeout
+	}
+	return defaultWriteDeadline
+}
+
+// PingInterval returns how often the agent pings the server to keep the connection alive.
+// It is half the read deadline, so a pong delayed by up to a full ping period still arrives
+// before the deadline expires and the connection is not dropped under load.
+func (c *Config) PingInterval() time.Duration {
+	return c.ReadDeadline() / 2
+}
+
+// ReconnectExhausted reports why the agent should stop reconnecting after failures
+// consecutive failed attempts while disconnected for disconnectedFor, or nil to keep trying.
+func (c *Config) ReconnectExhausted(failures int, disconnectedFor time.Duration) error {
+	if c.MaxReconnectAttempts > 0 && failures >= c.MaxReconnectAttempts {
+		return fmt.Errorf("%d consecutive connection attempts failed", failures)
+	}
+	if c.MaxReconnectDuration > 0 && disconnectedFor >= c.MaxReconnectDuration {
+		return fmt.Errorf("disconnected for %s", disconnectedFor.Round(time.Second))
+	}
+	return nil
+}
+
+// Report returns the effective, non-secret configuration for display to operators. The API key
+// is reduced to whether one is set.
+func (c *Config) Report() map[string]any {
+	hostStats := fmt.Sprintf("%t", c.MetricsCollectHostStats)
+	if c.MetricsCollectHostStatsAuto {
+		hostStats = "auto"
+	}
+	return map[string]any{
+		"agent_name":              c.AgentName,
+		"server_url":              c.GetServerURL(),
+		"api_key_set":             c.APIKey != "",
+		"log_level":               c.LogLevel,
+		"log_format":              c.LogFormat,
+		"docker_socket":           c.DockerSocket,
+		"docker_endpoints":        c.DockerEndpoints,
+		"heartbeat_interval":      c.HeartbeatInterval.String(),
+		"reconnect_interval":      c.ReconnectInterval.String(),
+		"max_reconnect_attempts":  c.MaxReconnectAttempts,
+		"max_reconnect_duration":  c.MaxReconnectDuration.String(),
+		"exit_on_auth_failure":    c.ExitOnAuthFailure,
+		"stop_timeout":            c.StopTimeout.String(),
+		"max_concurrent_commands": c.MaxConcurrentCommands,
+		"max_queued_commands":     c.MaxQueuedCommands,
+		"max_concurrent_streams":  c.MaxConcurrentStreams,
+		"outbound_buffer_size":    c.OutboundBufferSize,
+		"compose_import_root":     c.ComposeImportRoot,
+		"ws_read_timeout":         c.ReadDeadline().String(),
+		"ws_write_timeout":        c.WriteDeadline().String(),
+		"ws_ping_interval":        c.PingInterval().String(),
+		"metrics": map[string]any{
+			"enabled":                  c.MetricsEnabled,
+			"collection_interval":      c.MetricsCollectionInterval.String(),
+			"mode":                     c.MetricsMode,
+			"collect_host_stats":       hostStats,
+			"collect_network":          c.MetricsCollectNetwork,
+			"collect_disk_io_fallback": c.MetricsCollectDiskIOFallback,
+			"include_labels":           c.MetricsIncludeLabels,
+			"exclude_labels":           c.MetricsExcludeLabels,
+			"host_cgroup_root":         c.HostCgroupRoot,
+			"host_proc_root":           c.HostProcRoot,
+		},
+		"log_export": map[string]any{
+			"url":         redactedURL(c.LogExportURL),
+			"labels":      c.LogExportLabels,
+			"buffer_size": c.LogExportBufferSize,
+		},
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	shared "github.com/mikeysoft/flotilla/internal/shared/config"
 )
@@ -66,6 +67,78 @@ func TestValidateErrors(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stop timeout below one second",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress: "localhost",
+					ServerPort:    8080,
+					APIKey:        "key",
+					AgentName:     "agent",
+					StopTimeout:   500 * time.Millisecond,
+				},
+			},
+		},
+		{
+			name: "stop timeout above one hour",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress: "localhost",
+					ServerPort:    8080,
+					APIKey:        "key",
+					AgentName:     "agent",
+					StopTimeout:   2 * time.Hour,
+				},
+			},
+		},
+		{
+			name: "read timeout too short",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress: "localhost",
+					ServerPort:    8080,
+					APIKey:        "key",
+					AgentName:     "agent",
+					WSReadTimeout: time.Second,
+				},
+			},
+		},
+		{
+			name: "unknown metrics mode",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress: "localhost",
+					ServerPort:    8080,
+					APIKey:        "key",
+					AgentName:     "agent",
+					MetricsMode:   "everything",
+				},
+			},
+		},
+		{
+			name: "negative command concurrency",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress:         "localhost",
+					ServerPort:            8080,
+					APIKey:                "key",
+					AgentName:             "agent",
+					MaxConcurrentCommands: -1,
+				},
+			},
+		},
+		{
+			name: "negative outbound buffer",
+			cfg: Config{
+				AgentConfig: shared.AgentConfig{
+					ServerAddress:      "localhost",
+					ServerPort:         8080,
+					APIKey:             "key",
+					AgentName:          "agent",
+					OutboundBufferSize: -1,
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -76,3 +149,67 @@ func TestValidateErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestWebSocketDeadlines(t *testing.T) {
+	cfg := &Config{}
+	if cfg.ReadDeadline() != defaultReadDeadline || cfg.WriteDeadline() != defaultWriteDeadline {
+		t.Fatalf("expected default deadlines, got read=%s write=%s", cfg.ReadDeadline(), cfg.WriteDeadline())
+	}
+
+	cfg.WSReadTimeout = 2 * time.Minute
+	cfg.WSWriteTimeout = 30 * time.Second
+	if cfg.ReadDeadline() != 2*time.Minute || cfg.WriteDeadline() != 30*time.Second {
+		t.Fatalf("expected configured deadlines, got read=%s write=%s", cfg.ReadDeadline(), cfg.WriteDeadline())
+	}
+	if cfg.PingInterval() != time.Minute {
+		t.Fatalf("expected ping interval of half the read deadline, got %s", cfg.PingInterval())
+	}
+}
+
+func TestReportRedactsAPIKey(t *testing.T) {
+	cfg := &Config{
+		AgentConfig: shared.AgentConfig{
+			ServerAddress:               "flotilla.example.com",
+			ServerPort:                  443,
+			ServerUseTLS:                true,
+			APIKey:                      "FLA_secret",
+			MetricsEnabled:              true,
+			MetricsCollectHostStatsAuto: true,
+		},
+	}
+
+	report := cfg.Report()
+	for key, value := range report {
+		if s, ok := value.(string); ok && s == "FLA_secret" {
+			t.Fatalf("API key leaked in %s", key)
+		}
+	}
+	if report["api_key_set"] != true {
+		t.Fatalf("expected api_key_set, got %#v", report["api_key_set"])
+	}
+	metrics, _ := report["metrics"].(map[string]any)
+	if metrics["collect_host_stats"] != "auto" || metrics["enabled"] != true {
+		t.Fatalf("unexpected metrics report: %#v", metrics)
+	}
+	if report["ws_ping_interval"] != "30s" {
+		t.Fatalf("expected default ping interval, got %#v", report["ws_ping_interval"])
+	}
+}
+
+func TestReconnectExhausted(t *testing.T) {
+	unlimited := &Config{}
+	if err := unlimited.ReconnectExhausted(1000, 24*time.Hour); err != nil {
+		t.Fatalf("zero limits should retry forever, got %v", err)
+	}
+
+	cfg := &Config{AgentConfig: shared.AgentConfig{MaxReconnectAttempts: 3, MaxReconnectDuration: time.Minute}}
+	if err := cfg.ReconnectExhausted(2, 30*time.Second); err != nil {
+		t.Fatalf("expected to keep retrying below both limits, got %v", err)
+	}
+	if err := cfg.ReconnectExhausted(3, 30*time.Second); err == nil {
+		t.Fatal("expected to give up after the maximum attempts")
+	}
+	if err := cfg.ReconnectExhausted(1, time.Minute); err == nil {
+		t.Fatal("expected to give up after the maximum disconnected time")
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxDockerEndpointName bounds the name of an additional Docker endpoint
+const maxDockerEndpointName = 32
+
+// DockerEndpoint is an additional Docker daemon managed by the agent. The server lists each
+// endpoint as a host of its own, reached through the agent's connection.
+type DockerEndpoint struct {
+	Name string
+	// Host is a Docker host address such as tcp://10.0.0.5:2375 or unix:///run/edge.sock
+	Host string
+}
+
+// ParseDockerEndpoints parses a comma separated list of name=host pairs such as
+// "build=tcp://10.0.0.5:2375,edge=unix:///run/edge.sock". Names are lower case letters,
+// digits, dashes and underscores, and must be unique. An empty string yields no endpoints.
+func ParseDockerEndpoints(raw string) ([]DockerEndpoint, error) {
+	var endpoints []DockerEndpoint
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, host, ok := strings.Cut(entry, "=")
+		name, host = strings.TrimSpace(name), strings.TrimSpace(host)
+		if !ok || name == "" || host == "" {
+			return nil, fmt.Errorf("invalid docker endpoint %q; expected name=host", entry)
+		}
+		if !validEndpointName(name) {
+			return nil, fmt.Errorf("invalid docker endpoint name %q; use up to %d lower case letters, digits, dashes and underscores", name, maxDockerEndpointName)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("docker endpoint %s is listed more than once", name)
+		}
+		seen[name] = true
+
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host for docker endpoint %s: %w", name, err)
+		}
+		switch parsed.Scheme {
+		case "tcp", "unix", "npipe":
+		default:
+			return nil, fmt.Errorf("docker endpoint %s must use a tcp://, unix:// or npipe:// host", name)
+		}
+		endpoints = append(endpoints, DockerEndpoint{Name: name, Host: host})
+	}
+	return endpoints, nil
+}
+
+func validEndpointName(name string) bool {
+	if len(name) > maxDockerEndpointName {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// DockerEndpointList parses the additional Docker endpoints the agent manages.
+func (c *Config) DockerEndpointList() ([]DockerEndpoint, error) {
+	endpoints, err := ParseDockerEndpoints(c.DockerEndpoints)
+	if err != nil {
+		return nil, fmt.Errorf("docker endpoints: %w", err)
+	}
+	return endpoints, nil
+}
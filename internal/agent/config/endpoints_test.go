@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestParseDockerEndpoints(t *testing.T) {
+	endpoints, err := ParseDockerEndpoints(" build=tcp://10.0.0.5:2375 , edge_1=unix:///run/edge.sock ")
+	if err != nil {
+		t.Fatalf("ParseDockerEndpoints() unexpected error: %v", err)
+	}
+	want := []DockerEndpoint{
+		{Name: "build", Host: "tcp://10.0.0.5:2375"},
+		{Name: "edge_1", Host: "unix:///run/edge.sock"},
+	}
+	if len(endpoints) != len(want) || endpoints[0] != want[0] || endpoints[1] != want[1] {
+		t.Fatalf("unexpected endpoints %#v", endpoints)
+	}
+
+	if endpoints, err := ParseDockerEndpoints(""); err != nil || len(endpoints) != 0 {
+		t.Fatalf("expected no endpoints, got %#v err=%v", endpoints, err)
+	}
+	for _, raw := range []string{
+		"build",
+		"=tcp://10.0.0.5:2375",
+		"Build=tcp://10.0.0.5:2375",
+		"build=10.0.0.5:2375",
+		"build=http://10.0.0.5:2375",
+		"build=tcp://a:1,build=tcp://b:1",
+	} {
+		if _, err := ParseDockerEndpoints(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LabelSelector is a list of container label requirements. Each requirement is one of key
+// (the label is set), !key (the label is not set), key=value or key!=value.
+type LabelSelector []LabelRequirement
+
+// LabelRequirement is a single requirement of a LabelSelector.
+type LabelRequirement struct {
+	Key   string
+	Value string
+	// Negated inverts the requirement: the label is absent, or differs from Value
+	Negated bool
+	// HasValue is set for key=value and key!=value requirements
+	HasValue bool
+}
+
+// ParseLabelSelector parses a comma separated list of label requirements such as
+// "com.docker.compose.project=web,!io.flotilla.sidecar". An empty string yields an empty
+// selector.
+func ParseLabelSelector(raw string) (LabelSelector, error) {
+	var selector LabelSelector
+	for _, term := range strings.Split(raw, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var requirement LabelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			requirement = LabelRequirement{Key: key, Value: value, Negated: true, HasValue: true}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(term, "=")
+			requirement = LabelRequirement{Key: key, Value: value, HasValue: true}
+		case strings.HasPrefix(term, "!"):
+			requirement = LabelRequirement{Key: strings.TrimPrefix(term, "!"), Negated: true}
+		default:
+			requirement = LabelRequirement{Key: term}
+		}
+
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if requirement.Key == "" || strings.ContainsAny(requirement.Key, "!= ") || strings.Contains(requirement.Value, "=") {
+			return nil, fmt.Errorf("invalid label requirement %q", term)
+		}
+		selector = append(selector, requirement)
+	}
+	return selector, nil
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	matched := ok
+	if r.HasValue {
+		matched = ok && value == r.Value
+	}
+	return matched != r.Negated
+}
+
+// MatchesAll reports whether labels satisfy every requirement. An empty selector matches
+// any labels.
+func (s LabelSelector) MatchesAll(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesAny reports whether labels satisfy at least one requirement. An empty selector
+// matches no labels.
+func (s LabelSelector) MatchesAny(labels map[string]string) bool {
+	for _, requirement := range s {
+		if requirement.Matches(labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricsLabelSelectors parses the label selectors limiting which containers metrics are
+// collected for. A container is collected when it matches every include requirement and
+// none of the exclude requirements.
+func (c *Config) MetricsLabelSelectors() (include, exclude LabelSelector, err error) {
+	if include, err = ParseLabelSelector(c.MetricsIncludeLabels); err != nil {
+		return nil, nil, fmt.Errorf("metrics include labels: %w", err)
+	}
+	if exclude, err = ParseLabelSelector(c.MetricsExcludeLabels); err != nil {
+		return nil, nil, fmt.Errorf("metrics exclude labels: %w", err)
+	}
+	return include, exclude, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import "testing"
+
+func TestParseLabelSelector(t *testing.T) {
+	selector, err := ParseLabelSelector(" com.docker.compose.project=web, !io.flotilla.sidecar ,tier!=debug,monitored ")
+	if err != nil {
+		t.Fatalf("ParseLabelSelector() unexpected error: %v", err)
+	}
+	want := LabelSelector{
+		{Key: "com.docker.compose.project", Value: "web", HasValue: true},
+		{Key: "io.flotilla.sidecar", Negated: true},
+		{Key: "tier", Value: "debug", Negated: true, HasValue: true},
+		{Key: "monitored"},
+	}
+	if len(selector) != len(want) {
+		t.Fatalf("expected %d requirements, got %#v", len(want), selector)
+	}
+	for i := range want {
+		if selector[i] != want[i] {
+			t.Fatalf("requirement %d = %#v, want %#v", i, selector[i], want[i])
+		}
+	}
+
+	if selector, err := ParseLabelSelector(""); err != nil || len(selector) != 0 {
+		t.Fatalf("expected an empty selector, got %#v err=%v", selector, err)
+	}
+	for _, raw := range []string{"=web", "!", "a b=c", "!key=value"} {
+		if _, err := ParseLabelSelector(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestLabelSelectorMatching(t *testing.T) {
+	labels := map[string]string{"com.docker.compose.project": "web", "tier": "frontend"}
+	cases := []struct {
+		raw      string
+		all, any bool
+	}{
+		{"", true, false},
+		{"tier", true, true},
+		{"!tier", false, false},
+		{"tier=frontend", true, true},
+		{"tier=backend", false, false},
+		{"tier!=backend", true, true},
+		{"com.docker.compose.project=web,io.flotilla.sidecar", false, true},
+		{"io.flotilla.sidecar,role=monitoring", false, false},
+	}
+	for _, tc := range cases {
+		selector, err := ParseLabelSelector(tc.raw)
+		if err != nil {
+			t.Fatalf("ParseLabelSelector(%q) unexpected error: %v", tc.raw, err)
+		}
+		if got := selector.MatchesAll(labels); got != tc.all {
+			t.Fatalf("MatchesAll(%q) = %t, want %t", tc.raw, got, tc.all)
+		}
+		if got := selector.MatchesAny(labels); got != tc.any {
+			t.Fatalf("MatchesAny(%q) = %t, want %t", tc.raw, got, tc.any)
+		}
+	}
+}
+
+func TestValidateRejectsInvalidMetricsLabels(t *testing.T) {
+	cfg := &Config{}
+	cfg.ServerAddress = "localhost"
+	cfg.ServerPort = 8080
+	cfg.AgentName = "agent"
+	cfg.MetricsExcludeLabels = "role=="
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected invalid exclude labels to be rejected")
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Log export sink kinds
+const (
+	LogExportSyslog = "syslog"
+	LogExportHTTP   = "http"
+)
+
+// LogExportTarget is the external endpoint container logs are forwarded to.
+type LogExportTarget struct {
+	// Kind is LogExportSyslog or LogExportHTTP
+	Kind string
+	// Network is "udp" or "tcp" for syslog targets
+	Network string
+	// Address is host:port for syslog targets and the full URL for HTTP targets
+	Address string
+}
+
+// ParseLogExportURL parses a log export URL: syslog+udp://host:port or syslog://host:port
+// for syslog over UDP, syslog+tcp://host:port for syslog over TCP, or an http:// or https://
+// URL that receives batches of log lines as JSON. An empty string disables export.
+func ParseLogExportURL(raw string) (*LogExportTarget, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log export URL: %w", err)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("log export URL %s has no host", parsed.Redacted())
+	}
+	switch parsed.Scheme {
+	case "syslog", "syslog+udp":
+		return &LogExportTarget{Kind: LogExportSyslog, Network: "udp", Address: syslogAddress(parsed)}, nil
+	case "syslog+tcp":
+		return &LogExportTarget{Kind: LogExportSyslog, Network: "tcp", Address: syslogAddress(parsed)}, nil
+	case "http", "https":
+		return &LogExportTarget{Kind: LogExportHTTP, Address: raw}, nil
+	default:
+		return nil, fmt.Errorf("log export URL must use syslog://, syslog+udp://, syslog+tcp://, http:// or https://")
+	}
+}
+
+// syslogAddress returns the host:port of a syslog URL, defaulting to port 514.
+func syslogAddress(parsed *url.URL) string {
+	if parsed.Port() == "" {
+		return net.JoinHostPort(parsed.Hostname(), "514")
+	}
+	return parsed.Host
+}
+
+// LogExport parses the log export target and the label selector choosing the containers
+// whose logs are exported. A nil target means export is disabled.
+func (c *Config) LogExport() (*LogExportTarget, LabelSelector, error) {
+	target, err := ParseLogExportURL(c.LogExportURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	selector, err := ParseLabelSelector(c.LogExportLabels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("log export labels: %w", err)
+	}
+	if target != nil && len(selector) == 0 {
+		return nil, nil, fmt.Errorf("log export labels are required when log export is enabled")
+	}
+	return target, selector, nil
+}
+
+// redactedURL hides the password of a URL for display.
+func redactedURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return parsed.Redacted()
+}
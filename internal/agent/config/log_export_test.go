@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestParseLogExportURL(t *testing.T) {
+	cases := map[string]LogExportTarget{
+		"syslog://logs.internal":          {Kind: LogExportSyslog, Network: "udp", Address: "logs.internal:514"},
+		"syslog+udp://10.0.0.9:5514":      {Kind: LogExportSyslog, Network: "udp", Address: "10.0.0.9:5514"},
+		"syslog+tcp://logs.internal:601":  {Kind: LogExportSyslog, Network: "tcp", Address: "logs.internal:601"},
+		"https://logs.example.com/ingest": {Kind: LogExportHTTP, Address: "https://logs.example.com/ingest"},
+	}
+	for raw, want := range cases {
+		target, err := ParseLogExportURL(raw)
+		if err != nil {
+			t.Fatalf("ParseLogExportURL(%q) unexpected error: %v", raw, err)
+		}
+		if *target != want {
+			t.Fatalf("ParseLogExportURL(%q) = %#v, want %#v", raw, *target, want)
+		}
+	}
+
+	if target, err := ParseLogExportURL(""); err != nil || target != nil {
+		t.Fatalf("expected export to be disabled, got %#v err=%v", target, err)
+	}
+	for _, raw := range []string{"logs.internal:514", "ftp://logs.internal", "syslog+tcp://"} {
+		if _, err := ParseLogExportURL(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestLogExportRequiresLabels(t *testing.T) {
+	cfg := &Config{}
+	cfg.LogExportURL = "syslog://logs.internal"
+	if _, _, err := cfg.LogExport(); err == nil {
+		t.Fatal("expected export without a label selector to be rejected")
+	}
+	cfg.LogExportLabels = "io.flotilla.log-export=true"
+	target, selector, err := cfg.LogExport()
+	if err != nil || target == nil || len(selector) != 1 {
+		t.Fatalf("unexpected log export %#v %v err=%v", target, selector, err)
+	}
+}
@@ -3,6 +3,11 @@ package docker
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -254,6 +259,78 @@ func (c *Client) ListContainersByImage(ctx context.Context, imageRefs []string)
 	return containers, nil
 }
 
+// RemoteImageDigest asks the registry which digest imageRef currently points to, without
+// pulling the image.
+func (c *Client) RemoteImageDigest(ctx context.Context, imageRef string) (string, error) {
+	inspect, err := c.api.DistributionInspect(ctx, imageRef, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to query the registry for %s: %w", imageRef, err)
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// PullResult summarises the outcome of an image pull.
+type PullResult struct {
+	Image   string `json:"image"`
+	Updated bool   `json:"updated"` // false when the local image was already up to date
+	Digest  string `json:"digest,omitempty"`
+}
+
+// pullMessage is a single progress record from the image pull stream.
+type pullMessage struct {
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// PullImage pulls an image and waits for the pull to finish, condensing the progress stream
+// into a single result.
+func (c *Client) PullImage(ctx context.Context, imageRef string) (*PullResult, error) {
+	reader, err := c.api.ImagePull(ctx, imageRef, types.ImagePullOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	result := &PullResult{Image: imageRef}
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg pullMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read pull progress for %s: %w", imageRef, err)
+		}
+		if msg.Error != "" {
+			return nil, fmt.Errorf("failed to pull %s: %s", imageRef, msg.Error)
+		}
+		if msg.ErrorDetail != nil && msg.ErrorDetail.Message != "" {
+			return nil, fmt.Errorf("failed to pull %s: %s", imageRef, msg.ErrorDetail.Message)
+		}
+		switch {
+		case strings.HasPrefix(msg.Status, "Digest: "):
+			result.Digest = strings.TrimPrefix(msg.Status, "Digest: ")
+		case strings.HasPrefix(msg.Status, "Status: Downloaded newer image"):
+			result.Updated = true
+		}
+	}
+
+	logrus.Infof("Pulled image: %s (updated=%t)", imageRef, result.Updated)
+	return result, nil
+}
+
+// ServerPlatform returns the operating system and architecture of the Docker daemon.
+func (c *Client) ServerPlatform(ctx context.Context) (string, string, error) {
+	version, err := c.api.ServerVersion(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return version.Os, version.Arch, nil
+}
+
 // PruneDanglingImages removes all dangling images from the host
 func (c *Client) PruneDanglingImages(ctx context.Context) (*types.ImagesPruneReport, error) {
 	args := filters.NewArgs(filters.Arg("dangling", "true"))
@@ -323,6 +400,12 @@ func (c *Client) GetContainerStats(ctx context.Context, containerID string) (*ty
 	return &containerStats, nil
 }
 
+// IsEmptyStats reports whether a stats sample is the empty one Docker returns for a
+// container that is not running.
+func IsEmptyStats(stats *types.Stats) bool {
+	return stats.Read.IsZero() && stats.CPUStats.CPUUsage.TotalUsage == 0
+}
+
 // GetContainerStatsJSON returns detailed statistics as StatsJSON
 func (c *Client) GetContainerStatsJSON(ctx context.Context, containerID string) (*types.StatsJSON, error) {
 	stats, err := c.api.ContainerStats(ctx, containerID, false)
@@ -456,6 +539,60 @@ func (c *Client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
 	return sys, nil
 }
 
+// RuntimeInfo describes the Docker endpoint the agent talks to and how the daemon runs
+// containers on the host.
+type RuntimeInfo struct {
+	DockerHost      string   `json:"docker_host,omitempty"`
+	EndpointType    string   `json:"endpoint_type,omitempty"` // unix, npipe, tcp, ssh, ...
+	DefaultRuntime  string   `json:"default_runtime"`
+	Runtimes        []string `json:"runtimes"`
+	ContainerdID    string   `json:"containerd_commit,omitempty"`
+	RuncID          string   `json:"runc_commit,omitempty"`
+	StorageDriver   string   `json:"storage_driver"`
+	CgroupDriver    string   `json:"cgroup_driver"`
+	CgroupVersion   string   `json:"cgroup_version"`
+	OperatingSystem string   `json:"operating_system"`
+	KernelVersion   string   `json:"kernel_version"`
+	Architecture    string   `json:"architecture"`
+	SecurityOptions []string `json:"security_options"`
+}
+
+// GetRuntimeInfo reports the Docker endpoint in use and the daemon's runtime, storage and
+// cgroup setup.
+func (c *Client) GetRuntimeInfo(ctx context.Context) (*RuntimeInfo, error) {
+	info, err := c.api.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make([]string, 0, len(info.Runtimes))
+	for name := range info.Runtimes {
+		runtimes = append(runtimes, name)
+	}
+	sort.Strings(runtimes)
+
+	runtime := &RuntimeInfo{
+		DefaultRuntime:  info.DefaultRuntime,
+		Runtimes:        runtimes,
+		ContainerdID:    info.ContainerdCommit.ID,
+		RuncID:          info.RuncCommit.ID,
+		StorageDriver:   info.Driver,
+		CgroupDriver:    info.CgroupDriver,
+		CgroupVersion:   info.CgroupVersion,
+		OperatingSystem: info.OperatingSystem,
+		KernelVersion:   info.KernelVersion,
+		Architecture:    info.Architecture,
+		SecurityOptions: info.SecurityOptions,
+	}
+	if api, ok := c.api.(interface{ DaemonHost() string }); ok {
+		runtime.DockerHost = api.DaemonHost()
+		if scheme, _, found := strings.Cut(runtime.DockerHost, "://"); found {
+			runtime.EndpointType = scheme
+		}
+	}
+	return runtime, nil
+}
+
 func clampInt64ToUint64(v int64) uint64 {
 	if v <= 0 {
 		return 0
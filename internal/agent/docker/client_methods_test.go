@@ -5,12 +5,14 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -49,6 +51,26 @@ func TestClientStartStopRestartRemove(t *testing.T) {
 	}
 }
 
+func TestClientRunProbe(t *testing.T) {
+	api := &fakeDockerAPI{execPolls: 2, execExitCode: 3}
+	client := NewClient(api)
+
+	code, err := client.RunProbe(context.Background(), "ctr-probe", "test -z \"$(ls /work)\"")
+	if err != nil || code != 3 {
+		t.Fatalf("expected exit code 3, got %d err=%v", code, err)
+	}
+	if api.execContainer != "ctr-probe" || strings.Join(api.execCmd, " ") != `/bin/sh -c test -z "$(ls /work)"` {
+		t.Fatalf("unexpected probe exec: %s %v", api.execContainer, api.execCmd)
+	}
+
+	api.execPolls = 1000
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.RunProbe(ctx, "ctr-probe", "sleep 60"); err == nil {
+		t.Fatal("expected a probe that never finishes to fail")
+	}
+}
+
 func TestClientListImagesNetworksVolumes(t *testing.T) {
 	api := &fakeDockerAPI{
 		images: []types.ImageSummary{{ID: "img"}},
@@ -214,11 +236,51 @@ func TestClientGetEvents(t *testing.T) {
 	}
 }
 
+func TestClientPullImage(t *testing.T) {
+	api := &fakeDockerAPI{
+		pullStream: `{"status":"Pulling from library/nginx"}
+{"status":"Digest: sha256:abc"}
+{"status":"Status: Downloaded newer image for nginx:latest"}
+`,
+	}
+	client := NewClient(api)
+
+	result, err := client.PullImage(context.Background(), "nginx:latest")
+	if err != nil {
+		t.Fatalf("PullImage returned error: %v", err)
+	}
+	if api.pullRef != "nginx:latest" || !result.Updated || result.Digest != "sha256:abc" {
+		t.Fatalf("unexpected pull result: %#v", result)
+	}
+
+	api.pullStream = `{"errorDetail":{"message":"pull access denied"},"error":"pull access denied"}`
+	if _, err := client.PullImage(context.Background(), "private/app"); err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Fatalf("expected pull error, got %v", err)
+	}
+}
+
+func TestClientRemoteImageDigest(t *testing.T) {
+	api := &fakeDockerAPI{distribution: v1.Descriptor{Digest: "sha256:abc"}}
+	client := NewClient(api)
+
+	digest, err := client.RemoteImageDigest(context.Background(), "nginx:latest")
+	if err != nil {
+		t.Fatalf("RemoteImageDigest returned error: %v", err)
+	}
+	if api.distributionRef != "nginx:latest" || digest != "sha256:abc" {
+		t.Fatalf("unexpected registry digest %q for %q", digest, api.distributionRef)
+	}
+	if api.pullRef != "" {
+		t.Fatalf("expected no pull, got one for %q", api.pullRef)
+	}
+}
+
 type assertError string
 
 func (e assertError) Error() string { return string(e) }
 
 type fakeDockerAPI struct {
+	containers    []types.Container
 	listOptions   types.ContainerListOptions
 	listAncestors []string
 
@@ -267,12 +329,24 @@ type fakeDockerAPI struct {
 
 	imagesDeleted []types.ImageDeleteResponseItem
 	imageListOpts types.ImageListOptions
+
+	pullRef    string
+	pullStream string
+	pullErr    error
+
+	distributionRef string
+	distribution    v1.Descriptor
+
+	execContainer string
+	execCmd       []string
+	execPolls     int
+	execExitCode  int
 }
 
 func (f *fakeDockerAPI) ContainerList(ctx context.Context, opts types.ContainerListOptions) ([]types.Container, error) {
 	f.listOptions = opts
 	f.listAncestors = opts.Filters.Get("ancestor")
-	return nil, nil
+	return f.containers, nil
 }
 
 func (f *fakeDockerAPI) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
@@ -330,6 +404,28 @@ func (f *fakeDockerAPI) ContainerCreate(ctx context.Context, cfg *container.Conf
 	return f.createResponse, nil
 }
 
+func (f *fakeDockerAPI) ContainerRename(ctx context.Context, id, name string) error {
+	return nil
+}
+
+func (f *fakeDockerAPI) ContainerExecCreate(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+	f.execContainer = id
+	f.execCmd = config.Cmd
+	return types.IDResponse{ID: "exec-1"}, nil
+}
+
+func (f *fakeDockerAPI) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	return nil
+}
+
+func (f *fakeDockerAPI) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	if f.execPolls > 0 {
+		f.execPolls--
+		return types.ContainerExecInspect{ExecID: execID, Running: true}, nil
+	}
+	return types.ContainerExecInspect{ExecID: execID, ExitCode: f.execExitCode}, nil
+}
+
 func (f *fakeDockerAPI) ImageList(ctx context.Context, opts types.ImageListOptions) ([]types.ImageSummary, error) {
 	f.imageListOpts = opts
 	return f.images, nil
@@ -363,6 +459,10 @@ func (f *fakeDockerAPI) NetworkRemove(ctx context.Context, id string) error {
 	return nil
 }
 
+func (f *fakeDockerAPI) NetworkConnect(ctx context.Context, networkID, containerID string, cfg *network.EndpointSettings) error {
+	return nil
+}
+
 func (f *fakeDockerAPI) VolumeList(ctx context.Context, opts volume.ListOptions) (volume.ListResponse, error) {
 	if f.volumes != nil {
 		return *f.volumes, nil
@@ -397,3 +497,16 @@ func (f *fakeDockerAPI) Info(ctx context.Context) (types.Info, error) {
 func (f *fakeDockerAPI) ServerVersion(ctx context.Context) (types.Version, error) {
 	return f.versionResult, nil
 }
+
+func (f *fakeDockerAPI) ImagePull(ctx context.Context, ref string, opts types.ImagePullOptions) (io.ReadCloser, error) {
+	f.pullRef = ref
+	if f.pullErr != nil {
+		return nil, f.pullErr
+	}
+	return io.NopCloser(strings.NewReader(f.pullStream)), nil
+}
+
+func (f *fakeDockerAPI) DistributionInspect(ctx context.Context, ref, auth string) (registry.DistributionInspect, error) {
+	f.distributionRef = ref
+	return registry.DistributionInspect{Descriptor: f.distribution}, nil
+}
@@ -218,6 +218,14 @@ type stubDockerAPI struct {
 	containerStartFn  func(ctx context.Context, id string, opts types.ContainerStartOptions) error
 	containerRemoveFn func(ctx context.Context, id string, opts types.ContainerRemoveOptions) error
 	eventsFn          func(ctx context.Context, opts types.EventsOptions) (<-chan events.Message, <-chan error)
+	pingFn            func(ctx context.Context) (types.Ping, error)
+}
+
+func (s *stubDockerAPI) Ping(ctx context.Context) (types.Ping, error) {
+	if s.pingFn != nil {
+		return s.pingFn(ctx)
+	}
+	return types.Ping{}, nil
 }
 
 func (s *stubDockerAPI) Info(ctx context.Context) (types.Info, error) {
@@ -2,11 +2,14 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,40 +22,71 @@ const (
 	dockerComposeFileName  = "docker-compose.yml"
 	envFileName            = ".env"
 	composeProjectLabel    = "com.docker.compose.project"
+	composeServiceLabel    = "com.docker.compose.service"
+	composeWorkingDirLabel = "com.docker.compose.project.working_dir"
+	composeConfigLabel     = "com.docker.compose.project.config_files"
 	flotillaManagedLabel   = "io.flotilla.managed"
 	flotillaStackNameLabel = "io.flotilla.stack.name"
 	flotillaDeployedLabel  = "io.flotilla.deployed.timestamp"
-	composeDirPerm         = 0o750
-	composeFilePerm        = 0o600
+	// flotillaOneshotLabel marks services that are meant to run once and exit, such as
+	// migrations, so their stopped containers are not reported as needing attention
+	flotillaOneshotLabel = "io.flotilla.oneshot"
+	// flotillaSandboxLabel marks the containers of sandbox deployments, which the agent tears
+	// down by itself
+	flotillaSandboxLabel = "io.flotilla.sandbox"
+	composeDirPerm       = 0o750
+	composeFilePerm      = 0o600
+	maxComposeFileSize   = 1 << 20
+	// defaultComposeWorkDir holds the compose files of stacks deployed through Flotilla
+	defaultComposeWorkDir = "/tmp/flotilla-compose"
+	// defaultEndpointComposeWorkDir holds, in a directory per endpoint, the compose files of
+	// stacks deployed to additional Docker endpoints. It is kept apart from
+	// defaultComposeWorkDir so stale stack cleanup there never touches endpoint stacks.
+	defaultEndpointComposeWorkDir = "/tmp/flotilla-compose-endpoints"
 )
 
 var (
 	errDockerComposeOutput    = "Docker compose output: %s"
 	errFailedToListContainers = "failed to list containers: %w"
 	stackNamePattern          = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
-	composeArgPattern         = regexp.MustCompile(`^[A-Za-z0-9/_:@.=+-]+$`)
+	// exitCodePattern extracts the exit code from a container status like "Exited (1) 2 hours ago"
+	exitCodePattern   = regexp.MustCompile(`^Exited \((-?\d+)\)`)
+	composeArgPattern = regexp.MustCompile(`^[A-Za-z0-9/_:@.=+-]+$`)
+	// composeFileNames are the file names compose looks for in a project directory
+	composeFileNames = map[string]struct{}{
+		"compose.yaml":        {},
+		"compose.yml":         {},
+		"docker-compose.yaml": {},
+		"docker-compose.yml":  {},
+	}
 )
 
+// execCommand creates the compose processes; tests replace it to observe them
+var execCommand = exec.CommandContext
+
 // runCompose tries Docker Compose v2 first ("docker compose"), then falls back to v1 ("docker-compose").
-func runCompose(ctx context.Context, workDir string, args ...string) ([]byte, error) {
+// Compose talks to the daemon the client manages.
+func (c *ComposeClient) runCompose(ctx context.Context, workDir string, args ...string) ([]byte, error) {
 	if err := validateComposeArgs(args); err != nil {
 		return nil, err
 	}
+	env := composeEnv(c.dockerHost)
+
 	// Try v2: docker compose <args>
 	v2Args := append([]string{"compose"}, args...)
-	cmdV2 := exec.CommandContext(ctx, "docker", v2Args...) // #nosec G204 -- command name fixed and args validated by validateComposeArgs
+	cmdV2 := execCommand(ctx, "docker", v2Args...) // #nosec G204 -- command name fixed and args validated by validateComposeArgs
 	cmdV2.Dir = workDir
-	cmdV2.Env = os.Environ()
-	outV2, errV2 := cmdV2.CombinedOutput()
+	cmdV2.Env = env
+	outV2, errV2 := combinedOutput(ctx, cmdV2)
 	if errV2 == nil {
 		return outV2, nil
 	}
 
 	// Try v1: docker-compose <args>
-	cmdV1 := exec.CommandContext(ctx, "docker-compose", args...) // #nosec G204 -- command name fixed and args validated by validateComposeArgs
+	cmdV1 := execCommand(ctx, "docker-compose", args...) // #nosec G204 -- command name fixed and args validated by validateComposeArgs
 	cmdV1.Dir = workDir
-	cmdV1.Env = os.Environ()
-	outV1, errV1 := cmdV1.CombinedOutput()
+	cmdV1.Env = env
+	outV1, errV1 := combinedOutput(ctx, cmdV1)
 	if errV1 == nil {
 		return outV1, nil
 	}
@@ -67,10 +101,40 @@ func runCompose(ctx context.Context, workDir string, args ...string) ([]byte, er
 	return nil, fmt.Errorf("docker compose failed: v2 error: %w; v1 error: %w", errV2, errV1)
 }
 
+// composeEnv returns the environment compose runs with. A non-empty dockerHost replaces
+// DOCKER_HOST, and drops any DOCKER_CONTEXT that would take precedence over it, so compose
+// reaches that daemon rather than the agent's own.
+func composeEnv(dockerHost string) []string {
+	env := os.Environ()
+	if dockerHost == "" {
+		return env
+	}
+	filtered := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "DOCKER_HOST=") || strings.HasPrefix(kv, "DOCKER_CONTEXT=") {
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	return append(filtered, "DOCKER_HOST="+dockerHost)
+}
+
+// ErrComposeUnavailable is returned for stack operations when the agent could not set up
+// compose, for instance because its working directory could not be created
+var ErrComposeUnavailable = errors.New("compose unavailable")
+
 // ComposeClient handles Docker Compose operations
 type ComposeClient struct {
 	dockerClient *Client
 	workDir      string
+	// dockerHost is the daemon compose targets for an additional endpoint; empty uses the
+	// agent's own environment
+	dockerHost string
+	// importRoot is a host directory, besides workDir, whose compose projects may be adopted
+	// by reading their files in place; empty allows workDir only
+	importRoot string
+	// initErr records why compose could not be set up; nil when it is usable
+	initErr error
 }
 
 func sanitizeStackName(name string) (string, error) {
@@ -93,18 +157,49 @@ func validateComposeArgs(args []string) error {
 	return nil
 }
 
-// NewComposeClient creates a new compose client
+// NewComposeClient creates a new compose client. A working directory that cannot be created,
+// such as on a read-only or full disk, leaves the client unavailable rather than failing, so
+// the agent keeps serving everything that does not need compose.
 func NewComposeClient(dockerClient *Client) *ComposeClient {
-	// Create a temporary directory for compose files
-	workDir := "/tmp/flotilla-compose"
-	if err := os.MkdirAll(workDir, composeDirPerm); err != nil {
-		logrus.WithError(err).Fatal("failed to create compose working directory")
-	}
+	return newComposeClient(dockerClient, defaultComposeWorkDir)
+}
+
+// NewEndpointComposeClient creates a compose client for an additional Docker endpoint. Compose
+// runs against the endpoint's daemon at dockerHost, and its stack files are kept in a
+// working directory of the endpoint's own so they never overwrite the files of a stack of
+// the same name on another daemon.
+func NewEndpointComposeClient(dockerClient *Client, endpoint, dockerHost string) *ComposeClient {
+	return newEndpointComposeClient(dockerClient, defaultEndpointComposeWorkDir, endpoint, dockerHost)
+}
+
+func newEndpointComposeClient(dockerClient *Client, baseDir, endpoint, dockerHost string) *ComposeClient {
+	client := newComposeClient(dockerClient, filepath.Join(baseDir, endpoint))
+	client.dockerHost = dockerHost
+	return client
+}
 
-	return &ComposeClient{
+func newComposeClient(dockerClient *Client, workDir string) *ComposeClient {
+	client := &ComposeClient{
 		dockerClient: dockerClient,
 		workDir:      workDir,
 	}
+	if err := os.MkdirAll(workDir, composeDirPerm); err != nil {
+		logrus.WithError(err).Error("Failed to create compose working directory; stack commands are disabled")
+		client.initErr = fmt.Errorf("%w: failed to create working directory %s: %v", ErrComposeUnavailable, workDir, err)
+	}
+	return client
+}
+
+// SetImportRoot sets the directory, besides the compose working directory, that compose files
+// of existing projects may be read from when they are adopted.
+func (c *ComposeClient) SetImportRoot(root string) {
+	c.importRoot = root
+}
+
+// Available returns nil when compose can be used, or an error wrapping ErrComposeUnavailable
+// that explains why it cannot.
+func (c *ComposeClient) Available() error {
+	return c.initErr
 }
 
 func (c *ComposeClient) safeStackDir(stackName string) (string, string, error) {
@@ -115,8 +210,8 @@ func (c *ComposeClient) safeStackDir(stackName string) (string, string, error) {
 	return filepath.Join(c.workDir, safeName), safeName, nil
 }
 
-// injectFlotillaLabels adds Flotilla management labels to compose file
-func injectFlotillaLabels(composeContent, stackName string) (string, error) {
+// injectFlotillaLabels adds Flotilla management labels, and any extra labels, to compose file
+func injectFlotillaLabels(composeContent, stackName string, extra map[string]string) (string, error) {
 	var config map[string]interface{}
 	if err := yaml.Unmarshal([]byte(composeContent), &config); err != nil {
 		return "", fmt.Errorf("failed to parse compose file: %w", err)
@@ -132,41 +227,25 @@ func injectFlotillaLabels(composeContent, stackName string) (string, error) {
 
 	// Add labels to each service
 	timestamp := time.Now().UTC().Format(time.RFC3339)
-	for _, service := range services {
+	for serviceName, service := range services {
 		serviceMap, ok := service.(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		// Initialize labels section if it doesn't exist
-		if _, exists := serviceMap["labels"]; !exists {
-			serviceMap["labels"] = make(map[string]interface{})
-		}
-
-		labels, ok := serviceMap["labels"].(map[string]interface{})
-		if !ok {
-			// Convert array format to map if needed
-			if labelsArr, ok := serviceMap["labels"].([]interface{}); ok {
-				labels = make(map[string]interface{})
-				for _, label := range labelsArr {
-					if labelStr, ok := label.(string); ok {
-						parts := strings.SplitN(labelStr, "=", 2)
-						if len(parts) == 2 {
-							labels[parts[0]] = parts[1]
-						}
-					}
-				}
-				serviceMap["labels"] = labels
-			} else {
-				serviceMap["labels"] = make(map[string]interface{})
-				labels = serviceMap["labels"].(map[string]interface{})
-			}
+		labels, err := normalizeComposeLabels(serviceMap["labels"])
+		if err != nil {
+			return "", fmt.Errorf("service %s: %w", serviceName, err)
 		}
+		serviceMap["labels"] = labels
 
 		// Add Flotilla labels
 		labels[flotillaManagedLabel] = "true"
 		labels[flotillaStackNameLabel] = stackName
 		labels[flotillaDeployedLabel] = timestamp
+		for key, value := range extra {
+			labels[key] = value
+		}
 	}
 
 	// Marshal back to YAML
@@ -178,12 +257,96 @@ func injectFlotillaLabels(composeContent, stackName string) (string, error) {
 	return string(result), nil
 }
 
+// normalizeComposeLabels converts a service's labels, given either as a mapping or as a list
+// of key=value entries, into a mapping with string values. YAML decodes unquoted numbers,
+// booleans, timestamps and empty values as non-strings; they are rendered as compose would
+// read them so re-marshalling keeps them valid.
+func normalizeComposeLabels(value interface{}) (map[string]interface{}, error) {
+	labels := make(map[string]interface{})
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, raw := range v {
+			str, err := composeLabelValue(key, raw)
+			if err != nil {
+				return nil, err
+			}
+			labels[key] = str
+		}
+	case map[interface{}]interface{}:
+		for rawKey, raw := range v {
+			key := fmt.Sprint(rawKey)
+			str, err := composeLabelValue(key, raw)
+			if err != nil {
+				return nil, err
+			}
+			labels[key] = str
+		}
+	case []interface{}:
+		for _, item := range v {
+			entry, err := composeLabelValue("", item)
+			if err != nil {
+				return nil, err
+			}
+			key, val, _ := strings.Cut(entry, "=")
+			if key == "" {
+				continue
+			}
+			labels[key] = val
+		}
+	default:
+		return nil, fmt.Errorf("labels must be a mapping or a list, got %T", value)
+	}
+	return labels, nil
+}
+
+// composeLabelValue renders a scalar label value as a string. Nested mappings and lists are
+// not valid label values.
+func composeLabelValue(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(time.DateOnly), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		if key == "" {
+			return "", fmt.Errorf("label entries must be scalar values, got %T", value)
+		}
+		return "", fmt.Errorf("label %s must be a scalar value, got %T", key, value)
+	}
+}
+
 // DeployStack deploys a new stack from a compose file
 func (c *ComposeClient) DeployStack(ctx context.Context, stackName, composeContent string, envVars map[string]interface{}) error {
+	return c.deployStack(ctx, stackName, composeContent, envVars, nil)
+}
+
+// DeploySandboxStack deploys a stack like DeployStack, labelling its containers as a sandbox
+// so that cleanup can tell them apart from regular stacks.
+func (c *ComposeClient) DeploySandboxStack(ctx context.Context, stackName, composeContent string, envVars map[string]interface{}) error {
+	return c.deployStack(ctx, stackName, composeContent, envVars, map[string]string{flotillaSandboxLabel: "true"})
+}
+
+func (c *ComposeClient) deployStack(ctx context.Context, stackName, composeContent string, envVars map[string]interface{}, labels map[string]string) error {
 	logrus.Infof("Deploying stack: %s", stackName)
 
 	// Inject Flotilla management labels
-	composeWithLabels, err := injectFlotillaLabels(composeContent, stackName)
+	composeWithLabels, err := injectFlotillaLabels(composeContent, stackName, labels)
 	if err != nil {
 		logrus.Warnf("Failed to inject Flotilla labels: %v, deploying without labels", err)
 		composeWithLabels = composeContent
@@ -198,26 +361,23 @@ func (c *ComposeClient) DeployStack(ctx context.Context, stackName, composeConte
 		return fmt.Errorf("failed to create stack directory: %w", err)
 	}
 
+	// Create .env file if env vars are provided; it is written first so invalid variables
+	// fail the deploy before anything else changes
+	if len(envVars) > 0 {
+		envPath := filepath.Join(stackDir, envFileName)
+		if err := writeEnvFile(envPath, envVars); err != nil {
+			return fmt.Errorf("failed to write .env file: %w", err)
+		}
+	}
+
 	// Write compose file
 	composePath := filepath.Join(stackDir, dockerComposeFileName)
 	if err := os.WriteFile(composePath, []byte(composeWithLabels), composeFilePerm); err != nil {
 		return fmt.Errorf("failed to write compose file: %w", err)
 	}
 
-	// Create .env file if env vars are provided
-	if len(envVars) > 0 {
-		envPath := filepath.Join(stackDir, envFileName)
-		envLines := []string{}
-		for k, v := range envVars {
-			envLines = append(envLines, fmt.Sprintf("%s=%v", k, v))
-		}
-		if err := os.WriteFile(envPath, []byte(strings.Join(envLines, "\n")), composeFilePerm); err != nil {
-			logrus.Warnf("Failed to write .env file: %v", err)
-		}
-	}
-
 	// Execute compose up
-	output, err := runCompose(ctx, stackDir, "-p", safeName, "up", "-d")
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "up", "-d")
 	if err != nil {
 		logrus.Errorf(errDockerComposeOutput, string(output))
 		return fmt.Errorf("failed to deploy stack: %w", err)
@@ -232,7 +392,7 @@ func (c *ComposeClient) UpdateStack(ctx context.Context, stackName, composeConte
 	logrus.Infof("Updating stack: %s", stackName)
 
 	// Inject Flotilla management labels
-	composeWithLabels, err := injectFlotillaLabels(composeContent, stackName)
+	composeWithLabels, err := injectFlotillaLabels(composeContent, stackName, nil)
 	if err != nil {
 		logrus.Warnf("Failed to inject Flotilla labels: %v, updating without labels", err)
 		composeWithLabels = composeContent
@@ -244,26 +404,23 @@ func (c *ComposeClient) UpdateStack(ctx context.Context, stackName, composeConte
 		return fmt.Errorf("invalid stack name: %w", err)
 	}
 
+	// Update .env file if env vars are provided; it is written first so invalid variables
+	// fail the update before the compose file changes
+	if len(envVars) > 0 {
+		envPath := filepath.Join(stackDir, envFileName)
+		if err := writeEnvFile(envPath, envVars); err != nil {
+			return fmt.Errorf("failed to write .env file: %w", err)
+		}
+	}
+
 	// Write updated compose file
 	composePath := filepath.Join(stackDir, dockerComposeFileName)
 	if err := os.WriteFile(composePath, []byte(composeWithLabels), composeFilePerm); err != nil {
 		return fmt.Errorf("failed to write compose file: %w", err)
 	}
 
-	// Update .env file if env vars are provided
-	if len(envVars) > 0 {
-		envPath := filepath.Join(stackDir, envFileName)
-		envLines := []string{}
-		for k, v := range envVars {
-			envLines = append(envLines, fmt.Sprintf("%s=%v", k, v))
-		}
-		if err := os.WriteFile(envPath, []byte(strings.Join(envLines, "\n")), composeFilePerm); err != nil {
-			logrus.Warnf("Failed to write .env file: %v", err)
-		}
-	}
-
 	// Execute compose up with --force-recreate
-	output, err := runCompose(ctx, stackDir, "-p", safeName, "up", "-d", "--force-recreate")
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "up", "-d", "--force-recreate")
 	if err != nil {
 		logrus.Errorf(errDockerComposeOutput, string(output))
 		return fmt.Errorf("failed to update stack: %w", err)
@@ -289,7 +446,7 @@ func (c *ComposeClient) RemoveStack(ctx context.Context, stackName string) error
 		// Try to remove anyway using docker-compose with the stack name
 	} else {
 		// Execute compose down
-		output, err := runCompose(ctx, stackDir, "-p", safeName, "down", "-v")
+		output, err := c.runCompose(ctx, stackDir, "-p", safeName, "down", "-v")
 		if err != nil {
 			logrus.Errorf(errDockerComposeOutput, string(output))
 			return fmt.Errorf("failed to remove stack: %w", err)
@@ -305,6 +462,27 @@ func (c *ComposeClient) RemoveStack(ctx context.Context, stackName string) error
 	return nil
 }
 
+// ListSandboxStacks returns the names of the compose projects whose containers are labelled
+// as a sandbox deployment.
+func (c *ComposeClient) ListSandboxStacks(ctx context.Context) ([]string, error) {
+	containers, err := c.dockerClient.ListContainers(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToListContainers, err)
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for _, container := range containers {
+		project := container.Labels[composeProjectLabel]
+		if project == "" || container.Labels[flotillaSandboxLabel] != "true" || seen[project] {
+			continue
+		}
+		seen[project] = true
+		names = append(names, project)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // ListStacks lists all stacks by inspecting containers with compose labels
 func (c *ComposeClient) ListStacks(ctx context.Context) ([]map[string]interface{}, error) {
 	logrus.Debug("Listing stacks")
@@ -392,6 +570,7 @@ func (c *ComposeClient) ListStacks(ctx context.Context) ([]map[string]interface{
 			"compose_content":     composeContent,
 			"managed_by_flotilla": managedByFlotilla,
 			"created_at":          createdAt,
+			"services":            stackServiceBreakdown(containers),
 		}
 
 		stacks = append(stacks, stack)
@@ -401,6 +580,153 @@ func (c *ComposeClient) ListStacks(ctx context.Context) ([]map[string]interface{
 	return stacks, nil
 }
 
+// DiscoverStacks lists compose projects on the host that are not yet managed by Flotilla so
+// they can be imported.
+func (c *ComposeClient) DiscoverStacks(ctx context.Context) ([]map[string]interface{}, error) {
+	containers, err := c.dockerClient.ListContainers(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToListContainers, err)
+	}
+	return unmanagedStacks(containers), nil
+}
+
+// unmanagedStacks groups containers by compose project and returns the projects that have no
+// Flotilla-managed containers, sorted by name.
+func unmanagedStacks(containers []types.Container) []map[string]interface{} {
+	projects := map[string][]types.Container{}
+	for _, container := range containers {
+		if project, ok := container.Labels[composeProjectLabel]; ok && project != "" {
+			projects[project] = append(projects[project], container)
+		}
+	}
+
+	names := make([]string, 0, len(projects))
+	for name, members := range projects {
+		managed := false
+		for _, container := range members {
+			if container.Labels[flotillaManagedLabel] == "true" {
+				managed = true
+				break
+			}
+		}
+		if !managed {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	stacks := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		members := projects[name]
+		services := map[string]struct{}{}
+		running := 0
+		workingDir, configFiles := "", ""
+		for _, container := range members {
+			services[container.Labels[composeServiceLabel]] = struct{}{}
+			if container.State == "running" {
+				running++
+			}
+			if workingDir == "" {
+				workingDir = container.Labels[composeWorkingDirLabel]
+			}
+			if configFiles == "" {
+				configFiles = container.Labels[composeConfigLabel]
+			}
+		}
+		_, nameErr := sanitizeStackName(name)
+		stacks = append(stacks, map[string]interface{}{
+			"name":         name,
+			"services":     len(services),
+			"containers":   len(members),
+			"running":      running,
+			"working_dir":  workingDir,
+			"config_files": configFiles,
+			"importable":   nameErr == nil,
+		})
+	}
+	return stacks
+}
+
+// containerFailed reports whether a stopped container exited with a non-zero code.
+func containerFailed(container types.Container) bool {
+	match := exitCodePattern.FindStringSubmatch(container.Status)
+	return match != nil && match[1] != "0"
+}
+
+// stackServiceBreakdown summarises a stack's containers per compose service, listing the
+// images in use and the containers of each service that are not running. Services labeled
+// io.flotilla.oneshot=true are flagged, along with those of their containers that failed.
+func stackServiceBreakdown(containers []types.Container) []map[string]interface{} {
+	type serviceState struct {
+		total   int
+		running int
+		down    []string
+		failed  []string
+		oneshot bool
+		images  map[string]struct{}
+	}
+	services := map[string]*serviceState{}
+	for _, container := range containers {
+		name := container.Labels[composeServiceLabel]
+		if name == "" {
+			name = "unknown"
+		}
+		state, ok := services[name]
+		if !ok {
+			state = &serviceState{down: []string{}, failed: []string{}, images: map[string]struct{}{}}
+			services[name] = state
+		}
+		if oneshot, _ := strconv.ParseBool(container.Labels[flotillaOneshotLabel]); oneshot {
+			state.oneshot = true
+		}
+		state.total++
+		if container.Image != "" {
+			state.images[container.Image] = struct{}{}
+		}
+		if container.State == "running" {
+			state.running++
+			continue
+		}
+		containerName := container.ID
+		if len(container.Names) > 0 {
+			containerName = strings.TrimPrefix(container.Names[0], "/")
+		}
+		state.down = append(state.down, containerName)
+		if containerFailed(container) {
+			state.failed = append(state.failed, containerName)
+		}
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	breakdown := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		state := services[name]
+		images := make([]string, 0, len(state.images))
+		for image := range state.images {
+			images = append(images, image)
+		}
+		sort.Strings(images)
+		service := map[string]interface{}{
+			"name":            name,
+			"containers":      state.total,
+			"running":         state.running,
+			"down_containers": state.down,
+			"images":          images,
+		}
+		if state.oneshot {
+			service["oneshot"] = true
+			service["failed_containers"] = state.failed
+		}
+		breakdown = append(breakdown, service)
+	}
+	return breakdown
+}
+
 // GetStack retrieves detailed information about a specific stack
 func (c *ComposeClient) GetStack(ctx context.Context, stackName string) (map[string]interface{}, error) {
 	logrus.Debugf("Getting stack details: %s", stackName)
@@ -461,13 +787,7 @@ func (c *ComposeClient) GetStack(ctx context.Context, stackName string) (map[str
 	if _, err := os.Stat(envPath); err == nil {
 		content, err := os.ReadFile(envPath) // #nosec G304 -- envPath constrained within sanitized stack directory
 		if err == nil {
-			envLines := strings.Split(string(content), "\n")
-			for _, line := range envLines {
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					envVars[parts[0]] = parts[1]
-				}
-			}
+			envVars = parseEnvFile(string(content))
 		}
 	}
 
@@ -509,7 +829,7 @@ func (c *ComposeClient) StartStack(ctx context.Context, stackName string) error
 		return fmt.Errorf("invalid stack name: %w", err)
 	}
 
-	output, err := runCompose(ctx, stackDir, "-p", safeName, "start")
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "start")
 	if err != nil {
 		logrus.Errorf(errDockerComposeOutput, string(output))
 		return fmt.Errorf("failed to start stack: %w", err)
@@ -528,7 +848,7 @@ func (c *ComposeClient) StopStack(ctx context.Context, stackName string) error {
 		return fmt.Errorf("invalid stack name: %w", err)
 	}
 
-	output, err := runCompose(ctx, stackDir, "-p", safeName, "stop")
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "stop")
 	if err != nil {
 		logrus.Errorf(errDockerComposeOutput, string(output))
 		return fmt.Errorf("failed to stop stack: %w", err)
@@ -547,7 +867,7 @@ func (c *ComposeClient) RestartStack(ctx context.Context, stackName string) erro
 		return fmt.Errorf("invalid stack name: %w", err)
 	}
 
-	output, err := runCompose(ctx, stackDir, "-p", safeName, "restart")
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "restart")
 	if err != nil {
 		logrus.Errorf(errDockerComposeOutput, string(output))
 		return fmt.Errorf("failed to restart stack: %w", err)
@@ -616,36 +936,252 @@ func (c *ComposeClient) ImportStack(ctx context.Context, stackName, composeConte
 		return fmt.Errorf("failed to create stack directory: %w", err)
 	}
 
+	// Write .env file if env vars are provided; invalid variables fail the import
+	if len(envVars) > 0 {
+		envPath := filepath.Join(stackDir, envFileName)
+		if err := writeEnvFile(envPath, envVars); err != nil {
+			return fmt.Errorf("failed to write .env file: %w", err)
+		}
+	}
+
 	// Write compose file
 	composePath := filepath.Join(stackDir, dockerComposeFileName)
 	if err := os.WriteFile(composePath, []byte(composeContent), composeFilePerm); err != nil {
 		return fmt.Errorf("failed to write compose file: %w", err)
 	}
 
-	// Write .env file if env vars are provided
-	if len(envVars) > 0 {
-		envPath := filepath.Join(stackDir, envFileName)
-		envLines := []string{}
-		for k, v := range envVars {
-			envLines = append(envLines, fmt.Sprintf("%s=%v", k, v))
+	logrus.Infof("Stack imported successfully: %s", stackName)
+	return nil
+}
+
+// ProjectComposeFile is a compose file read from the host for an existing compose project.
+type ProjectComposeFile struct {
+	Path    string
+	Content string
+	EnvVars map[string]interface{}
+}
+
+// ReadProjectComposeFile reads the compose file of an existing compose project from the host so
+// it can be adopted without re-uploading it. The path must be one of the compose files recorded
+// on the project's containers, or a standard compose file name directly inside the project's
+// working directory; an empty path selects the first recorded file. A .env file next to the
+// compose file is read as the project's env vars.
+//
+// Anyone able to start a container can set the compose labels, so the path, with symlinks
+// resolved, must also lie under the compose working directory or the configured import root.
+func (c *ComposeClient) ReadProjectComposeFile(ctx context.Context, stackName, path string) (*ProjectComposeFile, error) {
+	containers, err := c.dockerClient.ListContainers(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToListContainers, err)
+	}
+
+	allowed, workingDirs, found := projectComposeLocations(containers, stackName)
+	if !found {
+		return nil, fmt.Errorf("stack '%s' not found - no containers with matching project label", stackName)
+	}
+
+	if path == "" {
+		for candidate := range allowed {
+			if path == "" || candidate < path {
+				path = candidate
+			}
 		}
-		if err := os.WriteFile(envPath, []byte(strings.Join(envLines, "\n")), composeFilePerm); err != nil {
-			logrus.Warnf("Failed to write .env file: %v", err)
+		if path == "" {
+			return nil, fmt.Errorf("stack '%s' does not record its compose file; a path is required", stackName)
 		}
 	}
 
-	logrus.Infof("Stack imported successfully: %s", stackName)
-	return nil
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return nil, fmt.Errorf("compose path must be an absolute, clean path")
+	}
+	if _, recorded := allowed[path]; !recorded {
+		_, standardName := composeFileNames[filepath.Base(path)]
+		_, inProject := workingDirs[filepath.Dir(path)]
+		if !standardName || !inProject {
+			return nil, fmt.Errorf("compose path %s does not belong to stack '%s'", path, stackName)
+		}
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file (is the project directory mounted into the agent?): %w", err)
+	}
+	if !c.importAllowed(resolved) {
+		return nil, fmt.Errorf("compose path %s is outside the directories stacks may be imported from; set AGENT_COMPOSE_IMPORT_ROOT to allow it", path)
+	}
+
+	content, err := readRegularFile(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file (is the project directory mounted into the agent?): %w", err)
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	if services, ok := doc["services"].(map[string]interface{}); !ok || len(services) == 0 {
+		return nil, fmt.Errorf("compose file %s defines no services", path)
+	}
+
+	file := &ProjectComposeFile{Path: path, Content: string(content), EnvVars: map[string]interface{}{}}
+	envContent, err := readRegularFile(filepath.Join(filepath.Dir(resolved), envFileName))
+	switch {
+	case err == nil:
+		file.EnvVars = parseEnvFile(string(envContent))
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read .env file: %w", err)
+	}
+	return file, nil
+}
+
+// projectComposeLocations returns the compose files and working directories recorded on the
+// containers of a compose project, and whether the project has any containers.
+func projectComposeLocations(containers []types.Container, stackName string) (map[string]struct{}, map[string]struct{}, bool) {
+	files := map[string]struct{}{}
+	dirs := map[string]struct{}{}
+	found := false
+	for _, container := range containers {
+		if container.Labels[composeProjectLabel] != stackName {
+			continue
+		}
+		found = true
+		if dir := container.Labels[composeWorkingDirLabel]; dir != "" {
+			dirs[filepath.Clean(dir)] = struct{}{}
+		}
+		for _, file := range strings.Split(container.Labels[composeConfigLabel], ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files[filepath.Clean(file)] = struct{}{}
+			}
+		}
+	}
+	return files, dirs, found
+}
+
+// importAllowed reports whether a path with its symlinks resolved lies under the compose
+// working directory or the import root.
+func (c *ComposeClient) importAllowed(resolved string) bool {
+	for _, root := range []string{c.workDir, c.importRoot} {
+		if root == "" {
+			continue
+		}
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
 
-// CleanupStaleStacks removes stacks that no longer have any containers
-func (c *ComposeClient) CleanupStaleStacks(ctx context.Context) error {
+// readRegularFile reads a size-limited regular file, refusing symlinks so a project directory
+// cannot point the agent at arbitrary host files.
+func readRegularFile(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if info.Size() > maxComposeFileSize {
+		return nil, fmt.Errorf("%s exceeds the %d byte limit", path, maxComposeFileSize)
+	}
+	return os.ReadFile(path) // #nosec G304 -- path validated against the project's compose labels
+}
+
+// RelabelStack re-applies Flotilla management labels to a stack's containers and returns the
+// names of containers that were missing them. Docker cannot change labels on an existing
+// container, so the labels are written into the stored compose file and compose recreates the
+// affected services. With dryRun set, the mislabeled containers are reported and nothing is
+// changed.
+func (c *ComposeClient) RelabelStack(ctx context.Context, stackName string, dryRun bool) ([]string, error) {
+	logrus.Infof("Relabeling stack: %s (dry run: %t)", stackName, dryRun)
+
+	containers, err := c.dockerClient.ListContainers(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToListContainers, err)
+	}
+
+	stackFound := false
+	for _, container := range containers {
+		if project, ok := container.Labels[composeProjectLabel]; ok && project == stackName {
+			stackFound = true
+			break
+		}
+	}
+	if !stackFound {
+		return nil, fmt.Errorf("stack not found: %s", stackName)
+	}
+
+	mislabeled := mislabeledStackContainers(containers, stackName)
+	if dryRun || len(mislabeled) == 0 {
+		return mislabeled, nil
+	}
+
+	stackDir, safeName, err := c.safeStackDir(stackName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stack name: %w", err)
+	}
+	composePath := filepath.Join(stackDir, dockerComposeFileName)
+	content, err := os.ReadFile(composePath) // #nosec G304 -- composePath derived from sanitized stack directory
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("stack %s has no stored compose file; import it before relabeling", stackName)
+		}
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	composeWithLabels, err := injectFlotillaLabels(string(content), stackName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(composePath, []byte(composeWithLabels), composeFilePerm); err != nil {
+		return nil, fmt.Errorf("failed to write compose file: %w", err)
+	}
+
+	// compose recreates only the services whose configuration (labels) changed
+	output, err := c.runCompose(ctx, stackDir, "-p", safeName, "up", "-d")
+	if err != nil {
+		logrus.Errorf(errDockerComposeOutput, string(output))
+		return nil, fmt.Errorf("failed to recreate stack containers: %w", err)
+	}
+
+	logrus.Infof("Stack relabeled successfully: %s (%d containers recreated)", stackName, len(mislabeled))
+	return mislabeled, nil
+}
+
+// mislabeledStackContainers returns the names of a stack's containers whose Flotilla labels are
+// missing or do not match the stack.
+func mislabeledStackContainers(containers []types.Container, stackName string) []string {
+	mislabeled := []string{}
+	for _, container := range containers {
+		if project, ok := container.Labels[composeProjectLabel]; !ok || project != stackName {
+			continue
+		}
+		if container.Labels[flotillaManagedLabel] == "true" && container.Labels[flotillaStackNameLabel] == stackName {
+			continue
+		}
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		mislabeled = append(mislabeled, name)
+	}
+	return mislabeled
+}
+
+// CleanupStaleStacks removes stack directories that no longer have any containers and returns
+// the names of the removed directories. With dryRun set, the orphaned directories are only
+// reported.
+func (c *ComposeClient) CleanupStaleStacks(ctx context.Context, dryRun bool) ([]string, error) {
 	logrus.Debug("Cleaning up stale stacks")
 
 	// List all containers
 	containers, err := c.dockerClient.ListContainers(ctx, true)
 	if err != nil {
-		return fmt.Errorf("failed to list containers: %w", err)
+		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 
 	// Get all active stack names
@@ -660,24 +1196,32 @@ func (c *ComposeClient) CleanupStaleStacks(ctx context.Context) error {
 	entries, err := os.ReadDir(c.workDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return []string{}, nil
 		}
-		return fmt.Errorf("failed to read work directory: %w", err)
+		return nil, fmt.Errorf("failed to read work directory: %w", err)
 	}
 
 	// Remove directories for inactive stacks
+	orphaned := []string{}
 	for _, entry := range entries {
 		name := entry.Name()
-		if entry.IsDir() && stackNamePattern.MatchString(name) && !activeStacks[name] {
-			stackDir := filepath.Join(c.workDir, name)
-			logrus.Infof("Removing stale stack directory: %s", stackDir)
-			if err := os.RemoveAll(stackDir); err != nil {
-				logrus.Warnf("Failed to remove stale stack directory: %v", err)
-			}
+		if !entry.IsDir() || !stackNamePattern.MatchString(name) || activeStacks[name] {
+			continue
+		}
+		if dryRun {
+			orphaned = append(orphaned, name)
+			continue
 		}
+		stackDir := filepath.Join(c.workDir, name)
+		logrus.Infof("Removing stale stack directory: %s", stackDir)
+		if err := os.RemoveAll(stackDir); err != nil {
+			logrus.Warnf("Failed to remove stale stack directory: %v", err)
+			continue
+		}
+		orphaned = append(orphaned, name)
 	}
 
-	return nil
+	return orphaned, nil
 }
 
 // GetStackContainers returns detailed info about containers in a stack
@@ -693,7 +1237,7 @@ func (c *ComposeClient) GetStackContainers(ctx context.Context, stackName string
 	for _, container := range containers {
 		if project, ok := container.Labels[composeProjectLabel]; ok && project == stackName {
 			// Extract service name from labels
-			serviceName := container.Labels["com.docker.compose.service"]
+			serviceName := container.Labels[composeServiceLabel]
 
 			stackContainers = append(stackContainers, map[string]interface{}{
 				"id":           container.ID,
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+type outputHandlerKey struct{}
+
+// WithOutputHandler returns a context under which compose commands pass each line of their
+// output to handle as it is written, so long deployments can report progress.
+func WithOutputHandler(ctx context.Context, handle func(line string)) context.Context {
+	return context.WithValue(ctx, outputHandlerKey{}, handle)
+}
+
+// combinedOutput runs cmd like exec.Cmd.CombinedOutput, also streaming its output line by
+// line to the handler set on ctx with WithOutputHandler, if any.
+func combinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	handle, _ := ctx.Value(outputHandlerKey{}).(func(string))
+	if handle == nil {
+		return cmd.CombinedOutput()
+	}
+
+	var output bytes.Buffer
+	lines := &lineWriter{handle: handle}
+	writer := &lockedWriter{buf: &output, lines: lines}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	err := cmd.Run()
+	lines.flush()
+	return output.Bytes(), err
+}
+
+// lockedWriter collects output written concurrently to stdout and stderr.
+type lockedWriter struct {
+	mu    sync.Mutex
+	buf   *bytes.Buffer
+	lines *lineWriter
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	w.lines.write(p)
+	return len(p), nil
+}
+
+// lineWriter splits written output into lines; compose redraws progress with carriage
+// returns, which are treated as line ends too.
+type lineWriter struct {
+	handle  func(string)
+	partial []byte
+}
+
+func (w *lineWriter) write(p []byte) {
+	for _, b := range p {
+		if b != '\n' && b != '\r' {
+			w.partial = append(w.partial, b)
+			continue
+		}
+		w.flush()
+	}
+}
+
+func (w *lineWriter) flush() {
+	line := strings.TrimSpace(string(w.partial))
+	w.partial = w.partial[:0]
+	if line != "" {
+		w.handle(line)
+	}
+}
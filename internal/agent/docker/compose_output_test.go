@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+)
+
+func TestCombinedOutputStreamsLines(t *testing.T) {
+	var lines []string
+	ctx := WithOutputHandler(context.Background(), func(line string) {
+		lines = append(lines, line)
+	})
+
+	cmd := exec.Command("sh", "-c", `printf 'Pulling web\n Pulling 10%%\r Pulling 100%%\n' ; printf 'Started' >&2`)
+	output, err := combinedOutput(ctx, cmd)
+	if err != nil {
+		t.Fatalf("combinedOutput returned error: %v", err)
+	}
+	if string(output) != "Pulling web\n Pulling 10%\r Pulling 100%\nStarted" {
+		t.Fatalf("unexpected output: %q", output)
+	}
+	want := []string{"Pulling web", "Pulling 10%", "Pulling 100%", "Started"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected lines %q, got %q", want, lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("expected lines %q, got %q", want, lines)
+		}
+	}
+}
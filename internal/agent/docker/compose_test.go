@@ -1,9 +1,16 @@
 package docker
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/docker/docker/api/types"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,7 +20,7 @@ services:
   app:
     image: nginx:latest
 `
-	result, err := injectFlotillaLabels(input, "test-stack")
+	result, err := injectFlotillaLabels(input, "test-stack", nil)
 	if err != nil {
 		t.Fatalf("injectFlotillaLabels returned error: %v", err)
 	}
@@ -45,7 +52,7 @@ services:
     labels:
       - "custom.label=value"
 `
-	result, err := injectFlotillaLabels(input, "array-stack")
+	result, err := injectFlotillaLabels(input, "array-stack", nil)
 	if err != nil {
 		t.Fatalf("injectFlotillaLabels returned error: %v", err)
 	}
@@ -63,11 +70,81 @@ services:
 	}
 }
 
+func TestInjectFlotillaLabelsNonStringValues(t *testing.T) {
+	input := `
+services:
+  web:
+    image: nginx
+    labels:
+      traefik.enable: true
+      traefik.http.services.web.loadbalancer.server.port: 8080
+      ratio: 0.5
+      empty:
+      released: 2024-01-02
+  worker:
+    image: alpine
+    labels:
+      - 42
+      - "flag"
+      - "priority=10"
+  legacy:
+    image: alpine
+    labels:
+      1: one
+`
+	result, err := injectFlotillaLabels(input, "typed-stack", nil)
+	if err != nil {
+		t.Fatalf("injectFlotillaLabels returned error: %v", err)
+	}
+
+	var parsed map[string]any
+	if err := yaml.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("failed to parse output yaml: %v", err)
+	}
+	services := parsed["services"].(map[string]any)
+	web := services["web"].(map[string]any)["labels"].(map[string]any)
+	expected := map[string]string{
+		"traefik.enable": "true",
+		"traefik.http.services.web.loadbalancer.server.port": "8080",
+		"ratio":    "0.5",
+		"empty":    "",
+		"released": "2024-01-02",
+	}
+	for key, want := range expected {
+		if web[key] != want {
+			t.Fatalf("expected label %s to be the string %q, got %#v", key, want, web[key])
+		}
+	}
+
+	worker := services["worker"].(map[string]any)["labels"].(map[string]any)
+	if worker["42"] != "" || worker["flag"] != "" || worker["priority"] != "10" || worker[flotillaManagedLabel] != "true" {
+		t.Fatalf("unexpected worker labels: %#v", worker)
+	}
+	legacy := services["legacy"].(map[string]any)["labels"].(map[string]any)
+	if legacy["1"] != "one" || legacy[flotillaStackNameLabel] != "typed-stack" {
+		t.Fatalf("unexpected legacy labels: %#v", legacy)
+	}
+}
+
+func TestInjectFlotillaLabelsRejectsNestedLabelValues(t *testing.T) {
+	input := `
+services:
+  web:
+    image: nginx
+    labels:
+      nested:
+        key: value
+`
+	if _, err := injectFlotillaLabels(input, "bad-stack", nil); err == nil {
+		t.Fatal("expected nested label value to be rejected")
+	}
+}
+
 func TestInjectFlotillaLabelsNoServices(t *testing.T) {
 	input := `
 version: "3.9"
 `
-	result, err := injectFlotillaLabels(input, "no-services")
+	result, err := injectFlotillaLabels(input, "no-services", nil)
 	if err != nil {
 		t.Fatalf("injectFlotillaLabels returned error: %v", err)
 	}
@@ -75,3 +152,338 @@ version: "3.9"
 		t.Fatalf("expected compose content unchanged when no services section present")
 	}
 }
+
+func TestMislabeledStackContainers(t *testing.T) {
+	containers := []types.Container{
+		{ID: "a", Names: []string{"/web-1"}, Labels: map[string]string{
+			composeProjectLabel:    "web",
+			flotillaManagedLabel:   "true",
+			flotillaStackNameLabel: "web",
+		}},
+		{ID: "b", Names: []string{"/web-2"}, Labels: map[string]string{
+			composeProjectLabel: "web",
+		}},
+		{ID: "c", Names: []string{"/web-3"}, Labels: map[string]string{
+			composeProjectLabel:    "web",
+			flotillaManagedLabel:   "true",
+			flotillaStackNameLabel: "other",
+		}},
+		{ID: "d", Names: []string{"/db-1"}, Labels: map[string]string{
+			composeProjectLabel: "db",
+		}},
+	}
+
+	got := mislabeledStackContainers(containers, "web")
+	if len(got) != 2 || got[0] != "web-2" || got[1] != "web-3" {
+		t.Fatalf("unexpected mislabeled containers: %#v", got)
+	}
+}
+
+func TestCleanupStaleStacks(t *testing.T) {
+	workDir := t.TempDir()
+	for _, name := range []string{"active", "orphan"} {
+		if err := os.Mkdir(filepath.Join(workDir, name), 0o750); err != nil {
+			t.Fatalf("failed to create stack dir: %v", err)
+		}
+	}
+
+	api := &fakeDockerAPI{
+		containers: []types.Container{{ID: "a", Labels: map[string]string{composeProjectLabel: "active"}}},
+	}
+	compose := &ComposeClient{dockerClient: NewClient(api), workDir: workDir}
+
+	orphaned, err := compose.CleanupStaleStacks(context.Background(), true)
+	if err != nil {
+		t.Fatalf("CleanupStaleStacks dry run returned error: %v", err)
+	}
+	if len(orphaned) != 1 || orphaned[0] != "orphan" {
+		t.Fatalf("unexpected orphaned stacks: %#v", orphaned)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "orphan")); err != nil {
+		t.Fatalf("dry run should not remove directories: %v", err)
+	}
+
+	removed, err := compose.CleanupStaleStacks(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CleanupStaleStacks returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "orphan" {
+		t.Fatalf("unexpected removed stacks: %#v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "orphan")); !os.IsNotExist(err) {
+		t.Fatalf("expected orphan directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "active")); err != nil {
+		t.Fatalf("active stack directory should remain: %v", err)
+	}
+}
+
+func TestStackServiceBreakdown(t *testing.T) {
+	containers := []types.Container{
+		{ID: "1", Names: []string{"/web-api-1"}, State: "running", Labels: map[string]string{composeServiceLabel: "api"}},
+		{ID: "2", Names: []string{"/web-api-2"}, State: "exited", Labels: map[string]string{composeServiceLabel: "api"}},
+		{ID: "3", Names: []string{"/web-db-1"}, State: "running", Labels: map[string]string{composeServiceLabel: "db"}},
+	}
+
+	breakdown := stackServiceBreakdown(containers)
+	if len(breakdown) != 2 || breakdown[0]["name"] != "api" || breakdown[1]["name"] != "db" {
+		t.Fatalf("unexpected breakdown: %#v", breakdown)
+	}
+	if breakdown[0]["containers"] != 2 || breakdown[0]["running"] != 1 {
+		t.Fatalf("unexpected api counts: %#v", breakdown[0])
+	}
+	down := breakdown[0]["down_containers"].([]string)
+	if len(down) != 1 || down[0] != "web-api-2" {
+		t.Fatalf("unexpected down containers: %#v", down)
+	}
+	if _, ok := breakdown[0]["oneshot"]; ok {
+		t.Fatalf("api should not be flagged as oneshot: %#v", breakdown[0])
+	}
+}
+
+func TestStackServiceBreakdownOneshot(t *testing.T) {
+	oneshot := map[string]string{composeServiceLabel: "migrate", flotillaOneshotLabel: "true"}
+	containers := []types.Container{
+		{ID: "1", Names: []string{"/web-migrate-1"}, State: "exited", Status: "Exited (0) 5 minutes ago", Labels: oneshot},
+		{ID: "2", Names: []string{"/web-migrate-2"}, State: "exited", Status: "Exited (1) 2 minutes ago", Labels: oneshot},
+	}
+
+	breakdown := stackServiceBreakdown(containers)
+	if len(breakdown) != 1 || breakdown[0]["oneshot"] != true {
+		t.Fatalf("expected migrate to be flagged as oneshot: %#v", breakdown)
+	}
+	failed := breakdown[0]["failed_containers"].([]string)
+	if len(failed) != 1 || failed[0] != "web-migrate-2" {
+		t.Fatalf("unexpected failed containers: %#v", failed)
+	}
+}
+
+func TestUnmanagedStacks(t *testing.T) {
+	containers := []types.Container{
+		{State: "running", Labels: map[string]string{composeProjectLabel: "legacy", composeServiceLabel: "web", composeWorkingDirLabel: "/srv/legacy"}},
+		{State: "exited", Labels: map[string]string{composeProjectLabel: "legacy", composeServiceLabel: "db"}},
+		{State: "running", Labels: map[string]string{composeProjectLabel: "managed", flotillaManagedLabel: "true"}},
+		{State: "running", Labels: map[string]string{}},
+	}
+
+	stacks := unmanagedStacks(containers)
+	if len(stacks) != 1 || stacks[0]["name"] != "legacy" {
+		t.Fatalf("unexpected discovered stacks: %#v", stacks)
+	}
+	stack := stacks[0]
+	if stack["services"] != 2 || stack["containers"] != 2 || stack["running"] != 1 {
+		t.Fatalf("unexpected counts: %#v", stack)
+	}
+	if stack["working_dir"] != "/srv/legacy" || stack["importable"] != true {
+		t.Fatalf("unexpected metadata: %#v", stack)
+	}
+}
+
+func TestReadProjectComposeFile(t *testing.T) {
+	importRoot := t.TempDir()
+	projectDir := filepath.Join(importRoot, "legacy")
+	if err := os.Mkdir(projectDir, 0o700); err != nil {
+		t.Fatalf("failed to create project dir: %v", err)
+	}
+	composePath := filepath.Join(projectDir, "docker-compose.yml")
+	if err := os.WriteFile(composePath, []byte("services:\n  web:\n    image: nginx\n"), 0o600); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".env"), []byte("# comment\nTAG=1.25\nexport MODE=prod\n"), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(outside, []byte("services:\n  web:\n    image: nginx\n"), 0o600); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(projectDir, "compose.yaml")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// Labels are set by whoever starts the container, so they can name any file on the host
+	forgedDir := filepath.Dir(outside)
+	linkedDir := filepath.Join(importRoot, "linked")
+	if err := os.Symlink(forgedDir, linkedDir); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	api := &fakeDockerAPI{
+		containers: []types.Container{
+			{ID: "a", Labels: map[string]string{
+				composeProjectLabel:    "legacy",
+				composeWorkingDirLabel: projectDir,
+				composeConfigLabel:     composePath,
+			}},
+			{ID: "b", Labels: map[string]string{
+				composeProjectLabel:    "forged",
+				composeWorkingDirLabel: forgedDir,
+				composeConfigLabel:     outside,
+			}},
+			{ID: "c", Labels: map[string]string{
+				composeProjectLabel:    "linked",
+				composeWorkingDirLabel: linkedDir,
+				composeConfigLabel:     filepath.Join(linkedDir, "docker-compose.yml"),
+			}},
+		},
+	}
+	compose := &ComposeClient{dockerClient: NewClient(api), workDir: t.TempDir(), importRoot: importRoot}
+
+	file, err := compose.ReadProjectComposeFile(context.Background(), "legacy", "")
+	if err != nil {
+		t.Fatalf("ReadProjectComposeFile returned error: %v", err)
+	}
+	if file.Path != composePath || !strings.Contains(file.Content, "nginx") {
+		t.Fatalf("unexpected compose file: %#v", file)
+	}
+	if file.EnvVars["TAG"] != "1.25" || file.EnvVars["MODE"] != "prod" || len(file.EnvVars) != 2 {
+		t.Fatalf("unexpected env vars: %#v", file.EnvVars)
+	}
+
+	for _, path := range []string{
+		outside,
+		filepath.Join(projectDir, "compose.yaml"),
+		projectDir + "/../" + filepath.Base(projectDir) + "/docker-compose.yml",
+		"relative/docker-compose.yml",
+	} {
+		if _, err := compose.ReadProjectComposeFile(context.Background(), "legacy", path); err == nil {
+			t.Fatalf("expected path %s to be rejected", path)
+		}
+	}
+	if _, err := compose.ReadProjectComposeFile(context.Background(), "missing", composePath); err == nil {
+		t.Fatal("expected unknown stack to be rejected")
+	}
+	for _, stack := range []string{"forged", "linked"} {
+		if _, err := compose.ReadProjectComposeFile(context.Background(), stack, ""); err == nil || !strings.Contains(err.Error(), "outside") {
+			t.Fatalf("expected the compose file of %s outside the import root to be rejected, got %v", stack, err)
+		}
+	}
+
+	// Without an import root only the compose working directory may be read
+	compose.importRoot = ""
+	if _, err := compose.ReadProjectComposeFile(context.Background(), "legacy", ""); err == nil {
+		t.Fatal("expected a project outside the working directory to be rejected without an import root")
+	}
+}
+
+func TestNewComposeClientWithoutWorkDir(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	compose := newComposeClient(NewClient(&fakeDockerAPI{}), filepath.Join(blocker, "compose"))
+	if err := compose.Available(); !errors.Is(err, ErrComposeUnavailable) {
+		t.Fatalf("expected compose to be unavailable, got %v", err)
+	}
+
+	compose = newComposeClient(NewClient(&fakeDockerAPI{}), filepath.Join(t.TempDir(), "compose"))
+	if err := compose.Available(); err != nil {
+		t.Fatalf("expected compose to be available, got %v", err)
+	}
+}
+
+func TestEndpointComposeClientTargetsEndpointDaemon(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix:///var/run/docker.sock")
+	t.Setenv("DOCKER_CONTEXT", "primary")
+
+	var commands []*exec.Cmd
+	original := execCommand
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "true")
+		commands = append(commands, cmd)
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = original })
+
+	base := t.TempDir()
+	primary := newComposeClient(NewClient(&fakeDockerAPI{}), filepath.Join(base, "primary"))
+	endpoint := newEndpointComposeClient(NewClient(&fakeDockerAPI{}), filepath.Join(base, "endpoints"), "build", "tcp://10.0.0.5:2375")
+	for _, dir := range []string{filepath.Join(base, "primary", "web"), filepath.Join(base, "endpoints", "build", "web")} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create stack directory: %v", err)
+		}
+	}
+
+	if err := endpoint.StartStack(context.Background(), "web"); err != nil {
+		t.Fatalf("StartStack returned error: %v", err)
+	}
+	if err := primary.StartStack(context.Background(), "web"); err != nil {
+		t.Fatalf("StartStack returned error: %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected one compose run per stack, got %d", len(commands))
+	}
+
+	endpointCmd, primaryCmd := commands[0], commands[1]
+	if want := filepath.Join(base, "endpoints", "build", "web"); endpointCmd.Dir != want {
+		t.Fatalf("endpoint compose ran in %s, want %s", endpointCmd.Dir, want)
+	}
+	if !slices.Contains(endpointCmd.Env, "DOCKER_HOST=tcp://10.0.0.5:2375") {
+		t.Fatalf("expected the endpoint's DOCKER_HOST, got %v", endpointCmd.Env)
+	}
+	for _, kv := range endpointCmd.Env {
+		if kv == "DOCKER_HOST=unix:///var/run/docker.sock" || strings.HasPrefix(kv, "DOCKER_CONTEXT=") {
+			t.Fatalf("expected the agent's daemon settings to be replaced, found %s", kv)
+		}
+	}
+
+	if want := filepath.Join(base, "primary", "web"); primaryCmd.Dir != want {
+		t.Fatalf("primary compose ran in %s, want %s", primaryCmd.Dir, want)
+	}
+	if !slices.Contains(primaryCmd.Env, "DOCKER_HOST=unix:///var/run/docker.sock") || !slices.Contains(primaryCmd.Env, "DOCKER_CONTEXT=primary") {
+		t.Fatalf("expected the primary client to keep the agent's environment, got %v", primaryCmd.Env)
+	}
+}
+
+func TestDeployStackRejectsInvalidEnvVars(t *testing.T) {
+	original := execCommand
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		t.Fatalf("expected compose not to run, got %s %v", name, args)
+		return nil
+	}
+	t.Cleanup(func() { execCommand = original })
+
+	compose := newComposeClient(NewClient(&fakeDockerAPI{}), t.TempDir())
+	content := "services:\n  web:\n    image: nginx\n"
+	if err := compose.DeployStack(context.Background(), "web", content, map[string]interface{}{"BAD KEY": "x"}); err == nil || !strings.Contains(err.Error(), "BAD KEY") {
+		t.Fatalf("expected the invalid variable to fail the deploy, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(compose.workDir, "web", dockerComposeFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no compose file to be written, got %v", err)
+	}
+}
+
+func TestSandboxStacksAreLabelled(t *testing.T) {
+	original := execCommand
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "true")
+	}
+	t.Cleanup(func() { execCommand = original })
+
+	api := &fakeDockerAPI{containers: []types.Container{
+		{ID: "a", Labels: map[string]string{composeProjectLabel: "web-sandbox-0011aabb", flotillaSandboxLabel: "true"}},
+		{ID: "b", Labels: map[string]string{composeProjectLabel: "web-sandbox-0011aabb", flotillaSandboxLabel: "true"}},
+		// Named like a sandbox but deployed as a regular stack
+		{ID: "c", Labels: map[string]string{composeProjectLabel: "api-sandbox-0011aabb"}},
+	}}
+	compose := newComposeClient(NewClient(api), t.TempDir())
+
+	if err := compose.DeploySandboxStack(context.Background(), "web-sandbox-0011aabb", "services:\n  web:\n    image: nginx\n", nil); err != nil {
+		t.Fatalf("DeploySandboxStack returned error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(compose.workDir, "web-sandbox-0011aabb", dockerComposeFileName))
+	if err != nil {
+		t.Fatalf("failed to read compose file: %v", err)
+	}
+	if !strings.Contains(string(content), flotillaSandboxLabel+": \"true\"") {
+		t.Fatalf("expected the sandbox label in the deployed compose file, got:\n%s", content)
+	}
+
+	names, err := compose.ListSandboxStacks(context.Background())
+	if err != nil {
+		t.Fatalf("ListSandboxStacks returned error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "web-sandbox-0011aabb" {
+		t.Fatalf("expected only the labelled sandbox, got %v", names)
+	}
+}
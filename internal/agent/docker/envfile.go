@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// envKeyPattern matches the variable names compose accepts in a .env file
+	envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	// plainEnvValuePattern matches values that can be written without quotes
+	plainEnvValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+	envValueEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+)
+
+// parseEnvFile parses a compose .env file. Blank lines and comments are skipped and an export
+// prefix is ignored. Unquoted values end at an inline comment and are trimmed. Single-quoted
+// values are literal; double-quoted values expand \n, \r, \t, \" and \\. Quoted values may
+// span lines. A quote that is never closed is read as part of an unquoted value.
+func parseEnvFile(content string) map[string]interface{} {
+	vars := map[string]interface{}{}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	for content != "" {
+		var line string
+		line, content, _ = strings.Cut(content, "\n")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			if unquoted, rest, closed := readQuotedEnvValue(value[1:]+"\n"+content, value[0]); closed {
+				vars[key] = unquoted
+				// Anything after the closing quote on its line is a comment
+				_, content, _ = strings.Cut(rest, "\n")
+				continue
+			}
+		}
+		vars[key] = stripEnvComment(value)
+	}
+	return vars
+}
+
+// readQuotedEnvValue reads a quoted value from s, which starts just after the opening quote.
+// It returns the unquoted value, the text after the closing quote and whether one was found.
+func readQuotedEnvValue(s string, quote byte) (string, string, bool) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return value.String(), s[i+1:], true
+		case quote == '"' && c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case '"', '\\':
+				value.WriteByte(s[i])
+			default:
+				value.WriteByte('\\')
+				value.WriteByte(s[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// stripEnvComment removes an inline comment, which must follow whitespace, from an unquoted
+// value and trims it.
+func stripEnvComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// formatEnvFile renders variables as a compose .env file, one per line in key order. Values
+// with a $ are single quoted when they can be, so compose does not interpolate them. Other
+// values that are not plain words are double quoted with their quotes, backslashes and line
+// breaks escaped, so parseEnvFile reads back exactly what was written.
+func formatEnvFile(vars map[string]interface{}) (string, error) {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		if !envKeyPattern.MatchString(key) {
+			return "", fmt.Errorf("invalid environment variable name %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		value := ""
+		if v := vars[key]; v != nil {
+			value = fmt.Sprint(v)
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(quoteEnvValue(value))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+func quoteEnvValue(value string) string {
+	if plainEnvValuePattern.MatchString(value) {
+		return value
+	}
+	if strings.Contains(value, "$") && !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return `"` + envValueEscaper.Replace(value) + `"`
+}
+
+// writeEnvFile writes variables to a compose .env file.
+func writeEnvFile(path string, vars map[string]interface{}) error {
+	content, err := formatEnvFile(vars)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), composeFilePerm)
+}
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	content := "# comment\r\n" +
+		"PLAIN=value\n" +
+		"export EXPORTED = spaced value  \n" +
+		"URL=postgres://u:p@db/app?sslmode=disable\n" +
+		"INLINE=on # trailing comment\n" +
+		"HASH=abc#123\n" +
+		"SINGLE='it''s $HOME \\n'\n" +
+		"DOUBLE=\"say \\\"hi\\\"\\tC:\\\\dir\\n\" # note\n" +
+		"MULTI=\"first\n" +
+		"second\"\n" +
+		"KEEP=\"\\$literal\"\n" +
+		"OPEN=\"unterminated\n" +
+		"EMPTY=\n" +
+		"noequals\n"
+
+	want := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "spaced value",
+		"URL":      "postgres://u:p@db/app?sslmode=disable",
+		"INLINE":   "on",
+		"HASH":     "abc#123",
+		"SINGLE":   "it",
+		"DOUBLE":   "say \"hi\"\tC:\\dir\n",
+		"MULTI":    "first\nsecond",
+		"KEEP":     `\$literal`,
+		"OPEN":     `"unterminated`,
+		"EMPTY":    "",
+	}
+	got := parseEnvFile(content)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d variables, got %d: %#v", len(want), len(got), got)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestFormatEnvFileRoundTrip(t *testing.T) {
+	vars := map[string]interface{}{
+		"PLAIN":     "value",
+		"PORT":      float64(8080),
+		"EQUALS":    "a=b=c",
+		"SPACES":    "  padded value  ",
+		"QUOTES":    `it's "quoted"`,
+		"BACKSLASH": `C:\path\n`,
+		"NEWLINES":  "line one\nline two\r\n",
+		"COMMENT":   "value # not a comment",
+		"TEMPLATE":  "${OTHER:-default}",
+		"DOLLAR":    "pa$word",
+		"EMPTY":     "",
+		"NIL":       nil,
+	}
+	content, err := formatEnvFile(vars)
+	if err != nil {
+		t.Fatalf("formatEnvFile returned error: %v", err)
+	}
+
+	// Compose interpolates $ in unquoted and double-quoted values but not in single quotes
+	if !strings.Contains(content, "DOLLAR='pa$word'\n") || !strings.Contains(content, "TEMPLATE='${OTHER:-default}'\n") {
+		t.Fatalf("expected values with $ to be single quoted, got:\n%s", content)
+	}
+
+	got := parseEnvFile(content)
+	if len(got) != len(vars) {
+		t.Fatalf("expected %d variables back, got %d from:\n%s", len(vars), len(got), content)
+	}
+	for key, value := range vars {
+		expected := ""
+		switch v := value.(type) {
+		case string:
+			expected = v
+		case float64:
+			expected = "8080"
+		}
+		if got[key] != expected {
+			t.Fatalf("%s round-tripped to %q, want %q; file:\n%s", key, got[key], expected, content)
+		}
+	}
+
+	if _, err := formatEnvFile(map[string]interface{}{"BAD KEY": "x"}); err == nil {
+		t.Fatal("expected an invalid variable name to be rejected")
+	}
+	if _, err := formatEnvFile(map[string]interface{}{"A\nB": "x"}); err == nil {
+		t.Fatal("expected a variable name with a newline to be rejected")
+	}
+}
+
+func TestWriteEnvFileIsSorted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), envFileName)
+	if err := writeEnvFile(path, map[string]interface{}{"B": "two words", "A": "1"}); err != nil {
+		t.Fatalf("writeEnvFile returned error: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read env file: %v", err)
+	}
+	if string(content) != "A=1\nB=\"two words\"\n" {
+		t.Fatalf("unexpected env file content: %q", content)
+	}
+}
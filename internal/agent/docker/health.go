@@ -0,0 +1,167 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// slowPingThreshold is the ping latency above which the daemon is reported as struggling
+	slowPingThreshold = 2 * time.Second
+	pingTimeout       = 10 * time.Second
+	// daemonErrorWindow is how long an observed daemon error counts against its health
+	daemonErrorWindow = 5 * time.Minute
+	maxRecentErrors   = 5
+	// eventsRetryDelay is the wait before resubscribing to a failed event stream
+	eventsRetryDelay = 5 * time.Second
+)
+
+// daemonError is an error the agent observed while talking to the daemon.
+type daemonError struct {
+	at  time.Time
+	msg string
+}
+
+// HealthMonitor tracks indicators of Docker daemon health: whether the event stream is
+// subscribed, how quickly the daemon answers pings and which errors were seen recently. A
+// degraded daemon often keeps running while commands against it start to time out.
+type HealthMonitor struct {
+	client *Client
+
+	mu               sync.Mutex
+	eventStreamAlive bool
+	eventsReceived   uint64
+	pingLatency      time.Duration
+	pingErr          string
+	pinged           bool
+	recentErrors     []daemonError
+}
+
+// NewHealthMonitor creates a monitor for the daemon behind client.
+func NewHealthMonitor(client *Client) *HealthMonitor {
+	return &HealthMonitor{client: client}
+}
+
+// WatchEvents keeps a Docker event subscription open until ctx ends, resubscribing after
+// failures, and records whether the stream is alive.
+func (m *HealthMonitor) WatchEvents(ctx context.Context) {
+	for {
+		m.watchOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+	}
+}
+
+func (m *HealthMonitor) watchOnce(ctx context.Context) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages, errs := m.client.GetEvents(streamCtx)
+	if messages == nil && errs == nil {
+		return
+	}
+	m.setEventStream(true)
+	defer m.setEventStream(false)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+			m.mu.Lock()
+			m.eventsReceived++
+			m.mu.Unlock()
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			if ctx.Err() == nil {
+				logrus.WithError(err).Warn("Docker event stream failed")
+				m.RecordError(fmt.Errorf("event stream: %w", err))
+			}
+			return
+		}
+	}
+}
+
+func (m *HealthMonitor) setEventStream(alive bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventStreamAlive = alive
+}
+
+// Probe pings the daemon and records how long it took to answer.
+func (m *HealthMonitor) Probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := m.client.Ping(ctx)
+	latency := time.Since(start)
+
+	m.mu.Lock()
+	m.pinged = true
+	m.pingLatency = latency
+	m.pingErr = ""
+	if err != nil {
+		m.pingErr = err.Error()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		m.RecordError(fmt.Errorf("ping: %w", err))
+	}
+}
+
+// RecordError notes an error observed while talking to the daemon.
+func (m *HealthMonitor) RecordError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recentErrors = append(m.recentErrors, daemonError{at: time.Now(), msg: err.Error()})
+	if len(m.recentErrors) > maxRecentErrors {
+		m.recentErrors = m.recentErrors[len(m.recentErrors)-maxRecentErrors:]
+	}
+}
+
+// Snapshot reports the daemon's current health. It is unhealthy when the last ping failed
+// or was slow, when the event stream is down, or when errors were seen recently.
+func (m *HealthMonitor) Snapshot() *protocol.DockerHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := &protocol.DockerHealth{
+		EventStreamAlive: m.eventStreamAlive,
+		EventsReceived:   m.eventsReceived,
+		PingLatencyMs:    m.pingLatency.Milliseconds(),
+		PingError:        m.pingErr,
+	}
+	cutoff := time.Now().Add(-daemonErrorWindow)
+	for _, e := range m.recentErrors {
+		if e.at.After(cutoff) {
+			health.RecentErrors = append(health.RecentErrors, e.msg)
+		}
+	}
+
+	switch {
+	case m.pingErr != "":
+		health.Reasons = append(health.Reasons, "daemon did not answer ping")
+	case m.pinged && m.pingLatency > slowPingThreshold:
+		health.Reasons = append(health.Reasons, fmt.Sprintf("daemon took %s to answer ping", m.pingLatency.Round(time.Millisecond)))
+	}
+	if !m.eventStreamAlive {
+		health.Reasons = append(health.Reasons, "event stream is down")
+	}
+	if len(health.RecentErrors) > 0 {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("%d daemon errors in the last %s", len(health.RecentErrors), daemonErrorWindow))
+	}
+	health.Healthy = len(health.Reasons) == 0
+	return health
+}
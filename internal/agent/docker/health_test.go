@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestHealthMonitorSnapshot(t *testing.T) {
+	pingErr := errors.New("daemon unreachable")
+	api := &stubDockerAPI{}
+	monitor := NewHealthMonitor(NewClient(api))
+
+	// Before the event stream is subscribed the daemon cannot be called healthy
+	if health := monitor.Snapshot(); health.Healthy || health.EventStreamAlive {
+		t.Fatalf("expected unhealthy snapshot without an event stream, got %+v", health)
+	}
+
+	messages := make(chan events.Message)
+	api.eventsFn = func(ctx context.Context, _ types.EventsOptions) (<-chan events.Message, <-chan error) {
+		return messages, make(chan error)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go monitor.WatchEvents(ctx)
+	messages <- events.Message{Type: events.ContainerEventType}
+	deadline := time.Now().Add(time.Second)
+	for monitor.Snapshot().EventsReceived == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	monitor.Probe(context.Background())
+	if health := monitor.Snapshot(); !health.Healthy || !health.EventStreamAlive || health.EventsReceived != 1 {
+		t.Fatalf("expected healthy snapshot, got %+v", health)
+	}
+
+	api.pingFn = func(context.Context) (types.Ping, error) { return types.Ping{}, pingErr }
+	monitor.Probe(context.Background())
+	health := monitor.Snapshot()
+	if health.Healthy || health.PingError == "" || len(health.RecentErrors) != 1 || len(health.Reasons) != 2 {
+		t.Fatalf("expected failed ping to make the daemon unhealthy, got %+v", health)
+	}
+}
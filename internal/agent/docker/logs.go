@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -31,7 +32,9 @@ type LogOptions struct {
 	Until      string
 }
 
-// LogChunk represents a chunk of log data
+// LogChunk represents a chunk of log data. When Docker timestamps are requested, Timestamp
+// holds the time Docker recorded for the line and the prefix is removed from Data; otherwise
+// it is the time the agent read the chunk.
 type LogChunk struct {
 	Data      string    `json:"data"`
 	Timestamp time.Time `json:"timestamp"`
@@ -97,6 +100,11 @@ func (ls *LogStreamer) StreamLogs(ctx context.Context, containerID string, optio
 				// Parse Docker log format (8-byte header + data)
 				data := buffer[:n]
 				chunks := ls.parseLogChunks(data)
+				if options.Timestamps {
+					for i := range chunks {
+						normalizeLogTimestamp(&chunks[i])
+					}
+				}
 
 				// Send each chunk via callback
 				for _, chunk := range chunks {
@@ -168,6 +176,39 @@ func (ls *LogStreamer) parseLogChunks(data []byte) []LogChunk {
 	return chunks
 }
 
+// normalizeLogTimestamp moves the RFC3339Nano timestamp Docker prefixes to each line into the
+// chunk's Timestamp, keeping the agent read time for chunks without one. When a chunk holds
+// several lines, every prefix is stripped and the first timestamp is kept.
+func normalizeLogTimestamp(chunk *LogChunk) {
+	lines := strings.SplitAfter(chunk.Data, "\n")
+	found := false
+	for i, line := range lines {
+		ts, rest, ok := splitLogTimestamp(line)
+		if !ok {
+			continue
+		}
+		if !found {
+			chunk.Timestamp = ts
+			found = true
+		}
+		lines[i] = rest
+	}
+	if found {
+		chunk.Data = strings.Join(lines, "")
+	}
+}
+
+// splitLogTimestamp splits a Docker log line of the form "<RFC3339Nano timestamp> <message>".
+func splitLogTimestamp(line string) (time.Time, string, bool) {
+	body := strings.TrimRight(line, "\r\n")
+	prefix, message, _ := strings.Cut(body, " ")
+	ts, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts.UTC(), message + line[len(body):], true
+}
+
 // GetLogs gets a snapshot of container logs without streaming
 func (ls *LogStreamer) GetLogs(ctx context.Context, containerID string, options LogOptions) ([]LogChunk, error) {
 	var chunks []LogChunk
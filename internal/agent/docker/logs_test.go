@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeLogTimestamp(t *testing.T) {
+	chunk := LogChunk{Data: "2024-03-05T10:15:30.123456789Z server started\n", Timestamp: time.Now(), Stream: "stdout"}
+	normalizeLogTimestamp(&chunk)
+
+	want := time.Date(2024, 3, 5, 10, 15, 30, 123456789, time.UTC)
+	if !chunk.Timestamp.Equal(want) {
+		t.Fatalf("expected timestamp %v, got %v", want, chunk.Timestamp)
+	}
+	if chunk.Data != "server started\n" {
+		t.Fatalf("expected timestamp prefix to be stripped, got %q", chunk.Data)
+	}
+
+	multi := LogChunk{Data: "2024-03-05T10:15:30Z first\n2024-03-05T10:15:31Z second\n"}
+	normalizeLogTimestamp(&multi)
+	if multi.Data != "first\nsecond\n" || multi.Timestamp.Second() != 30 {
+		t.Fatalf("unexpected multi-line chunk: %q at %v", multi.Data, multi.Timestamp)
+	}
+}
+
+func TestNormalizeLogTimestampWithoutPrefix(t *testing.T) {
+	readAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chunk := LogChunk{Data: "plain line without timestamp\n", Timestamp: readAt}
+	normalizeLogTimestamp(&chunk)
+	if chunk.Data != "plain line without timestamp\n" || !chunk.Timestamp.Equal(readAt) {
+		t.Fatalf("expected chunk to be left untouched, got %q at %v", chunk.Data, chunk.Timestamp)
+	}
+
+	empty := LogChunk{Data: "2024-03-05T10:15:30Z\n", Timestamp: readAt}
+	normalizeLogTimestamp(&empty)
+	if empty.Data != "\n" || empty.Timestamp.Equal(readAt) {
+		t.Fatalf("expected timestamp-only line to be parsed, got %q at %v", empty.Data, empty.Timestamp)
+	}
+}
@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// probePollInterval is how often a running probe is checked for completion
+const probePollInterval = 200 * time.Millisecond
+
+// RunProbe runs a shell command inside a running container and returns its exit code. The
+// command runs detached, so its output is discarded; ctx bounds how long it may take.
+func (c *Client) RunProbe(ctx context.Context, containerID, command string) (int, error) {
+	exec, err := c.api.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:    []string{"/bin/sh", "-c", command},
+		Detach: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create probe: %w", err)
+	}
+	if err := c.api.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true}); err != nil {
+		return 0, fmt.Errorf("failed to start probe: %w", err)
+	}
+
+	ticker := time.NewTicker(probePollInterval)
+	defer ticker.Stop()
+	for {
+		inspect, err := c.api.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect probe: %w", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("probe did not finish: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
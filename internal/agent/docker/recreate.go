@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+)
+
+// replacedContainerSuffix is appended to the name of a container while its replacement is
+// created, and dropped again if the replacement fails
+const replacedContainerSuffix = "-flotilla-replaced"
+
+// restoreTimeout bounds putting the old container back after a failed replacement
+const restoreTimeout = 30 * time.Second
+
+// RecreateContainer replaces a container with one created from imageRef, keeping its name,
+// configuration, network attachments and volumes. The old container is renamed and kept
+// until the new one is running; if anything fails it is restored and the error returned.
+// A container that was not running is replaced without being started.
+func (c *Client) RecreateContainer(ctx context.Context, current *types.ContainerJSON, imageRef string, stopTimeout *int) (string, error) {
+	if current == nil || current.ContainerJSONBase == nil || current.Config == nil {
+		return "", fmt.Errorf("container details are incomplete")
+	}
+	name := strings.TrimPrefix(current.Name, "/")
+	backupName := name + replacedContainerSuffix
+	wasRunning := current.State != nil && current.State.Running
+
+	if err := c.api.ContainerRename(ctx, current.ID, backupName); err != nil {
+		return "", fmt.Errorf("failed to rename container %s: %w", name, err)
+	}
+	// The old container is put back even when ctx was cancelled or timed out part way, as
+	// that is often why the replacement failed
+	restore := func(newID string) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+		defer cancel()
+		if newID != "" {
+			if err := c.api.ContainerRemove(ctx, newID, types.ContainerRemoveOptions{Force: true}); err != nil {
+				logrus.WithError(err).Warnf("Failed to remove replacement container %s", newID)
+			}
+		}
+		if err := c.api.ContainerRename(ctx, current.ID, name); err != nil {
+			logrus.WithError(err).Warnf("Failed to restore the name of container %s", current.ID)
+		}
+		if wasRunning {
+			if err := c.api.ContainerStart(ctx, current.ID, types.ContainerStartOptions{}); err != nil {
+				logrus.WithError(err).Warnf("Failed to restart container %s", current.ID)
+			}
+		}
+	}
+
+	config, hostConfig, primary, extra := replacementConfig(current, imageRef)
+	created, err := c.api.ContainerCreate(ctx, config, hostConfig, primary, nil, name)
+	if err != nil {
+		restore("")
+		return "", fmt.Errorf("failed to create replacement container: %w", err)
+	}
+	for _, networkName := range sortedKeys(extra) {
+		if err := c.api.NetworkConnect(ctx, networkName, created.ID, extra[networkName]); err != nil {
+			restore(created.ID)
+			return "", fmt.Errorf("failed to connect replacement container to network %s: %w", networkName, err)
+		}
+	}
+
+	if wasRunning {
+		stopOptions := container.StopOptions{Timeout: stopTimeout}
+		if err := c.api.ContainerStop(ctx, current.ID, stopOptions); err != nil {
+			restore(created.ID)
+			return "", fmt.Errorf("failed to stop container %s: %w", name, err)
+		}
+		if err := c.api.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			restore(created.ID)
+			return "", fmt.Errorf("failed to start replacement container: %w", err)
+		}
+	}
+
+	// The old container's named and anonymous volumes now belong to the replacement
+	if err := c.api.ContainerRemove(ctx, current.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+		logrus.WithError(err).Warnf("Failed to remove replaced container %s; remove %s manually", current.ID, backupName)
+	}
+
+	logrus.Infof("Recreated container %s from %s (ID: %s)", name, imageRef, created.ID)
+	return created.ID, nil
+}
+
+// replacementConfig derives the configuration of a container replacing current. The
+// network named by the network mode, or else the first attached network, is configured at
+// creation; Docker before API 1.44 accepts only one there, so the others are returned to be
+// connected afterwards.
+func replacementConfig(current *types.ContainerJSON, imageRef string) (*container.Config, *container.HostConfig, *network.NetworkingConfig, map[string]*network.EndpointSettings) {
+	config := *current.Config
+	config.Image = imageRef
+	// A hostname Docker derived from the old container ID would otherwise stick
+	if len(current.ID) >= 12 && config.Hostname == current.ID[:12] {
+		config.Hostname = ""
+	}
+
+	hostConfig := &container.HostConfig{}
+	if current.HostConfig != nil {
+		copied := *current.HostConfig
+		hostConfig = &copied
+	}
+	hostConfig.Binds = append(append([]string(nil), hostConfig.Binds...), anonymousVolumeBinds(current, hostConfig)...)
+
+	var endpoints map[string]*network.EndpointSettings
+	if current.NetworkSettings != nil {
+		endpoints = make(map[string]*network.EndpointSettings, len(current.NetworkSettings.Networks))
+		for networkName, settings := range current.NetworkSettings.Networks {
+			if settings == nil {
+				continue
+			}
+			endpoints[networkName] = &network.EndpointSettings{
+				IPAMConfig: settings.IPAMConfig,
+				Links:      settings.Links,
+				Aliases:    containerAliases(settings.Aliases, current.ID),
+				DriverOpts: settings.DriverOpts,
+			}
+		}
+	}
+	mode := hostConfig.NetworkMode
+	if len(endpoints) == 0 || mode.IsHost() || mode.IsNone() || mode.IsContainer() {
+		return &config, hostConfig, nil, nil
+	}
+
+	primaryName := mode.NetworkName()
+	if _, ok := endpoints[primaryName]; !ok {
+		primaryName = sortedKeys(endpoints)[0]
+	}
+	primary := &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+		primaryName: endpoints[primaryName],
+	}}
+	delete(endpoints, primaryName)
+	return &config, hostConfig, primary, endpoints
+}
+
+// anonymousVolumeBinds binds the volumes mounted by current that are not declared in its
+// host config, typically anonymous volumes from the image, so their data carries over.
+func anonymousVolumeBinds(current *types.ContainerJSON, hostConfig *container.HostConfig) []string {
+	declared := make(map[string]bool)
+	for _, bind := range hostConfig.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) >= 2 {
+			declared[parts[1]] = true
+		}
+	}
+	for _, mount := range hostConfig.Mounts {
+		declared[mount.Target] = true
+	}
+
+	var binds []string
+	for _, mount := range current.Mounts {
+		if mount.Type != "volume" || mount.Name == "" || declared[mount.Destination] {
+			continue
+		}
+		bind := mount.Name + ":" + mount.Destination
+		if !mount.RW {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds
+}
+
+// containerAliases drops the alias Docker adds for the short container ID, which would
+// otherwise point at the replaced container.
+func containerAliases(aliases []string, containerID string) []string {
+	var kept []string
+	for _, alias := range aliases {
+		if len(containerID) >= 12 && alias == containerID[:12] {
+			continue
+		}
+		kept = append(kept, alias)
+	}
+	return kept
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
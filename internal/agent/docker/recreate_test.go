@@ -0,0 +1,206 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// recreateStub records the calls RecreateContainer makes in order
+type recreateStub struct {
+	stubDockerAPI
+	calls   []string
+	startFn func(id string) error
+}
+
+func (s *recreateStub) ContainerRename(ctx context.Context, id, name string) error {
+	s.calls = append(s.calls, fmt.Sprintf("rename %s %s", id, name))
+	return ctx.Err()
+}
+
+func (s *recreateStub) ContainerStop(ctx context.Context, id string, opts container.StopOptions) error {
+	s.calls = append(s.calls, "stop "+id)
+	return ctx.Err()
+}
+
+func (s *recreateStub) NetworkConnect(ctx context.Context, networkID, containerID string, settings *network.EndpointSettings) error {
+	s.calls = append(s.calls, fmt.Sprintf("connect %s %s", networkID, containerID))
+	return nil
+}
+
+func newRecreateStub() *recreateStub {
+	stub := &recreateStub{}
+	stub.containerCreateFn = func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+		stub.calls = append(stub.calls, "create "+name)
+		return container.CreateResponse{ID: "new"}, nil
+	}
+	stub.containerStartFn = func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+		stub.calls = append(stub.calls, "start "+id)
+		if stub.startFn != nil {
+			return stub.startFn(id)
+		}
+		return ctx.Err()
+	}
+	stub.containerRemoveFn = func(ctx context.Context, id string, opts types.ContainerRemoveOptions) error {
+		stub.calls = append(stub.calls, "remove "+id)
+		return ctx.Err()
+	}
+	return stub
+}
+
+func runningContainer() *types.ContainerJSON {
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "0123456789abcdef",
+			Name:       "/web",
+			State:      &types.ContainerState{Running: true},
+			HostConfig: &container.HostConfig{NetworkMode: "frontend"},
+		},
+		Config: &container.Config{Image: "nginx:latest", Hostname: "0123456789ab"},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"frontend": {Aliases: []string{"web", "0123456789ab"}},
+			"backend":  {Aliases: []string{"web"}},
+		}},
+	}
+}
+
+func TestRecreateContainer(t *testing.T) {
+	stub := newRecreateStub()
+	client := NewClient(stub)
+
+	id, err := client.RecreateContainer(context.Background(), runningContainer(), "nginx:latest", nil)
+	if err != nil {
+		t.Fatalf("RecreateContainer returned error: %v", err)
+	}
+	if id != "new" {
+		t.Fatalf("expected the replacement ID, got %q", id)
+	}
+	want := []string{
+		"rename 0123456789abcdef web-flotilla-replaced",
+		"create web",
+		"connect backend new",
+		"stop 0123456789abcdef",
+		"start new",
+		"remove 0123456789abcdef",
+	}
+	if !reflect.DeepEqual(stub.calls, want) {
+		t.Fatalf("unexpected calls:\n got %v\nwant %v", stub.calls, want)
+	}
+}
+
+func TestRecreateContainerRestoresOnStartFailure(t *testing.T) {
+	stub := newRecreateStub()
+	stub.startFn = func(id string) error {
+		if id == "new" {
+			return errors.New("port already allocated")
+		}
+		return nil
+	}
+	client := NewClient(stub)
+
+	if _, err := client.RecreateContainer(context.Background(), runningContainer(), "nginx:latest", nil); err == nil {
+		t.Fatalf("expected an error when the replacement fails to start")
+	}
+	want := []string{
+		"rename 0123456789abcdef web-flotilla-replaced",
+		"create web",
+		"connect backend new",
+		"stop 0123456789abcdef",
+		"start new",
+		"remove new",
+		"rename 0123456789abcdef web",
+		"start 0123456789abcdef",
+	}
+	if !reflect.DeepEqual(stub.calls, want) {
+		t.Fatalf("unexpected calls:\n got %v\nwant %v", stub.calls, want)
+	}
+}
+
+func TestRecreateContainerRestoresAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stub := newRecreateStub()
+	create := stub.containerCreateFn
+	stub.containerCreateFn = func(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig, netCfg *network.NetworkingConfig, platform *v1.Platform, name string) (container.CreateResponse, error) {
+		// The command times out while the replacement is being created
+		defer cancel()
+		return create(ctx, cfg, hostCfg, netCfg, platform, name)
+	}
+	var restoreErrs []error
+	restoreStart := stub.containerStartFn
+	stub.containerStartFn = func(ctx context.Context, id string, opts types.ContainerStartOptions) error {
+		err := restoreStart(ctx, id, opts)
+		restoreErrs = append(restoreErrs, err)
+		return err
+	}
+	client := NewClient(stub)
+
+	if _, err := client.RecreateContainer(ctx, runningContainer(), "nginx:latest", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation to be reported, got %v", err)
+	}
+	want := []string{
+		"rename 0123456789abcdef web-flotilla-replaced",
+		"create web",
+		"connect backend new",
+		"stop 0123456789abcdef",
+		"remove new",
+		"rename 0123456789abcdef web",
+		"start 0123456789abcdef",
+	}
+	if !reflect.DeepEqual(stub.calls, want) {
+		t.Fatalf("unexpected calls:\n got %v\nwant %v", stub.calls, want)
+	}
+	if len(restoreErrs) != 1 || restoreErrs[0] != nil {
+		t.Fatalf("expected the old container to be restarted under a live context, got %v", restoreErrs)
+	}
+}
+
+func TestReplacementConfig(t *testing.T) {
+	current := runningContainer()
+	current.HostConfig.Binds = []string{"/srv/web:/usr/share/nginx/html:ro"}
+	current.Mounts = []types.MountPoint{
+		{Type: "bind", Source: "/srv/web", Destination: "/usr/share/nginx/html"},
+		{Type: "volume", Name: "cache", Destination: "/var/cache/nginx", RW: true},
+		{Type: "volume", Name: "seed", Destination: "/seed"},
+	}
+
+	config, hostConfig, primary, extra := replacementConfig(current, "nginx:1.27")
+	if config.Image != "nginx:1.27" || config.Hostname != "" {
+		t.Fatalf("unexpected config: image %q hostname %q", config.Image, config.Hostname)
+	}
+	wantBinds := []string{"/srv/web:/usr/share/nginx/html:ro", "cache:/var/cache/nginx", "seed:/seed:ro"}
+	if !reflect.DeepEqual(hostConfig.Binds, wantBinds) {
+		t.Fatalf("unexpected binds %v", hostConfig.Binds)
+	}
+	if len(current.HostConfig.Binds) != 1 {
+		t.Fatalf("expected the current host config to be left alone, got %v", current.HostConfig.Binds)
+	}
+	endpoint, ok := primary.EndpointsConfig["frontend"]
+	if !ok || len(primary.EndpointsConfig) != 1 {
+		t.Fatalf("expected frontend as the only primary network, got %v", primary.EndpointsConfig)
+	}
+	if !reflect.DeepEqual(endpoint.Aliases, []string{"web"}) {
+		t.Fatalf("expected the short ID alias to be dropped, got %v", endpoint.Aliases)
+	}
+	if _, ok := extra["backend"]; !ok || len(extra) != 1 {
+		t.Fatalf("expected backend to be connected afterwards, got %v", extra)
+	}
+}
+
+func TestReplacementConfigHostNetwork(t *testing.T) {
+	current := runningContainer()
+	current.HostConfig.NetworkMode = "host"
+	current.NetworkSettings.Networks = map[string]*network.EndpointSettings{"host": {}}
+
+	_, _, primary, extra := replacementConfig(current, "nginx:latest")
+	if primary != nil || extra != nil {
+		t.Fatalf("expected no networking config in host mode, got %v %v", primary, extra)
+	}
+}
@@ -0,0 +1,170 @@
+// Package logexport forwards container logs from the agent to an external syslog or HTTP
+// endpoint, independently of the server connection.
+package logexport
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBufferSize = 1000
+	maxBatchSize      = 100
+	flushInterval     = time.Second
+	minRetryBackoff   = time.Second
+	maxRetryBackoff   = 30 * time.Second
+	// dropReportInterval limits how often dropped lines are logged
+	dropReportInterval = time.Minute
+)
+
+// Entry is one exported log line.
+type Entry struct {
+	Host          string    `json:"host"`
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	Stream        string    `json:"stream"`
+	Timestamp     time.Time `json:"timestamp"`
+	Message       string    `json:"message"`
+}
+
+// Sink delivers batches of log lines to an external endpoint. A failed Send is retried with
+// the same batch.
+type Sink interface {
+	Send(ctx context.Context, entries []Entry) error
+	Close() error
+}
+
+// Exporter buffers log lines and delivers them to a sink in batches. When the sink is
+// unreachable the buffer fills and the oldest lines are dropped, so a logging outage never
+// blocks the containers' log streams or grows the agent's memory without bound.
+type Exporter struct {
+	sink Sink
+
+	mu     sync.Mutex
+	buffer []Entry
+	// removed counts the lines ever removed from the front of buffer, delivered or dropped
+	removed uint64
+	limit   int
+	pending chan struct{}
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewExporter creates an exporter holding up to bufferSize undelivered lines. Non-positive
+// sizes use the default of 1000.
+func NewExporter(sink Sink, bufferSize int) *Exporter {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	return &Exporter{
+		sink:    sink,
+		limit:   bufferSize,
+		pending: make(chan struct{}, 1),
+	}
+}
+
+// Export queues a line for delivery, dropping the oldest queued line when the buffer is full.
+func (e *Exporter) Export(entry Entry) {
+	e.mu.Lock()
+	if len(e.buffer) >= e.limit {
+		e.buffer = e.buffer[1:]
+		e.removed++
+		e.dropped.Add(1)
+	}
+	e.buffer = append(e.buffer, entry)
+	full := len(e.buffer) >= maxBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.pending <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stats returns how many lines were delivered and how many were dropped.
+func (e *Exporter) Stats() (sent, dropped uint64) {
+	return e.sent.Load(), e.dropped.Load()
+}
+
+// Run delivers queued lines until ctx is cancelled, then closes the sink. Failed batches are
+// retried with exponential backoff.
+func (e *Exporter) Run(ctx context.Context) {
+	defer func() {
+		if err := e.sink.Close(); err != nil {
+			logrus.WithError(err).Debug("Failed to close log export sink")
+		}
+	}()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	backoff := minRetryBackoff
+	var reportedDrops uint64
+	lastReport := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.pending:
+		}
+
+		if dropped := e.dropped.Load(); dropped > reportedDrops && time.Since(lastReport) >= dropReportInterval {
+			logrus.Warnf("Log export dropped %d lines because the sink could not keep up", dropped-reportedDrops)
+			reportedDrops, lastReport = dropped, time.Now()
+		}
+
+		for {
+			batch, offset := e.peek()
+			if len(batch) == 0 {
+				break
+			}
+			if err := e.sink.Send(ctx, batch); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logrus.WithError(err).Warnf("Failed to export %d log lines; retrying in %s", len(batch), backoff)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, maxRetryBackoff)
+				continue
+			}
+			backoff = minRetryBackoff
+			e.commit(offset, len(batch))
+		}
+	}
+}
+
+// peek returns the oldest queued lines, up to a batch, without removing them, along with the
+// position of the first one.
+func (e *Exporter) peek() ([]Entry, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := min(len(e.buffer), maxBatchSize)
+	return append([]Entry(nil), e.buffer[:n]...), e.removed
+}
+
+// commit removes a delivered batch of count lines starting at offset. Lines dropped while the
+// batch was being sent may already have shifted part of it out.
+func (e *Exporter) commit(offset uint64, count int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent.Add(uint64(count))
+	end := offset + uint64(count)
+	if end <= e.removed {
+		return
+	}
+	n := min(int(end-e.removed), len(e.buffer))
+	e.buffer = e.buffer[n:]
+	e.removed += uint64(n)
+}
@@ -0,0 +1,109 @@
+package logexport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink records delivered entries and fails while failing is set
+type recordingSink struct {
+	mu       sync.Mutex
+	failing  bool
+	received []Entry
+}
+
+func (s *recordingSink) Send(ctx context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.received = append(s.received, entries...)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.received))
+	for _, entry := range s.received {
+		out = append(out, entry.Message)
+	}
+	return out
+}
+
+func TestExporterDropsOldestWhenFull(t *testing.T) {
+	exporter := NewExporter(&recordingSink{}, 2)
+	for _, message := range []string{"one", "two", "three"} {
+		exporter.Export(Entry{Message: message})
+	}
+	batch, offset := exporter.peek()
+	if len(batch) != 2 || batch[0].Message != "two" || offset != 1 {
+		t.Fatalf("unexpected buffer %v at offset %d", batch, offset)
+	}
+	if _, dropped := exporter.Stats(); dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+}
+
+func TestExporterCommitAfterDrops(t *testing.T) {
+	exporter := NewExporter(&recordingSink{}, 3)
+	for _, message := range []string{"a", "b", "c"} {
+		exporter.Export(Entry{Message: message})
+	}
+	batch, offset := exporter.peek()
+	// Two lines arrive while the batch is in flight, pushing out "a" and "b"
+	exporter.Export(Entry{Message: "d"})
+	exporter.Export(Entry{Message: "e"})
+	exporter.commit(offset, len(batch))
+
+	rest, _ := exporter.peek()
+	if len(rest) != 2 || rest[0].Message != "d" || rest[1].Message != "e" {
+		t.Fatalf("expected only the lines queued after the batch to remain, got %v", rest)
+	}
+}
+
+func TestExporterRunDelivers(t *testing.T) {
+	sink := &recordingSink{}
+	exporter := NewExporter(sink, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Run(ctx)
+
+	exporter.Export(Entry{Message: "hello"})
+	exporter.Export(Entry{Message: "world"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.messages()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lines were not delivered, got %v", sink.messages())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sink.messages(); got[0] != "hello" || got[1] != "world" {
+		t.Fatalf("unexpected delivery order %v", got)
+	}
+	if sent, _ := exporter.Stats(); sent != 2 {
+		t.Fatalf("sent = %d, want 2", sent)
+	}
+}
+
+func TestLineSplitter(t *testing.T) {
+	lines := newLineSplitter()
+	if got := lines.split("stdout", "first\r\nsec"); len(got) != 1 || got[0] != "first" {
+		t.Fatalf("unexpected lines %q", got)
+	}
+	if got := lines.split("stderr", "oops\n"); len(got) != 1 || got[0] != "oops" {
+		t.Fatalf("unexpected stderr lines %q", got)
+	}
+	if got := lines.split("stdout", "ond\nthird"); len(got) != 1 || got[0] != "second" {
+		t.Fatalf("expected the partial line to be joined, got %q", got)
+	}
+	if rest := lines.rest(); len(rest) != 1 || rest["stdout"] != "third" {
+		t.Fatalf("unexpected remainder %v", rest)
+	}
+}
@@ -0,0 +1,192 @@
+package logexport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	"github.com/sirupsen/logrus"
+)
+
+// reconcileInterval is how often the follower looks for containers to start or resume
+// following
+const reconcileInterval = 10 * time.Second
+
+// Follower streams the logs of the running containers matching a label selector into an
+// exporter. Streams end with their container; the container is followed again once it runs,
+// resuming after the last exported line so nothing is sent twice.
+type Follower struct {
+	api      docker.DockerAPI
+	streamer *docker.LogStreamer
+	selector config.LabelSelector
+	exporter *Exporter
+	host     string
+	// since is where logs start for containers not followed before
+	since time.Time
+
+	mu       sync.Mutex
+	active   map[string]bool
+	lastSeen map[string]time.Time
+}
+
+// NewFollower creates a follower exporting the logs of containers on api that match every
+// requirement of selector. host names the agent in exported lines.
+func NewFollower(api docker.DockerAPI, selector config.LabelSelector, exporter *Exporter, host string) *Follower {
+	return &Follower{
+		api:      api,
+		streamer: docker.NewLogStreamer(api),
+		selector: selector,
+		exporter: exporter,
+		host:     host,
+		since:    time.Now(),
+		active:   make(map[string]bool),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Run follows matching containers until ctx is cancelled.
+func (f *Follower) Run(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		f.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile starts a stream for every matching running container not yet followed.
+func (f *Follower) reconcile(ctx context.Context) {
+	listCtx, cancel := context.WithTimeout(ctx, sinkTimeout)
+	defer cancel()
+	containers, err := f.api.ContainerList(listCtx, types.ContainerListOptions{})
+	if err != nil {
+		logrus.WithError(err).Debug("Log export could not list containers")
+		return
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID] = true
+		if !f.selector.MatchesAll(container.Labels) {
+			continue
+		}
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		if since, ok := f.begin(container.ID); ok {
+			go f.follow(ctx, container.ID, name, since)
+		}
+	}
+	f.forget(running)
+}
+
+// begin marks a container as followed and returns where its logs resume, or false when it
+// is already followed.
+func (f *Follower) begin(containerID string) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.active[containerID] {
+		return time.Time{}, false
+	}
+	f.active[containerID] = true
+	if last, ok := f.lastSeen[containerID]; ok {
+		return last.Add(time.Nanosecond), true
+	}
+	return f.since, true
+}
+
+// forget drops the resume positions of containers that no longer run and are not followed.
+func (f *Follower) forget(running map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id := range f.lastSeen {
+		if !running[id] && !f.active[id] {
+			delete(f.lastSeen, id)
+		}
+	}
+}
+
+// follow streams one container's logs until the container stops or ctx is cancelled.
+func (f *Follower) follow(ctx context.Context, containerID, name string, since time.Time) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.active, containerID)
+		f.mu.Unlock()
+	}()
+	logrus.Debugf("Exporting logs of container %s", name)
+
+	lines := newLineSplitter()
+	options := docker.LogOptions{
+		Follow:     true,
+		Timestamps: true,
+		Since:      fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+	}
+	err := f.streamer.StreamLogs(ctx, containerID, options, func(chunk docker.LogChunk) error {
+		for _, line := range lines.split(chunk.Stream, chunk.Data) {
+			f.export(containerID, name, chunk.Stream, chunk.Timestamp, line)
+		}
+		f.mu.Lock()
+		f.lastSeen[containerID] = chunk.Timestamp
+		f.mu.Unlock()
+		return nil
+	})
+	for stream, line := range lines.rest() {
+		f.export(containerID, name, stream, time.Now(), line)
+	}
+	if err != nil && ctx.Err() == nil {
+		logrus.WithError(err).Warnf("Log export stream for container %s ended", name)
+	}
+}
+
+func (f *Follower) export(containerID, name, stream string, timestamp time.Time, message string) {
+	f.exporter.Export(Entry{
+		Host:          f.host,
+		ContainerID:   containerID,
+		ContainerName: name,
+		Stream:        stream,
+		Timestamp:     timestamp,
+		Message:       message,
+	})
+}
+
+// lineSplitter joins log data into whole lines per stream; Docker chunks may end mid-line.
+type lineSplitter struct {
+	partial map[string]string
+}
+
+func newLineSplitter() *lineSplitter {
+	return &lineSplitter{partial: make(map[string]string)}
+}
+
+// split returns the complete lines of data, keeping a trailing partial line for the next call.
+func (s *lineSplitter) split(stream, data string) []string {
+	data = s.partial[stream] + data
+	parts := strings.Split(data, "\n")
+	s.partial[stream] = parts[len(parts)-1]
+	lines := make([]string, 0, len(parts)-1)
+	for _, line := range parts[:len(parts)-1] {
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
+
+// rest returns the partial lines left when a stream ends.
+func (s *lineSplitter) rest() map[string]string {
+	rest := make(map[string]string)
+	for stream, line := range s.partial {
+		if line != "" {
+			rest[stream] = line
+		}
+	}
+	return rest
+}
@@ -0,0 +1,171 @@
+package logexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+)
+
+const (
+	sinkTimeout = 10 * time.Second
+	// syslogFacility is the user-level facility of RFC 5424
+	syslogFacility = 1
+	// syslogMaxMessage keeps a UDP datagram below common MTU-safe sizes
+	syslogMaxMessage = 2048
+)
+
+// NewSink creates the sink for a log export target.
+func NewSink(target *config.LogExportTarget) (Sink, error) {
+	switch target.Kind {
+	case config.LogExportSyslog:
+		return &syslogSink{network: target.Network, address: target.Address}, nil
+	case config.LogExportHTTP:
+		return &httpSink{url: target.Address, client: &http.Client{Timeout: sinkTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported log export sink %q", target.Kind)
+	}
+}
+
+// syslogSink writes RFC 5424 messages over UDP or TCP. TCP messages are newline framed. The
+// connection is dialed lazily and redialed after a failed write.
+type syslogSink struct {
+	network string
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *syslogSink) Send(ctx context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: sinkTimeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog at %s: %w", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout)); err != nil {
+		return s.reset(err)
+	}
+	for _, entry := range entries {
+		message := formatSyslog(entry)
+		if s.network == "tcp" {
+			message += "\n"
+		}
+		if _, err := io.WriteString(s.conn, message); err != nil {
+			return s.reset(fmt.Errorf("failed to write to syslog at %s: %w", s.address, err))
+		}
+	}
+	return nil
+}
+
+// reset drops the connection so the next send redials, and returns err.
+func (s *syslogSink) reset(err error) error {
+	s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// formatSyslog renders an entry as an RFC 5424 message. The container name is the
+// app-name and the short container ID the procid; stderr lines are logged as errors.
+func formatSyslog(entry Entry) string {
+	severity := 6
+	if entry.Stream == "stderr" {
+		severity = 3
+	}
+	message := entry.Message
+	if len(message) > syslogMaxMessage {
+		message = message[:syslogMaxMessage]
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		syslogFacility*8+severity,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		syslogField(entry.Host, 255),
+		syslogField(entry.ContainerName, 48),
+		syslogField(shortID(entry.ContainerID), 128),
+		message,
+	)
+}
+
+// syslogField makes a header field valid: printable ASCII without spaces, at most max
+// characters, and "-" when empty.
+func syslogField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// httpSink POSTs each batch as a JSON array of entries. Any non-2xx answer fails the batch.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Send(ctx context.Context, entries []Entry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post logs: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("log endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
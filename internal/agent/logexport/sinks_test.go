@@ -0,0 +1,97 @@
+package logexport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/agent/config"
+)
+
+func TestFormatSyslog(t *testing.T) {
+	entry := Entry{
+		Host:          "edge 1",
+		ContainerID:   "0123456789abcdef",
+		ContainerName: "web",
+		Stream:        "stderr",
+		Timestamp:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Message:       "connection refused",
+	}
+	want := "<11>1 2024-05-01T12:00:00Z edge_1 web 0123456789ab - - connection refused"
+	if got := formatSyslog(entry); got != want {
+		t.Fatalf("formatSyslog() = %q, want %q", got, want)
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			received <- scanner.Text()
+		}
+	}()
+
+	sink, err := NewSink(&config.LogExportTarget{Kind: config.LogExportSyslog, Network: "tcp", Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	defer sink.Close()
+	entries := []Entry{{ContainerName: "web", Stream: "stdout", Message: "one"}, {ContainerName: "web", Stream: "stdout", Message: "two"}}
+	if err := sink.Send(context.Background(), entries); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for _, want := range []string{"one", "two"} {
+		select {
+		case line := <-received:
+			if !strings.HasPrefix(line, "<14>1 ") || !strings.HasSuffix(line, " "+want) {
+				t.Fatalf("unexpected syslog line %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("syslog line %q not received", want)
+		}
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got []Entry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	sink, _ := NewSink(&config.LogExportTarget{Kind: config.LogExportHTTP, Address: server.URL + "/ingest"})
+	if err := sink.Send(context.Background(), []Entry{{ContainerName: "web", Message: "hello"}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(got) != 1 || got[0].Message != "hello" {
+		t.Fatalf("unexpected entries posted: %v", got)
+	}
+
+	down, _ := NewSink(&config.LogExportTarget{Kind: config.LogExportHTTP, Address: server.URL + "/down"})
+	if err := down.Send(context.Background(), []Entry{{Message: "hello"}}); err == nil {
+		t.Fatal("expected a 503 to fail the batch")
+	}
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -11,8 +12,10 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
 	"github.com/mikeysoft/flotilla/internal/agent/config"
 	"github.com/mikeysoft/flotilla/internal/agent/docker"
+	sharedconfig "github.com/mikeysoft/flotilla/internal/shared/config"
 	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -43,7 +46,12 @@ type Collector struct {
 	hostAutoChecked bool
 	hostAutoEnabled bool
 	hostAutoLogged  bool
-	mu              sync.RWMutex
+	// lastPayload is the most recent sample, served to live metrics requests
+	lastPayload *protocol.MetricsPayload
+	// includeLabels and excludeLabels select the containers metrics are collected for
+	includeLabels config.LabelSelector
+	excludeLabels config.LabelSelector
+	mu            sync.RWMutex
 }
 
 // MetricsSender interface for sending metrics to the server
@@ -53,6 +61,11 @@ type MetricsSender interface {
 
 // NewCollector creates a new metrics collector
 func NewCollector(cfg *config.Config, dockerClient *docker.Client, agentID, hostID string) *Collector {
+	// The selectors are checked by config validation, so a parse error leaves them unset
+	include, exclude, err := cfg.MetricsLabelSelectors()
+	if err != nil {
+		logrus.WithError(err).Warn("Ignoring invalid metrics label selectors")
+	}
 	return &Collector{
 		config:            cfg,
 		dockerClient:      dockerClient,
@@ -66,6 +79,8 @@ func NewCollector(cfg *config.Config, dockerClient *docker.Client, agentID, host
 			Write uint64
 		}),
 		ioZeroIntervals: make(map[string]int),
+		includeLabels:   include,
+		excludeLabels:   exclude,
 	}
 }
 
@@ -132,18 +147,68 @@ func (c *Collector) collectAndSend(ctx context.Context) {
 		return
 	}
 
-	// Collect container metrics
-	containerMetrics, err := c.collectContainerMetrics(ctx)
+	payload, err := c.collect(ctx)
 	if err != nil {
 		logrus.Errorf("Failed to collect container metrics: %v", err)
 		return
 	}
+	if payload == nil {
+		return
+	}
+
+	message := protocol.NewMetrics(c.agentID, payload)
+	logrus.Debugf("Sending metrics message with %d container metrics, hostID=%s", len(payload.ContainerMetrics), c.agentID)
+	c.logSerializedPreview(message)
+	if err := c.metricsSender.SendMetrics(message); err != nil {
+		logrus.Errorf("Failed to send metrics: %v", err)
+	} else {
+		logrus.Debugf("Successfully sent metrics to server")
+	}
+}
+
+// LatestMetrics returns the most recent metrics sample, collecting a fresh one when none was
+// taken within the last two collection intervals, as when collection is disabled on the agent.
+func (c *Collector) LatestMetrics(ctx context.Context) (*protocol.MetricsPayload, error) {
+	c.mu.RLock()
+	last := c.lastPayload
+	c.mu.RUnlock()
+	if last != nil && time.Since(last.Timestamp) <= 2*c.config.MetricsCollectionInterval {
+		return last, nil
+	}
 
-	logrus.Debugf("Collected %d container metrics", len(containerMetrics))
+	payload, err := c.collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("no metrics are collected on this host")
+	}
+	return payload, nil
+}
+
+// collect takes one metrics sample and records it as the latest. It returns nil when the
+// configured mode collects nothing or host-only collection failed.
+func (c *Collector) collect(ctx context.Context) (*protocol.MetricsPayload, error) {
+	collectContainers, collectHost := c.collectionScopes()
+	if !collectContainers && !collectHost {
+		logrus.Debug("No metrics enabled for this host, skipping collection")
+		return nil, nil
+	}
+
+	// Collect container metrics
+	var containerMetrics []protocol.ContainerMetric
+	if collectContainers {
+		var err error
+		containerMetrics, err = c.collectContainerMetrics(ctx)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Collected %d container metrics", len(containerMetrics))
+	}
 
 	// Host metrics
 	var hostMetrics *protocol.HostMetric
-	if c.shouldCollectHostMetrics() {
+	if collectHost {
 		logrus.Debugf("Collecting host metrics...")
 		hm, herr := c.collectHostMetrics()
 		if herr != nil {
@@ -153,16 +218,32 @@ func (c *Collector) collectAndSend(ctx context.Context) {
 			logrus.Debugf("Collected host metrics: CPU=%.2f%%, Memory=%d/%d", hostMetrics.CPUPercent, hostMetrics.MemoryUsage, hostMetrics.MemoryTotal)
 		}
 	}
+	if !collectContainers && hostMetrics == nil {
+		// Host-only collection failed, so there is nothing to report
+		return nil, nil
+	}
+
+	if invalid := sanitizeMetrics(containerMetrics, hostMetrics); invalid > 0 {
+		logrus.Warnf("metrics: dropped %d NaN or infinite percentages before sending", invalid)
+	}
 
-	// Create metrics payload and message
 	payload := c.buildMetricsPayload(containerMetrics, hostMetrics)
-	message := protocol.NewMetrics(c.agentID, payload)
-	logrus.Debugf("Sending metrics message with %d container metrics, hostID=%s", len(payload.ContainerMetrics), c.agentID)
-	c.logSerializedPreview(message)
-	if err := c.metricsSender.SendMetrics(message); err != nil {
-		logrus.Errorf("Failed to send metrics: %v", err)
-	} else {
-		logrus.Debugf("Successfully sent metrics to server")
+	c.mu.Lock()
+	c.lastPayload = payload
+	c.mu.Unlock()
+	return payload, nil
+}
+
+// collectionScopes reports which metrics the configured mode collects. Host-only mode always
+// collects host metrics; otherwise host metrics follow the explicit and autodetect settings.
+func (c *Collector) collectionScopes() (containers bool, host bool) {
+	switch c.config.MetricsMode {
+	case sharedconfig.MetricsModeHost:
+		return false, true
+	case sharedconfig.MetricsModeContainers:
+		return true, false
+	default:
+		return true, c.shouldCollectHostMetrics()
 	}
 }
 
@@ -256,9 +337,20 @@ func (c *Collector) collectContainerMetrics(ctx context.Context) ([]protocol.Con
 	}
 
 	var metrics []protocol.ContainerMetric
+	active := make(map[string]struct{}, len(containers))
 
 	for _, container := range containers {
+		// Containers that stopped since the listing have no stats worth reporting
+		if !containerHasStats(container.State) || !c.selectsContainer(container.Labels) {
+			continue
+		}
+		active[container.ID] = struct{}{}
+
 		metric, err := c.collectContainerMetric(ctx, container.ID, container.Names[0])
+		if errors.Is(err, errContainerNotRunning) || errdefs.IsNotFound(err) {
+			logrus.Debugf("Skipping metrics for container %s: %v", container.ID, err)
+			continue
+		}
 		if err != nil {
 			logrus.Errorf("Failed to collect metrics for container %s: %v", container.ID, err)
 			continue
@@ -273,10 +365,48 @@ func (c *Collector) collectContainerMetrics(ctx context.Context) ([]protocol.Con
 
 		metrics = append(metrics, *metric)
 	}
+	c.forgetInactiveContainers(active)
 
 	return metrics, nil
 }
 
+// selectsContainer reports whether the configured label selectors include a container.
+func (c *Collector) selectsContainer(labels map[string]string) bool {
+	return c.includeLabels.MatchesAll(labels) && !c.excludeLabels.MatchesAny(labels)
+}
+
+// errContainerNotRunning is returned when a container stops between being listed and its
+// stats being read; Docker then answers with an empty sample rather than an error.
+var errContainerNotRunning = errors.New("container is not running")
+
+// containerHasStats reports whether a container in the given state produces stats samples.
+func containerHasStats(state string) bool {
+	return state == "running" || state == "paused"
+}
+
+// forgetInactiveContainers drops the previous samples of containers that are no longer
+// running, so a restarted container starts from a fresh baseline.
+func (c *Collector) forgetInactiveContainers(active map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.previousStats {
+		if _, ok := active[id]; !ok {
+			delete(c.previousStats, id)
+			delete(c.previousStatsTime, id)
+		}
+	}
+	for id := range c.previousIOTotals {
+		if _, ok := active[id]; !ok {
+			delete(c.previousIOTotals, id)
+		}
+	}
+	for id := range c.ioZeroIntervals {
+		if _, ok := active[id]; !ok {
+			delete(c.ioZeroIntervals, id)
+		}
+	}
+}
+
 // collectContainerMetric collects metrics for a single container
 func (c *Collector) collectContainerMetric(ctx context.Context, containerID, containerName string) (*protocol.ContainerMetric, error) {
 	// Get container stats
@@ -284,6 +414,9 @@ func (c *Collector) collectContainerMetric(ctx context.Context, containerID, con
 	if err != nil {
 		return nil, fmt.Errorf("failed to get container stats: %w", err)
 	}
+	if docker.IsEmptyStats(&statsJSON.Stats) {
+		return nil, errContainerNotRunning
+	}
 
 	// Calculate CPU percentage
 	cpuPercent := c.calculateCPUPercent(statsJSON, containerID)
@@ -507,14 +640,36 @@ func (c *Collector) calculateCPUPercent(stats *types.StatsJSON, containerID stri
 		return c.cpuPercentFromPreCPU(stats)
 	}
 
-	cpuPercent := c.cpuPercentFromDelta(stats, previousStats)
-	if cpuPercent < 0 {
-		cpuPercent = 0
+	return c.cpuPercentFromDelta(stats, previousStats)
+}
+
+// sanitizePercent clamps a percentage to [0, 100]. NaN and infinite values are reported as
+// invalid since they cannot be encoded in JSON and would fail the whole metrics message.
+func sanitizePercent(v float64) (float64, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return math.Min(math.Max(v, 0), 100), true
+}
+
+// sanitizeMetrics clamps every percentage in the metrics about to be sent and zeroes NaN and
+// infinite ones, keeping the absolute values of the same samples. It returns how many
+// percentages were invalid.
+func sanitizeMetrics(containerMetrics []protocol.ContainerMetric, hostMetrics *protocol.HostMetric) int {
+	invalid := 0
+	for i := range containerMetrics {
+		var ok bool
+		if containerMetrics[i].CPUPercent, ok = sanitizePercent(containerMetrics[i].CPUPercent); !ok {
+			invalid++
+		}
 	}
-	if cpuPercent > 100 {
-		cpuPercent = 100
+	if hostMetrics != nil {
+		var ok bool
+		if hostMetrics.CPUPercent, ok = sanitizePercent(hostMetrics.CPUPercent); !ok {
+			invalid++
+		}
 	}
-	return cpuPercent
+	return invalid
 }
 
 // cpuPercentFromPreCPU computes first-sample CPU% using PreCPUStats when available.
@@ -522,6 +677,10 @@ func (c *Collector) cpuPercentFromPreCPU(stats *types.StatsJSON) float64 {
 	if stats.PreCPUStats.SystemUsage <= 0 {
 		return 0.0
 	}
+	// Counters that went backwards would wrap around as unsigned deltas
+	if stats.CPUStats.CPUUsage.TotalUsage < stats.PreCPUStats.CPUUsage.TotalUsage || stats.CPUStats.SystemUsage < stats.PreCPUStats.SystemUsage {
+		return 0.0
+	}
 	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage - stats.PreCPUStats.CPUUsage.TotalUsage)
 	systemDelta := float64(stats.CPUStats.SystemUsage - stats.PreCPUStats.SystemUsage)
 	if systemDelta <= 0 || cpuDelta < 0 {
@@ -531,8 +690,12 @@ func (c *Collector) cpuPercentFromPreCPU(stats *types.StatsJSON) float64 {
 	return (cpuDelta / systemDelta) * float64(cpuCount) * 100.0
 }
 
-// cpuPercentFromDelta computes CPU% using deltas against previous sample.
+// cpuPercentFromDelta computes CPU% using deltas against previous sample. Counters that went
+// backwards since the previous sample, as after a container restart, fall back to PreCPUStats.
 func (c *Collector) cpuPercentFromDelta(current *types.StatsJSON, previous *types.StatsJSON) float64 {
+	if current.CPUStats.CPUUsage.TotalUsage < previous.CPUStats.CPUUsage.TotalUsage || current.CPUStats.SystemUsage < previous.CPUStats.SystemUsage {
+		return c.cpuPercentFromPreCPU(current)
+	}
 	cpuDelta := float64(current.CPUStats.CPUUsage.TotalUsage - previous.CPUStats.CPUUsage.TotalUsage)
 	systemDelta := float64(current.CPUStats.SystemUsage - previous.CPUStats.SystemUsage)
 	if systemDelta <= 0 || cpuDelta < 0 {
@@ -1,7 +1,10 @@
 package metrics
 
 import (
+	"context"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	agentconfig "github.com/mikeysoft/flotilla/internal/agent/config"
@@ -51,6 +54,27 @@ func TestShouldCollectHostMetrics(t *testing.T) {
 	}
 }
 
+func TestCollectionScopes(t *testing.T) {
+	collector := newTestCollector()
+	collector.config.MetricsMode = sharedconfig.MetricsModeHost
+	if containers, host := collector.collectionScopes(); containers || !host {
+		t.Fatalf("expected host-only collection, got containers=%t host=%t", containers, host)
+	}
+
+	collector = newTestCollector()
+	collector.config.MetricsMode = sharedconfig.MetricsModeContainers
+	collector.config.MetricsCollectHostStats = true
+	if containers, host := collector.collectionScopes(); !containers || host {
+		t.Fatalf("expected container-only collection, got containers=%t host=%t", containers, host)
+	}
+
+	collector = newTestCollector()
+	collector.config.MetricsCollectHostStats = true
+	if containers, host := collector.collectionScopes(); !containers || !host {
+		t.Fatalf("expected both scopes by default, got containers=%t host=%t", containers, host)
+	}
+}
+
 func TestCalculateCPUPercentFirstSample(t *testing.T) {
 	collector := newTestCollector()
 	stats := &types.StatsJSON{
@@ -92,3 +116,93 @@ func TestResolveCpuCountFallback(t *testing.T) {
 		t.Fatalf("expected cpu count 4, got %d", got)
 	}
 }
+
+func TestSanitizeMetrics(t *testing.T) {
+	containerMetrics := []protocol.ContainerMetric{
+		{ContainerID: "over", CPUPercent: 250, MemoryUsage: 10},
+		{ContainerID: "under", CPUPercent: -5},
+		{ContainerID: "nan", CPUPercent: math.NaN(), MemoryUsage: 20},
+		{ContainerID: "ok", CPUPercent: 42.5},
+	}
+	hostMetrics := &protocol.HostMetric{CPUPercent: math.Inf(1), MemoryUsage: 30}
+
+	if invalid := sanitizeMetrics(containerMetrics, hostMetrics); invalid != 2 {
+		t.Fatalf("expected 2 invalid percentages, got %d", invalid)
+	}
+	want := []float64{100, 0, 0, 42.5}
+	for i, m := range containerMetrics {
+		if m.CPUPercent != want[i] {
+			t.Fatalf("%s: cpu percent = %v, want %v", m.ContainerID, m.CPUPercent, want[i])
+		}
+	}
+	if containerMetrics[2].MemoryUsage != 20 || hostMetrics.CPUPercent != 0 || hostMetrics.MemoryUsage != 30 {
+		t.Fatalf("absolute values must survive sanitizing: %+v %+v", containerMetrics[2], hostMetrics)
+	}
+
+	payload, err := protocol.NewMetrics("agent", &protocol.MetricsPayload{ContainerMetrics: containerMetrics, HostMetrics: hostMetrics}).Serialize()
+	if err != nil || len(payload) == 0 {
+		t.Fatalf("sanitized metrics should serialize: %v", err)
+	}
+}
+
+func TestCPUPercentAfterCounterReset(t *testing.T) {
+	collector := newTestCollector()
+	previous := &types.StatsJSON{Stats: types.Stats{CPUStats: types.CPUStats{
+		CPUUsage:    types.CPUUsage{TotalUsage: 5000},
+		SystemUsage: 10000,
+	}}}
+	// The container restarted: its usage counter starts over below the previous sample
+	current := &types.StatsJSON{Stats: types.Stats{
+		CPUStats:    types.CPUStats{CPUUsage: types.CPUUsage{TotalUsage: 100}, SystemUsage: 12000, OnlineCPUs: 1},
+		PreCPUStats: types.CPUStats{CPUUsage: types.CPUUsage{TotalUsage: 50}, SystemUsage: 11000},
+	}}
+	if got := collector.cpuPercentFromDelta(current, previous); got != 5 {
+		t.Fatalf("expected the PreCPUStats fallback of 5%%, got %v", got)
+	}
+}
+
+func TestLatestMetricsReturnsRecentSample(t *testing.T) {
+	collector := newTestCollector()
+	collector.config.MetricsCollectionInterval = 30 * time.Second
+	sample := collector.buildMetricsPayload([]protocol.ContainerMetric{{ContainerID: "c1"}}, nil)
+	collector.lastPayload = sample
+
+	got, err := collector.LatestMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("LatestMetrics returned error: %v", err)
+	}
+	if got != sample {
+		t.Fatalf("expected the recent sample to be reused, got %#v", got)
+	}
+}
+
+func TestSelectsContainerByLabels(t *testing.T) {
+	cfg := &agentconfig.Config{
+		AgentConfig: sharedconfig.AgentConfig{
+			MetricsEnabled:       true,
+			MetricsIncludeLabels: "com.docker.compose.project",
+			MetricsExcludeLabels: "io.flotilla.sidecar,role=monitoring",
+		},
+	}
+	collector := NewCollector(cfg, nil, "agent-1", "host-1")
+
+	cases := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"com.docker.compose.project": "web"}, true},
+		{map[string]string{"com.docker.compose.project": "web", "io.flotilla.sidecar": "true"}, false},
+		{map[string]string{"com.docker.compose.project": "web", "role": "monitoring"}, false},
+		{map[string]string{"role": "app"}, false},
+		{nil, false},
+	}
+	for _, tc := range cases {
+		if got := collector.selectsContainer(tc.labels); got != tc.want {
+			t.Fatalf("selectsContainer(%v) = %t, want %t", tc.labels, got, tc.want)
+		}
+	}
+
+	if !newTestCollector().selectsContainer(nil) {
+		t.Fatal("expected every container to be selected without selectors")
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const defaultHostCgroupRoot = "/host/sys/fs/cgroup"
+
+// Disk I/O sources reported by IOStatus.
+const (
+	IOSourceDockerBlkio    = "docker_blkio"
+	IOSourceCgroupFallback = "cgroup_fallback"
+)
+
+// IOStatus explains where container disk I/O metrics come from on this host. Docker reports
+// no block I/O on many cgroup v2 hosts, so the collector reads io.stat from the host cgroup
+// tree instead, which can make I/O numbers differ between hosts.
+type IOStatus struct {
+	CgroupVersion    string `json:"cgroup_version"` // "1", "2" or "unknown"
+	CgroupRoot       string `json:"cgroup_root"`
+	Source           string `json:"io_source"`
+	FallbackForced   bool   `json:"io_fallback_forced"`
+	FallbackDetected bool   `json:"io_fallback_detected"`
+}
+
+// detectCgroupVersion reports the cgroup version mounted at root: cgroup v2 exposes
+// cgroup.controllers at the root of its unified hierarchy, while v1 mounts one directory per
+// controller.
+func detectCgroupVersion(root string) string {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return "2"
+	}
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		return "1"
+	}
+	return "unknown"
+}
+
+// IOStatus reports the detected cgroup version and whether disk I/O comes from Docker or
+// from the cgroup fallback.
+func (c *Collector) IOStatus() IOStatus {
+	root := c.config.HostCgroupRoot
+	if root == "" {
+		root = defaultHostCgroupRoot
+	}
+
+	c.mu.RLock()
+	detected := c.ioFallbackActive
+	c.mu.RUnlock()
+
+	status := IOStatus{
+		CgroupVersion:    detectCgroupVersion(root),
+		CgroupRoot:       root,
+		Source:           IOSourceDockerBlkio,
+		FallbackForced:   c.config.MetricsCollectDiskIOFallback,
+		FallbackDetected: detected,
+	}
+	if status.FallbackForced || status.FallbackDetected {
+		status.Source = IOSourceCgroupFallback
+	}
+	return status
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	agentconfig "github.com/mikeysoft/flotilla/internal/agent/config"
+	sharedconfig "github.com/mikeysoft/flotilla/internal/shared/config"
+)
+
+func TestDetectCgroupVersion(t *testing.T) {
+	v1 := t.TempDir()
+	if got := detectCgroupVersion(v1); got != "1" {
+		t.Fatalf("detectCgroupVersion(v1) = %q, want 1", got)
+	}
+
+	v2 := t.TempDir()
+	if err := os.WriteFile(filepath.Join(v2, "cgroup.controllers"), []byte("cpu io memory\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := detectCgroupVersion(v2); got != "2" {
+		t.Fatalf("detectCgroupVersion(v2) = %q, want 2", got)
+	}
+
+	if got := detectCgroupVersion(filepath.Join(v1, "missing")); got != "unknown" {
+		t.Fatalf("detectCgroupVersion(missing) = %q, want unknown", got)
+	}
+}
+
+func TestIOStatusReportsFallback(t *testing.T) {
+	cfg := &agentconfig.Config{AgentConfig: sharedconfig.AgentConfig{HostCgroupRoot: t.TempDir()}}
+	collector := NewCollector(cfg, nil, "agent", "host")
+
+	if status := collector.IOStatus(); status.Source != IOSourceDockerBlkio || status.CgroupVersion != "1" {
+		t.Fatalf("unexpected initial status: %+v", status)
+	}
+
+	// Containers without blkio entries switch the collector to the cgroup fallback
+	collector.updateIoFallbackState("c1", false, false)
+	status := collector.IOStatus()
+	if status.Source != IOSourceCgroupFallback || !status.FallbackDetected || status.FallbackForced {
+		t.Fatalf("expected a detected fallback, got %+v", status)
+	}
+}
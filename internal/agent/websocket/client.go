@@ -69,6 +69,7 @@ func (c *Client) Connect(ctx context.Context) error {
 	// Connect to WebSocket
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     protocol.AgentSubprotocols(protocol.AgentCapabilities),
 	}
 
 	if strings.EqualFold(os.Getenv("SKIP_TLS_VERIFY"), "true") {
@@ -88,7 +89,7 @@ func (c *Client) Connect(ctx context.Context) error {
 	c.conn = conn
 	c.connected = true
 
-	logrus.Infof("Connected to server at %s", u.String())
+	logrus.WithField("protocol", conn.Subprotocol()).Infof("Connected to server at %s", u.String())
 
 	// Start goroutines for reading and writing
 	go c.readPump()
@@ -163,11 +164,11 @@ func (c *Client) readPump() {
 	}()
 
 	c.conn.SetReadLimit(512)
-	if err := c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.config.ReadDeadline())); err != nil {
 		logrus.WithError(err).Warn("Failed to set initial read deadline for agent websocket")
 	}
 	c.conn.SetPongHandler(func(string) error {
-		if err := c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.config.ReadDeadline())); err != nil {
 			logrus.WithError(err).Warn("Failed to extend read deadline for agent websocket")
 		}
 		return nil
@@ -210,7 +211,7 @@ func (c *Client) readPump() {
 
 // writePump pumps messages to the websocket connection
 func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second) // Send pings
+	ticker := time.NewTicker(c.config.PingInterval())
 	defer ticker.Stop()
 
 	for {
@@ -218,7 +219,7 @@ func (c *Client) writePump() {
 		case <-c.stopCh:
 			return
 		case command := <-c.commandCh:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			if err := c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteDeadline())); err != nil {
 				logrus.WithError(err).Warn("Failed to set write deadline for command")
 				return
 			}
@@ -232,7 +233,7 @@ func (c *Client) writePump() {
 				return
 			}
 		case <-ticker.C:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			if err := c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteDeadline())); err != nil {
 				logrus.WithError(err).Warn("Failed to set ping write deadline")
 				return
 			}
@@ -271,7 +272,7 @@ func (c *Client) heartbeatLoop() {
 					continue
 				}
 
-				if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				if err := c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteDeadline())); err != nil {
 					logrus.WithError(err).Warn("Failed to set heartbeat write deadline")
 					continue
 				}
@@ -335,7 +336,7 @@ func (c *Client) SendLogEvent(containerID, data, stream string, timestamp time.T
 	event := protocol.NewEvent("log_data", map[string]interface{}{
 		"container_id": containerID,
 		"data":         data,
-		"timestamp":    timestamp.Format(time.RFC3339),
+		"timestamp":    timestamp.UTC().Format(time.RFC3339Nano),
 		"stream":       stream,
 	})
 
@@ -344,7 +345,7 @@ func (c *Client) SendLogEvent(containerID, data, stream string, timestamp time.T
 		return fmt.Errorf("failed to serialize log event: %v", err)
 	}
 
-	if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteDeadline())); err != nil {
 		return fmt.Errorf("failed to set log event write deadline: %w", err)
 	}
 	if err := c.conn.WriteMessage(websocket.TextMessage, eventData); err != nil {
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	invalidAgentResponseMsg = "Invalid response format from agent"
+	// maxPayloadShapeLen caps the payload shape written to logs for a malformed response
+	maxPayloadShapeLen = 512
+)
+
+// malformedResponseError reports a field of a successful agent response that is missing or
+// has an unexpected type, typically because server and agent run different versions.
+type malformedResponseError struct {
+	field    string
+	expected string
+	got      string
+}
+
+func (e *malformedResponseError) Error() string {
+	if e.got == "" {
+		return fmt.Sprintf("agent response field %q is missing, expected %s", e.field, e.expected)
+	}
+	return fmt.Sprintf("agent response field %q is %s, expected %s", e.field, e.got, e.expected)
+}
+
+// jsonKind names the JSON type of a decoded value.
+func jsonKind(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return fmt.Sprintf("array[%d]", len(v))
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64, json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// malformedField describes why decoding a response failed when decodeErr is set, or
+// otherwise why response[field] is not of the expected kind ("array" or "object").
+func malformedField(response map[string]any, field, expected string, decodeErr error) error {
+	if decodeErr != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(decodeErr, &typeErr) && typeErr.Field != "" {
+			return &malformedResponseError{field: typeErr.Field, expected: typeErr.Type.String(), got: typeErr.Value}
+		}
+		return fmt.Errorf("agent response could not be decoded: %w", decodeErr)
+	}
+	value, ok := response[field]
+	if !ok {
+		return &malformedResponseError{field: field, expected: expected}
+	}
+	return &malformedResponseError{field: field, expected: expected, got: jsonKind(value)}
+}
+
+// payloadShape summarizes a response for logs as its keys and their JSON types, without
+// values so that secrets in the payload never reach the log.
+func payloadShape(response map[string]any) string {
+	keys := make([]string, 0, len(response))
+	for key := range response {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+": "+jsonKind(response[key]))
+	}
+	shape := "{" + strings.Join(parts, ", ") + "}"
+	if len(shape) > maxPayloadShapeLen {
+		shape = shape[:maxPayloadShapeLen] + "..."
+	}
+	return shape
+}
+
+// logMalformedResponse logs a malformed agent response with its payload shape.
+func logMalformedResponse(hostID string, response map[string]any, err error) {
+	logrus.WithFields(logrus.Fields{
+		"host_id":       hostID,
+		"payload_shape": payloadShape(response),
+	}).Errorf("Malformed response from agent: %v", err)
+}
+
+// respondMalformedResponse logs a malformed agent response and writes a 500 naming the
+// offending field.
+func respondMalformedResponse(c *gin.Context, hostID string, response map[string]any, err error) {
+	logMalformedResponse(hostID, response, err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   invalidAgentResponseMsg,
+		"details": err.Error(),
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestMalformedField(t *testing.T) {
+	cases := []struct {
+		name     string
+		response map[string]any
+		want     string
+	}{
+		{"missing", map[string]any{"status": "success"}, `agent response field "images" is missing, expected array`},
+		{"wrong type", map[string]any{"images": "none"}, `agent response field "images" is string, expected array`},
+		{"null", map[string]any{"images": nil}, `agent response field "images" is null, expected array`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := malformedField(tc.response, "images", "array", nil).Error(); got != tc.want {
+				t.Fatalf("malformedField() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// Decode errors name the field the agent got wrong
+	response := map[string]any{"images": []any{"sha256:abc"}}
+	var result protocol.ImageListResult
+	err := malformedField(response, "images", "array", protocol.DecodeResult(response, &result))
+	if !strings.Contains(err.Error(), `field "images`) || !strings.Contains(err.Error(), "is string") {
+		t.Fatalf("expected the decode error to name the field and type, got %q", err)
+	}
+}
+
+func TestPayloadShape(t *testing.T) {
+	shape := payloadShape(map[string]any{"stacks": []any{1, 2}, "status": "success", "secret": "hunter2"})
+	if shape != "{secret: string, stacks: array[2], status: string}" {
+		t.Fatalf("unexpected payload shape %q", shape)
+	}
+
+	large := map[string]any{}
+	for i := 0; i < 100; i++ {
+		large[strings.Repeat("k", i+1)] = i
+	}
+	if shape := payloadShape(large); len(shape) != maxPayloadShapeLen+3 || !strings.HasSuffix(shape, "...") {
+		t.Fatalf("expected the shape to be truncated, got %d bytes", len(shape))
+	}
+}
@@ -31,6 +31,7 @@ func NewAPIKeysHandler() *APIKeysHandler {
 type CreateAPIKeyRequest struct {
 	Name   string `json:"name" binding:"required"`
 	HostID string `json:"host_id,omitempty"`
+	Scope  string `json:"scope,omitempty"` // agent (default) or deploy
 }
 
 // CreateAPIKeyResponse represents the response after creating an API key
@@ -39,6 +40,7 @@ type CreateAPIKeyResponse struct {
 	Prefix string `json:"prefix"`
 	Name   string `json:"name"`
 	HostID string `json:"host_id,omitempty"`
+	Scope  string `json:"scope"`
 }
 
 // APIKeyResponse represents an API key in responses (without secret)
@@ -50,6 +52,7 @@ type APIKeyResponse struct {
 	CreatedAt time.Time  `json:"created_at"`
 	LastUsed  *time.Time `json:"last_used,omitempty"`
 	IsActive  bool       `json:"is_active"`
+	Scope     string     `json:"scope"`
 }
 
 // CreateAPIKey creates a new API key for agent authentication
@@ -65,6 +68,17 @@ func (h *APIKeysHandler) CreateAPIKey(c *gin.Context) {
 		return
 	}
 
+	scope := strings.ToLower(strings.TrimSpace(req.Scope))
+	if scope == "" {
+		scope = auth.APIKeyScopeAgent
+	}
+	if !auth.IsValidAPIKeyScope(scope) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid scope. Must be one of: agent, deploy",
+		})
+		return
+	}
+
 	// Get current user ID from context
 	userIDStr, exists := c.Get("user_id")
 	if !exists {
@@ -108,6 +122,7 @@ func (h *APIKeysHandler) CreateAPIKey(c *gin.Context) {
 		HostID:    hostUUID,
 		CreatedBy: &userID,
 		IsActive:  true,
+		Scope:     scope,
 	}
 
 	// Save to database
@@ -131,6 +146,7 @@ func (h *APIKeysHandler) CreateAPIKey(c *gin.Context) {
 		"name":    req.Name,
 		"prefix":  prefix,
 		"host_id": req.HostID,
+		"scope":   scope,
 	}, c.ClientIP(), c.GetHeader(userAgentHeader)); err != nil {
 		logrus.WithError(err).Warn("Failed to record api_key_created audit event")
 	}
@@ -140,6 +156,7 @@ func (h *APIKeysHandler) CreateAPIKey(c *gin.Context) {
 		Prefix: prefix,
 		Name:   req.Name,
 		HostID: req.HostID,
+		Scope:  scope,
 	})
 }
 
@@ -172,6 +189,11 @@ func (h *APIKeysHandler) ListAPIKeys(c *gin.Context) {
 			prefix = *key.Prefix
 		}
 
+		scope := key.Scope
+		if scope == "" {
+			scope = auth.APIKeyScopeAgent
+		}
+
 		responses[i] = APIKeyResponse{
 			ID:        key.ID.String(),
 			Name:      key.Name,
@@ -180,6 +202,7 @@ func (h *APIKeysHandler) ListAPIKeys(c *gin.Context) {
 			CreatedAt: key.CreatedAt,
 			LastUsed:  key.LastUsed,
 			IsActive:  key.IsActive,
+			Scope:     scope,
 		}
 	}
 
@@ -9,6 +9,7 @@ import (
 	"github.com/mikeysoft/flotilla/internal/server/auth"
 	"github.com/mikeysoft/flotilla/internal/server/database"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
@@ -130,12 +131,20 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
 		return
 	}
-	// Rotate refresh
+	// Rotate refresh; revoking the old token and storing the new one happen together so a
+	// failure cannot leave the session without a usable refresh token
 	now := time.Now()
-	_ = database.DB.Model(&rt).Update("revoked_at", now).Error
 	newTokenID := uuid.New()
 	nrt := database.RefreshToken{UserID: u.ID, FamilyID: rt.FamilyID, TokenID: newTokenID, CreatedAt: now, ExpiresAt: now.Add(14 * 24 * time.Hour)}
-	_ = database.DB.Create(&nrt).Error
+	if err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rt).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&nrt).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+		return
+	}
 	c.SetCookie("flotilla_refresh", newTokenID.String(), int((14 * 24 * time.Hour).Seconds()), "/", "", true, true)
 	// Issue new access
 	jti := uuid.New().String()
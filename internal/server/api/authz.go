@@ -8,17 +8,21 @@ import (
 )
 
 func ensureAdmin(c *gin.Context) bool {
-	roleValue, exists := c.Get("role")
-	if !exists {
+	if !hasAdminRole(c) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 		return false
 	}
-	role, ok := roleValue.(string)
-	if !ok || !strings.EqualFold(role, "admin") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	return true
+}
+
+// hasAdminRole reports whether the authenticated user on the request is an admin.
+func hasAdminRole(c *gin.Context) bool {
+	roleValue, exists := c.Get("role")
+	if !exists {
 		return false
 	}
-	return true
+	role, ok := roleValue.(string)
+	return ok && strings.EqualFold(role, "admin")
 }
 
 func normalizeRole(role string) string {
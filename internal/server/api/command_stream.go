@@ -0,0 +1,67 @@
+package api
+
+import (
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/server/websocket"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+// sendCommandAndStream sends a command asking the agent to report its progress and waits
+// for the final response. Progress reports are forwarded to progress when it is set, and
+// each one restarts idleTimeout, so a long deployment or pull only times out once the agent
+// stops reporting. Agents without progress support answer like sendCommandAndWait.
+func sendCommandAndStream(hub *websocket.Hub, agentID string, command *protocol.Message, idleTimeout time.Duration, progress chan<- protocol.Progress) (map[string]any, error) {
+	if params, ok := command.Payload["params"].(map[string]any); ok {
+		params[protocol.ParamStreamProgress] = true
+	}
+
+	responseCh := hub.SubscribeResponse(command.ID)
+	defer hub.UnsubscribeResponse(command.ID)
+	progressCh := hub.SubscribeProgress(command.ID)
+	defer hub.UnsubscribeProgress(command.ID)
+
+	if err := hub.SendCommand(agentID, command); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case report := <-progressCh:
+			if progress != nil {
+				select {
+				case progress <- report:
+				default:
+				}
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idleTimeout)
+		case response := <-responseCh:
+			if response == nil || response.AgentID != agentID {
+				continue
+			}
+			return commandResponseData(response)
+		case <-timer.C:
+			return nil, protocol.ErrCommandTimeout
+		}
+	}
+}
+
+// commandResponseData returns the data of an agent's response to a command.
+func commandResponseData(response *websocket.CommandResponse) (map[string]any, error) {
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	if response.Response != nil {
+		if responseData, ok := response.Response.Payload["data"].(map[string]any); ok {
+			return responseData, nil
+		}
+		return response.Response.Payload, nil
+	}
+	return map[string]any{"message": "Command completed"}, nil
+}
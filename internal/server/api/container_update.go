@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// RollingUpdateContainer pulls a container's image and recreates the container only when a
+// newer image was found. The response status is "updated" or "up_to_date".
+func (h *HostsHandler) RollingUpdateContainer(c *gin.Context) {
+	hostID := c.Param("id")
+	containerID := c.Param("container_id")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	params := map[string]any{"container_id": containerID}
+	if timeoutStr := c.Query("timeout"); timeoutStr != "" {
+		timeout, err := strconv.Atoi(timeoutStr)
+		if err != nil || timeout < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must be a non-negative number of seconds"})
+			return
+		}
+		params["timeout"] = timeout
+	}
+
+	// The pull dominates and reports no progress of its own, so it gets the pull timeout
+	command := protocol.NewCommandWithAction("rolling_update_container", params)
+	response, err := sendCommandAndStream(h.hub, agent.ID, command, pullImagesTimeout, nil)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to update container %s on host %s: %v", containerID, hostID, err)
+		h.addLog("error", "container", "Container update failed", map[string]any{
+			"host_id":      host.ID.String(),
+			"host_name":    host.Name,
+			"container_id": containerID,
+			"error":        err.Error(),
+		})
+		respondCommandError(c, err, "Failed to update container")
+		return
+	}
+
+	if status, _ := response["status"].(string); status == "updated" {
+		h.addLog("info", "container", "Container updated to a newer image", map[string]any{
+			"host_id":               host.ID.String(),
+			"host_name":             host.Name,
+			"container_id":          response["container_id"],
+			"previous_container_id": containerID,
+			"image":                 response["image"],
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
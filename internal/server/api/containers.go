@@ -2,11 +2,13 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +26,9 @@ type ContainersHandler struct {
 	hub      *websocket.Hub
 	logs     *appLogs.Manager
 	topology *topology.Manager
+
+	// publishedURLScheme is the scheme of published URLs for ports without a TLS convention
+	publishedURLScheme string
 }
 
 // NewContainersHandler creates a new containers handler
@@ -32,6 +37,8 @@ func NewContainersHandler(hub *websocket.Hub, logs *appLogs.Manager, topologyMan
 		hub:      hub,
 		logs:     logs,
 		topology: topologyManager,
+
+		publishedURLScheme: "http",
 	}
 }
 
@@ -51,59 +58,6 @@ func (h *ContainersHandler) addLog(level, source, message string, fields map[str
 	})
 }
 
-func toStringSlice(value any) []string {
-	switch v := value.(type) {
-	case []string:
-		return v
-	case []interface{}:
-		out := make([]string, 0, len(v))
-		for _, item := range v {
-			if s, ok := item.(string); ok {
-				out = append(out, s)
-			}
-		}
-		return out
-	default:
-		return nil
-	}
-}
-
-func decodeRemovalConflicts(value any) []protocol.ResourceRemovalConflict {
-	if value == nil {
-		return nil
-	}
-
-	bytes, err := json.Marshal(value)
-	if err != nil {
-		return nil
-	}
-
-	var conflicts []protocol.ResourceRemovalConflict
-	if err := json.Unmarshal(bytes, &conflicts); err != nil {
-		return nil
-	}
-
-	return conflicts
-}
-
-func decodeRemovalErrors(value any) []protocol.ResourceRemovalError {
-	if value == nil {
-		return nil
-	}
-
-	bytes, err := json.Marshal(value)
-	if err != nil {
-		return nil
-	}
-
-	var removalErrors []protocol.ResourceRemovalError
-	if err := json.Unmarshal(bytes, &removalErrors); err != nil {
-		return nil
-	}
-
-	return removalErrors
-}
-
 // GetContainer returns details about a specific container
 func (h *ContainersHandler) GetContainer(c *gin.Context) {
 	hostID := c.Param("id")
@@ -152,9 +106,7 @@ func (h *ContainersHandler) GetContainer(c *gin.Context) {
 			"container_id": containerID,
 			"error":        err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve container",
-		})
+		respondCommandError(c, err, "Failed to retrieve container")
 		return
 	}
 
@@ -227,9 +179,7 @@ func (h *ContainersHandler) GetContainerLogs(c *gin.Context) {
 			"container_id": containerID,
 			"error":        err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve container logs",
-		})
+		respondCommandError(c, err, "Failed to retrieve container logs")
 		return
 	}
 
@@ -274,15 +224,117 @@ func (h *ContainersHandler) GetContainerStats(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get stats for container %s from host %s: %v", containerID, hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve container stats",
-		})
+		respondCommandError(c, err, "Failed to retrieve container stats")
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+const (
+	// containerDetailTimeout bounds the whole detail request; its commands run concurrently
+	containerDetailTimeout = 20 * time.Second
+	defaultDetailLogTail   = 50
+	maxDetailLogTail       = 1000
+)
+
+// GetContainerDetail returns a container's inspect data together with a stats sample and the
+// tail of its logs, fetched from the agent concurrently so a detail page needs one request.
+// Stats and logs are best effort: a failure there is reported next to the other results,
+// while a failed inspect fails the request. published_urls lists ready-to-use URLs for the
+// container's published TCP ports; url_host and url_scheme override the host and scheme.
+func (h *ContainersHandler) GetContainerDetail(c *gin.Context) {
+	hostID := c.Param("id")
+	containerID := c.Param("container_id")
+
+	tail := defaultDetailLogTail
+	if raw := c.Query("tail"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxDetailLogTail {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tail must be a number between 0 and %d", maxDetailLogTail)})
+			return
+		}
+		tail = n
+	}
+
+	var host database.Host
+	if err := database.DB.Where("id = ?", hostID).First(&host).Error; err != nil {
+		logrus.Errorf("Host %s not found: %v", hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Host not found",
+		})
+		return
+	}
+
+	agent, exists := h.hub.GetAgent(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	commands := []*protocol.Message{
+		protocol.NewCommandWithAction("get_container", map[string]any{"container_id": containerID}),
+		protocol.NewCommandWithAction("get_container_stats", map[string]any{"container_id": containerID}),
+		protocol.NewCommandWithAction("get_container_logs", map[string]any{
+			"container_id": containerID,
+			"tail":         strconv.Itoa(tail),
+		}),
+	}
+	responses := make([]map[string]any, len(commands))
+	errs := make([]error, len(commands))
+	var wg sync.WaitGroup
+	for idx, command := range commands {
+		wg.Add(1)
+		go func(index int, command *protocol.Message) {
+			defer wg.Done()
+			response, err := h.sendCommandAndWait(agent.ID, command, containerDetailTimeout)
+			if err == nil {
+				err = agentResponseError(response)
+			}
+			responses[index], errs[index] = response, err
+		}(idx, command)
+	}
+	wg.Wait()
+
+	if err := errs[0]; err != nil {
+		logrus.Errorf("Failed to get container %s from host %s: %v", containerID, hostID, err)
+		h.addLog("error", "container", "Failed to fetch container detail", map[string]any{
+			"host_id":      host.ID.String(),
+			"host_name":    host.Name,
+			"container_id": containerID,
+			"error":        err.Error(),
+		})
+		respondCommandError(c, err, "Failed to retrieve container")
+		return
+	}
+
+	// Published URLs use the agent's address unless the caller names the host to link to
+	address := strings.TrimSpace(c.Query("url_host"))
+	if address == "" {
+		address = agent.Address()
+	}
+	container, _ := responses[0]["container"].(map[string]any)
+
+	result := gin.H{
+		"host_id":        host.ID.String(),
+		"host_name":      host.Name,
+		"container":      responses[0],
+		"published_urls": publishedURLs(container, address, strings.ToLower(c.Query("url_scheme")), h.publishedURLScheme),
+	}
+	for index, key := range map[int]string{1: "stats", 2: "logs"} {
+		if err := errs[index]; err != nil {
+			logrus.Warnf("Failed to get %s for container %s from host %s: %v", key, containerID, hostID, err)
+			result[key+"_error"] = err.Error()
+			continue
+		}
+		result[key] = responses[index]
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // ListImages returns images for a specific host
 func (h *ContainersHandler) ListImages(c *gin.Context) {
 	hostID := c.Param("id")
@@ -313,25 +365,20 @@ func (h *ContainersHandler) ListImages(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get images from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve images",
-		})
+		respondCommandError(c, err, "Failed to retrieve images")
 		return
 	}
 
-	images, ok := response["images"].([]interface{})
-	if !ok {
-		logrus.Errorf("Invalid images response format from host %s", hostID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid response format from agent",
-		})
+	var result protocol.ImageListResult
+	if err := protocol.DecodeResult(response, &result); err != nil || result.Images == nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "images", "array", err))
 		return
 	}
+	images := result.Images
 
-	for i := range images {
-		if m, ok := images[i].(map[string]any); ok {
-			m["host_name"] = host.Name
-		}
+	for _, m := range images {
+		m["host_id"] = host.ID.String()
+		m["host_name"] = host.Name
 	}
 
 	q := strings.TrimSpace(c.Query("q"))
@@ -342,22 +389,16 @@ func (h *ContainersHandler) ListImages(c *gin.Context) {
 			return
 		}
 		filtered := make([]map[string]any, 0, len(images))
-		for _, it := range images {
-			if m, ok := it.(map[string]any); ok {
-				if querydsl.EvaluateRecord(ast, m) {
-					filtered = append(filtered, m)
-				}
+		for _, m := range images {
+			if querydsl.EvaluateRecord(ast, m) {
+				filtered = append(filtered, m)
 			}
 		}
-		out := make([]interface{}, len(filtered))
-		for i := range filtered {
-			out[i] = filtered[i]
-		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, filtered)
 		return
 	}
 
-	c.JSON(http.StatusOK, images)
+	respondList(c, images)
 }
 
 // RemoveImages removes one or more images from a host
@@ -410,13 +451,16 @@ func (h *ContainersHandler) RemoveImages(c *gin.Context) {
 			"images":  request.Images,
 			"error":   err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove images"})
+		respondCommandError(c, err, "Failed to remove images")
 		return
 	}
 
-	removed := toStringSlice(response["removed"])
-	conflicts := decodeRemovalConflicts(response["conflicts"])
-	errors := decodeRemovalErrors(response["errors"])
+	var result protocol.ResourceRemovalResult
+	if err := protocol.DecodeResult(response, &result); err != nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "", "", err))
+		return
+	}
+	removed, conflicts, errors := result.Removed, result.Conflicts, result.Errors
 
 	for _, imageID := range removed {
 		h.addLog("info", "images", "Removed Docker image", map[string]any{
@@ -490,24 +534,179 @@ func (h *ContainersHandler) PruneDanglingImages(c *gin.Context) {
 			"host_id": hostID,
 			"error":   err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune dangling images"})
+		respondCommandError(c, err, "Failed to prune dangling images")
 		return
 	}
 
-	removed := toStringSlice(response["removed"])
-	spaceReclaimed := response["space_reclaimed"]
+	var result protocol.ImagePruneResult
+	if err := protocol.DecodeResult(response, &result); err != nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "", "", err))
+		return
+	}
 	h.addLog("info", "images", "Pruned dangling images", map[string]any{
 		"host_id":         hostID,
-		"removed_count":   len(removed),
-		"space_reclaimed": spaceReclaimed,
+		"removed_count":   len(result.Removed),
+		"space_reclaimed": result.SpaceReclaimed,
 	})
 
+	c.JSON(http.StatusOK, result)
+}
+
+// pullImagesRequest selects the images to pull. InUse re-pulls every image used by a host's containers.
+type pullImagesRequest struct {
+	HostIDs []string `json:"host_ids"`
+	Images  []string `json:"images"`
+	InUse   bool     `json:"in_use"`
+}
+
+// pullImagesTimeout is how long a pull may go without reporting progress. Agents keep a
+// streamed pull running for as long, so it must not exceed their progress idle timeout.
+const pullImagesTimeout = 10 * time.Minute
+
+// PullImages pulls images on a host ahead of an update
+func (h *ContainersHandler) PullImages(c *gin.Context) {
+	hostID := c.Param("id")
+
+	var host database.Host
+	if err := database.DB.Where("id = ?", hostID).First(&host).Error; err != nil {
+		logrus.Errorf("Host %s not found: %v", hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Host not found",
+		})
+		return
+	}
+
+	agent, exists := h.hub.GetAgent(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	var request pullImagesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(request.Images) == 0 && !request.InUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "images must not be empty unless in_use is set"})
+		return
+	}
+
+	response, err := h.pullImagesOnHost(agent.ID, host, request, nil)
+	if err != nil {
+		respondCommandError(c, err, "Failed to pull images")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PullImagesFleet pulls images on several hosts at once, at most maxConcurrentHostQueries
+// at a time. Hosts default to every connected agent; each host bounds its own pull
+// concurrency.
+func (h *ContainersHandler) PullImagesFleet(c *gin.Context) {
+	var request pullImagesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(request.Images) == 0 && !request.InUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "images must not be empty unless in_use is set"})
+		return
+	}
+
+	hostIDs := request.HostIDs
+	if len(hostIDs) == 0 {
+		for _, agent := range h.hub.GetAgents() {
+			hostIDs = append(hostIDs, agent.HostID)
+		}
+	}
+
+	results := make([]map[string]any, len(hostIDs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentHostQueries)
+	for idx, hostID := range hostIDs {
+		wg.Add(1)
+		go func(index int, hostID string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			entry := map[string]any{"host_id": hostID}
+			results[index] = entry
+
+			var host database.Host
+			if err := database.DB.Where("id = ?", hostID).First(&host).Error; err != nil {
+				entry["status"] = "error"
+				entry["error"] = "Host not found"
+				return
+			}
+			entry["host_name"] = host.Name
+
+			agent, exists := h.hub.GetAgent(hostID)
+			if !exists {
+				entry["status"] = "error"
+				entry["error"] = "Host agent not connected"
+				return
+			}
+
+			response, err := h.pullImagesOnHost(agent.ID, host, request, nil)
+			if err != nil {
+				entry["status"] = "error"
+				entry["error"] = err.Error()
+				return
+			}
+			entry["status"] = "success"
+			for k, v := range response {
+				entry[k] = v
+			}
+		}(idx, hostID)
+	}
+	wg.Wait()
+
 	c.JSON(http.StatusOK, gin.H{
-		"removed":         removed,
-		"space_reclaimed": spaceReclaimed,
+		"hosts": results,
 	})
 }
 
+// pullImagesOnHost pulls images on one host, forwarding the agent's progress reports to
+// progress when it is set.
+func (h *ContainersHandler) pullImagesOnHost(agentID string, host database.Host, request pullImagesRequest, progress chan<- protocol.Progress) (map[string]any, error) {
+	params := map[string]any{
+		"images": request.Images,
+	}
+	if request.InUse {
+		params["in_use"] = true
+	}
+
+	command := protocol.NewCommandWithAction("pull_images", params)
+	response, err := sendCommandAndStream(h.hub, agentID, command, pullImagesTimeout, progress)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to pull images on host %s: %v", host.ID, err)
+		h.addLog("error", "images", "Failed to pull images", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"images":    request.Images,
+			"in_use":    request.InUse,
+			"error":     err.Error(),
+		})
+		return nil, err
+	}
+
+	h.addLog("info", "images", "Pulled images", map[string]any{
+		"host_id":    host.ID.String(),
+		"host_name":  host.Name,
+		"pulled":     response["pulled"],
+		"up_to_date": response["up_to_date"],
+		"failed":     response["failed"],
+	})
+	return response, nil
+}
+
 // ListNetworks returns networks for a specific host
 func (h *ContainersHandler) ListNetworks(c *gin.Context) {
 	hostID := c.Param("id")
@@ -533,23 +732,19 @@ func (h *ContainersHandler) ListNetworks(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get networks from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve networks",
-		})
+		respondCommandError(c, err, "Failed to retrieve networks")
 		return
 	}
 
 	networks, ok := response["networks"].([]interface{})
 	if !ok {
-		logrus.Errorf("Invalid networks response format from host %s", hostID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid response format from agent",
-		})
+		respondMalformedResponse(c, hostID, response, malformedField(response, "networks", "array", nil))
 		return
 	}
 
 	for i := range networks {
 		if m, ok := networks[i].(map[string]any); ok {
+			m["host_id"] = host.ID.String()
 			m["host_name"] = host.Name
 		}
 	}
@@ -575,11 +770,11 @@ func (h *ContainersHandler) ListNetworks(c *gin.Context) {
 		for i := range filtered {
 			out[i] = filtered[i]
 		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, out)
 		return
 	}
 
-	c.JSON(http.StatusOK, networks)
+	respondList(c, networks)
 }
 
 // InspectNetwork returns detailed information about a specific network.
@@ -600,46 +795,41 @@ func (h *ContainersHandler) InspectNetwork(c *gin.Context) {
 		return
 	}
 
-	command := protocol.NewCommandWithAction("inspect_networks", map[string]any{
-		"ids": []string{networkID},
-	})
-	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
-	if err != nil {
-		logrus.Errorf("Failed to inspect network %s on host %s: %v", networkID, hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect network"})
+	payload, ok := h.inspectResource(c, agent.ID, "inspect_networks", "ids", networkID, "network")
+	if !ok {
 		return
 	}
+	h.addLog("info", "network", "Inspected Docker network", map[string]any{
+		"host_id":    host.ID.String(),
+		"host_name":  host.Name,
+		"network_id": networkID,
+	})
+	c.JSON(http.StatusOK, payload)
+}
 
-	if errorsField, ok := response["errors"].([]interface{}); ok && len(errorsField) > 0 {
-		for _, item := range errorsField {
-			if errMap, ok := item.(map[string]any); ok {
-				if id, ok := errMap["id"].(string); ok && id == networkID {
-					c.JSON(http.StatusNotFound, gin.H{"error": errMap["error"]})
-					return
-				}
-			}
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect network"})
+// ListNetworkContainers returns the containers attached to a specific network, so
+// dependents can be reviewed before the network is removed.
+func (h *ContainersHandler) ListNetworkContainers(c *gin.Context) {
+	hostID := c.Param("id")
+	networkID := c.Param("network_id")
+
+	if err := database.DB.Where("id = ?", hostID).First(&database.Host{}).Error; err != nil {
+		logrus.Errorf("Host %s not found: %v", hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Host not found"})
 		return
 	}
 
-	networks, ok := response["networks"].([]interface{})
-	if !ok || len(networks) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Network not found"})
+	agent, exists := h.hub.GetAgent(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
 		return
 	}
 
-	if payload, ok := networks[0].(map[string]any); ok && payload != nil {
-		h.addLog("info", "network", "Inspected Docker network", map[string]any{
-			"host_id":    host.ID.String(),
-			"host_name":  host.Name,
-			"network_id": networkID,
-		})
-		c.JSON(http.StatusOK, payload)
+	payload, ok := h.inspectResource(c, agent.ID, "inspect_networks", "ids", networkID, "network")
+	if !ok {
 		return
 	}
-
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response format from agent"})
+	c.JSON(http.StatusOK, resourceConsumers(payload))
 }
 
 // RemoveNetwork removes a specific network from a host.
@@ -682,13 +872,16 @@ func (h *ContainersHandler) RemoveNetwork(c *gin.Context) {
 			"network_id": networkID,
 			"error":      err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove network"})
+		respondCommandError(c, err, "Failed to remove network")
 		return
 	}
 
-	removed := toStringSlice(response["removed"])
-	conflicts := decodeRemovalConflicts(response["conflicts"])
-	errors := decodeRemovalErrors(response["errors"])
+	var result protocol.ResourceRemovalResult
+	if err := protocol.DecodeResult(response, &result); err != nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "", "", err))
+		return
+	}
+	removed, conflicts, errors := result.Removed, result.Conflicts, result.Errors
 
 	for _, conflict := range conflicts {
 		h.addLog("warn", "network", "Network removal conflict", map[string]any{
@@ -769,23 +962,19 @@ func (h *ContainersHandler) ListVolumes(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get volumes from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve volumes",
-		})
+		respondCommandError(c, err, "Failed to retrieve volumes")
 		return
 	}
 
 	volumes, ok := response["volumes"].([]interface{})
 	if !ok {
-		logrus.Errorf("Invalid volumes response format from host %s", hostID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid response format from agent",
-		})
+		respondMalformedResponse(c, hostID, response, malformedField(response, "volumes", "array", nil))
 		return
 	}
 
 	for i := range volumes {
 		if m, ok := volumes[i].(map[string]any); ok {
+			m["host_id"] = host.ID.String()
 			m["host_name"] = host.Name
 		}
 	}
@@ -811,11 +1000,11 @@ func (h *ContainersHandler) ListVolumes(c *gin.Context) {
 		for i := range filtered {
 			out[i] = filtered[i]
 		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, out)
 		return
 	}
 
-	c.JSON(http.StatusOK, volumes)
+	respondList(c, volumes)
 }
 
 // InspectVolume returns detailed information about a specific volume.
@@ -836,46 +1025,108 @@ func (h *ContainersHandler) InspectVolume(c *gin.Context) {
 		return
 	}
 
-	command := protocol.NewCommandWithAction("inspect_volumes", map[string]any{
-		"names": []string{volumeName},
+	payload, ok := h.inspectResource(c, agent.ID, "inspect_volumes", "names", volumeName, "volume")
+	if !ok {
+		return
+	}
+	h.addLog("info", "volume", "Inspected Docker volume", map[string]any{
+		"host_id":     host.ID.String(),
+		"host_name":   host.Name,
+		"volume_name": volumeName,
 	})
-	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
-	if err != nil {
-		logrus.Errorf("Failed to inspect volume %s on host %s: %v", volumeName, hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect volume"})
+	c.JSON(http.StatusOK, payload)
+}
+
+// ListVolumeContainers returns the containers mounting a specific volume, so dependents
+// can be reviewed before the volume is removed.
+func (h *ContainersHandler) ListVolumeContainers(c *gin.Context) {
+	hostID := c.Param("id")
+	volumeName := c.Param("volume_name")
+
+	if err := database.DB.Where("id = ?", hostID).First(&database.Host{}).Error; err != nil {
+		logrus.Errorf("Host %s not found: %v", hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Host not found"})
 		return
 	}
 
+	agent, exists := h.hub.GetAgent(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	payload, ok := h.inspectResource(c, agent.ID, "inspect_volumes", "names", volumeName, "volume")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, resourceConsumers(payload))
+}
+
+// inspectResource inspects a single network or volume through the agent's batch inspect
+// command, passing id under the idKey parameter. On failure it writes the error response
+// and returns false.
+func (h *ContainersHandler) inspectResource(c *gin.Context, agentID, action, idKey, id, kind string) (map[string]any, bool) {
+	command := protocol.NewCommandWithAction(action, map[string]any{
+		idKey: []string{id},
+	})
+	response, err := h.sendCommandAndWait(agentID, command, 30*time.Second)
+	if err != nil {
+		logrus.Errorf("Failed to inspect %s %s on host %s: %v", kind, id, c.Param("id"), err)
+		respondCommandError(c, err, "Failed to inspect "+kind)
+		return nil, false
+	}
+
 	if errorsField, ok := response["errors"].([]interface{}); ok && len(errorsField) > 0 {
 		for _, item := range errorsField {
 			if errMap, ok := item.(map[string]any); ok {
-				if name, ok := errMap["name"].(string); ok && name == volumeName {
+				failed, _ := errMap["id"].(string)
+				if failed == "" {
+					failed, _ = errMap["name"].(string)
+				}
+				if failed == id {
 					c.JSON(http.StatusNotFound, gin.H{"error": errMap["error"]})
-					return
+					return nil, false
 				}
 			}
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect volume"})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect " + kind})
+		return nil, false
 	}
 
-	volumes, ok := response["volumes"].([]interface{})
-	if !ok || len(volumes) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Volume not found"})
-		return
+	items, ok := response[kind+"s"].([]interface{})
+	if !ok || len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": strings.ToUpper(kind[:1]) + kind[1:] + " not found"})
+		return nil, false
 	}
 
-	if payload, ok := volumes[0].(map[string]any); ok && payload != nil {
-		h.addLog("info", "volume", "Inspected Docker volume", map[string]any{
-			"host_id":     host.ID.String(),
-			"host_name":   host.Name,
-			"volume_name": volumeName,
-		})
-		c.JSON(http.StatusOK, payload)
-		return
+	payload, ok := items[0].(map[string]any)
+	if !ok || payload == nil {
+		err := &malformedResponseError{field: kind + "s[0]", expected: "object", got: jsonKind(items[0])}
+		respondMalformedResponse(c, agentID, response, err)
+		return nil, false
 	}
+	return payload, true
+}
 
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response format from agent"})
+// resourceConsumers reduces an inspected network or volume to the containers using it.
+func resourceConsumers(payload map[string]any) gin.H {
+	containers, _ := payload["containers_detail"].([]interface{})
+	if containers == nil {
+		containers = []interface{}{}
+	}
+	stacks, _ := payload["stacks"].([]interface{})
+	if stacks == nil {
+		stacks = []interface{}{}
+	}
+	out := gin.H{
+		"name":       payload["name"],
+		"containers": containers,
+		"stacks":     stacks,
+	}
+	if id, ok := payload["id"]; ok {
+		out["id"] = id
+	}
+	return out
 }
 
 // RemoveVolume removes a specific volume from a host.
@@ -918,13 +1169,16 @@ func (h *ContainersHandler) RemoveVolume(c *gin.Context) {
 			"volume_name": volumeName,
 			"error":       err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove volume"})
+		respondCommandError(c, err, "Failed to remove volume")
 		return
 	}
 
-	removed := toStringSlice(response["removed"])
-	conflicts := decodeRemovalConflicts(response["conflicts"])
-	errors := decodeRemovalErrors(response["errors"])
+	var result protocol.ResourceRemovalResult
+	if err := protocol.DecodeResult(response, &result); err != nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "", "", err))
+		return
+	}
+	removed, conflicts, errors := result.Removed, result.Conflicts, result.Errors
 
 	for _, conflict := range conflicts {
 		h.addLog("warn", "volume", "Volume removal conflict", map[string]any{
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// maxConcurrentContainerUpdates caps the containers a fleet update pulls and recreates on one
+// host at once; hosts are updated in parallel
+const maxConcurrentContainerUpdates = 2
+
+// fleetUpdateRequest is the body of a fleet-wide update of outdated containers. Hosts default
+// to every connected agent. Without dry_run, confirm must be set.
+type fleetUpdateRequest struct {
+	HostIDs []string `json:"host_ids"`
+	DryRun  bool     `json:"dry_run"`
+	Confirm bool     `json:"confirm"`
+}
+
+// validateFleetUpdate checks a fleet update request before anything is dispatched.
+func validateFleetUpdate(req fleetUpdateRequest) error {
+	if !req.DryRun && !req.Confirm {
+		return fmt.Errorf("confirm must be set to update containers; use dry_run to preview the updates")
+	}
+	return nil
+}
+
+// updatableContainers returns the containers of Flotilla-managed stacks that a fleet update
+// covers. Containers labelled io.flotilla.ignore=true are skipped, as are containers created
+// from a bare image ID, which have no registry reference to check.
+func updatableContainers(containers []map[string]any) []map[string]any {
+	updatable := make([]map[string]any, 0)
+	for _, container := range containers {
+		labels, _ := container["labels"].(map[string]any)
+		if labels[flotillaManagedLabel] != "true" || labels[flotillaIgnoreLabel] == "true" {
+			continue
+		}
+		image, _ := container["image"].(string)
+		if image == "" || strings.HasPrefix(image, "sha256:") {
+			continue
+		}
+		updatable = append(updatable, container)
+	}
+	return updatable
+}
+
+// summarizeFleetUpdate counts the container outcomes of a fleet update and the hosts that
+// could not be updated at all.
+func summarizeFleetUpdate(hostResults []gin.H) gin.H {
+	counts := map[string]int{}
+	for _, hostResult := range hostResults {
+		if hostResult["status"] != "success" {
+			counts["failed_hosts"]++
+			continue
+		}
+		containers, _ := hostResult["containers"].([]gin.H)
+		for _, result := range containers {
+			status, _ := result["status"].(string)
+			counts[status]++
+		}
+	}
+	return gin.H{
+		"updated":          counts["updated"],
+		"update_available": counts["update_available"],
+		"up_to_date":       counts["up_to_date"],
+		"failed":           counts["error"],
+		"failed_hosts":     counts["failed_hosts"],
+	}
+}
+
+// UpdateOutdatedContainers pulls the images of every managed container across the fleet and
+// recreates the containers whose image has a newer version. With dry_run the registries are
+// only asked for the current digests and the outdated containers reported. Each container
+// gets its own result, so one failure does not hide the outcome of the others.
+//
+// A fleet-wide run can take a long time, so the outcome is sent as Server-Sent Events: a host
+// event as each host finishes and a final result event with every host and a summary.
+func (h *HostsHandler) UpdateOutdatedContainers(c *gin.Context) {
+	var req fleetUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := validateFleetUpdate(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hostIDs := uniqueHostIDs(req.HostIDs)
+	if len(hostIDs) == 0 {
+		for _, agent := range h.hub.GetAgents() {
+			hostIDs = append(hostIDs, agent.HostID)
+		}
+	}
+
+	// The run goes on without the client, so its outcome is still logged if the client leaves
+	hostDone := make(chan gin.H, len(hostIDs))
+	done := make(chan gin.H, 1)
+	userID := c.GetString("user_id")
+	go func() {
+		done <- h.runFleetUpdate(hostIDs, req.DryRun, userID, hostDone)
+	}()
+
+	startSSE(c)
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			writeSSEKeepAlive(c)
+		case hostResult := <-hostDone:
+			writeSSE(c, "host", hostResult)
+		case result := <-done:
+			for len(hostDone) > 0 {
+				writeSSE(c, "host", <-hostDone)
+			}
+			writeSSE(c, "result", result)
+			return
+		}
+	}
+}
+
+// uniqueHostIDs drops empty and repeated host IDs, keeping the order they were given in, so
+// a host listed twice is not updated twice at once.
+func uniqueHostIDs(hostIDs []string) []string {
+	seen := make(map[string]bool, len(hostIDs))
+	unique := make([]string, 0, len(hostIDs))
+	for _, hostID := range hostIDs {
+		hostID = strings.TrimSpace(hostID)
+		if hostID == "" || seen[hostID] {
+			continue
+		}
+		seen[hostID] = true
+		unique = append(unique, hostID)
+	}
+	return unique
+}
+
+// runFleetUpdate updates the hosts in parallel, sending each host's result on hostDone as it
+// finishes, and returns the results of all hosts with their summary.
+func (h *HostsHandler) runFleetUpdate(hostIDs []string, dryRun bool, userID string, hostDone chan<- gin.H) gin.H {
+	hostResults := make([]gin.H, len(hostIDs))
+	var wg sync.WaitGroup
+	for i, hostID := range hostIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hostResults[i] = h.updateOutdatedOnHost(hostID, dryRun)
+			hostDone <- hostResults[i]
+		}()
+	}
+	wg.Wait()
+
+	summary := summarizeFleetUpdate(hostResults)
+	level := "info"
+	if summary["failed"].(int) > 0 || summary["failed_hosts"].(int) > 0 {
+		level = "warn"
+	}
+	message := "Fleet update completed"
+	if dryRun {
+		message = "Fleet update check completed"
+	}
+	h.addLog(level, "container", message, map[string]any{
+		"hosts":   len(hostIDs),
+		"dry_run": dryRun,
+		"user_id": userID,
+		"summary": summary,
+	})
+
+	return gin.H{
+		"dry_run": dryRun,
+		"hosts":   hostResults,
+		"summary": summary,
+	}
+}
+
+// updateOutdatedOnHost runs a fleet update against one host and returns its result.
+func (h *HostsHandler) updateOutdatedOnHost(hostID string, dryRun bool) gin.H {
+	result := gin.H{"host_id": hostID}
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		result["status"] = "error"
+		result["error"] = hostNotFoundMsg
+		return result
+	}
+	result["host_name"] = host.Name
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		result["status"] = "error"
+		result["error"] = "Host agent not connected"
+		return result
+	}
+
+	response, err := h.sendCommandAndWait(agent.ID, protocol.NewCommandWithAction("list_containers", map[string]any{
+		"all": true,
+	}), 15*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	var listed protocol.ContainerListResult
+	if err == nil {
+		err = protocol.DecodeResult(response, &listed)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to list containers for fleet update on host %s: %v", hostID, err)
+		result["status"] = "error"
+		result["error"] = err.Error()
+		return result
+	}
+
+	containers := updatableContainers(listed.Containers)
+	containerResults := make([]gin.H, len(containers))
+	sem := make(chan struct{}, maxConcurrentContainerUpdates)
+	var wg sync.WaitGroup
+	for i, container := range containers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			containerResults[i] = h.updateContainerIfOutdated(agent.ID, host, container, dryRun)
+		}()
+	}
+	wg.Wait()
+
+	result["status"] = "success"
+	result["containers"] = containerResults
+	return result
+}
+
+// updateContainerIfOutdated sends one rolling_update_container command of a fleet update.
+func (h *HostsHandler) updateContainerIfOutdated(agentID string, host database.Host, container map[string]any, dryRun bool) gin.H {
+	containerID, _ := container["id"].(string)
+	labels, _ := container["labels"].(map[string]any)
+	result := gin.H{
+		"container_id":   containerID,
+		"container_name": container["name"],
+		"stack_name":     labels[composeProjectLabel],
+		"image":          container["image"],
+	}
+
+	params := map[string]any{"container_id": containerID}
+	if dryRun {
+		params["dry_run"] = true
+	}
+	response, err := sendCommandAndStream(h.hub, agentID, protocol.NewCommandWithAction("rolling_update_container", params), pullImagesTimeout, nil)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to update container %s on host %s: %v", containerID, host.ID, err)
+		result["status"] = "error"
+		result["error"] = err.Error()
+		return result
+	}
+
+	status, _ := response["status"].(string)
+	result["status"] = status
+	for _, key := range []string{"image_id", "previous_image_id", "digest"} {
+		if value, ok := response[key]; ok {
+			result[key] = value
+		}
+	}
+	if status == "updated" {
+		result["container_id"] = response["container_id"]
+		result["previous_container_id"] = containerID
+		h.addLog("info", "container", "Container updated to a newer image", map[string]any{
+			"host_id":               host.ID.String(),
+			"host_name":             host.Name,
+			"container_id":          response["container_id"],
+			"previous_container_id": containerID,
+			"image":                 container["image"],
+		})
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateFleetUpdate(t *testing.T) {
+	if err := validateFleetUpdate(fleetUpdateRequest{}); err == nil {
+		t.Fatal("expected an unconfirmed update to be rejected")
+	}
+	if err := validateFleetUpdate(fleetUpdateRequest{DryRun: true}); err != nil {
+		t.Fatalf("expected a dry run to need no confirmation, got %v", err)
+	}
+	if err := validateFleetUpdate(fleetUpdateRequest{Confirm: true}); err != nil {
+		t.Fatalf("expected a confirmed update to be accepted, got %v", err)
+	}
+}
+
+func TestUniqueHostIDs(t *testing.T) {
+	got := uniqueHostIDs([]string{"b", "a", " b", "", "a", "c"})
+	want := []string{"b", "a", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUpdatableContainers(t *testing.T) {
+	managed := map[string]any{flotillaManagedLabel: "true", composeProjectLabel: "web"}
+	containers := []map[string]any{
+		{"id": "a", "image": "nginx:latest", "labels": managed},
+		{"id": "b", "image": "redis:7", "labels": map[string]any{composeProjectLabel: "cache"}},
+		{"id": "c", "image": "sha256:abc", "labels": managed},
+		{"id": "d", "image": "postgres:16", "labels": map[string]any{flotillaManagedLabel: "true", flotillaIgnoreLabel: "true"}},
+		{"id": "e", "image": "busybox"},
+	}
+
+	updatable := updatableContainers(containers)
+	if len(updatable) != 1 || updatable[0]["id"] != "a" {
+		t.Fatalf("expected only the managed nginx container, got %v", updatable)
+	}
+}
+
+func TestSummarizeFleetUpdate(t *testing.T) {
+	summary := summarizeFleetUpdate([]gin.H{
+		{"status": "success", "containers": []gin.H{
+			{"status": "updated"},
+			{"status": "up_to_date"},
+			{"status": "error"},
+		}},
+		{"status": "success", "containers": []gin.H{{"status": "update_available"}}},
+		{"status": "error", "error": "Host agent not connected"},
+	})
+
+	want := gin.H{"updated": 1, "update_available": 1, "up_to_date": 1, "failed": 1, "failed_hosts": 1}
+	for key, value := range want {
+		if summary[key] != value {
+			t.Fatalf("expected %s=%v, got %v", key, value, summary)
+		}
+	}
+}
@@ -1,45 +1,64 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	gorillawebsocket "github.com/gorilla/websocket"
 	"github.com/mikeysoft/flotilla/internal/server/auth"
 	"github.com/mikeysoft/flotilla/internal/server/database"
 	appLogs "github.com/mikeysoft/flotilla/internal/server/logs"
+	"github.com/mikeysoft/flotilla/internal/server/middleware"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
 	"github.com/mikeysoft/flotilla/internal/server/topology"
 	serverws "github.com/mikeysoft/flotilla/internal/server/websocket"
 	sharedconfig "github.com/mikeysoft/flotilla/internal/shared/config"
 	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	"github.com/mikeysoft/flotilla/internal/shared/querydsl"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
 	hostIDQuery     = "id = ?"
 	hostNotFoundMsg = "Host not found"
 	hostNotFoundLog = "Host %s not found: %v"
+	agentTimeoutMsg = "Host agent did not respond in time"
+	agentBusyMsg    = "Host agent is busy, retry later"
+	agentPanicMsg   = "Host agent failed unexpectedly while running the command"
+	commandDenyMsg  = "Command is disabled by the server's command policy"
+	// agentBusyRetryAfter is the Retry-After hint, in seconds, sent when an agent is saturated
+	agentBusyRetryAfter = "5"
+	// maxConcurrentHostQueries bounds the agents a fleet-wide list or image pull queries at once
+	maxConcurrentHostQueries = 16
 )
 
 // HostsHandler handles host-related API endpoints
 type HostsHandler struct {
-	hub      *serverws.Hub
-	logs     *appLogs.Manager
-	topology *topology.Manager
+	hub          *serverws.Hub
+	logs         *appLogs.Manager
+	topology     *topology.Manager
+	stackHistory *stacks.History
+	// maxStackPayload caps compose content and env var maps in bytes; zero disables the check
+	maxStackPayload int
 }
 
 // NewHostsHandler creates a new hosts handler
-func NewHostsHandler(hub *serverws.Hub, logs *appLogs.Manager, topologyManager *topology.Manager) *HostsHandler {
+func NewHostsHandler(hub *serverws.Hub, logs *appLogs.Manager, topologyManager *topology.Manager, stackHistory *stacks.History) *HostsHandler {
 	return &HostsHandler{
-		hub:      hub,
-		logs:     logs,
-		topology: topologyManager,
+		hub:             hub,
+		logs:            logs,
+		topology:        topologyManager,
+		stackHistory:    stackHistory,
+		maxStackPayload: defaultMaxStackPayloadSize,
 	}
 }
 
@@ -75,8 +94,10 @@ func (h *HostsHandler) DeleteHost(c *gin.Context) {
 		return
 	}
 
-	// If an agent is connected, mark as offline and close connection
-	if agent, exists := h.hub.GetAgentByHost(hostID); exists {
+	// If an agent is connected, mark as offline and close connection. An endpoint of a
+	// multi-endpoint agent shares the agent's connection, which is left open; the endpoint
+	// comes back with the next heartbeat unless it is removed from the agent's configuration.
+	if agent, exists := h.hub.GetAgentByHost(hostID); exists && agent.Endpoint == "" {
 		// Best-effort close: unregister will update status to offline
 		go func(a *serverws.AgentConnection) {
 			defer func() { recover() }()
@@ -86,8 +107,22 @@ func (h *HostsHandler) DeleteHost(c *gin.Context) {
 		}(agent)
 	}
 
-	// Delete host; stacks are CASCADE via model constraints
-	if err := database.DB.Delete(&host).Error; err != nil {
+	// Delete the host together with the rows that reference it in one transaction, so a
+	// failure part way leaves nothing orphaned; stacks are CASCADE via model constraints
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if h.stackHistory != nil {
+			if err := h.stackHistory.DeleteHostTx(tx, host.ID); err != nil {
+				return err
+			}
+		}
+		if h.topology != nil {
+			if err := h.topology.PurgeHostTx(tx, host.ID.String()); err != nil {
+				return fmt.Errorf("failed to purge host topology: %w", err)
+			}
+		}
+		return tx.Delete(&host).Error
+	})
+	if err != nil {
 		logrus.Errorf("Failed to delete host %s: %v", hostID, err)
 		h.addLog("error", "host", "Failed to delete host", map[string]any{
 			"host_id":   host.ID.String(),
@@ -98,12 +133,6 @@ func (h *HostsHandler) DeleteHost(c *gin.Context) {
 		return
 	}
 
-	if h.topology != nil {
-		if err := h.topology.PurgeHost(hostID); err != nil {
-			logrus.WithError(err).WithField("host_id", hostID).Warn("failed to purge host topology cache")
-		}
-	}
-
 	h.addLog("info", "host", "Deleted host", map[string]any{
 		"host_id":   host.ID.String(),
 		"host_name": host.Name,
@@ -174,14 +203,23 @@ func (h *HostsHandler) GetHost(c *gin.Context) {
 	}
 
 	// Update online status based on WebSocket connection
+	detail := hostDetail{Host: host}
 	if agent, exists := h.hub.GetAgent(hostID); exists {
-		host.Status = "online"
-		host.LastSeen = &agent.LastSeen
+		detail.Status = "online"
+		detail.LastSeen = &agent.LastSeen
+		connection := agent.ConnectionInfo()
+		detail.Connection = &connection
 	} else {
-		host.Status = "offline"
+		detail.Status = "offline"
 	}
 
-	c.JSON(http.StatusOK, host)
+	c.JSON(http.StatusOK, detail)
+}
+
+// hostDetail is a host with the details of its agent's connection while it is online
+type hostDetail struct {
+	database.Host
+	Connection *serverws.ConnectionInfo `json:"connection,omitempty"`
 }
 
 // GetHostInfo queries the agent for docker and host info
@@ -208,13 +246,178 @@ func (h *HostsHandler) GetHostInfo(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 10*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get docker info from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host info"})
+		respondCommandError(c, err, "Failed to get host info")
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GetHostRuntime returns the Docker endpoint the host's agent uses and the daemon's container
+// runtime, storage driver and cgroup setup
+func (h *HostsHandler) GetHostRuntime(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Ensure host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	// Find connected agent
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("get_runtime_info", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 10*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to get runtime info from host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to get runtime info")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLiveMetrics returns the most recent metrics sample held by the host's agent. It works
+// without metrics storage, so current usage can be shown when InfluxDB is disabled.
+func (h *HostsHandler) GetLiveMetrics(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Ensure host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	// Find connected agent
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	// The agent collects a fresh sample when it has no recent one, which takes a while
+	command := protocol.NewCommandWithAction("get_live_metrics", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to get live metrics from host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to get live metrics")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAgentConfig returns the effective, non-secret configuration the host's agent runs with
+func (h *HostsHandler) GetAgentConfig(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Ensure host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	// Find connected agent
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("get_agent_config", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
+	if err != nil {
+		logrus.Errorf("Failed to get agent config from host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to get agent config")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetAgentName renames a host's agent at runtime. The agent persists the name and reports it
+// in its heartbeats, and the host record is updated right away.
+func (h *HostsHandler) SetAgentName(c *gin.Context) {
+	hostID := c.Param("id")
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	name, err := protocol.NormalizeAgentName(request.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("set_agent_name", map[string]any{"name": name})
+	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to rename agent on host %s: %v", hostID, err)
+		h.addLog("error", "host", "Failed to rename agent", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"name":      name,
+			"error":     err.Error(),
+		})
+		respondCommandError(c, err, "Failed to rename agent")
+		return
+	}
+
+	oldName := host.Name
+	if err := database.DB.Model(&host).Update("name", name).Error; err != nil {
+		logrus.Errorf("Failed to update name of host %s: %v", hostID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Agent renamed but host record could not be updated"})
+		return
+	}
+
+	h.addLog("info", "host", "Renamed agent", map[string]any{
+		"host_id":   host.ID.String(),
+		"old_name":  oldName,
+		"host_name": name,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"host_id":   host.ID.String(),
+		"host_name": name,
+	})
+}
+
 // ListContainers returns containers for a specific host
 func (h *HostsHandler) ListContainers(c *gin.Context) {
 	hostID := c.Param("id")
@@ -254,27 +457,22 @@ func (h *HostsHandler) ListContainers(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get containers from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve containers",
-		})
+		respondCommandError(c, err, "Failed to retrieve containers")
 		return
 	}
 
 	// Extract containers from response
-	containers, ok := response["containers"].([]interface{})
-	if !ok {
-		logrus.Errorf("Invalid containers response format from host %s", hostID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid response format from agent",
-		})
+	var result protocol.ContainerListResult
+	if err := protocol.DecodeResult(response, &result); err != nil || result.Containers == nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "containers", "array", err))
 		return
 	}
+	containers := result.Containers
 
-	// Add host name for filtering consistency
-	for i := range containers {
-		if m, ok := containers[i].(map[string]any); ok {
-			m["host_name"] = host.Name
-		}
+	// Add host info for filtering consistency and deep links
+	for _, m := range containers {
+		m["host_id"] = host.ID.String()
+		m["host_name"] = host.Name
 	}
 
 	// Apply optional filtering
@@ -286,25 +484,20 @@ func (h *HostsHandler) ListContainers(c *gin.Context) {
 			return
 		}
 		filtered := make([]map[string]any, 0, len(containers))
-		for _, it := range containers {
-			if m, ok := it.(map[string]any); ok {
-				if querydsl.EvaluateRecord(ast, m) {
-					filtered = append(filtered, m)
-				}
+		for _, m := range containers {
+			if querydsl.EvaluateRecord(ast, m) {
+				filtered = append(filtered, m)
 			}
 		}
-		out := make([]interface{}, len(filtered))
-		for i := range filtered {
-			out[i] = filtered[i]
-		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, filtered)
 		return
 	}
 
-	c.JSON(http.StatusOK, containers)
+	respondList(c, containers)
 }
 
-// ListAllContainers returns containers from all connected hosts
+// ListAllContainers returns containers from all connected hosts. Hosts are queried
+// concurrently and each host's containers are streamed to the response as they arrive.
 func (h *HostsHandler) ListAllContainers(c *gin.Context) {
 	// Get all connected agents
 	agents := h.hub.GetAgents()
@@ -315,79 +508,80 @@ func (h *HostsHandler) ListAllContainers(c *gin.Context) {
 		return
 	}
 
-	var allContainers []map[string]interface{}
-
-	// Iterate through all connected agents
-	for agentID, agent := range agents {
-		logrus.Infof("ListAllContainers: Processing agent %s with host ID %s", agentID, agent.HostID)
-
-		// Get host information from database
-		var host database.Host
-		if err := database.DB.Where(hostIDQuery, agent.HostID).First(&host).Error; err != nil {
-			logrus.Errorf("Failed to get host %s for agent %s: %v", agent.HostID, agentID, err)
-			continue
-		}
-
-		logrus.Infof("ListAllContainers: Found host %s (%s) for agent %s", host.ID.String(), host.Name, agentID)
-
-		// Send command to agent to get containers
-		command := protocol.NewCommandWithAction("list_containers", map[string]any{
-			"all": true,
-		})
-
-		// Send command and wait for response
-		response, err := h.sendCommandAndWait(agentID, command, 15*time.Second)
+	// Reject a bad query before any host is asked
+	var keep func(map[string]any) bool
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		ast, err := querydsl.Parse(q)
 		if err != nil {
-			logrus.Errorf("Failed to get containers from host %s (agent %s): %v", agent.HostID, agentID, err)
-			continue
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query"})
+			return
 		}
+		keep = func(m map[string]any) bool { return querydsl.EvaluateRecord(ast, m) }
+	}
 
-		// Extract containers from response
-		containers, ok := response["containers"].([]interface{})
-		if !ok {
-			logrus.Errorf("Invalid containers response format from host %s (agent %s)", agent.HostID, agentID)
-			continue
-		}
+	// The buffer holds only as many hosts as are queried at once, so a slow client holds
+	// back the queries instead of the server buffering the whole fleet; once the request
+	// ends, the remaining queries give up sending
+	ctx := c.Request.Context()
+	batches := make(chan []map[string]any, maxConcurrentHostQueries)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentHostQueries)
+	for agentID, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+			if containers := h.hostContainers(agentID, agent.HostID); len(containers) > 0 {
+				select {
+				case batches <- containers:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(batches)
+	}()
 
-		logrus.Infof("ListAllContainers: Found %d containers from agent %s", len(containers), agentID)
+	written := respondListStream(c, batches, keep)
+	logrus.Infof("ListAllContainers: Returned %d total containers", written)
+}
 
-		// Add host information to each container
-		for _, container := range containers {
-			if containerMap, ok := container.(map[string]interface{}); ok {
-				containerMap["host_id"] = host.ID.String()
-				containerMap["host_name"] = host.Name
-				logrus.Debugf("ListAllContainers: Added host info to container %s: host_id=%s, host_name=%s",
-					containerMap["name"], containerMap["host_id"], containerMap["host_name"])
-				allContainers = append(allContainers, containerMap)
-			}
-		}
+// hostContainers lists the containers of one host for a fleet-wide list, tagged with the
+// host for filtering and deep links. Failures are logged and yield no containers.
+func (h *HostsHandler) hostContainers(agentID, hostID string) []map[string]any {
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf("Failed to get host %s for agent %s: %v", hostID, agentID, err)
+		return nil
 	}
 
-	logrus.Infof("ListAllContainers: Returning %d total containers", len(allContainers))
+	command := protocol.NewCommandWithAction("list_containers", map[string]any{
+		"all": true,
+	})
+	response, err := h.sendCommandAndWait(agentID, command, 15*time.Second)
+	if err != nil {
+		logrus.Errorf("Failed to get containers from host %s (agent %s): %v", hostID, agentID, err)
+		return nil
+	}
 
-	// Apply optional filtering
-	q := strings.TrimSpace(c.Query("q"))
-	if q != "" {
-		ast, err := querydsl.Parse(q)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query"})
-			return
-		}
-		filtered := make([]map[string]any, 0, len(allContainers))
-		for _, m := range allContainers {
-			if querydsl.EvaluateRecord(ast, m) {
-				filtered = append(filtered, m)
-			}
-		}
-		out := make([]interface{}, len(filtered))
-		for i := range filtered {
-			out[i] = filtered[i]
-		}
-		c.JSON(http.StatusOK, out)
-		return
+	var result protocol.ContainerListResult
+	if err := protocol.DecodeResult(response, &result); err != nil || result.Containers == nil {
+		logMalformedResponse(hostID, response, malformedField(response, "containers", "array", err))
+		return nil
 	}
 
-	c.JSON(http.StatusOK, allContainers)
+	logrus.Debugf("ListAllContainers: Found %d containers from host %s (%s)", len(result.Containers), host.ID.String(), host.Name)
+	for _, containerMap := range result.Containers {
+		containerMap["host_id"] = host.ID.String()
+		containerMap["host_name"] = host.Name
+	}
+	return result.Containers
 }
 
 // ListAllStacks returns stacks from all connected hosts
@@ -429,7 +623,7 @@ func (h *HostsHandler) ListAllStacks(c *gin.Context) {
 		// Extract stacks from response
 		stacks, ok := response["stacks"].([]interface{})
 		if !ok {
-			logrus.Errorf("Invalid stacks response format from host %s (agent %s)", agent.HostID, agentID)
+			logMalformedResponse(agent.HostID, response, malformedField(response, "stacks", "array", nil))
 			continue
 		}
 
@@ -462,6 +656,10 @@ func (h *HostsHandler) ListAllStacks(c *gin.Context) {
 			if sensitive {
 				if reveal && admin {
 					stackMap["env_vars"] = decryptEnvMapIfSensitive(envVars)
+					hostID, _ := stackMap["host_id"].(string)
+					hostName, _ := stackMap["host_name"].(string)
+					stackName, _ := stackMap["name"].(string)
+					auditSecretsReveal(c, hostID, hostName, stackName, "")
 				} else {
 					stackMap["env_vars"] = maskEnvMap(envVars)
 				}
@@ -487,11 +685,11 @@ func (h *HostsHandler) ListAllStacks(c *gin.Context) {
 		for i := range filtered {
 			out[i] = filtered[i]
 		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, out)
 		return
 	}
 
-	c.JSON(http.StatusOK, allStacks)
+	respondList(c, allStacks)
 }
 
 // ListStacks returns stacks for a specific host
@@ -531,19 +729,14 @@ func (h *HostsHandler) ListStacks(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get stacks from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve stacks",
-		})
+		respondCommandError(c, err, "Failed to retrieve stacks")
 		return
 	}
 
 	// Extract stacks from response
 	stacks, ok := response["stacks"].([]interface{})
 	if !ok {
-		logrus.Errorf("Invalid stacks response format from host %s", hostID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid response format from agent",
-		})
+		respondMalformedResponse(c, hostID, response, malformedField(response, "stacks", "array", nil))
 		return
 	}
 
@@ -560,6 +753,8 @@ func (h *HostsHandler) ListStacks(c *gin.Context) {
 				if sensitive {
 					if reveal2 && admin2 {
 						stackMap["env_vars"] = decryptEnvMapIfSensitive(envVars)
+						stackName, _ := stackMap["name"].(string)
+						auditSecretsReveal(c, host.ID.String(), host.Name, stackName, "")
 					} else {
 						stackMap["env_vars"] = maskEnvMap(envVars)
 					}
@@ -568,9 +763,10 @@ func (h *HostsHandler) ListStacks(c *gin.Context) {
 		}
 	}
 
-	// Add host name for filtering consistency and apply optional filtering
+	// Add host info for filtering consistency and deep links and apply optional filtering
 	for i := range stacks {
 		if m, ok := stacks[i].(map[string]any); ok {
+			m["host_id"] = host.ID.String()
 			m["host_name"] = host.Name
 		}
 	}
@@ -593,89 +789,258 @@ func (h *HostsHandler) ListStacks(c *gin.Context) {
 		for i := range filtered {
 			out[i] = filtered[i]
 		}
-		c.JSON(http.StatusOK, out)
+		respondList(c, out)
+		return
+	}
+
+	respondList(c, stacks)
+}
+
+// RevealStackEnvVar returns the decrypted value of one stack env var, so an admin can copy a
+// single secret without revealing the rest. The access is recorded in the audit trail.
+func (h *HostsHandler) RevealStackEnvVar(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+	key := c.Param("key")
+
+	if !userIsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("get_stack", map[string]any{
+		"name": stackName,
+	})
+	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to get stack %s from host %s: %v", stackName, hostID, err)
+		respondCommandError(c, err, "Failed to retrieve stack")
+		return
+	}
+
+	stack, _ := response["stack"].(map[string]any)
+	envVars, _ := stack["env_vars"].(map[string]any)
+	value, ok := envVars[key]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Env var %s not found in stack %s", key, stackName),
+		})
+		return
+	}
+
+	auditSecretsReveal(c, host.ID.String(), host.Name, stackName, key)
+	h.addLog("info", "stack", "Stack env var revealed", map[string]any{
+		"host_id":    host.ID.String(),
+		"host_name":  host.Name,
+		"stack_name": stackName,
+		"key":        key,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"stack_name": stackName,
+		"key":        key,
+		"value":      decryptEnvMapIfSensitive(map[string]any{key: value})[key],
+	})
+}
+
+// DeployStack deploys a new stack on a host
+func (h *HostsHandler) DeployStack(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		h.addLog("warn", "stack", "Attempted stack import on unknown host", map[string]any{
+			"host_id": hostID,
+		})
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		h.addLog("error", "stack", "Agent not connected for stack import", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+		})
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	// Parse request body
+	var requestBody map[string]interface{}
+	h.limitStackPayloadBody(c, 1)
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		h.addLog("warn", "stack", "Invalid stack deploy payload", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"error":     err.Error(),
+		})
+		respondStackBindError(c, err)
+		return
+	}
+
+	if !h.checkStackPayload(c, requestBody, map[string]any{
+		"host_id":   host.ID.String(),
+		"host_name": host.Name,
+	}) {
+		return
+	}
+
+	requestedName, _ := requestBody["name"].(string)
+
+	// Send command and wait for response
+	response, err := h.dispatchStackDeploy(c.Request.Context(), agent.ID, host, stacks.ActionDeploy, requestedName, requestBody, parseUserID(c))
+	if err != nil {
+		logrus.Errorf("Failed to deploy stack on host %s: %v", hostID, err)
+		h.addLog("error", "stack", "Failed to deploy stack", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"error":     err.Error(),
+		})
+		respondCommandError(c, err, "Failed to deploy stack")
+		return
+	}
+
+	stackName := requestedName
+	if name, ok := response["name"].(string); ok && stackName == "" {
+		stackName = name
+	}
+	message := "Deployed stack"
+	fields := map[string]any{
+		"host_id":    host.ID.String(),
+		"host_name":  host.Name,
+		"stack_name": stackName,
+	}
+	if sandbox, _ := response["sandbox"].(bool); sandbox {
+		message = "Deployed sandbox stack"
+		fields["sandbox_name"] = response["name"]
+		fields["expires_at"] = response["expires_at"]
+	}
+	h.addLog("info", "stack", message, fields)
+	c.JSON(http.StatusOK, response)
+}
+
+// ListSandboxes returns the sandbox deployments on a host that are awaiting teardown
+func (h *HostsHandler) ListSandboxes(c *gin.Context) {
+	hostID := c.Param("id")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("list_sandboxes", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
+	if err != nil {
+		logrus.Errorf("Failed to list sandboxes on host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to list sandboxes")
 		return
 	}
 
-	c.JSON(http.StatusOK, stacks)
+	c.JSON(http.StatusOK, response)
 }
 
-// DeployStack deploys a new stack on a host
-func (h *HostsHandler) DeployStack(c *gin.Context) {
+// EndSandbox tears a sandbox deployment down before its TTL expires, once the caller has
+// confirmed the compose file works on the host
+func (h *HostsHandler) EndSandbox(c *gin.Context) {
 	hostID := c.Param("id")
+	sandboxName := c.Param("sandbox_name")
 
-	// Check if host exists
 	var host database.Host
 	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
 		logrus.Errorf(hostNotFoundLog, hostID, err)
-		h.addLog("warn", "stack", "Attempted stack import on unknown host", map[string]any{
-			"host_id": hostID,
-		})
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": hostNotFoundMsg,
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
 		return
 	}
 
-	// Check if agent is connected
 	agent, exists := h.hub.GetAgentByHost(hostID)
 	if !exists {
-		h.addLog("error", "stack", "Agent not connected for stack import", map[string]any{
-			"host_id":   host.ID.String(),
-			"host_name": host.Name,
-		})
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Host agent not connected",
-		})
-		return
-	}
-
-	// Parse request body
-	var requestBody map[string]interface{}
-	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		h.addLog("warn", "stack", "Invalid stack deploy payload", map[string]any{
-			"host_id":   host.ID.String(),
-			"host_name": host.Name,
-			"error":     err.Error(),
-		})
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request body",
-		})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
 		return
 	}
 
-	// Send command to agent
-	command := protocol.NewCommandWithAction("deploy_stack", requestBody)
-
-	// Send command and wait for response
+	command := protocol.NewCommandWithAction("end_sandbox", map[string]any{"name": sandboxName})
 	response, err := h.sendCommandAndWait(agent.ID, command, 120*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
 	if err != nil {
-		logrus.Errorf("Failed to deploy stack on host %s: %v", hostID, err)
-		h.addLog("error", "stack", "Failed to deploy stack", map[string]any{
-			"host_id":   host.ID.String(),
-			"host_name": host.Name,
-			"error":     err.Error(),
-		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to deploy stack",
+		logrus.Errorf("Failed to end sandbox %s on host %s: %v", sandboxName, hostID, err)
+		h.addLog("error", "stack", "Failed to tear down sandbox stack", map[string]any{
+			"host_id":      host.ID.String(),
+			"host_name":    host.Name,
+			"sandbox_name": sandboxName,
+			"error":        err.Error(),
 		})
+		respondCommandError(c, err, "Failed to tear down sandbox")
 		return
 	}
 
-	stackName := ""
-	if name, ok := requestBody["name"].(string); ok {
-		stackName = name
-	} else if name, ok := response["name"].(string); ok {
-		stackName = name
-	}
-	h.addLog("info", "stack", "Deployed stack", map[string]any{
-		"host_id":    host.ID.String(),
-		"host_name":  host.Name,
-		"stack_name": stackName,
+	h.addLog("info", "stack", "Tore down sandbox stack", map[string]any{
+		"host_id":      host.ID.String(),
+		"host_name":    host.Name,
+		"sandbox_name": sandboxName,
 	})
 	c.JSON(http.StatusOK, response)
 }
 
+// validStackActions are the actions StackAction accepts
+var validStackActions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"remove":  true,
+	"update":  true,
+	"relabel": true,
+}
+
+// stackActionTimeout is how long to wait for the agent to complete a stack action.
+func stackActionTimeout(action string) time.Duration {
+	switch action {
+	case "remove", "relabel":
+		return 120 * time.Second // 2 minutes for remove and recreation
+	default:
+		return 30 * time.Second
+	}
+}
+
 // StackAction performs an action on a stack
 func (h *HostsHandler) StackAction(c *gin.Context) {
 	hostID := c.Param("id")
@@ -683,17 +1048,9 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 	action := c.Param("action")
 
 	// Validate action
-	validActions := map[string]bool{
-		"start":   true,
-		"stop":    true,
-		"restart": true,
-		"remove":  true,
-		"update":  true,
-	}
-
-	if !validActions[action] {
+	if !validStackActions[action] {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid action. Must be one of: start, stop, restart, remove, update",
+			"error": "Invalid action. Must be one of: start, stop, restart, remove, update, relabel",
 		})
 		h.addLog("warn", "stack", "Invalid stack action requested", map[string]any{
 			"host_id":    hostID,
@@ -741,6 +1098,7 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 	// For update action, parse request body
 	if action == "update" {
 		var requestBody map[string]interface{}
+		h.limitStackPayloadBody(c, 1)
 		if err := c.ShouldBindJSON(&requestBody); err != nil {
 			h.addLog("warn", "stack", "Invalid stack update payload", map[string]any{
 				"host_id":    host.ID.String(),
@@ -749,9 +1107,15 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 				"action":     action,
 				"error":      err.Error(),
 			})
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid request body",
-			})
+			respondStackBindError(c, err)
+			return
+		}
+		if !h.checkStackPayload(c, requestBody, map[string]any{
+			"host_id":    host.ID.String(),
+			"host_name":  host.Name,
+			"stack_name": stackName,
+			"action":     action,
+		}) {
 			return
 		}
 		// Merge request body into params
@@ -760,15 +1124,13 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 		}
 	}
 
-	// Send command to agent
-	command := protocol.NewCommandWithAction(action+"_stack", params)
+	// Relabeling recreates containers unless only a dry run is requested
+	if action == "relabel" {
+		params["dry_run"] = c.Query("dry_run") == "true"
+	}
 
 	// Send command and wait for response
-	timeout := 30 * time.Second
-	if action == "remove" || action == "update" {
-		timeout = 120 * time.Second // 2 minutes for remove/update
-	}
-	response, err := h.sendCommandAndWait(agent.ID, command, timeout)
+	response, err := h.performStackAction(c.Request.Context(), agent.ID, host, action, stackName, params, parseUserID(c))
 	if err != nil {
 		logrus.Errorf("Failed to %s stack %s on host %s: %v", action, stackName, hostID, err)
 		h.addLog("error", "stack", "Stack action failed", map[string]any{
@@ -778,9 +1140,7 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 			"action":     action,
 			"error":      err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to perform stack action",
-		})
+		respondCommandError(c, err, "Failed to perform stack action")
 		return
 	}
 
@@ -793,6 +1153,62 @@ func (h *HostsHandler) StackAction(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// performStackAction sends a stack action to an agent and waits for it to complete. Updates
+// go through dispatchStackDeploy so they are versioned, and removals are recorded so that
+// reconciliation stops expecting the stack on the host.
+func (h *HostsHandler) performStackAction(ctx context.Context, agentID string, host database.Host, action, stackName string, params map[string]any, actor *uuid.UUID) (map[string]any, error) {
+	if action == "update" {
+		return h.dispatchStackDeploy(ctx, agentID, host, stacks.ActionUpdate, stackName, params, actor)
+	}
+
+	command := protocol.NewCommandWithAction(action+"_stack", params)
+	response, err := h.sendCommandAndWait(agentID, command, stackActionTimeout(action))
+	if err != nil {
+		return nil, err
+	}
+	if action == "remove" && agentResponseError(response) == nil {
+		h.recordStackVersion(ctx, host, stacks.VersionInput{
+			HostID:    host.ID,
+			StackName: stackName,
+			Action:    stacks.ActionRemove,
+			CreatedBy: actor,
+		})
+	}
+	return response, nil
+}
+
+// dispatchStackDeploy sends a deploy_stack or update_stack command to an agent and records the
+// deployed version when the agent reports success. Updates snapshot the running version first
+// so they can be rolled back.
+func (h *HostsHandler) dispatchStackDeploy(ctx context.Context, agentID string, host database.Host, action, stackName string, params map[string]any, actor *uuid.UUID) (map[string]any, error) {
+	if action == stacks.ActionUpdate {
+		h.snapshotStack(ctx, agentID, host, stackName)
+	}
+
+	// Deployments can pull images for minutes; the timeout restarts whenever the agent reports progress
+	command := protocol.NewCommandWithAction(action+"_stack", params)
+	response, err := sendCommandAndStream(h.hub, agentID, command, 120*time.Second, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sandbox deployments are temporary and are not part of the stack's history
+	sandbox, _ := params["sandbox"].(bool)
+	if stackName != "" && !sandbox && agentResponseError(response) == nil {
+		compose, _ := params["compose"].(string)
+		envVars, _ := params["env_vars"].(map[string]any)
+		h.recordStackVersion(ctx, host, stacks.VersionInput{
+			HostID:    host.ID,
+			StackName: stackName,
+			Action:    action,
+			Compose:   compose,
+			EnvVars:   envVars,
+			CreatedBy: actor,
+		})
+	}
+	return response, nil
+}
+
 // ImportStack imports an existing stack into Flotilla management
 func (h *HostsHandler) ImportStack(c *gin.Context) {
 	hostID := c.Param("id")
@@ -818,20 +1234,34 @@ func (h *HostsHandler) ImportStack(c *gin.Context) {
 
 	// Parse request body
 	var requestBody map[string]interface{}
+	h.limitStackPayloadBody(c, 1)
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
 		h.addLog("warn", "stack", "Invalid stack import payload", map[string]any{
 			"host_id":   host.ID.String(),
 			"host_name": host.Name,
 			"error":     err.Error(),
 		})
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request body",
-		})
+		respondStackBindError(c, err)
 		return
 	}
 
+	if !h.checkStackPayload(c, requestBody, map[string]any{
+		"host_id":   host.ID.String(),
+		"host_name": host.Name,
+	}) {
+		return
+	}
+
+	// Without pasted content, the agent adopts the compose file from the project's path on the host
+	action := "import_stack"
+	if compose, _ := requestBody["compose"].(string); compose == "" {
+		if _, hasPath := requestBody["path"]; hasPath {
+			action = "import_stack_from_path"
+		}
+	}
+
 	// Send command to agent
-	command := protocol.NewCommandWithAction("import_stack", requestBody)
+	command := protocol.NewCommandWithAction(action, requestBody)
 
 	// Send command and wait for response
 	response, err := h.sendCommandAndWait(agent.ID, command, 60*time.Second)
@@ -842,9 +1272,7 @@ func (h *HostsHandler) ImportStack(c *gin.Context) {
 			"host_name": host.Name,
 			"error":     err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to import stack",
-		})
+		respondCommandError(c, err, "Failed to import stack")
 		return
 	}
 
@@ -858,7 +1286,102 @@ func (h *HostsHandler) ImportStack(c *gin.Context) {
 		"host_id":    host.ID.String(),
 		"host_name":  host.Name,
 		"stack_name": stackName,
+		"source":     action,
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+// DiscoverStacks lists compose projects on a host that are not yet managed by Flotilla
+func (h *HostsHandler) DiscoverStacks(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("discover_stacks", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to discover stacks on host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to discover stacks")
+		return
+	}
+
+	response["host_id"] = host.ID.String()
+	response["host_name"] = host.Name
+	c.JSON(http.StatusOK, response)
+}
+
+// CleanupStacks removes stack directories on a host that no longer have any containers.
+// With dry_run=true the orphaned directories are listed without being removed.
+func (h *HostsHandler) CleanupStacks(c *gin.Context) {
+	hostID := c.Param("id")
+	dryRun := c.Query("dry_run") == "true"
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("cleanup_stacks", map[string]any{
+		"dry_run": dryRun,
 	})
+
+	response, err := h.sendCommandAndWait(agent.ID, command, 60*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to clean up stacks on host %s: %v", hostID, err)
+		h.addLog("error", "stack", "Failed to clean up stack directories", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"dry_run":   dryRun,
+			"error":     err.Error(),
+		})
+		respondCommandError(c, err, "Failed to clean up stacks")
+		return
+	}
+
+	if !dryRun {
+		h.addLog("info", "stack", "Cleaned up stack directories", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"removed":   response["removed"],
+		})
+	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -895,9 +1418,7 @@ func (h *HostsHandler) GetStackContainers(c *gin.Context) {
 	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
 	if err != nil {
 		logrus.Errorf("Failed to get stack containers from host %s: %v", hostID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get stack containers",
-		})
+		respondCommandError(c, err, "Failed to get stack containers")
 		return
 	}
 
@@ -975,9 +1496,7 @@ func (h *HostsHandler) StackContainerAction(c *gin.Context) {
 			"action":       action,
 			"error":        err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to %s container", action),
-		})
+		respondCommandError(c, err, fmt.Sprintf("Failed to %s container", action))
 		return
 	}
 
@@ -1023,6 +1542,19 @@ func (h *HostsHandler) CreateContainer(c *gin.Context) {
 		return
 	}
 
+	// Privileged containers have full access to the host and are restricted to admins
+	if privileged, _ := requestBody["privileged"].(bool); privileged && !hasAdminRole(c) {
+		h.addLog("warn", "container", "Rejected privileged container request from non-admin", map[string]any{
+			"host_id":   host.ID.String(),
+			"host_name": host.Name,
+			"name":      requestBody["name"],
+		})
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only admins can create privileged containers",
+		})
+		return
+	}
+
 	// Send command to agent
 	command := protocol.NewCommandWithAction("create_container", requestBody)
 
@@ -1035,9 +1567,12 @@ func (h *HostsHandler) CreateContainer(c *gin.Context) {
 			"host_name": host.Name,
 			"error":     err.Error(),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create container",
-		})
+		respondCommandError(c, err, "Failed to create container")
+		return
+	}
+	// A dry run only validated the configuration
+	if dryRun, _ := response["dry_run"].(bool); dryRun {
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
@@ -1122,13 +1657,17 @@ func (h *HostsHandler) ContainerAction(c *gin.Context) {
 		params["container_name"] = containerName
 	}
 
-	// Add timeout for stop/restart actions
+	// Add timeout for stop/restart actions; safe asks the agent to check the container is
+	// idle first
 	if action == "stop" || action == "restart" {
 		if timeoutStr := c.Query("timeout"); timeoutStr != "" {
 			if timeout, err := strconv.Atoi(timeoutStr); err == nil {
 				params["timeout"] = timeout
 			}
 		}
+		if c.Query("safe") == "true" {
+			params["safe"] = true
+		}
 	}
 
 	// Add force parameter for remove action
@@ -1146,6 +1685,10 @@ func (h *HostsHandler) ContainerAction(c *gin.Context) {
 	timeout := 30 * time.Second
 	if action == "stop" || action == "restart" {
 		timeout = 120 * time.Second // 2 minutes for stop/restart
+		// A longer grace period keeps the agent busy for longer
+		if grace, ok := params["timeout"].(int); ok && time.Duration(grace)*time.Second+time.Minute > timeout {
+			timeout = time.Duration(grace)*time.Second + time.Minute
+		}
 	}
 	response, err := h.sendCommandAndWait(agent.ID, command, timeout)
 	if err != nil {
@@ -1158,8 +1701,23 @@ func (h *HostsHandler) ContainerAction(c *gin.Context) {
 			"error":          err.Error(),
 			"container_name": containerName,
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to perform container action",
+		respondCommandError(c, err, "Failed to perform container action")
+		return
+	}
+	// A safe stop or restart found the container busy and left it alone
+	if confirm, _ := response["confirmation_required"].(bool); confirm {
+		h.addLog("warn", "container", "Container action held for confirmation", map[string]any{
+			"host_id":        host.ID.String(),
+			"host_name":      host.Name,
+			"container_id":   containerID,
+			"action":         action,
+			"reason":         response["reason"],
+			"container_name": containerName,
+		})
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                 "Container appears busy; repeat the action without safe to go ahead",
+			"confirmation_required": true,
+			"reason":                response["reason"],
 		})
 		return
 	}
@@ -1212,6 +1770,54 @@ func (h *HostsHandler) sendCommandAndWait(agentID string, command *protocol.Mess
 	}
 }
 
+// respondCommandError writes the response for a failed agent command. A command the agent
+// did not answer in time is reported as 504 so a slow or unreachable host can be told apart
+// from an operation that failed on the host, and one the agent declined because it was
+// saturated is reported as 503 with a Retry-After hint.
+func respondCommandError(c *gin.Context, err error, message string) {
+	if errors.Is(err, serverws.ErrServerReadOnly) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":     middleware.ReadOnlyMessage,
+			"details":   message,
+			"read_only": true,
+		})
+		return
+	}
+	if errors.Is(err, serverws.ErrCommandNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   commandDenyMsg,
+			"details": message,
+		})
+		return
+	}
+	if errors.Is(err, protocol.ErrAgentBusy) {
+		c.Header("Retry-After", agentBusyRetryAfter)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   agentBusyMsg,
+			"details": message,
+		})
+		return
+	}
+	if errors.Is(err, protocol.ErrCommandTimeout) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":   agentTimeoutMsg,
+			"details": message,
+		})
+		return
+	}
+	if errors.Is(err, protocol.ErrCommandPanic) {
+		logrus.WithError(err).Errorf("Agent command panicked: %s", message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   agentPanicMsg,
+			"details": message,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": message,
+	})
+}
+
 func userIsAdmin(c *gin.Context) bool {
 	header := c.GetHeader("Authorization")
 	if len(header) >= 8 && strings.HasPrefix(header, "Bearer ") {
@@ -1231,6 +1837,33 @@ func maskEnvMap(envVars map[string]any) map[string]any {
 	return masked
 }
 
+// auditSecretsReveal records that the requesting user was shown a stack's decrypted env vars,
+// or only the one named by key when it is set.
+func auditSecretsReveal(c *gin.Context, hostID, hostName, stackName, key string) {
+	var userID *uuid.UUID
+	if raw, ok := c.Get("user_id"); ok {
+		if s, ok := raw.(string); ok {
+			if id, err := uuid.Parse(s); err == nil {
+				userID = &id
+			}
+		}
+	}
+	var hostUUID *uuid.UUID
+	if id, err := uuid.Parse(hostID); err == nil {
+		hostUUID = &id
+	}
+	details := map[string]any{
+		"host_name":  hostName,
+		"stack_name": stackName,
+	}
+	if key != "" {
+		details["key"] = key
+	}
+	if err := auth.LogAuditEvent(userID, "stack_secrets_revealed", "host", hostUUID, details, c.ClientIP(), c.GetHeader(userAgentHeader)); err != nil {
+		logrus.WithError(err).Warn("Failed to record stack_secrets_revealed audit event")
+	}
+}
+
 func decryptEnvMapIfSensitive(envVars map[string]any) map[string]any {
 	out := make(map[string]any, len(envVars))
 	for k, v := range envVars {
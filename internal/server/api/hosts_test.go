@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	serverws "github.com/mikeysoft/flotilla/internal/server/websocket"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestRespondCommandError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{protocol.ErrCommandTimeout, http.StatusGatewayTimeout, agentTimeoutMsg},
+		{fmt.Errorf("deploy: %w", protocol.ErrCommandTimeout), http.StatusGatewayTimeout, agentTimeoutMsg},
+		{fmt.Errorf("%w: command start_container was not started", protocol.ErrAgentBusy), http.StatusServiceUnavailable, agentBusyMsg},
+		{fmt.Errorf("%w: start_container", serverws.ErrCommandNotAllowed), http.StatusForbidden, commandDenyMsg},
+		{fmt.Errorf("%w: start_container", serverws.ErrServerReadOnly), http.StatusForbidden, "read-only mode"},
+		{fmt.Errorf("%w: nil pointer dereference", protocol.ErrCommandPanic), http.StatusInternalServerError, agentPanicMsg},
+		{errors.New("no such container"), http.StatusInternalServerError, "Failed to start container"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondCommandError(c, tc.err, "Failed to start container")
+		if w.Code != tc.status {
+			t.Fatalf("expected status %d for %v, got %d", tc.status, tc.err, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tc.body) {
+			t.Fatalf("expected body to contain %q, got %s", tc.body, w.Body.String())
+		}
+		if busy := w.Header().Get("Retry-After") != ""; busy != (tc.status == http.StatusServiceUnavailable) {
+			t.Fatalf("unexpected Retry-After header %q for %v", w.Header().Get("Retry-After"), tc.err)
+		}
+	}
+}
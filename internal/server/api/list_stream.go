@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// respondListStream writes the records arriving on batches as one JSON array, flushing after
+// each batch so large fleet lists are never held in memory whole and the first host's records
+// reach the client without waiting for the slowest host. Records are filtered by keep, when
+// set, and projected like respondList. Unlike respondList, requested fields are not checked
+// against the records: a field may only appear in a later host's records, and by then the
+// array is under way, so records simply lack fields they do not have. It returns the number
+// of records written. The caller must close batches.
+func respondListStream(c *gin.Context, batches <-chan []map[string]any, keep func(map[string]any) bool) int {
+	fields, err := parseFieldsParam(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0
+	}
+
+	started := false
+	start := func() {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		_, _ = c.Writer.WriteString("[")
+		started = true
+	}
+	written := 0
+	for batch := range batches {
+		records := batch
+		if keep != nil {
+			records = make([]map[string]any, 0, len(batch))
+			for _, record := range batch {
+				if keep(record) {
+					records = append(records, record)
+				}
+			}
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		if !started {
+			start()
+		}
+		for _, record := range records {
+			if fields != nil {
+				record = projectRecord(record, fields)
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				logrus.WithError(err).Warn("Failed to encode list record")
+				continue
+			}
+			if written > 0 {
+				_, _ = c.Writer.WriteString(",")
+			}
+			_, _ = c.Writer.Write(data)
+			written++
+		}
+		c.Writer.Flush()
+	}
+
+	if !started {
+		start()
+	}
+	_, _ = c.Writer.WriteString("]")
+	return written
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func streamBatches(batches ...[]map[string]any) <-chan []map[string]any {
+	ch := make(chan []map[string]any, len(batches))
+	for _, batch := range batches {
+		ch <- batch
+	}
+	close(ch)
+	return ch
+}
+
+func TestRespondListStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	batches := [][]map[string]any{
+		{{"id": "a", "state": "running"}, {"id": "b", "state": "exited"}},
+		{},
+		{{"id": "c", "state": "running", "labels": map[string]any{}}},
+	}
+	running := func(m map[string]any) bool { return m["state"] == "running" }
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?fields=id", nil)
+	if written := respondListStream(c, streamBatches(batches...), running); written != 2 {
+		t.Fatalf("expected 2 records written, got %d", written)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not a JSON array: %v: %s", err, w.Body.String())
+	}
+	if len(got) != 2 || got[0]["id"] != "a" || got[1]["id"] != "c" || len(got[1]) != 1 {
+		t.Fatalf("unexpected records %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	respondListStream(c, streamBatches(), nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Fatalf("expected an empty array, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A field only the later hosts report is not rejected on the strength of the first
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?fields=id,labels", nil)
+	if written := respondListStream(c, streamBatches(batches...), nil); written != 3 || w.Code != http.StatusOK {
+		t.Fatalf("expected all 3 records with status 200, got %d records and %d", written, w.Code)
+	}
+	got = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not a JSON array: %v: %s", err, w.Body.String())
+	}
+	if _, ok := got[0]["labels"]; ok || got[2]["labels"] == nil {
+		t.Fatalf("expected labels only on the record that has them, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?fields=id,na-me", nil)
+	respondListStream(c, streamBatches(batches...), nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a malformed fields parameter to be rejected, got %d", w.Code)
+	}
+}
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -30,28 +33,61 @@ func NewLogsHandler(manager *appLogs.Manager) *LogsHandler {
 	}
 }
 
-// ListLogs returns recent application logs.
+// ListLogs returns a page of recent application logs. Pages are walked by passing the
+// returned next_cursor as after; since and until (RFC 3339) bound the time range and level
+// and source narrow the entries further.
 func (h *LogsHandler) ListLogs(c *gin.Context) {
-	after := c.Query("after")
-	limitStr := c.DefaultQuery("limit", "200")
-	limit, err := strconv.Atoi(limitStr)
+	query, err := parseLogQuery(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	entries := h.manager.List(after, limit)
+	page := h.manager.Query(query)
 	next := ""
-	if len(entries) > 0 {
-		next = entries[len(entries)-1].ID
+	if len(page.Entries) > 0 {
+		next = page.Entries[len(page.Entries)-1].ID
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"logs":        entries,
+		"logs":        page.Entries,
 		"next_cursor": next,
+		"has_more":    page.HasMore,
+		"total":       page.Total,
 	})
 }
 
+// parseLogQuery reads the paging and filter parameters of a log listing.
+func parseLogQuery(c *gin.Context) (appLogs.Query, error) {
+	query := appLogs.Query{
+		After:  c.Query("after"),
+		Level:  strings.TrimSpace(c.Query("level")),
+		Source: strings.TrimSpace(c.Query("source")),
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if err != nil || limit < 0 {
+		return query, fmt.Errorf("invalid limit")
+	}
+	query.Limit = limit
+
+	for param, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		raw := strings.TrimSpace(c.Query(param))
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", param)
+		}
+		*target = parsed
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		return query, fmt.Errorf("since must be before until")
+	}
+	return query, nil
+}
+
 // StreamLogs upgrades to a WebSocket connection and streams log entries.
 func (h *LogsHandler) StreamLogs(c *gin.Context) {
 	token := ""
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	appLogs "github.com/mikeysoft/flotilla/internal/server/logs"
+)
+
+func TestListLogsPagination(t *testing.T) {
+	manager := appLogs.NewManager(10)
+	for i := 0; i < 3; i++ {
+		manager.Add(appLogs.Entry{Level: "info", Source: "host", Message: "entry"})
+	}
+	handler := NewLogsHandler(manager)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?limit=2", nil)
+	handler.ListLogs(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Logs       []appLogs.Entry `json:"logs"`
+		NextCursor string          `json:"next_cursor"`
+		HasMore    bool            `json:"has_more"`
+		Total      int             `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Logs) != 2 || !body.HasMore || body.Total != 3 || body.NextCursor != body.Logs[1].ID {
+		t.Fatalf("unexpected page: %+v", body)
+	}
+
+	for _, query := range []string{"/?limit=x", "/?since=yesterday", "/?since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z"} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, query, nil)
+		handler.ListLogs(c)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", query, w.Code)
+		}
+	}
+}
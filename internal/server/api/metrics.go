@@ -2,6 +2,9 @@ package api
 
 import (
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -153,3 +156,148 @@ func (h *MetricsHandler) parseMetricsParams(c *gin.Context) (time.Time, time.Tim
 
 	return startTime, endTime, interval
 }
+
+// fleetMetricNames are the host metric fields that can be aggregated across hosts
+var fleetMetricNames = map[string]func(protocol.HostMetric) float64{
+	"cpu_percent":  func(m protocol.HostMetric) float64 { return m.CPUPercent },
+	"memory_usage": func(m protocol.HostMetric) float64 { return float64(m.MemoryUsage) },
+	"memory_total": func(m protocol.HostMetric) float64 { return float64(m.MemoryTotal) },
+	"disk_usage":   func(m protocol.HostMetric) float64 { return float64(m.DiskUsage) },
+	"disk_total":   func(m protocol.HostMetric) float64 { return float64(m.DiskTotal) },
+}
+
+// maxConcurrentFleetQueries bounds the InfluxDB queries a fleet metrics request runs at once
+const maxConcurrentFleetQueries = 8
+
+// fleetMetricPoint is one aggregated sample of a fleet metric.
+type fleetMetricPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	// Hosts is how many hosts reported a sample for this timestamp
+	Hosts int `json:"hosts"`
+}
+
+// aggregateFleetSeries combines per-host series into one, summing or averaging the samples
+// that share a timestamp. Hosts are queried with the same aggregation window, so their
+// samples line up.
+func aggregateFleetSeries(series map[string][]protocol.HostMetric, value func(protocol.HostMetric) float64, aggregation string) []fleetMetricPoint {
+	byTime := map[time.Time]*fleetMetricPoint{}
+	for _, samples := range series {
+		for _, sample := range samples {
+			point, ok := byTime[sample.Timestamp]
+			if !ok {
+				point = &fleetMetricPoint{Timestamp: sample.Timestamp}
+				byTime[sample.Timestamp] = point
+			}
+			point.Value += value(sample)
+			point.Hosts++
+		}
+	}
+
+	points := make([]fleetMetricPoint, 0, len(byTime))
+	for _, point := range byTime {
+		if aggregation == "avg" {
+			point.Value /= float64(point.Hosts)
+		}
+		points = append(points, *point)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return points
+}
+
+// GetFleetMetrics aggregates one host metric across several hosts over a time range, for a
+// fleet-wide load graph. host_ids is a comma-separated list and defaults to every host;
+// metric is one of fleetMetricNames and agg is sum (default) or avg. Hosts whose query fails
+// are reported under errors instead of failing the request.
+func (h *MetricsHandler) GetFleetMetrics(c *gin.Context) {
+	metricName := c.DefaultQuery("metric", "cpu_percent")
+	value, ok := fleetMetricNames[metricName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid metric. Must be one of: cpu_percent, memory_usage, memory_total, disk_usage, disk_total"})
+		return
+	}
+	aggregation := c.DefaultQuery("agg", "sum")
+	if aggregation != "sum" && aggregation != "avg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agg. Must be one of: sum, avg"})
+		return
+	}
+
+	// Check if metrics client is available
+	if h.metricsClient == nil || !h.metricsClient.IsEnabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Metrics storage not available",
+		})
+		return
+	}
+
+	var hosts []database.Host
+	query := database.DB.Model(&database.Host{})
+	if raw := strings.TrimSpace(c.Query("host_ids")); raw != "" {
+		ids := make([]string, 0)
+		for _, id := range strings.Split(raw, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		query = query.Where("id IN ?", ids)
+	}
+	if err := query.Find(&hosts).Error; err != nil {
+		logrus.Errorf("Failed to load hosts for fleet metrics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load hosts"})
+		return
+	}
+
+	startTime, endTime, interval := h.parseMetricsParams(c)
+
+	ctx := c.Request.Context()
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		series = make(map[string][]protocol.HostMetric, len(hosts))
+		failed = make([]gin.H, 0)
+		sem    = make(chan struct{}, maxConcurrentFleetQueries)
+	)
+	for _, host := range hosts {
+		hostID := host.ID.String()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			hostMetrics, err := h.metricsClient.QueryHostMetrics(ctx, hostID, startTime, endTime, interval)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logrus.Errorf("Failed to query host metrics for %s: %v", hostID, err)
+				failed = append(failed, gin.H{"host_id": hostID, "error": "Failed to retrieve host metrics"})
+				return
+			}
+			series[hostID] = hostMetrics
+		}()
+	}
+	wg.Wait()
+
+	hostIDs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		hostIDs = append(hostIDs, host.ID.String())
+	}
+
+	response := gin.H{
+		"metric":      metricName,
+		"aggregation": aggregation,
+		"host_ids":    hostIDs,
+		"metrics":     aggregateFleetSeries(series, value, aggregation),
+	}
+	if len(failed) > 0 {
+		response["errors"] = failed
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSendQueues reports the outbound message queue of each connected agent, deepest first.
+// A queue that stays deep, or that records send timeouts, belongs to an agent that is not
+// keeping up with commands fanned out to it.
+func (h *MetricsHandler) GetSendQueues(c *gin.Context) {
+	respondList(c, h.hub.SendQueueStats())
+}
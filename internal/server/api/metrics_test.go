@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestAggregateFleetSeries(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	series := map[string][]protocol.HostMetric{
+		"a": {{Timestamp: t0, CPUPercent: 10}, {Timestamp: t1, CPUPercent: 30}},
+		"b": {{Timestamp: t1, CPUPercent: 50}},
+	}
+	cpu := fleetMetricNames["cpu_percent"]
+
+	sum := aggregateFleetSeries(series, cpu, "sum")
+	if len(sum) != 2 || !sum[0].Timestamp.Equal(t0) || sum[0].Value != 10 || sum[1].Value != 80 || sum[1].Hosts != 2 {
+		t.Fatalf("unexpected sum: %+v", sum)
+	}
+
+	avg := aggregateFleetSeries(series, cpu, "avg")
+	if avg[0].Value != 10 || avg[1].Value != 40 {
+		t.Fatalf("unexpected avg: %+v", avg)
+	}
+
+	if got := aggregateFleetSeries(nil, cpu, "sum"); len(got) != 0 {
+		t.Fatalf("expected no points for no hosts, got %+v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProjectedFields bounds the fields query parameter; no list record has more keys than this
+const maxProjectedFields = 32
+
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseFieldsParam reads the comma-separated fields query parameter. It returns nil when no
+// projection was requested.
+func parseFieldsParam(raw string) ([]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	seen := make(map[string]struct{})
+	var fields []string
+	for _, part := range strings.Split(raw, ",") {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			continue
+		}
+		if !fieldNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid field name %q", name)
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields must name at least one field")
+	}
+	if len(fields) > maxProjectedFields {
+		return nil, fmt.Errorf("at most %d fields may be requested", maxProjectedFields)
+	}
+	return fields, nil
+}
+
+// projectRecords keeps only the requested fields of each record. A field that none of the
+// records carry is rejected so a misspelt name is not answered with empty objects; an
+// empty list cannot be checked and is returned as is.
+func projectRecords(records []map[string]any, fields []string) ([]map[string]any, error) {
+	if err := checkProjectedFields(records, fields); err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]any, len(records))
+	for i, record := range records {
+		projected[i] = projectRecord(record, fields)
+	}
+	return projected, nil
+}
+
+// checkProjectedFields rejects a field that none of records carry. An empty list passes.
+func checkProjectedFields(records []map[string]any, fields []string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	for _, field := range fields {
+		found := false
+		for _, record := range records {
+			if _, ok := record[field]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// projectRecord keeps only the requested fields of a record.
+func projectRecord(record map[string]any, fields []string) map[string]any {
+	out := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := record[field]; ok {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+// respondList writes a list of records, projected onto the fields named in the optional
+// fields query parameter so callers that only need a few columns skip labels and raw data.
+// records is a []map[string]any or a []interface{} of such maps.
+func respondList(c *gin.Context, records any) {
+	fields, err := parseFieldsParam(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if fields == nil {
+		c.JSON(http.StatusOK, records)
+		return
+	}
+
+	var maps []map[string]any
+	switch list := records.(type) {
+	case []map[string]any:
+		maps = list
+	case []interface{}:
+		maps = make([]map[string]any, 0, len(list))
+		for _, item := range list {
+			if m, ok := item.(map[string]any); ok {
+				maps = append(maps, m)
+			}
+		}
+	}
+
+	projected, err := projectRecords(maps, fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, projected)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseFieldsParam(t *testing.T) {
+	fields, err := parseFieldsParam(" id, name,,status,id ")
+	if err != nil {
+		t.Fatalf("parseFieldsParam returned error: %v", err)
+	}
+	if len(fields) != 3 || fields[0] != "id" || fields[1] != "name" || fields[2] != "status" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+
+	if fields, err := parseFieldsParam(""); err != nil || fields != nil {
+		t.Fatalf("expected no projection, got %v, %v", fields, err)
+	}
+	for _, raw := range []string{",", "labels.env", "name;drop"} {
+		if _, err := parseFieldsParam(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestRespondListProjectsFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	records := []interface{}{
+		map[string]any{"id": "a", "name": "web", "labels": map[string]any{"x": "y"}},
+		map[string]any{"id": "b", "status": "running"},
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?fields=id,name", nil)
+	respondList(c, records)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(got) != 2 || len(got[0]) != 2 || got[0]["name"] != "web" || len(got[1]) != 1 || got[1]["id"] != "b" {
+		t.Fatalf("unexpected projection: %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?fields=id,nmae", nil)
+	respondList(c, records)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown field to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tlsContainerPorts are container ports whose published URLs default to https
+var tlsContainerPorts = map[string]bool{"443": true, "8443": true}
+
+// SetPublishedURLScheme sets the scheme used for published URLs of container ports that are
+// not conventionally served over TLS. Empty keeps the default of http.
+func (h *ContainersHandler) SetPublishedURLScheme(scheme string) {
+	if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+		h.publishedURLScheme = scheme
+	}
+}
+
+// publishedURLs turns the published TCP ports of an inspected container into URLs on
+// address. Bindings to loopback are skipped since they are unreachable from elsewhere, and
+// containers on the host network publish their exposed ports directly. scheme, when set,
+// overrides the per-port default of https for TLS ports and defaultScheme otherwise.
+func publishedURLs(container map[string]any, address, scheme, defaultScheme string) []map[string]any {
+	type binding struct{ containerPort, hostIP, hostPort string }
+	var bindings []binding
+
+	networkSettings, _ := container["NetworkSettings"].(map[string]any)
+	ports, _ := networkSettings["Ports"].(map[string]any)
+	for containerPort, raw := range ports {
+		hostBindings, _ := raw.([]any)
+		for _, rawBinding := range hostBindings {
+			b, _ := rawBinding.(map[string]any)
+			hostIP, _ := b["HostIp"].(string)
+			hostPort, _ := b["HostPort"].(string)
+			if hostPort != "" {
+				bindings = append(bindings, binding{containerPort, hostIP, hostPort})
+			}
+		}
+	}
+	hostConfig, _ := container["HostConfig"].(map[string]any)
+	if mode, _ := hostConfig["NetworkMode"].(string); mode == "host" {
+		config, _ := container["Config"].(map[string]any)
+		exposed, _ := config["ExposedPorts"].(map[string]any)
+		for containerPort := range exposed {
+			port, _, _ := strings.Cut(containerPort, "/")
+			bindings = append(bindings, binding{containerPort, "", port})
+		}
+	}
+
+	seen := map[string]bool{}
+	urls := make([]map[string]any, 0, len(bindings))
+	for _, b := range bindings {
+		port, proto, _ := strings.Cut(b.containerPort, "/")
+		if proto != "" && proto != "tcp" {
+			continue
+		}
+		host := address
+		if ip := net.ParseIP(b.hostIP); ip != nil {
+			if ip.IsLoopback() {
+				continue
+			}
+			if !ip.IsUnspecified() {
+				host = b.hostIP
+			}
+		}
+		if host == "" {
+			continue
+		}
+
+		urlScheme := scheme
+		if urlScheme == "" {
+			urlScheme = defaultScheme
+			if tlsContainerPorts[port] {
+				urlScheme = "https"
+			}
+		}
+		u := (&url.URL{Scheme: urlScheme, Host: net.JoinHostPort(host, b.hostPort)}).String()
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, map[string]any{
+			"container_port": b.containerPort,
+			"host_ip":        b.hostIP,
+			"host_port":      b.hostPort,
+			"url":            u,
+		})
+	}
+
+	sort.SliceStable(urls, func(i, j int) bool {
+		pi, _ := strconv.Atoi(urls[i]["host_port"].(string))
+		pj, _ := strconv.Atoi(urls[j]["host_port"].(string))
+		if pi != pj {
+			return pi < pj
+		}
+		return urls[i]["url"].(string) < urls[j]["url"].(string)
+	})
+	return urls
+}
@@ -0,0 +1,43 @@
+package api
+
+import "testing"
+
+func TestPublishedURLs(t *testing.T) {
+	container := map[string]any{
+		"NetworkSettings": map[string]any{
+			"Ports": map[string]any{
+				"80/tcp": []any{
+					map[string]any{"HostIp": "0.0.0.0", "HostPort": "8080"},
+					map[string]any{"HostIp": "::", "HostPort": "8080"},
+				},
+				"443/tcp":  []any{map[string]any{"HostIp": "10.0.0.5", "HostPort": "8443"}},
+				"9000/tcp": []any{map[string]any{"HostIp": "127.0.0.1", "HostPort": "9000"}},
+				"53/udp":   []any{map[string]any{"HostIp": "0.0.0.0", "HostPort": "53"}},
+				"6379/tcp": nil,
+			},
+		},
+	}
+
+	urls := publishedURLs(container, "docker-1.lan", "", "http")
+	want := []string{"http://docker-1.lan:8080", "https://10.0.0.5:8443"}
+	if len(urls) != len(want) {
+		t.Fatalf("expected %d urls, got %+v", len(want), urls)
+	}
+	for i, u := range want {
+		if urls[i]["url"] != u {
+			t.Fatalf("url %d = %v, want %s", i, urls[i]["url"], u)
+		}
+	}
+
+	if urls := publishedURLs(container, "docker-1.lan", "ftp", "http"); urls[1]["url"] != "ftp://10.0.0.5:8443" {
+		t.Fatalf("explicit scheme should apply to every port, got %+v", urls)
+	}
+
+	hostNetwork := map[string]any{
+		"HostConfig": map[string]any{"NetworkMode": "host"},
+		"Config":     map[string]any{"ExposedPorts": map[string]any{"3000/tcp": map[string]any{}}},
+	}
+	if urls := publishedURLs(hostNetwork, "fd00::1", "", "http"); len(urls) != 1 || urls[0]["url"] != "http://[fd00::1]:3000" {
+		t.Fatalf("unexpected host network urls: %+v", urls)
+	}
+}
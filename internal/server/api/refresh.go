@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// refreshTopologyTimeout bounds the topology refresh that follows a resource refresh
+const refreshTopologyTimeout = 90 * time.Second
+
+// containerTopologyRefs returns the networks and named volumes an inspected container is
+// attached to, which are the topology cache entries its state is reflected in.
+func containerTopologyRefs(container map[string]any) (networks, volumes []string) {
+	networkSettings, _ := container["NetworkSettings"].(map[string]any)
+	attached, _ := networkSettings["Networks"].(map[string]any)
+	for _, raw := range attached {
+		endpoint, _ := raw.(map[string]any)
+		if id, _ := endpoint["NetworkID"].(string); id != "" {
+			networks = append(networks, id)
+		}
+	}
+
+	mounts, _ := container["Mounts"].([]any)
+	for _, raw := range mounts {
+		mount, _ := raw.(map[string]any)
+		if kind, _ := mount["Type"].(string); kind != "volume" {
+			continue
+		}
+		if name, _ := mount["Name"].(string); name != "" {
+			volumes = append(volumes, name)
+		}
+	}
+	sort.Strings(networks)
+	sort.Strings(volumes)
+	return networks, volumes
+}
+
+// findListedImage returns the image of a list_images response whose ID is id, accepting the
+// short form with or without the sha256: prefix.
+func findListedImage(response map[string]any, id string) map[string]any {
+	id = strings.TrimPrefix(id, "sha256:")
+	if id == "" {
+		return nil
+	}
+	images, _ := response["images"].([]any)
+	for _, raw := range images {
+		image, _ := raw.(map[string]any)
+		imageID, _ := image["id"].(string)
+		if strings.HasPrefix(strings.TrimPrefix(imageID, "sha256:"), id) {
+			return image
+		}
+	}
+	return nil
+}
+
+// RefreshContainer re-reads a container from its agent and refreshes the cached topology of
+// the networks and volumes it is attached to, so the result of an action shows up without
+// waiting for the background topology refresh.
+func (h *ContainersHandler) RefreshContainer(c *gin.Context) {
+	hostID := c.Param("id")
+	containerID := c.Param("container_id")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("get_container", map[string]any{
+		"container_id": containerID,
+	})
+	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to refresh container %s on host %s: %v", containerID, hostID, err)
+		respondCommandError(c, err, "Failed to refresh container")
+		return
+	}
+
+	container, _ := response["container"].(map[string]any)
+	networks, volumes := containerTopologyRefs(container)
+	topologyRefreshed := false
+	if h.topology != nil && (len(networks) > 0 || len(volumes) > 0) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), refreshTopologyTimeout)
+		defer cancel()
+		topologyRefreshed = true
+		if len(networks) > 0 {
+			if err := h.topology.RefreshNetworks(ctx, hostID, networks); err != nil {
+				logrus.WithError(err).WithField("host_id", hostID).Warn("failed to refresh network topology for container")
+				topologyRefreshed = false
+			}
+		}
+		if len(volumes) > 0 {
+			if err := h.topology.RefreshVolumes(ctx, hostID, volumes); err != nil {
+				logrus.WithError(err).WithField("host_id", hostID).Warn("failed to refresh volume topology for container")
+				topologyRefreshed = false
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"container":          container,
+		"networks":           networks,
+		"volumes":            volumes,
+		"topology_refreshed": topologyRefreshed,
+		"refreshed":          time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// RefreshImage re-reads an image from its agent by ID. Image details are not cached by the
+// server and the agent caches only content addressed data, so this is a targeted fetch.
+func (h *ContainersHandler) RefreshImage(c *gin.Context) {
+	hostID := c.Param("id")
+	imageID := c.Param("image_id")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("list_images", map[string]any{})
+	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to refresh image %s on host %s: %v", imageID, hostID, err)
+		respondCommandError(c, err, "Failed to refresh image")
+		return
+	}
+
+	image := findListedImage(response, imageID)
+	if image == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"image":     image,
+		"refreshed": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// RefreshStack re-reads a stack and its containers from the agent. Deploying or removing a
+// stack creates and deletes networks and volumes, so the host's cached topology is
+// refreshed as well.
+func (h *HostsHandler) RefreshStack(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return
+	}
+
+	stackResponse, err := h.sendCommandAndWait(agent.ID, protocol.NewCommandWithAction("get_stack", map[string]any{
+		"name": stackName,
+	}), 30*time.Second)
+	if err == nil {
+		err = agentResponseError(stackResponse)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to refresh stack %s on host %s: %v", stackName, hostID, err)
+		respondCommandError(c, err, "Failed to refresh stack")
+		return
+	}
+
+	containersResponse, err := h.sendCommandAndWait(agent.ID, protocol.NewCommandWithAction("get_stack_containers", map[string]any{
+		"stack_name": stackName,
+	}), 30*time.Second)
+	if err == nil {
+		err = agentResponseError(containersResponse)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to refresh containers of stack %s on host %s: %v", stackName, hostID, err)
+		respondCommandError(c, err, "Failed to refresh stack")
+		return
+	}
+
+	if h.topology != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), refreshTopologyTimeout)
+		defer cancel()
+		h.topology.RefreshHostTopology(ctx, hostID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stack":      stackResponse["stack"],
+		"containers": containersResponse["containers"],
+		"refreshed":  time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerTopologyRefs(t *testing.T) {
+	container := map[string]any{
+		"NetworkSettings": map[string]any{
+			"Networks": map[string]any{
+				"web_default": map[string]any{"NetworkID": "net-b"},
+				"bridge":      map[string]any{"NetworkID": "net-a"},
+				"pending":     map[string]any{},
+			},
+		},
+		"Mounts": []any{
+			map[string]any{"Type": "volume", "Name": "web_data"},
+			map[string]any{"Type": "bind", "Source": "/srv/config"},
+		},
+	}
+
+	networks, volumes := containerTopologyRefs(container)
+	if !reflect.DeepEqual(networks, []string{"net-a", "net-b"}) {
+		t.Fatalf("unexpected networks: %v", networks)
+	}
+	if !reflect.DeepEqual(volumes, []string{"web_data"}) {
+		t.Fatalf("unexpected volumes: %v", volumes)
+	}
+
+	if networks, volumes := containerTopologyRefs(nil); networks != nil || volumes != nil {
+		t.Fatalf("expected no references for a missing container, got %v %v", networks, volumes)
+	}
+}
+
+func TestFindListedImage(t *testing.T) {
+	response := map[string]any{"images": []any{
+		map[string]any{"id": "sha256:aaa111", "tag": "nginx:1"},
+		map[string]any{"id": "sha256:bbb222", "tag": "redis:7"},
+	}}
+
+	for _, id := range []string{"sha256:bbb222", "bbb222", "bbb"} {
+		if image := findListedImage(response, id); image == nil || image["tag"] != "redis:7" {
+			t.Fatalf("expected %q to find redis, got %v", id, image)
+		}
+	}
+	if image := findListedImage(response, "ccc"); image != nil {
+		t.Fatalf("expected no match, got %v", image)
+	}
+	if image := findListedImage(response, "sha256:"); image != nil {
+		t.Fatalf("expected an empty ID not to match, got %v", image)
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// sseKeepAliveInterval is how often an idle event stream sends a comment so proxies do
+	// not close it
+	sseKeepAliveInterval = 15 * time.Second
+	defaultStatsInterval = 2 * time.Second
+	minStatsInterval     = time.Second
+	maxStatsInterval     = time.Minute
+	// statsStreamTimeout bounds each stats sample of a stats stream
+	statsStreamTimeout = 10 * time.Second
+)
+
+// startSSE prepares the response for a Server-Sent Events stream.
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep reverse proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// writeSSE sends one event and flushes it to the client.
+func writeSSE(c *gin.Context, event string, data any) {
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+}
+
+// writeSSEKeepAlive sends a comment line, which clients ignore.
+func writeSSEKeepAlive(c *gin.Context) {
+	_, _ = c.Writer.WriteString(": keepalive\n\n")
+	c.Writer.Flush()
+}
+
+// drainProgress sends the progress reports still queued once the command has finished.
+func drainProgress(c *gin.Context, progress <-chan protocol.Progress) {
+	for {
+		select {
+		case report := <-progress:
+			writeSSE(c, "progress", report)
+		default:
+			return
+		}
+	}
+}
+
+// parseStatsInterval reads the interval query parameter of a stats stream.
+func parseStatsInterval(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultStatsInterval, nil
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, fmt.Errorf("interval must be a duration such as 5s")
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval < minStatsInterval || interval > maxStatsInterval {
+		return 0, fmt.Errorf("interval must be between %s and %s", minStatsInterval, maxStatsInterval)
+	}
+	return interval, nil
+}
+
+// lookupStreamTarget resolves the host of a stream request and its connected agent, writing
+// the error response when either is missing.
+func (h *ContainersHandler) lookupStreamTarget(c *gin.Context) (database.Host, string, bool) {
+	hostID := c.Param("id")
+
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": hostNotFoundMsg})
+		return host, "", false
+	}
+
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Host agent not connected"})
+		return host, "", false
+	}
+	return host, agent.ID, true
+}
+
+// StreamContainerLogs relays a container's logs as Server-Sent Events, an alternative to
+// the /ws/logs WebSocket for clients and proxies that handle WebSockets poorly. Events are
+// named after the WebSocket message types: log_connected, log_data and log_error.
+func (h *ContainersHandler) StreamContainerLogs(c *gin.Context) {
+	containerID := c.Param("container_id")
+	host, _, ok := h.lookupStreamTarget(c)
+	if !ok {
+		return
+	}
+
+	follow := c.DefaultQuery("follow", "true") == "true"
+	timestamps := c.Query("timestamps") == "true"
+	stream := h.hub.OpenLogStream(host.ID.String(), containerID, follow, c.Query("tail"), timestamps)
+	defer stream.Close()
+
+	startSSE(c)
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-stream.Done():
+			return
+		case <-keepAlive.C:
+			writeSSEKeepAlive(c)
+		case data := <-stream.Send:
+			var message struct {
+				Type    string          `json:"type"`
+				Payload json.RawMessage `json:"payload"`
+			}
+			if err := json.Unmarshal(data, &message); err != nil {
+				logrus.WithError(err).Debug("Dropping malformed log stream message")
+				continue
+			}
+			writeSSE(c, message.Type, string(message.Payload))
+			if message.Type == "log_error" {
+				return
+			}
+		}
+	}
+}
+
+// StreamContainerStats samples a container's stats at a fixed interval and sends each
+// sample as a stats event. A failed sample is sent as an error event and ends the stream.
+func (h *ContainersHandler) StreamContainerStats(c *gin.Context) {
+	containerID := c.Param("container_id")
+	interval, err := parseStatsInterval(c.Query("interval"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host, agentID, ok := h.lookupStreamTarget(c)
+	if !ok {
+		return
+	}
+
+	startSSE(c)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		command := protocol.NewCommandWithAction("get_container_stats", map[string]any{
+			"container_id": containerID,
+		})
+		response, err := h.sendCommandAndWait(agentID, command, statsStreamTimeout)
+		if err == nil {
+			err = agentResponseError(response)
+		}
+		if err != nil {
+			logrus.Errorf("Failed to stream stats for container %s from host %s: %v", containerID, host.ID, err)
+			writeSSE(c, "error", gin.H{"error": err.Error()})
+			return
+		}
+		writeSSE(c, "stats", response)
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PullImagesStream pulls images on a host like PullImages, sending the agent's progress as
+// progress events while the pull runs and its outcome as a final result or error event.
+func (h *ContainersHandler) PullImagesStream(c *gin.Context) {
+	var request pullImagesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(request.Images) == 0 && !request.InUse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "images must not be empty unless in_use is set"})
+		return
+	}
+	host, agentID, ok := h.lookupStreamTarget(c)
+	if !ok {
+		return
+	}
+
+	type pullOutcome struct {
+		response map[string]any
+		err      error
+	}
+	progress := make(chan protocol.Progress, 64)
+	done := make(chan pullOutcome, 1)
+	go func() {
+		response, err := h.pullImagesOnHost(agentID, host, request, progress)
+		done <- pullOutcome{response, err}
+	}()
+
+	startSSE(c)
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			// The pull carries on at the agent; only the relay stops
+			return
+		case <-keepAlive.C:
+			writeSSEKeepAlive(c)
+		case report := <-progress:
+			writeSSE(c, "progress", report)
+		case outcome := <-done:
+			drainProgress(c, progress)
+			if outcome.err != nil {
+				body := gin.H{"error": outcome.err.Error()}
+				if errors.Is(outcome.err, protocol.ErrCommandTimeout) {
+					body["code"] = "timeout"
+				}
+				writeSSE(c, "error", body)
+				return
+			}
+			writeSSE(c, "result", outcome.response)
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestParseStatsInterval(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":   defaultStatsInterval,
+		"5s": 5 * time.Second,
+		"10": 10 * time.Second,
+	}
+	for raw, want := range cases {
+		got, err := parseStatsInterval(raw)
+		if err != nil || got != want {
+			t.Fatalf("parseStatsInterval(%q) = %s, %v; want %s", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"100ms", "2h", "soon"} {
+		if _, err := parseStatsInterval(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	startSSE(c)
+	progress := make(chan protocol.Progress, 2)
+	progress <- protocol.Progress{CommandID: "cmd-1", Stage: "pull", Current: 1, Total: 2}
+	drainProgress(c, progress)
+	writeSSE(c, "log_data", `{"data":"hello"}`)
+
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", got)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "event:progress\ndata:{\"command_id\":\"cmd-1\",\"stage\":\"pull\",\"current\":1,\"total\":2}\n\n") {
+		t.Fatalf("expected a progress event, got %q", body)
+	}
+	if !strings.Contains(body, "event:log_data\ndata:{\"data\":\"hello\"}\n\n") {
+		t.Fatalf("expected the log payload to be relayed as is, got %q", body)
+	}
+}
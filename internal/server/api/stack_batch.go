@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxStackBatchSize caps how many stacks one batch request may act on
+	maxStackBatchSize = 50
+	// maxConcurrentStackActions caps the stack actions a batch runs against an agent at once
+	maxConcurrentStackActions = 4
+)
+
+// batchStackActions are the stack actions available in bulk. Removal and relabeling are left
+// out since applying them to many stacks at once is rarely intended.
+var batchStackActions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"update":  true,
+}
+
+// stackBatchRequest is the body of a bulk stack action.
+type stackBatchRequest struct {
+	Action string           `json:"action" binding:"required"`
+	Stacks []stackBatchItem `json:"stacks" binding:"required"`
+}
+
+// stackBatchItem names a stack in a bulk action. Compose and env vars are only used by update.
+type stackBatchItem struct {
+	Name    string         `json:"name"`
+	Compose string         `json:"compose,omitempty"`
+	EnvVars map[string]any `json:"env_vars,omitempty"`
+}
+
+// validateStackBatch checks a bulk stack action request before anything is dispatched.
+func validateStackBatch(req stackBatchRequest) error {
+	if !batchStackActions[req.Action] {
+		return fmt.Errorf("invalid action %q; must be one of: start, stop, restart, update", req.Action)
+	}
+	if len(req.Stacks) == 0 {
+		return fmt.Errorf("at least one stack is required")
+	}
+	if len(req.Stacks) > maxStackBatchSize {
+		return fmt.Errorf("at most %d stacks can be acted on in one request", maxStackBatchSize)
+	}
+	seen := make(map[string]bool, len(req.Stacks))
+	for _, item := range req.Stacks {
+		if item.Name == "" {
+			return fmt.Errorf("every stack needs a name")
+		}
+		if seen[item.Name] {
+			return fmt.Errorf("stack %s is listed more than once", item.Name)
+		}
+		seen[item.Name] = true
+		if req.Action == "update" && item.Compose == "" {
+			return fmt.Errorf("stack %s needs compose content to be updated", item.Name)
+		}
+	}
+	return nil
+}
+
+// stackBatchParams builds the command parameters for one stack of a bulk action.
+func stackBatchParams(action string, item stackBatchItem) map[string]any {
+	params := map[string]any{"name": item.Name}
+	if action == "update" {
+		params["compose"] = item.Compose
+		if len(item.EnvVars) > 0 {
+			params["env_vars"] = item.EnvVars
+		}
+	}
+	return params
+}
+
+// BatchStackAction starts, stops, restarts or updates several stacks on a host in one
+// request. The actions run concurrently and each stack gets its own result, so one failing
+// stack does not hide the outcome of the others.
+func (h *HostsHandler) BatchStackAction(c *gin.Context) {
+	hostID := c.Param("id")
+
+	var req stackBatchRequest
+	h.limitStackPayloadBody(c, maxStackBatchSize)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondStackBindError(c, err)
+		return
+	}
+	if err := validateStackBatch(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	params := make([]map[string]any, len(req.Stacks))
+	for i, item := range req.Stacks {
+		params[i] = stackBatchParams(req.Action, item)
+		if !h.checkStackPayload(c, params[i], map[string]any{
+			"host_id":    host.ID.String(),
+			"host_name":  host.Name,
+			"stack_name": item.Name,
+			"action":     req.Action,
+		}) {
+			return
+		}
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	actor := parseUserID(c)
+	results := make([]gin.H, len(req.Stacks))
+	sem := make(chan struct{}, maxConcurrentStackActions)
+	var wg sync.WaitGroup
+	for i, item := range req.Stacks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			response, err := h.performStackAction(ctx, agent.ID, host, req.Action, item.Name, params[i], actor)
+			if err == nil {
+				err = agentResponseError(response)
+			}
+			if err != nil {
+				logrus.Errorf("Failed to %s stack %s on host %s: %v", req.Action, item.Name, hostID, err)
+				results[i] = gin.H{"stack_name": item.Name, "status": "error", "error": err.Error()}
+				return
+			}
+			results[i] = gin.H{"stack_name": item.Name, "status": "success", "response": response}
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result["status"] != "success" {
+			failed++
+		}
+	}
+	level := "info"
+	if failed > 0 {
+		level = "warn"
+	}
+	h.addLog(level, "stack", "Batch stack action completed", map[string]any{
+		"host_id":   host.ID.String(),
+		"host_name": host.Name,
+		"action":    req.Action,
+		"stacks":    len(req.Stacks),
+		"failed":    failed,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    req.Action,
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidateStackBatch(t *testing.T) {
+	tooMany := make([]stackBatchItem, maxStackBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = stackBatchItem{Name: fmt.Sprintf("stack-%d", i)}
+	}
+
+	cases := []struct {
+		name    string
+		req     stackBatchRequest
+		wantErr bool
+	}{
+		{"restart", stackBatchRequest{Action: "restart", Stacks: []stackBatchItem{{Name: "web"}, {Name: "db"}}}, false},
+		{"remove is not available in bulk", stackBatchRequest{Action: "remove", Stacks: []stackBatchItem{{Name: "web"}}}, true},
+		{"no stacks", stackBatchRequest{Action: "start"}, true},
+		{"too many stacks", stackBatchRequest{Action: "start", Stacks: tooMany}, true},
+		{"unnamed stack", stackBatchRequest{Action: "stop", Stacks: []stackBatchItem{{}}}, true},
+		{"duplicate stack", stackBatchRequest{Action: "stop", Stacks: []stackBatchItem{{Name: "web"}, {Name: "web"}}}, true},
+		{"update without compose", stackBatchRequest{Action: "update", Stacks: []stackBatchItem{{Name: "web"}}}, true},
+		{"update", stackBatchRequest{Action: "update", Stacks: []stackBatchItem{{Name: "web", Compose: "services: {}"}}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateStackBatch(tc.req); (err != nil) != tc.wantErr {
+				t.Fatalf("validateStackBatch() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestStackBatchParams(t *testing.T) {
+	item := stackBatchItem{Name: "web", Compose: "services: {}", EnvVars: map[string]any{"TAG": "v2"}}
+	if params := stackBatchParams("restart", item); len(params) != 1 || params["name"] != "web" {
+		t.Fatalf("restart should only carry the stack name, got %+v", params)
+	}
+	params := stackBatchParams("update", item)
+	if params["compose"] != "services: {}" || params["env_vars"] == nil {
+		t.Fatalf("update should carry compose and env vars, got %+v", params)
+	}
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// stackVersionSummary is the history view of a stack version, without compose content or env vars
+type stackVersionSummary struct {
+	Version      int        `json:"version"`
+	Action       string     `json:"action"`
+	ComposeHash  string     `json:"compose_hash"`
+	RestoredFrom *int       `json:"restored_from,omitempty"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// GetStackHistory returns the recorded versions of a stack, newest first
+func (h *HostsHandler) GetStackHistory(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	versions, err := h.stackHistory.List(c.Request.Context(), host.ID, stackName)
+	if err != nil {
+		if errors.Is(err, stacks.ErrHistoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Stack history not available",
+			})
+			return
+		}
+		logrus.Errorf("Failed to load stack history for %s on host %s: %v", stackName, hostID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load stack history",
+		})
+		return
+	}
+
+	history := make([]stackVersionSummary, 0, len(versions))
+	for _, v := range versions {
+		history = append(history, stackVersionSummary{
+			Version:      v.Version,
+			Action:       v.Action,
+			ComposeHash:  v.ComposeHash,
+			RestoredFrom: v.RestoredFrom,
+			CreatedBy:    v.CreatedBy,
+			CreatedAt:    v.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"host_id":    host.ID.String(),
+		"stack_name": stackName,
+		"versions":   history,
+	})
+}
+
+// GetStackDiff returns a structured diff between two recorded versions of a stack
+func (h *HostsHandler) GetStackDiff(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+
+	fromVersion, fromErr := strconv.Atoi(c.Query("from"))
+	toVersion, toErr := strconv.Atoi(c.Query("to"))
+	if fromErr != nil || toErr != nil || fromVersion <= 0 || toVersion <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "from and to must be positive version numbers",
+		})
+		return
+	}
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	versions := make([]*database.StackVersion, 0, 2)
+	for _, number := range []int{fromVersion, toVersion} {
+		version, err := h.stackHistory.Get(ctx, host.ID, stackName, number)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": fmt.Sprintf("Stack version %d not found", number),
+				})
+				return
+			}
+			if errors.Is(err, stacks.ErrHistoryUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "Stack history not available",
+				})
+				return
+			}
+			logrus.Errorf("Failed to load stack version %d for %s on host %s: %v", number, stackName, hostID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load stack history",
+			})
+			return
+		}
+		versions = append(versions, version)
+	}
+
+	diff, err := stacks.DiffVersions(versions[0], versions[1])
+	if err != nil {
+		logrus.Errorf("Failed to diff stack %s versions %d and %d on host %s: %v", stackName, fromVersion, toVersion, hostID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Failed to compare stack versions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// RollbackStack redeploys a previous version of a stack. The target defaults to the version
+// preceding the current one and can be chosen with the version query parameter.
+func (h *HostsHandler) RollbackStack(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+
+	targetVersion := 0
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "version must be a positive integer",
+			})
+			return
+		}
+		targetVersion = parsed
+	}
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		h.addLog("warn", "stack", "Attempted stack rollback on unknown host", map[string]any{
+			"host_id":    hostID,
+			"stack_name": stackName,
+		})
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		h.addLog("error", "stack", "Agent not connected for stack rollback", map[string]any{
+			"host_id":    host.ID.String(),
+			"host_name":  host.Name,
+			"stack_name": stackName,
+		})
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var version *database.StackVersion
+	var err error
+	if targetVersion > 0 {
+		version, err = h.stackHistory.Get(ctx, host.ID, stackName, targetVersion)
+	} else {
+		version, err = h.stackHistory.RollbackTarget(ctx, host.ID, stackName)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No previous stack version available",
+			})
+			return
+		}
+		if errors.Is(err, stacks.ErrHistoryUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Stack history not available",
+			})
+			return
+		}
+		logrus.Errorf("Failed to load stack history for %s on host %s: %v", stackName, hostID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load stack history",
+		})
+		return
+	}
+
+	// An explicitly requested version may record a removal, which has nothing to redeploy
+	if err := stacks.CheckRestorable(version); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	envVars, err := stacks.DecryptEnvVars(version.EnvVars)
+	if err != nil {
+		logrus.Errorf("Failed to decrypt stack version %d for %s on host %s: %v", version.Version, stackName, hostID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load stack version",
+		})
+		return
+	}
+
+	command := protocol.NewCommandWithAction("update_stack", map[string]any{
+		"name":     stackName,
+		"compose":  version.ComposeContent,
+		"env_vars": envVars,
+	})
+
+	response, err := h.sendCommandAndWait(agent.ID, command, 120*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to roll back stack %s on host %s: %v", stackName, hostID, err)
+		h.addLog("error", "stack", "Stack rollback failed", map[string]any{
+			"host_id":    host.ID.String(),
+			"host_name":  host.Name,
+			"stack_name": stackName,
+			"version":    version.Version,
+			"error":      err.Error(),
+		})
+		respondCommandError(c, err, "Failed to roll back stack")
+		return
+	}
+
+	restoredFrom := version.Version
+	h.recordStackVersion(ctx, host, stacks.VersionInput{
+		HostID:       host.ID,
+		StackName:    stackName,
+		Action:       stacks.ActionRollback,
+		Compose:      version.ComposeContent,
+		EnvVars:      envVars,
+		RestoredFrom: &restoredFrom,
+		CreatedBy:    parseUserID(c),
+	})
+
+	h.addLog("info", "stack", "Stack rolled back", map[string]any{
+		"host_id":    host.ID.String(),
+		"host_name":  host.Name,
+		"stack_name": stackName,
+		"version":    version.Version,
+	})
+	response["restored_version"] = version.Version
+	c.JSON(http.StatusOK, response)
+}
+
+// snapshotStack records the currently deployed compose file and env vars of a stack when no
+// history exists yet, so stacks deployed before history was kept can still be rolled back.
+// Failures are logged and do not block the update that follows.
+func (h *HostsHandler) snapshotStack(ctx context.Context, agentID string, host database.Host, stackName string) {
+	if h.stackHistory == nil {
+		return
+	}
+	if exists, err := h.stackHistory.HasVersions(ctx, host.ID, stackName); err != nil || exists {
+		if err != nil {
+			logrus.WithError(err).WithField("stack_name", stackName).Warn("failed to check stack history")
+		}
+		return
+	}
+
+	command := protocol.NewCommandWithAction("get_stack", map[string]any{
+		"name": stackName,
+	})
+	response, err := h.sendCommandAndWait(agentID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("stack_name", stackName).Warn("failed to fetch stack for snapshot")
+		return
+	}
+
+	stack, _ := response["stack"].(map[string]any)
+	compose, _ := stack["compose_content"].(string)
+	if compose == "" {
+		return
+	}
+	envVars, _ := stack["env_vars"].(map[string]any)
+
+	h.recordStackVersion(ctx, host, stacks.VersionInput{
+		HostID:    host.ID,
+		StackName: stackName,
+		Action:    stacks.ActionSnapshot,
+		Compose:   compose,
+		EnvVars:   envVars,
+	})
+}
+
+// recordStackVersion stores a stack version, logging rather than failing the request on error.
+func (h *HostsHandler) recordStackVersion(ctx context.Context, host database.Host, input stacks.VersionInput) {
+	if h.stackHistory == nil {
+		return
+	}
+	if _, err := h.stackHistory.Record(ctx, input); err != nil {
+		logrus.WithError(err).WithField("stack_name", input.StackName).Warn("failed to record stack version")
+		h.addLog("warn", "stack", "Failed to record stack version", map[string]any{
+			"host_id":    host.ID.String(),
+			"host_name":  host.Name,
+			"stack_name": input.StackName,
+			"action":     input.Action,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// agentResponseError converts an agent response payload reporting status "error" into an error.
+func agentResponseError(response map[string]any) error {
+	if status, _ := response["status"].(string); status != "error" {
+		return nil
+	}
+	if msg, ok := response["error"].(string); ok && msg != "" {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("agent reported an error")
+}
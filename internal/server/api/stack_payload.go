@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultMaxStackPayloadSize matches the largest compose file the agent is willing to read
+	defaultMaxStackPayloadSize = 1 << 20
+	// stackPayloadSlack is allowed in a request body on top of the compose content and env
+	// vars, for the rest of the JSON and the escaping that enlarges them
+	stackPayloadSlack = 64 << 10
+)
+
+// stackPayloadTooLargeError reports a compose file or env var map over the configured limit.
+type stackPayloadTooLargeError struct {
+	field string
+	size  int
+	limit int
+}
+
+func (e *stackPayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%s is %d bytes, exceeding the %d byte limit", e.field, e.size, e.limit)
+}
+
+// envVarsSize is the combined size of an env var map's keys and values.
+func envVarsSize(envVars map[string]any) int {
+	size := 0
+	for key, value := range envVars {
+		size += len(key)
+		switch v := value.(type) {
+		case nil:
+		case string:
+			size += len(v)
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
+
+// validateStackPayload rejects stack deploy parameters whose compose content or env vars
+// exceed limit bytes. A non-positive limit disables the check.
+func validateStackPayload(params map[string]any, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	if compose, _ := params["compose"].(string); len(compose) > limit {
+		return &stackPayloadTooLargeError{field: "compose", size: len(compose), limit: limit}
+	}
+	if envVars, _ := params["env_vars"].(map[string]any); envVars != nil {
+		if size := envVarsSize(envVars); size > limit {
+			return &stackPayloadTooLargeError{field: "env_vars", size: size, limit: limit}
+		}
+	}
+	return nil
+}
+
+// SetMaxStackPayloadSize sets the byte limit applied to compose content and env var maps
+// submitted with stack deploys, updates and imports. Zero disables the limit.
+func (h *HostsHandler) SetMaxStackPayloadSize(limit int) {
+	if limit < 0 {
+		return
+	}
+	h.maxStackPayload = limit
+}
+
+// checkStackPayload writes a 413 response and reports false when params are over the limit.
+func (h *HostsHandler) checkStackPayload(c *gin.Context, params map[string]any, fields map[string]any) bool {
+	err := validateStackPayload(params, h.maxStackPayload)
+	if err == nil {
+		return true
+	}
+	logFields := map[string]any{"error": err.Error()}
+	for k, v := range fields {
+		logFields[k] = v
+	}
+	h.addLog("warn", "stack", "Rejected oversized stack payload", logFields)
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": err.Error(),
+	})
+	return false
+}
+
+// limitStackPayloadBody caps the request body at what the given number of stacks of the
+// configured size can take, so an oversized body fails while it is read instead of being
+// decoded in full first.
+func (h *HostsHandler) limitStackPayloadBody(c *gin.Context, stacks int) {
+	if h.maxStackPayload <= 0 {
+		return
+	}
+	// Each stack carries a compose file and env vars, each up to the limit
+	limit := int64(stacks)*2*int64(h.maxStackPayload) + stackPayloadSlack
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+}
+
+// respondStackBindError writes the response for a stack request body that could not be
+// decoded: 413 when limitStackPayloadBody cut it off, 400 otherwise.
+func respondStackBindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("request body exceeds the %d byte limit", tooLarge.Limit),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "Invalid request body",
+	})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateStackPayloadBoundary(t *testing.T) {
+	const limit = 64
+
+	if err := validateStackPayload(map[string]any{"compose": strings.Repeat("a", limit)}, limit); err != nil {
+		t.Fatalf("compose at the limit should be accepted: %v", err)
+	}
+	err := validateStackPayload(map[string]any{"compose": strings.Repeat("a", limit+1)}, limit)
+	var tooLarge *stackPayloadTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.field != "compose" {
+		t.Fatalf("expected compose over the limit to be rejected, got %v", err)
+	}
+
+	// Keys count towards the env var size alongside values
+	atLimit := map[string]any{"KEY": strings.Repeat("v", limit-3)}
+	if err := validateStackPayload(map[string]any{"env_vars": atLimit}, limit); err != nil {
+		t.Fatalf("env vars at the limit should be accepted: %v", err)
+	}
+	overLimit := map[string]any{"KEY": strings.Repeat("v", limit-3), "X": nil}
+	err = validateStackPayload(map[string]any{"env_vars": overLimit}, limit)
+	if !errors.As(err, &tooLarge) || tooLarge.field != "env_vars" {
+		t.Fatalf("expected env vars over the limit to be rejected, got %v", err)
+	}
+
+	if err := validateStackPayload(map[string]any{"compose": strings.Repeat("a", limit+1)}, 0); err != nil {
+		t.Fatalf("a zero limit should disable the check: %v", err)
+	}
+}
+
+func TestLimitStackPayloadBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &HostsHandler{}
+	h.SetMaxStackPayloadSize(64)
+
+	bind := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.limitStackPayloadBody(c, 1)
+		var payload map[string]any
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			respondStackBindError(c, err)
+		}
+		return w
+	}
+
+	if w := bind(`{"compose":"` + strings.Repeat("a", 64) + `"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected a body within the limit to be read, got %d", w.Code)
+	}
+	if w := bind(`{"compose":"` + strings.Repeat("a", 2*64+stackPayloadSlack) + `"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an oversized body to be rejected with 413, got %d", w.Code)
+	}
+	if w := bind(`{"compose":`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected malformed JSON to be rejected with 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// stackUsage is the footprint of a stack on one host: its containers, their combined current
+// resource usage and the networks and volumes the stack uses.
+type stackUsage struct {
+	StackName  string              `json:"stack_name"`
+	HostID     string              `json:"host_id"`
+	Containers stackContainerUsage `json:"containers"`
+	Metrics    stackMetricsUsage   `json:"metrics"`
+	Networks   []stackNetworkUsage `json:"networks"`
+	Volumes    []stackVolumeUsage  `json:"volumes"`
+	// VolumeSizeBytes sums the sizes Docker reported; VolumeSizeComplete is false when some
+	// volume sizes were unknown
+	VolumeSizeBytes    int64 `json:"volume_size_bytes"`
+	VolumeSizeComplete bool  `json:"volume_size_complete"`
+	// TopologyAvailable is false when cached network and volume data could not be loaded
+	TopologyAvailable bool `json:"topology_available"`
+}
+
+type stackContainerUsage struct {
+	Total   int            `json:"total"`
+	Running int            `json:"running"`
+	ByState map[string]int `json:"by_state"`
+}
+
+// stackMetricsUsage sums the latest metrics sample of the stack's containers. Only running
+// containers report metrics, so Reporting may be lower than the container total.
+type stackMetricsUsage struct {
+	Available      bool       `json:"available"`
+	Error          string     `json:"error,omitempty"`
+	SampledAt      *time.Time `json:"sampled_at,omitempty"`
+	Reporting      int        `json:"containers_reporting"`
+	CPUPercent     float64    `json:"cpu_percent"`
+	MemoryUsage    uint64     `json:"memory_usage"`
+	DiskReadBytes  uint64     `json:"disk_read_bytes"`
+	DiskWriteBytes uint64     `json:"disk_write_bytes"`
+	NetworkRxBytes uint64     `json:"network_rx_bytes"`
+	NetworkTxBytes uint64     `json:"network_tx_bytes"`
+}
+
+type stackNetworkUsage struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Driver      string `json:"driver"`
+	Attached    int    `json:"attached_containers"`
+	RefreshedAt string `json:"refreshed_at"`
+	IsStale     bool   `json:"is_stale"`
+}
+
+type stackVolumeUsage struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	// SizeBytes is -1 when Docker has not reported the volume's size
+	SizeBytes   int64  `json:"size_bytes"`
+	Attached    int    `json:"attached_containers"`
+	RefreshedAt string `json:"refreshed_at"`
+	IsStale     bool   `json:"is_stale"`
+}
+
+// GetStackUsage returns a stack's footprint in one response: container counts by state, the
+// combined CPU, memory, disk and network usage of its containers from the agent's latest
+// metrics sample, and the networks and volumes the stack uses from the cached topology.
+// Metrics and topology are best effort; when either cannot be loaded the rest is still
+// returned.
+func (h *HostsHandler) GetStackUsage(c *gin.Context) {
+	hostID := c.Param("id")
+	stackName := c.Param("stack_name")
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	// Collecting a fresh metrics sample takes a while, so it runs alongside the container query
+	type metricsResult struct {
+		payload *protocol.MetricsPayload
+		err     error
+	}
+	metricsCh := make(chan metricsResult, 1)
+	go func() {
+		command := protocol.NewCommandWithAction("get_live_metrics", map[string]any{})
+		response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+		if err == nil {
+			err = agentResponseError(response)
+		}
+		var result protocol.LiveMetricsResult
+		if err == nil {
+			err = protocol.DecodeResult(response, &result)
+		}
+		metricsCh <- metricsResult{payload: result.Metrics, err: err}
+	}()
+
+	command := protocol.NewCommandWithAction("get_stack_containers", map[string]any{
+		"stack_name": stackName,
+	})
+	response, err := h.sendCommandAndWait(agent.ID, command, 30*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to get stack containers from host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to get stack containers")
+		return
+	}
+	var containers protocol.ContainerListResult
+	if err := protocol.DecodeResult(response, &containers); err != nil || containers.Containers == nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "containers", "array", err))
+		return
+	}
+
+	usage := summarizeStackUsage(stackName, containers.Containers)
+	usage.HostID = hostID
+
+	metrics := <-metricsCh
+	if metrics.err != nil {
+		logrus.WithError(metrics.err).WithField("host_id", hostID).Warn("Failed to get live metrics for stack usage")
+		usage.Metrics.Error = metrics.err.Error()
+	} else {
+		usage.addMetrics(containers.Containers, metrics.payload)
+	}
+
+	if h.topology != nil {
+		networks, netErr := h.topology.GetNetworkTopology(hostID)
+		volumes, volErr := h.topology.GetVolumeTopology(hostID)
+		if netErr != nil || volErr != nil {
+			logrus.WithField("host_id", hostID).Warnf("Failed to load cached topology for stack usage: networks=%v volumes=%v", netErr, volErr)
+		} else {
+			usage.addTopology(networks, volumes, h.topology.IsStale)
+		}
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// summarizeStackUsage counts a stack's containers by state.
+func summarizeStackUsage(stackName string, containers []map[string]any) *stackUsage {
+	usage := &stackUsage{
+		StackName:          stackName,
+		Containers:         stackContainerUsage{ByState: map[string]int{}},
+		Networks:           []stackNetworkUsage{},
+		Volumes:            []stackVolumeUsage{},
+		VolumeSizeComplete: true,
+	}
+	for _, container := range containers {
+		state, _ := container["state"].(string)
+		if state == "" {
+			state = "unknown"
+		}
+		usage.Containers.Total++
+		usage.Containers.ByState[state]++
+		if state == "running" {
+			usage.Containers.Running++
+		}
+	}
+	return usage
+}
+
+// addMetrics sums the metrics of the stack's containers from a metrics sample. Containers
+// are matched by ID, or by the stack name the agent recorded for them.
+func (u *stackUsage) addMetrics(containers []map[string]any, sample *protocol.MetricsPayload) {
+	u.Metrics.Available = true
+	if sample == nil {
+		return
+	}
+	if !sample.Timestamp.IsZero() {
+		sampledAt := sample.Timestamp
+		u.Metrics.SampledAt = &sampledAt
+	}
+
+	ids := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		if id, _ := container["id"].(string); id != "" {
+			ids[id] = true
+		}
+	}
+	for _, m := range sample.ContainerMetrics {
+		if !ids[m.ContainerID] && m.StackName != u.StackName {
+			continue
+		}
+		u.Metrics.Reporting++
+		u.Metrics.CPUPercent += m.CPUPercent
+		u.Metrics.MemoryUsage += m.MemoryUsage
+		u.Metrics.DiskReadBytes += m.DiskReadBytes
+		u.Metrics.DiskWriteBytes += m.DiskWriteBytes
+		u.Metrics.NetworkRxBytes += m.NetworkRxBytes
+		u.Metrics.NetworkTxBytes += m.NetworkTxBytes
+	}
+}
+
+// addTopology adds the cached networks and volumes that belong to the stack: those its
+// containers are attached to and those labelled with its compose project, which covers
+// resources of a stack whose containers are stopped.
+func (u *stackUsage) addTopology(networks map[string]database.NetworkTopology, volumes map[string]database.VolumeTopology, isStale func(time.Time) bool) {
+	u.TopologyAvailable = true
+
+	for id, record := range networks {
+		attached, ok := stackTopologyMembership(record.Snapshot, u.StackName)
+		if !ok {
+			continue
+		}
+		name, _ := record.Snapshot["name"].(string)
+		driver, _ := record.Snapshot["driver"].(string)
+		u.Networks = append(u.Networks, stackNetworkUsage{
+			ID:          id,
+			Name:        name,
+			Driver:      driver,
+			Attached:    attached,
+			RefreshedAt: record.RefreshedAt.Format(time.RFC3339),
+			IsStale:     isStale(record.RefreshedAt),
+		})
+	}
+	sort.Slice(u.Networks, func(i, j int) bool { return u.Networks[i].Name < u.Networks[j].Name })
+
+	for name, record := range volumes {
+		attached, ok := stackTopologyMembership(record.Snapshot, u.StackName)
+		if !ok {
+			continue
+		}
+		driver, _ := record.Snapshot["driver"].(string)
+		size := int64(-1)
+		if v, ok := record.Snapshot["size_bytes"].(float64); ok && v >= 0 {
+			size = int64(v)
+		}
+		if size >= 0 {
+			u.VolumeSizeBytes += size
+		} else {
+			u.VolumeSizeComplete = false
+		}
+		u.Volumes = append(u.Volumes, stackVolumeUsage{
+			Name:        name,
+			Driver:      driver,
+			SizeBytes:   size,
+			Attached:    attached,
+			RefreshedAt: record.RefreshedAt.Format(time.RFC3339),
+			IsStale:     isStale(record.RefreshedAt),
+		})
+	}
+	sort.Slice(u.Volumes, func(i, j int) bool { return u.Volumes[i].Name < u.Volumes[j].Name })
+}
+
+// stackTopologyMembership reports whether a cached network or volume snapshot belongs to a
+// stack and how many of the stack's containers use it.
+func stackTopologyMembership(snapshot database.JSONB, stackName string) (int, bool) {
+	attached := 0
+	details, _ := snapshot["containers_detail"].([]any)
+	for _, raw := range details {
+		detail, _ := raw.(map[string]any)
+		if stack, _ := detail["stack"].(string); stack == stackName {
+			attached++
+		}
+	}
+	labels, _ := snapshot["labels"].(map[string]any)
+	project, _ := labels[composeProjectLabel].(string)
+	return attached, attached > 0 || project == stackName
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestStackUsageAggregatesContainersAndMetrics(t *testing.T) {
+	containers := []map[string]any{
+		{"id": "web", "state": "running"},
+		{"id": "worker", "state": "running"},
+		{"id": "migrate", "state": "exited"},
+	}
+	usage := summarizeStackUsage("shop", containers)
+	if usage.Containers.Total != 3 || usage.Containers.Running != 2 || usage.Containers.ByState["exited"] != 1 {
+		t.Fatalf("unexpected container counts: %+v", usage.Containers)
+	}
+
+	sampledAt := time.Unix(1700000000, 0).UTC()
+	usage.addMetrics(containers, &protocol.MetricsPayload{
+		Timestamp: sampledAt,
+		ContainerMetrics: []protocol.ContainerMetric{
+			{ContainerID: "web", CPUPercent: 12.5, MemoryUsage: 100, NetworkRxBytes: 10},
+			{ContainerID: "worker", CPUPercent: 2.5, MemoryUsage: 50, DiskWriteBytes: 7},
+			// Recreated since the container list was taken, but labelled with the stack
+			{ContainerID: "web-new", StackName: "shop", CPUPercent: 1, MemoryUsage: 25},
+			{ContainerID: "other", StackName: "blog", CPUPercent: 90, MemoryUsage: 1000},
+		},
+	})
+	m := usage.Metrics
+	if !m.Available || m.Reporting != 3 || m.CPUPercent != 16 || m.MemoryUsage != 175 || m.NetworkRxBytes != 10 || m.DiskWriteBytes != 7 {
+		t.Fatalf("unexpected metrics totals: %+v", m)
+	}
+	if m.SampledAt == nil || !m.SampledAt.Equal(sampledAt) {
+		t.Fatalf("expected the sample time to be reported, got %v", m.SampledAt)
+	}
+}
+
+func TestStackUsageTopology(t *testing.T) {
+	refreshed := time.Now()
+	attached := func(stacks ...string) []any {
+		details := make([]any, 0, len(stacks))
+		for _, stack := range stacks {
+			details = append(details, map[string]any{"stack": stack})
+		}
+		return details
+	}
+	networks := map[string]database.NetworkTopology{
+		"net-1": {Snapshot: database.JSONB{"name": "shop_default", "driver": "bridge", "containers_detail": attached("shop", "shop", "blog")}, RefreshedAt: refreshed},
+		"net-2": {Snapshot: database.JSONB{"name": "shop_backend", "driver": "bridge", "labels": map[string]any{composeProjectLabel: "shop"}}, RefreshedAt: refreshed},
+		"net-3": {Snapshot: database.JSONB{"name": "blog_default", "containers_detail": attached("blog")}, RefreshedAt: refreshed},
+	}
+	volumes := map[string]database.VolumeTopology{
+		"shop_data":  {Snapshot: database.JSONB{"driver": "local", "size_bytes": float64(2048), "containers_detail": attached("shop")}, RefreshedAt: refreshed},
+		"shop_cache": {Snapshot: database.JSONB{"driver": "local", "size_bytes": float64(-1), "labels": map[string]any{composeProjectLabel: "shop"}}, RefreshedAt: refreshed},
+		"blog_data":  {Snapshot: database.JSONB{"size_bytes": float64(4096), "containers_detail": attached("blog")}, RefreshedAt: refreshed},
+	}
+
+	usage := summarizeStackUsage("shop", nil)
+	usage.addTopology(networks, volumes, func(time.Time) bool { return false })
+
+	if !usage.TopologyAvailable || len(usage.Networks) != 2 || len(usage.Volumes) != 2 {
+		t.Fatalf("expected the stack's two networks and two volumes, got %+v / %+v", usage.Networks, usage.Volumes)
+	}
+	if usage.Networks[0].Name != "shop_backend" || usage.Networks[0].Attached != 0 || usage.Networks[1].ID != "net-1" || usage.Networks[1].Attached != 2 {
+		t.Fatalf("unexpected networks: %+v", usage.Networks)
+	}
+	if usage.Volumes[0].Name != "shop_cache" || usage.Volumes[0].SizeBytes != -1 || usage.Volumes[1].SizeBytes != 2048 {
+		t.Fatalf("unexpected volumes: %+v", usage.Volumes)
+	}
+	if usage.VolumeSizeBytes != 2048 || usage.VolumeSizeComplete {
+		t.Fatalf("expected a partial volume size of 2048, got %d (complete=%v)", usage.VolumeSizeBytes, usage.VolumeSizeComplete)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	composeProjectLabel  = "com.docker.compose.project"
+	flotillaManagedLabel = "io.flotilla.managed"
+	// flotillaIgnoreLabel marks a container as intentionally left outside Flotilla management
+	flotillaIgnoreLabel = "io.flotilla.ignore"
+)
+
+// Reasons a container is reported as unmanaged.
+const (
+	unmanagedReasonNoProject      = "no_compose_project"
+	unmanagedReasonUnmanagedStack = "unmanaged_stack"
+)
+
+// unmanagedContainers returns the containers that run outside Flotilla management: those
+// without a compose project and those whose project has no Flotilla-managed container.
+// Stopped containers are skipped unless includeStopped is set, and containers labelled
+// io.flotilla.ignore=true are always skipped.
+func unmanagedContainers(containers []map[string]any, includeStopped bool) []map[string]any {
+	managedProjects := map[string]bool{}
+	for _, container := range containers {
+		labels, _ := container["labels"].(map[string]any)
+		if project, _ := labels[composeProjectLabel].(string); project != "" && labels[flotillaManagedLabel] == "true" {
+			managedProjects[project] = true
+		}
+	}
+
+	unmanaged := make([]map[string]any, 0)
+	for _, container := range containers {
+		labels, _ := container["labels"].(map[string]any)
+		if labels[flotillaIgnoreLabel] == "true" {
+			continue
+		}
+		if state, _ := container["state"].(string); !includeStopped && state != "running" {
+			continue
+		}
+
+		project, _ := labels[composeProjectLabel].(string)
+		reason := unmanagedReasonNoProject
+		if project != "" {
+			if managedProjects[project] {
+				continue
+			}
+			reason = unmanagedReasonUnmanagedStack
+		}
+
+		out := make(map[string]any, len(container)+2)
+		for k, v := range container {
+			out[k] = v
+		}
+		out["compose_project"] = project
+		out["unmanaged_reason"] = reason
+		unmanaged = append(unmanaged, out)
+	}
+	return unmanaged
+}
+
+// ListUnmanagedContainers lists the running containers on a host that are not part of a
+// Flotilla-managed stack, so they can be imported or deliberately labelled as ignored.
+// all=true includes stopped containers.
+func (h *HostsHandler) ListUnmanagedContainers(c *gin.Context) {
+	hostID := c.Param("id")
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	// Stack membership is judged across all containers, including stopped ones
+	command := protocol.NewCommandWithAction("list_containers", map[string]any{
+		"all": true,
+	})
+	response, err := h.sendCommandAndWait(agent.ID, command, 15*time.Second)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to get containers from host %s: %v", hostID, err)
+		respondCommandError(c, err, "Failed to retrieve containers")
+		return
+	}
+
+	var result protocol.ContainerListResult
+	if err := protocol.DecodeResult(response, &result); err != nil || result.Containers == nil {
+		respondMalformedResponse(c, hostID, response, malformedField(response, "containers", "array", err))
+		return
+	}
+
+	unmanaged := unmanagedContainers(result.Containers, c.Query("all") == "true")
+	for _, m := range unmanaged {
+		m["host_id"] = host.ID.String()
+		m["host_name"] = host.Name
+	}
+	respondList(c, unmanaged)
+}
@@ -0,0 +1,32 @@
+package api
+
+import "testing"
+
+func TestUnmanagedContainers(t *testing.T) {
+	containers := []map[string]any{
+		{"id": "managed-web", "state": "running", "labels": map[string]any{composeProjectLabel: "shop", flotillaManagedLabel: "true"}},
+		{"id": "managed-db", "state": "running", "labels": map[string]any{composeProjectLabel: "shop"}},
+		{"id": "manual-stack", "state": "running", "labels": map[string]any{composeProjectLabel: "legacy"}},
+		{"id": "plain", "state": "running", "labels": map[string]any{}},
+		{"id": "stopped", "state": "exited", "labels": nil},
+		{"id": "ignored", "state": "running", "labels": map[string]any{flotillaIgnoreLabel: "true"}},
+	}
+
+	got := unmanagedContainers(containers, false)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 unmanaged containers, got %v", got)
+	}
+	if got[0]["id"] != "manual-stack" || got[0]["unmanaged_reason"] != unmanagedReasonUnmanagedStack || got[0]["compose_project"] != "legacy" {
+		t.Fatalf("unexpected first container: %v", got[0])
+	}
+	if got[1]["id"] != "plain" || got[1]["unmanaged_reason"] != unmanagedReasonNoProject {
+		t.Fatalf("unexpected second container: %v", got[1])
+	}
+	if _, ok := containers[2]["unmanaged_reason"]; ok {
+		t.Fatal("expected the input records to be left untouched")
+	}
+
+	if got := unmanagedContainers(containers, true); len(got) != 3 || got[2]["id"] != "stopped" {
+		t.Fatalf("expected stopped containers when requested, got %v", got)
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/auth"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
+	serverws "github.com/mikeysoft/flotilla/internal/server/websocket"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const webhookAPIKeyHeader = "X-API-Key" // #nosec G101 -- header name constant, not a credential
+
+// deployWebhookRequest is the payload CI systems send to trigger a stack deploy. The compose
+// file is sent inline or referenced as a template; exactly one of the two must be set.
+type deployWebhookRequest struct {
+	HostID    string                 `json:"host_id"`
+	StackName string                 `json:"stack_name" binding:"required"`
+	Compose   string                 `json:"compose"`
+	Template  *deployWebhookTemplate `json:"template"`
+	EnvVars   map[string]any         `json:"env_vars"`
+	Action    string                 `json:"action"` // deploy (default) or update
+	Source    string                 `json:"source"` // free-form trigger description, e.g. pipeline or commit
+}
+
+// deployWebhookTemplate references a compose file from the stack history of the target host:
+// a recorded version of a stack, the latest one that can be redeployed unless Version is set
+type deployWebhookTemplate struct {
+	StackName string `json:"stack_name" binding:"required"`
+	Version   int    `json:"version"`
+}
+
+// DeployWebhook deploys or updates a stack on behalf of a CI system authenticated with a
+// deploy-scoped API key. Keys bound to a host may only deploy to that host.
+func (h *HostsHandler) DeployWebhook(c *gin.Context) {
+	apiKey := c.GetHeader(webhookAPIKeyHeader)
+	if apiKey == "" {
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			apiKey = strings.TrimPrefix(header, "Bearer ")
+		}
+	}
+	if apiKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	keyRecord, err := auth.ValidateAPIKey(apiKey)
+	if err != nil {
+		logrus.Warnf("Deploy webhook authentication failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if !auth.HasScope(keyRecord, auth.APIKeyScopeDeploy) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is not scoped for deploys"})
+		return
+	}
+
+	var req deployWebhookRequest
+	h.limitStackPayloadBody(c, 1)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondStackBindError(c, err)
+		return
+	}
+
+	if (req.Compose == "") == (req.Template == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of compose or template is required"})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action == "" {
+		action = stacks.ActionDeploy
+	}
+	if action != stacks.ActionDeploy && action != stacks.ActionUpdate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action. Must be one of: deploy, update"})
+		return
+	}
+
+	hostID := req.HostID
+	if keyRecord.HostID != nil {
+		if hostID != "" && hostID != keyRecord.HostID.String() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is not allowed to deploy to this host"})
+			return
+		}
+		hostID = keyRecord.HostID.String()
+	}
+	if hostID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "host_id is required"})
+		return
+	}
+
+	// Check if host exists
+	var host database.Host
+	if err := database.DB.Where(hostIDQuery, hostID).First(&host).Error; err != nil {
+		logrus.Errorf(hostNotFoundLog, hostID, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": hostNotFoundMsg,
+		})
+		return
+	}
+
+	trigger := map[string]any{
+		"host_id":      host.ID.String(),
+		"host_name":    host.Name,
+		"stack_name":   req.StackName,
+		"action":       action,
+		"trigger":      "webhook",
+		"api_key_name": keyRecord.Name,
+	}
+	if keyRecord.Prefix != nil {
+		trigger["api_key_prefix"] = *keyRecord.Prefix
+	}
+	if req.Source != "" {
+		trigger["source"] = req.Source
+	}
+
+	compose, envVars := req.Compose, req.EnvVars
+	if req.Template != nil {
+		version, err := h.resolveWebhookTemplate(c.Request.Context(), host, req.Template)
+		if err != nil {
+			respondWebhookTemplateError(c, err)
+			return
+		}
+		trigger["template_stack"] = version.StackName
+		trigger["template_version"] = version.Version
+		templateEnv, err := stacks.DecryptEnvVars(version.EnvVars)
+		if err != nil {
+			logrus.Errorf("Failed to decrypt stack version %d of %s on host %s: %v", version.Version, version.StackName, hostID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+			return
+		}
+		// Env vars sent with the request override the template's
+		for k, v := range req.EnvVars {
+			templateEnv[k] = v
+		}
+		compose, envVars = version.ComposeContent, templateEnv
+	}
+
+	params := map[string]any{
+		"name":    req.StackName,
+		"compose": compose,
+	}
+	if len(envVars) > 0 {
+		params["env_vars"] = envVars
+	}
+
+	if !h.checkStackPayload(c, params, trigger) {
+		return
+	}
+
+	// Check if agent is connected
+	agent, exists := h.hub.GetAgentByHost(hostID)
+	if !exists {
+		h.addLog("error", "stack", "Agent not connected for webhook deploy", trigger)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Host agent not connected",
+		})
+		return
+	}
+
+	h.addLog("info", "stack", "Webhook deploy triggered", trigger)
+	if err := auth.LogAuditEvent(nil, "stack_webhook_deploy", "api_key", &keyRecord.ID, trigger, c.ClientIP(), c.GetHeader(userAgentHeader)); err != nil {
+		logrus.WithError(err).Warn("Failed to record stack_webhook_deploy audit event")
+	}
+
+	response, err := h.dispatchStackDeploy(c.Request.Context(), agent.ID, host, action, req.StackName, params, nil)
+	if err == nil {
+		err = agentResponseError(response)
+	}
+	if err != nil {
+		logrus.Errorf("Webhook %s of stack %s on host %s failed: %v", action, req.StackName, hostID, err)
+		failure := map[string]any{"error": err.Error()}
+		for k, v := range trigger {
+			failure[k] = v
+		}
+		h.addLog("error", "stack", "Webhook deploy failed", failure)
+		if errors.Is(err, protocol.ErrCommandTimeout) || errors.Is(err, protocol.ErrAgentBusy) || errors.Is(err, serverws.ErrCommandNotAllowed) || errors.Is(err, serverws.ErrServerReadOnly) {
+			respondCommandError(c, err, "Failed to deploy stack")
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to deploy stack",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.addLog("info", "stack", "Webhook deploy completed", trigger)
+	c.JSON(http.StatusOK, response)
+}
+
+// resolveWebhookTemplate loads the stack version a webhook template refers to from the
+// target host's stack history
+func (h *HostsHandler) resolveWebhookTemplate(ctx context.Context, host database.Host, template *deployWebhookTemplate) (*database.StackVersion, error) {
+	if template.Version > 0 {
+		version, err := h.stackHistory.Get(ctx, host.ID, template.StackName, template.Version)
+		if err != nil {
+			return nil, err
+		}
+		return version, stacks.CheckRestorable(version)
+	}
+
+	versions, err := h.stackHistory.List(ctx, host.ID, template.StackName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if stacks.CheckRestorable(&versions[i]) == nil {
+			return &versions[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// respondWebhookTemplateError answers a webhook whose template could not be resolved
+func respondWebhookTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found in the host's stack history"})
+	case errors.Is(err, stacks.ErrVersionNotRestorable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, stacks.ErrHistoryUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stack history not available"})
+	default:
+		logrus.Errorf("Failed to load webhook template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
+	"gorm.io/gorm"
+)
+
+func TestDeployWebhookRequiresAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHostsHandler(nil, nil, nil, nil)
+	r := gin.New()
+	r.POST("/webhooks/deploy", handler.DeployWebhook)
+
+	body := `{"stack_name":"app","compose":"services: {}"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/deploy", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without API key, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhooks/deploy", strings.NewReader(body))
+	req.Header.Set(webhookAPIKeyHeader, "FLA_prefix_secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unverifiable API key, got %d", w.Code)
+	}
+}
+
+func TestRespondWebhookTemplateError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHostsHandler(nil, nil, nil, nil)
+	_, err := handler.resolveWebhookTemplate(context.Background(), database.Host{}, &deployWebhookTemplate{StackName: "app"})
+
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{err, http.StatusServiceUnavailable},
+		{gorm.ErrRecordNotFound, http.StatusNotFound},
+		{stacks.CheckRestorable(&database.StackVersion{Version: 3, Action: stacks.ActionRemove}), http.StatusConflict},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondWebhookTemplateError(c, tc.err)
+		if w.Code != tc.status {
+			t.Fatalf("expected status %d for %v, got %d", tc.status, tc.err, w.Code)
+		}
+	}
+}
@@ -15,8 +15,36 @@ import (
 
 const (
 	dbNotInitializedMsg = "database not initialized"
+
+	// APIKeyScopeAgent keys authenticate agent WebSocket connections.
+	APIKeyScopeAgent = "agent"
+	// APIKeyScopeDeploy keys authenticate inbound deploy webhooks from CI systems.
+	APIKeyScopeDeploy = "deploy"
 )
 
+// IsValidAPIKeyScope reports whether scope is a known API key scope.
+func IsValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case APIKeyScopeAgent, APIKeyScopeDeploy:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasScope reports whether an API key grants the given scope. Keys created before scopes
+// existed are treated as agent keys.
+func HasScope(key *database.APIKey, scope string) bool {
+	if key == nil {
+		return false
+	}
+	keyScope := key.Scope
+	if keyScope == "" {
+		keyScope = APIKeyScopeAgent
+	}
+	return keyScope == scope
+}
+
 // GenerateAPIKey generates a new API key for agent authentication
 func GenerateAPIKey(name string, hostID *string) (string, error) {
 	if database.DB == nil {
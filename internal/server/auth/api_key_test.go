@@ -1,6 +1,10 @@
 package auth
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+)
 
 func TestAPIKeyOperationsRequireDatabase(t *testing.T) {
 	if _, err := GenerateAPIKey("name", nil); err == nil {
@@ -16,3 +20,24 @@ func TestAPIKeyOperationsRequireDatabase(t *testing.T) {
 		t.Fatal("expected ListAPIKeys to fail without database")
 	}
 }
+
+func TestHasScope(t *testing.T) {
+	if !HasScope(&database.APIKey{}, APIKeyScopeAgent) {
+		t.Fatal("expected unscoped legacy key to be treated as an agent key")
+	}
+	if HasScope(&database.APIKey{}, APIKeyScopeDeploy) {
+		t.Fatal("expected unscoped legacy key not to grant deploy scope")
+	}
+	if !HasScope(&database.APIKey{Scope: APIKeyScopeDeploy}, APIKeyScopeDeploy) {
+		t.Fatal("expected deploy key to grant deploy scope")
+	}
+	if HasScope(&database.APIKey{Scope: APIKeyScopeDeploy}, APIKeyScopeAgent) {
+		t.Fatal("expected deploy key not to grant agent scope")
+	}
+	if HasScope(nil, APIKeyScopeAgent) {
+		t.Fatal("expected nil key to grant nothing")
+	}
+	if IsValidAPIKeyScope("admin") {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+}
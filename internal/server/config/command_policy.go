@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseCommandActions parses a comma separated list of agent command actions such as
+// "remove_volumes,prune_dangling_images". Actions are lower case letters, digits and
+// underscores; duplicates are ignored. An empty string yields no actions.
+func ParseCommandActions(raw string) ([]string, error) {
+	var actions []string
+	seen := make(map[string]bool)
+	for _, action := range strings.Split(raw, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" {
+			continue
+		}
+		if !validCommandAction(action) {
+			return nil, fmt.Errorf("invalid command action %q; use lower case letters, digits and underscores", action)
+		}
+		if seen[action] {
+			continue
+		}
+		seen[action] = true
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func validCommandAction(action string) bool {
+	for _, r := range action {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandPolicy parses the command actions the server may send to agents. An empty
+// allowlist allows every action not on the denylist.
+func (c *Config) CommandPolicy() (allow, deny []string, err error) {
+	if allow, err = ParseCommandActions(c.CommandAllowlist); err != nil {
+		return nil, nil, fmt.Errorf("command allowlist: %w", err)
+	}
+	if deny, err = ParseCommandActions(c.CommandDenylist); err != nil {
+		return nil, nil, fmt.Errorf("command denylist: %w", err)
+	}
+	return allow, deny, nil
+}
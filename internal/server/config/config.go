@@ -7,6 +7,11 @@ import (
 	"github.com/mikeysoft/flotilla/internal/shared/config"
 )
 
+const (
+	minLogBufferSize = 100
+	maxLogBufferSize = 100000
+)
+
 // Config extends the shared server configuration with server-specific fields
 type Config struct {
 	config.ServerConfig
@@ -19,6 +24,17 @@ func Load() *Config {
 	}
 }
 
+// Validate validates the server configuration
+func (c *Config) Validate() error {
+	if c.LogBufferSize < minLogBufferSize || c.LogBufferSize > maxLogBufferSize {
+		return fmt.Errorf("log buffer size must be between %d and %d entries", minLogBufferSize, maxLogBufferSize)
+	}
+	if _, _, err := c.CommandPolicy(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // GetServerAddress returns the server address in host:port format
 func (c *Config) GetServerAddress() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
@@ -31,3 +31,40 @@ func TestWebSocketAccessors(t *testing.T) {
 		t.Fatalf("unexpected handshake timeout")
 	}
 }
+
+func TestValidateLogBufferSize(t *testing.T) {
+	cfg := &Config{}
+	cfg.LogBufferSize = 1000
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	for _, size := range []int{0, 10, 1000000} {
+		cfg.LogBufferSize = size
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected log buffer size %d to be rejected", size)
+		}
+	}
+}
+
+func TestCommandPolicy(t *testing.T) {
+	cfg := &Config{}
+	cfg.LogBufferSize = 1000
+	cfg.CommandAllowlist = " list_containers, get_docker_info,list_containers "
+	cfg.CommandDenylist = "remove_volumes"
+
+	allow, deny, err := cfg.CommandPolicy()
+	if err != nil {
+		t.Fatalf("CommandPolicy() unexpected error: %v", err)
+	}
+	if len(allow) != 2 || allow[0] != "list_containers" || allow[1] != "get_docker_info" {
+		t.Fatalf("unexpected allowlist %v", allow)
+	}
+	if len(deny) != 1 || deny[0] != "remove_volumes" {
+		t.Fatalf("unexpected denylist %v", deny)
+	}
+
+	cfg.CommandDenylist = "remove-volumes"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an invalid action name to be rejected")
+	}
+}
@@ -7,12 +7,14 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mikeysoft/flotilla/internal/server/database"
 	"github.com/mikeysoft/flotilla/internal/server/metrics"
+	"github.com/mikeysoft/flotilla/internal/server/stacks"
 	"github.com/mikeysoft/flotilla/internal/server/topology"
 	"github.com/mikeysoft/flotilla/internal/server/websocket"
 	"github.com/mikeysoft/flotilla/internal/shared/protocol"
@@ -28,6 +30,12 @@ const (
 	defaultMemoryCriticalPercent = 5.0
 	defaultOfflineCriticalAfter  = 5 * time.Minute
 	commandTimeout               = 20 * time.Second
+	// minAgentScanBudget is the least time an agent's fetches get in a scan, however short
+	// the scan interval
+	minAgentScanBudget = 2 * time.Second
+	// maxConcurrentAgentScans caps how many agents a scan queries at once, so a slow host
+	// delays only its own results rather than the whole cycle
+	maxConcurrentAgentScans = 8
 )
 
 // ScannerOptions configures dashboard background scanning behaviour.
@@ -47,12 +55,13 @@ type Scanner struct {
 	manager  *Manager
 	topology *topology.Manager
 	metrics  *metrics.Client
+	history  *stacks.History
 	opts     ScannerOptions
 	started  uint32
 }
 
 // NewScanner constructs a new dashboard scanner with sane defaults.
-func NewScanner(db *gorm.DB, hub *websocket.Hub, manager *Manager, topologyManager *topology.Manager, metricsClient *metrics.Client, opts *ScannerOptions) *Scanner {
+func NewScanner(db *gorm.DB, hub *websocket.Hub, manager *Manager, topologyManager *topology.Manager, metricsClient *metrics.Client, stackHistory *stacks.History, opts *ScannerOptions) *Scanner {
 	options := ScannerOptions{
 		Interval:              defaultScanInterval,
 		DiskWarningPercent:    defaultDiskWarningPercent,
@@ -88,6 +97,7 @@ func NewScanner(db *gorm.DB, hub *websocket.Hub, manager *Manager, topologyManag
 		manager:  manager,
 		topology: topologyManager,
 		metrics:  metricsClient,
+		history:  stackHistory,
 		opts:     options,
 	}
 }
@@ -173,15 +183,33 @@ func (s *Scanner) scan(ctx context.Context) error {
 		}
 	}
 
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, maxConcurrentAgentScans)
+	)
 	for _, agent := range agents {
 		host, ok := hostByID[agent.HostID]
 		if !ok {
 			continue
 		}
-		if err := s.processAgent(ctx, agent, host, &summary); err != nil && !errors.Is(err, context.Canceled) {
-			logrus.WithError(err).WithField("host_id", agent.HostID).Warn("dashboard agent scan failed")
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			counts, err := s.processAgent(ctx, agent, host)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logrus.WithError(err).WithField("host_id", agent.HostID).Warn("dashboard agent scan failed")
+			}
+			mu.Lock()
+			summary.StacksTotal += counts.stacks
+			summary.ContainersTotal += counts.containers
+			mu.Unlock()
+		}()
 	}
+	wg.Wait()
 
 	summary.HostsOffline = summary.HostsTotal - summary.HostsOnline
 	if summary.HostsOffline < 0 {
@@ -192,39 +220,95 @@ func (s *Scanner) scan(ctx context.Context) error {
 	return nil
 }
 
-func (s *Scanner) processAgent(ctx context.Context, agent *websocket.AgentConnection, host database.Host, summary *Summary) error {
+// agentCounts are an agent's contributions to the dashboard summary.
+type agentCounts struct {
+	stacks     int
+	containers int
+}
+
+// agentScanBudget is how long one agent's fetches may take per scan. It is derived from the
+// scan interval so a slow host is done with before the next cycle, and never exceeds
+// commandTimeout.
+func (s *Scanner) agentScanBudget() time.Duration {
+	budget := s.opts.Interval * 2 / 3
+	if budget > commandTimeout {
+		budget = commandTimeout
+	}
+	if budget < minAgentScanBudget {
+		budget = minAgentScanBudget
+	}
+	return budget
+}
+
+// processAgent evaluates one connected agent. Its stacks, containers and host info are
+// fetched concurrently under one shared deadline, agentScanBudget; fetches still running
+// when it passes are abandoned and reported as timeouts.
+func (s *Scanner) processAgent(ctx context.Context, agent *websocket.AgentConnection, host database.Host) (agentCounts, error) {
 	hostID := host.ID
 	hostIDPtr := uuidPtr(hostID)
+	var counts agentCounts
+
+	if err := s.evaluateDockerHealth(ctx, host, agent.DockerHealth(), hostIDPtr); err != nil {
+		logrus.WithError(err).WithField("host_id", agent.HostID).Debug("docker health evaluation failed")
+	}
+
+	// Only the fetches share the budget; evaluating their results is not cut short
+	fetchCtx, cancel := context.WithTimeout(ctx, s.agentScanBudget())
+	defer cancel()
+	var (
+		wg                                sync.WaitGroup
+		stacks, containers                []map[string]any
+		info                              map[string]any
+		stacksErr, containersErr, infoErr error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		stacks, stacksErr = s.fetchStacks(fetchCtx, agent.ID)
+	}()
+	go func() {
+		defer wg.Done()
+		containers, containersErr = s.fetchContainers(fetchCtx, agent.ID)
+	}()
+	go func() {
+		defer wg.Done()
+		info, infoErr = s.fetchHostInfo(fetchCtx, agent.ID)
+	}()
+	wg.Wait()
+	if errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		logrus.WithField("host_id", agent.HostID).Debugf("dashboard scan budget of %s exhausted", s.agentScanBudget())
+	}
 
-	stacks, err := s.fetchStacks(ctx, agent.ID)
-	if err != nil && !errors.Is(err, protocol.ErrCommandTimeout) {
-		logrus.WithError(err).WithField("host_id", agent.HostID).Debug("failed to fetch stacks for dashboard scan")
+	if stacksErr != nil && !errors.Is(stacksErr, protocol.ErrCommandTimeout) {
+		logrus.WithError(stacksErr).WithField("host_id", agent.HostID).Debug("failed to fetch stacks for dashboard scan")
 	} else if len(stacks) > 0 {
-		summary.StacksTotal += len(stacks)
+		counts.stacks = len(stacks)
 		active := s.evaluateStacks(ctx, host, stacks, hostIDPtr)
 		s.resolveMissingStackTasks(ctx, hostID, active)
 	}
+	if stacksErr == nil {
+		s.reconcileStacks(ctx, host, stacks, hostIDPtr)
+	}
 
-	containers, err := s.fetchContainers(ctx, agent.ID)
-	if err != nil && !errors.Is(err, protocol.ErrCommandTimeout) {
-		logrus.WithError(err).WithField("host_id", agent.HostID).Debug("failed to fetch containers for dashboard scan")
+	if containersErr != nil && !errors.Is(containersErr, protocol.ErrCommandTimeout) {
+		logrus.WithError(containersErr).WithField("host_id", agent.HostID).Debug("failed to fetch containers for dashboard scan")
 	} else {
-		summary.ContainersTotal += len(containers)
+		counts.containers = len(containers)
 	}
 
-	if info, err := s.fetchHostInfo(ctx, agent.ID); err == nil {
+	if infoErr == nil {
 		if err := s.evaluateDiskUsage(ctx, host, info, hostIDPtr); err != nil {
 			logrus.WithError(err).WithField("host_id", agent.HostID).Debug("disk evaluation failed")
 		}
-	} else if !errors.Is(err, protocol.ErrCommandTimeout) {
-		logrus.WithError(err).WithField("host_id", agent.HostID).Debug("failed to fetch host info for dashboard scan")
+	} else if !errors.Is(infoErr, protocol.ErrCommandTimeout) {
+		logrus.WithError(infoErr).WithField("host_id", agent.HostID).Debug("failed to fetch host info for dashboard scan")
 	}
 
 	if err := s.evaluateMemoryUsage(ctx, host, hostIDPtr); err != nil {
 		logrus.WithError(err).WithField("host_id", agent.HostID).Debug("memory evaluation failed")
 	}
 
-	return nil
+	return counts, nil
 }
 
 func (s *Scanner) ensureHostOfflineTask(ctx context.Context, host database.Host) error {
@@ -325,6 +409,18 @@ func (s *Scanner) evaluateStacks(ctx context.Context, host database.Host, stacks
 			// running or unknown -> resolve
 		}
 
+		servicesDown, explanation := explainStackServices(raw["services"])
+		if needsAttention && status != "error" && len(servicesDown) == 0 && len(stackServices(raw["services"])) > 0 {
+			// Only services labeled io.flotilla.oneshot are stopped, and none of them failed
+			needsAttention = false
+		}
+		if needsAttention && explanation != "" {
+			desc = fmt.Sprintf("Stack %s needs attention: %s", name, explanation)
+			if status == "error" {
+				desc = fmt.Sprintf("Stack reported error state from agent: %s", explanation)
+			}
+		}
+
 		fingerprintUnhealthy := fmt.Sprintf("stack_unhealthy:%s:%s", hostIDStr, stackKey)
 		if needsAttention {
 			active[fingerprintUnhealthy] = struct{}{}
@@ -342,6 +438,7 @@ func (s *Scanner) evaluateStacks(ctx context.Context, host database.Host, stacks
 					"status":           status,
 					"containers_total": containersCount,
 					"containers_up":    runningCount,
+					"services_down":    servicesDown,
 				},
 				HostID: hostID,
 			})
@@ -358,6 +455,149 @@ func (s *Scanner) evaluateStacks(ctx context.Context, host database.Host, stacks
 	return active
 }
 
+// stackServices returns the agent's per-service breakdown of a stack.
+func stackServices(raw interface{}) []map[string]interface{} {
+	var services []map[string]interface{}
+	switch list := raw.(type) {
+	case []map[string]interface{}:
+		services = list
+	case []interface{}:
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				services = append(services, m)
+			}
+		}
+	}
+	return services
+}
+
+// explainStackServices lists the services of a stack that are not fully running, as reported in
+// the agent's per-service breakdown, and renders them as "service api (0/2 running)". Oneshot
+// services are expected to stop and only count when one of their containers failed.
+func explainStackServices(raw interface{}) ([]map[string]interface{}, string) {
+	down := []map[string]interface{}{}
+	parts := []string{}
+	for _, svc := range stackServices(raw) {
+		name := getString(svc["name"])
+		total := intFromAny(svc["containers"])
+		running := intFromAny(svc["running"])
+		if name == "" || running >= total {
+			continue
+		}
+		if oneshot, _ := svc["oneshot"].(bool); oneshot {
+			failed := stringsFromAny(svc["failed_containers"])
+			if len(failed) == 0 {
+				continue
+			}
+			down = append(down, map[string]interface{}{
+				"name":              name,
+				"containers":        total,
+				"running":           running,
+				"oneshot":           true,
+				"failed_containers": failed,
+			})
+			parts = append(parts, fmt.Sprintf("oneshot service %s (%d failed)", name, len(failed)))
+			continue
+		}
+		down = append(down, map[string]interface{}{
+			"name":            name,
+			"containers":      total,
+			"running":         running,
+			"down_containers": svc["down_containers"],
+		})
+		parts = append(parts, fmt.Sprintf("service %s (%d/%d running)", name, running, total))
+	}
+	return down, strings.Join(parts, ", ")
+}
+
+// reconcileStacks compares the latest recorded version of every stack deployed through
+// Flotilla with what the agent reports as running, raising a drift task per stack whose
+// services or images no longer match the compose file.
+func (s *Scanner) reconcileStacks(ctx context.Context, host database.Host, reported []map[string]any, hostID *uuid.UUID) {
+	if s.history == nil {
+		return
+	}
+	versions, err := s.history.Latest(ctx, host.ID)
+	if err != nil {
+		logrus.WithError(err).WithField("host_id", host.ID.String()).Debug("failed to load stack history for reconciliation")
+		return
+	}
+
+	running := make(map[string][]stacks.RunningService, len(reported))
+	for _, raw := range reported {
+		if name, _ := raw["name"].(string); name != "" {
+			running[name] = runningServices(raw["services"])
+		}
+	}
+
+	hostIDStr := host.ID.String()
+	for i := range versions {
+		version := &versions[i]
+		fingerprint := fmt.Sprintf("stack_drift:%s:%s", hostIDStr, sanitizeFingerprintComponent(version.StackName))
+		if version.Action == stacks.ActionRemove {
+			if err := s.manager.ResolveTaskByFingerprint(ctx, fingerprint, StatusResolved); err != nil {
+				logrus.WithError(err).WithField("fingerprint", fingerprint).Debug("failed to resolve stack drift task")
+			}
+			continue
+		}
+
+		services, present := running[version.StackName]
+		drift, err := stacks.DetectDrift(version, services, present)
+		if err != nil {
+			logrus.WithError(err).WithField("stack_name", version.StackName).Debug("failed to detect stack drift")
+			continue
+		}
+		if !drift.HasDrift() {
+			if err := s.manager.ResolveTaskByFingerprint(ctx, fingerprint, StatusResolved); err != nil {
+				logrus.WithError(err).WithField("fingerprint", fingerprint).Debug("failed to resolve stack drift task")
+			}
+			continue
+		}
+
+		_, err = s.manager.UpsertSystemTask(ctx, SystemTaskInput{
+			Fingerprint: fingerprint,
+			Title:       fmt.Sprintf("Stack %s has drifted from its compose file", version.StackName),
+			Description: fmt.Sprintf("Running state differs from recorded version %d: %s", version.Version, drift.Summary()),
+			Severity:    SeverityWarning,
+			Status:      StatusOpen,
+			Category:    "stack",
+			TaskType:    "stack_drift",
+			Metadata: map[string]interface{}{
+				"host_id":          hostIDStr,
+				"stack_name":       version.StackName,
+				"version":          version.Version,
+				"stack_missing":    drift.StackMissing,
+				"missing_services": drift.MissingServices,
+				"extra_services":   drift.ExtraServices,
+				"image_drift":      drift.ImageDrift,
+			},
+			HostID: hostID,
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("fingerprint", fingerprint).Warn("failed to upsert stack drift task")
+		}
+	}
+}
+
+// runningServices converts the agent's per-service stack breakdown into reconciliation input.
+func runningServices(raw interface{}) []stacks.RunningService {
+	services := stackServices(raw)
+	out := make([]stacks.RunningService, 0, len(services))
+	for _, svc := range services {
+		name := getString(svc["name"])
+		if name == "" {
+			continue
+		}
+		out = append(out, stacks.RunningService{
+			Name:       name,
+			Containers: intFromAny(svc["containers"]),
+			Running:    intFromAny(svc["running"]),
+			Images:     stringsFromAny(svc["images"]),
+		})
+	}
+	return out
+}
+
 func (s *Scanner) resolveMissingStackTasks(ctx context.Context, hostID uuid.UUID, active map[string]struct{}) {
 	if s.db == nil {
 		return
@@ -435,6 +675,48 @@ func (s *Scanner) evaluateDiskUsage(ctx context.Context, host database.Host, inf
 	return err
 }
 
+// dockerHealthSeverity grades an agent's report of its Docker daemon; an empty severity means
+// the daemon is healthy or its health is unknown.
+func dockerHealthSeverity(health *protocol.DockerHealth) string {
+	switch {
+	case health == nil || health.Healthy:
+		return ""
+	case health.PingError != "":
+		return SeverityCritical
+	default:
+		return SeverityWarning
+	}
+}
+
+func (s *Scanner) evaluateDockerHealth(ctx context.Context, host database.Host, health *protocol.DockerHealth, hostID *uuid.UUID) error {
+	fingerprint := fmt.Sprintf("docker_unhealthy:%s", host.ID.String())
+	severity := dockerHealthSeverity(health)
+	if severity == "" {
+		return s.manager.ResolveTaskByFingerprint(ctx, fingerprint, StatusResolved)
+	}
+
+	description := fmt.Sprintf("The Docker daemon is struggling: %s.", strings.Join(health.Reasons, "; "))
+	_, err := s.manager.UpsertSystemTask(ctx, SystemTaskInput{
+		Fingerprint: fingerprint,
+		Title:       fmt.Sprintf("Docker on host %s is unhealthy", strings.TrimSpace(host.Name)),
+		Description: description,
+		Severity:    severity,
+		Status:      StatusOpen,
+		Category:    "host",
+		TaskType:    "docker_unhealthy",
+		Metadata: map[string]interface{}{
+			"host_id":            host.ID.String(),
+			"reasons":            health.Reasons,
+			"event_stream_alive": health.EventStreamAlive,
+			"ping_latency_ms":    health.PingLatencyMs,
+			"ping_error":         health.PingError,
+			"recent_errors":      health.RecentErrors,
+		},
+		HostID: hostID,
+	})
+	return err
+}
+
 func (s *Scanner) evaluateMemoryUsage(ctx context.Context, host database.Host, hostID *uuid.UUID) error {
 	if s.metrics == nil || !s.metrics.IsEnabled() {
 		return s.manager.ResolveTaskByFingerprint(ctx, fmt.Sprintf("host_low_memory:%s", host.ID.String()), StatusResolved)
@@ -567,6 +849,10 @@ func (s *Scanner) sendCommand(ctx context.Context, agentID string, command *prot
 	for {
 		select {
 		case <-ctx.Done():
+			// A spent scan budget is a timeout like any other
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, protocol.ErrCommandTimeout
+			}
 			return nil, ctx.Err()
 		case <-timer.C:
 			return nil, protocol.ErrCommandTimeout
@@ -686,6 +972,23 @@ func getString(v interface{}) string {
 	return ""
 }
 
+// stringsFromAny returns the non-empty strings of a decoded JSON array.
+func stringsFromAny(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		var out []string
+		for _, item := range list {
+			if str := getString(item); str != "" {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
 func bytesToGiB(bytes float64) float64 {
 	if bytes <= 0 {
 		return 0
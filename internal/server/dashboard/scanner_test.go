@@ -0,0 +1,100 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestExplainStackServices(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{"name": "api", "containers": float64(2), "running": float64(0), "down_containers": []interface{}{"web-api-1", "web-api-2"}},
+		map[string]interface{}{"name": "db", "containers": float64(1), "running": float64(1)},
+		map[string]interface{}{"name": "worker", "containers": float64(2), "running": float64(1)},
+	}
+
+	down, explanation := explainStackServices(raw)
+	if explanation != "service api (0/2 running), service worker (1/2 running)" {
+		t.Fatalf("unexpected explanation: %q", explanation)
+	}
+	if len(down) != 2 || down[0]["name"] != "api" || down[1]["name"] != "worker" {
+		t.Fatalf("unexpected services down: %#v", down)
+	}
+
+	if down, explanation := explainStackServices(nil); len(down) != 0 || explanation != "" {
+		t.Fatalf("expected no explanation without a service breakdown, got %q", explanation)
+	}
+}
+
+func TestExplainStackServicesOneshot(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{"name": "migrate", "containers": float64(1), "running": float64(0), "oneshot": true, "failed_containers": []interface{}{}},
+		map[string]interface{}{"name": "web", "containers": float64(1), "running": float64(1)},
+	}
+	if down, explanation := explainStackServices(raw); len(down) != 0 || explanation != "" {
+		t.Fatalf("expected a completed oneshot service to be ignored, got %q", explanation)
+	}
+
+	raw[0] = map[string]interface{}{"name": "migrate", "containers": float64(1), "running": float64(0), "oneshot": true, "failed_containers": []interface{}{"web-migrate-1"}}
+	down, explanation := explainStackServices(raw)
+	if explanation != "oneshot service migrate (1 failed)" {
+		t.Fatalf("unexpected explanation: %q", explanation)
+	}
+	if len(down) != 1 || down[0]["name"] != "migrate" {
+		t.Fatalf("unexpected services down: %#v", down)
+	}
+}
+
+func TestRunningServices(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{"name": "api", "containers": float64(2), "running": float64(1), "images": []interface{}{"example/api:1.1"}},
+		map[string]interface{}{"containers": float64(1)},
+	}
+
+	services := runningServices(raw)
+	if len(services) != 1 {
+		t.Fatalf("expected one service, got %#v", services)
+	}
+	if services[0].Name != "api" || services[0].Containers != 2 || services[0].Running != 1 {
+		t.Fatalf("unexpected service: %#v", services[0])
+	}
+	if len(services[0].Images) != 1 || services[0].Images[0] != "example/api:1.1" {
+		t.Fatalf("unexpected images: %#v", services[0].Images)
+	}
+}
+
+func TestDockerHealthSeverity(t *testing.T) {
+	cases := []struct {
+		health *protocol.DockerHealth
+		want   string
+	}{
+		{nil, ""},
+		{&protocol.DockerHealth{Healthy: true}, ""},
+		{&protocol.DockerHealth{PingError: "connection refused"}, SeverityCritical},
+		{&protocol.DockerHealth{Reasons: []string{"event stream is down"}}, SeverityWarning},
+	}
+	for _, tc := range cases {
+		if got := dockerHealthSeverity(tc.health); got != tc.want {
+			t.Fatalf("dockerHealthSeverity(%+v) = %q, want %q", tc.health, got, tc.want)
+		}
+	}
+}
+
+func TestAgentScanBudget(t *testing.T) {
+	cases := []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{interval: 30 * time.Second, want: 20 * time.Second},
+		{interval: 15 * time.Second, want: 10 * time.Second},
+		{interval: 5 * time.Minute, want: commandTimeout},
+		{interval: time.Second, want: minAgentScanBudget},
+	}
+	for _, tc := range cases {
+		scanner := NewScanner(nil, nil, nil, nil, nil, nil, &ScannerOptions{Interval: tc.interval})
+		if got := scanner.agentScanBudget(); got != tc.want {
+			t.Fatalf("agentScanBudget() with interval %s = %s, want %s", tc.interval, got, tc.want)
+		}
+	}
+}
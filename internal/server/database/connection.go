@@ -64,6 +64,7 @@ func Migrate() error {
 	err = DB.AutoMigrate(
 		&Host{},
 		&Stack{},
+		&StackVersion{},
 		&User{},
 		&APIKey{},
 		&RefreshToken{},
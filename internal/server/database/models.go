@@ -11,14 +11,15 @@ import (
 
 // Host represents a Docker host managed by an agent
 type Host struct {
-	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Name         string     `gorm:"not null" json:"name"`
-	Description  string     `json:"description"`
-	AgentVersion string     `json:"agent_version"`
-	LastSeen     *time.Time `json:"last_seen"`
-	Status       string     `gorm:"not null;default:'offline'" json:"status"` // online, offline, error
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Name          string     `gorm:"not null" json:"name"`
+	Description   string     `json:"description"`
+	AgentVersion  string     `json:"agent_version"`
+	LastSeen      *time.Time `json:"last_seen"`
+	Status        string     `gorm:"not null;default:'offline'" json:"status"` // online, offline, error
+	PingLatencyMs *float64   `json:"ping_latency_ms"`                          // Agent's average websocket ping round trip, from its last heartbeat
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 
 	// Relationships
 	Stacks  []Stack  `gorm:"foreignKey:HostID;constraint:OnDelete:CASCADE" json:"stacks,omitempty"`
@@ -43,6 +44,21 @@ type Stack struct {
 	Host Host `gorm:"foreignKey:HostID;constraint:OnDelete:CASCADE" json:"host,omitempty"`
 }
 
+// StackVersion records a deployed revision of a stack's compose file and environment
+type StackVersion struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	HostID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_stack_versions_host_stack" json:"host_id"`
+	StackName      string     `gorm:"not null;index:idx_stack_versions_host_stack" json:"stack_name"`
+	Version        int        `gorm:"not null" json:"version"`
+	Action         string     `gorm:"not null;default:'deploy'" json:"action"` // deploy, update, rollback, snapshot
+	ComposeContent string     `gorm:"type:text;not null" json:"compose_content"`
+	ComposeHash    string     `gorm:"size:64" json:"compose_hash"`
+	EnvVars        JSONB      `gorm:"type:jsonb" json:"-"` // Values are always encrypted via AES-GCM
+	RestoredFrom   *int       `json:"restored_from,omitempty"`
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
 // User represents a system user (for future RBAC)
 type User struct {
 	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
@@ -68,6 +84,7 @@ type APIKey struct {
 	LastUsed  *time.Time `json:"last_used,omitempty"`
 	IsActive  bool       `gorm:"not null;default:true" json:"is_active"`
 	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Scope     string     `gorm:"size:32;not null;default:'agent'" json:"scope"` // agent, deploy
 
 	// Relationships
 	Host *Host `gorm:"foreignKey:HostID;constraint:OnDelete:SET NULL" json:"host,omitempty"`
@@ -159,6 +176,11 @@ func (Stack) TableName() string {
 	return "stacks"
 }
 
+// TableName returns the table name for the StackVersion model
+func (StackVersion) TableName() string {
+	return "stack_versions"
+}
+
 // TableName returns the table name for the User model
 func (User) TableName() string {
 	return "users"
@@ -184,6 +206,13 @@ func (s *Stack) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (v *StackVersion) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
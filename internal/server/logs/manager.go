@@ -1,6 +1,7 @@
 package logs
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,27 @@ type Entry struct {
 	Fields    map[string]interface{} `json:"fields,omitempty"`
 }
 
+// Query selects a page of log entries. Zero values leave a filter unset.
+type Query struct {
+	// After is the ID of the last entry of the previous page (exclusive)
+	After string
+	// Since and Until bound entry timestamps, inclusive and exclusive respectively
+	Since  time.Time
+	Until  time.Time
+	Level  string
+	Source string
+	Limit  int
+}
+
+// Page is one page of log entries matching a Query.
+type Page struct {
+	Entries []Entry
+	// Total counts every retained entry matching the filters, on any page
+	Total int
+	// HasMore reports whether matching entries remain after this page
+	HasMore bool
+}
+
 // Manager keeps a bounded in-memory history of log entries and notifies subscribers.
 type Manager struct {
 	mu          sync.RWMutex
@@ -92,6 +114,60 @@ func (m *Manager) List(afterID string, limit int) []Entry {
 	return out
 }
 
+// Query returns the page of entries matching q, oldest first.
+func (m *Manager) Query(q Query) Page {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit := q.Limit
+	if limit <= 0 || limit > m.maxEntries {
+		limit = m.maxEntries
+	}
+
+	startIdx := 0
+	if q.After != "" {
+		for i := len(m.entries) - 1; i >= 0; i-- {
+			if m.entries[i].ID == q.After {
+				startIdx = i + 1
+				break
+			}
+		}
+	}
+
+	page := Page{Entries: []Entry{}}
+	for i, entry := range m.entries {
+		if !q.matches(entry) {
+			continue
+		}
+		page.Total++
+		if i < startIdx {
+			continue
+		}
+		if len(page.Entries) < limit {
+			page.Entries = append(page.Entries, entry)
+		} else {
+			page.HasMore = true
+		}
+	}
+	return page
+}
+
+func (q Query) matches(entry Entry) bool {
+	if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !entry.Timestamp.Before(q.Until) {
+		return false
+	}
+	if q.Level != "" && !strings.EqualFold(entry.Level, q.Level) {
+		return false
+	}
+	if q.Source != "" && !strings.EqualFold(entry.Source, q.Source) {
+		return false
+	}
+	return true
+}
+
 // Subscribe returns a channel that receives live log entries and an unsubscribe function.
 func (m *Manager) Subscribe() (chan Entry, func()) {
 	ch := make(chan Entry, 100)
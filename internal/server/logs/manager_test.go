@@ -42,3 +42,45 @@ func TestSubscribeReceivesEntries(t *testing.T) {
 		t.Fatal("timed out waiting for log entry")
 	}
 }
+
+func TestManagerQueryPagesAndFilters(t *testing.T) {
+	mgr := NewManager(10)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		level := "info"
+		if i%2 == 1 {
+			level = "error"
+		}
+		mgr.Add(Entry{Message: "entry", Level: level, Source: "host", Timestamp: base.Add(time.Duration(i) * time.Minute)})
+	}
+
+	first := mgr.Query(Query{Limit: 4})
+	if len(first.Entries) != 4 || first.Total != 6 || !first.HasMore {
+		t.Fatalf("unexpected first page: %d entries, total %d, more %v", len(first.Entries), first.Total, first.HasMore)
+	}
+	second := mgr.Query(Query{After: first.Entries[3].ID, Limit: 4})
+	if len(second.Entries) != 2 || second.Total != 6 || second.HasMore {
+		t.Fatalf("unexpected second page: %d entries, total %d, more %v", len(second.Entries), second.Total, second.HasMore)
+	}
+
+	errors := mgr.Query(Query{Level: "ERROR", Since: base.Add(time.Minute), Until: base.Add(5 * time.Minute)})
+	if errors.Total != 2 || len(errors.Entries) != 2 {
+		t.Fatalf("expected 2 errors in range, got total %d (%d entries)", errors.Total, len(errors.Entries))
+	}
+	for _, entry := range errors.Entries {
+		if entry.Level != "error" || entry.Timestamp.Before(base.Add(time.Minute)) || !entry.Timestamp.Before(base.Add(5*time.Minute)) {
+			t.Fatalf("entry outside filters: %#v", entry)
+		}
+	}
+}
+
+func TestManagerEvictsAtConfiguredSize(t *testing.T) {
+	mgr := NewManager(3)
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		mgr.Add(Entry{Message: msg})
+	}
+	entries := mgr.List("", 0)
+	if len(entries) != 3 || entries[0].Message != "two" || entries[2].Message != "four" {
+		t.Fatalf("expected the oldest entry to be evicted, got %#v", entries)
+	}
+}
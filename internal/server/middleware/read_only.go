@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnlyMessage explains why a mutating request was refused
+const ReadOnlyMessage = "Server is in read-only mode; changes to hosts, containers, stacks, tasks, API keys and users are disabled"
+
+// ReadOnlyMiddleware refuses the request with a 403 when the server runs in read-only
+// mode. It is attached to the routes that change Docker state on hosts and to those that
+// change dashboard tasks, API keys and users.
+func ReadOnlyMiddleware(readOnly bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readOnly {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":     ReadOnlyMessage,
+				"read_only": true,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, readOnly := range []bool{false, true} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+		ReadOnlyMiddleware(readOnly)(c)
+
+		if c.IsAborted() != readOnly {
+			t.Fatalf("read-only %v: expected aborted=%v", readOnly, readOnly)
+		}
+		if readOnly && recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 in read-only mode, got %d", recorder.Code)
+		}
+	}
+}
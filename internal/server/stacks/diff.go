@@ -0,0 +1,191 @@
+package stacks
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"gopkg.in/yaml.v3"
+)
+
+// VersionDiff describes what changed between two stack versions.
+type VersionDiff struct {
+	From     VersionContent `json:"from"`
+	To       VersionContent `json:"to"`
+	Services ServicesDiff   `json:"services"`
+	Env      KeysDiff       `json:"env"`
+}
+
+// VersionContent carries one side of a diff so it can be rendered side-by-side.
+type VersionContent struct {
+	Version        int    `json:"version"`
+	Action         string `json:"action"`
+	ComposeHash    string `json:"compose_hash"`
+	ComposeContent string `json:"compose_content"`
+}
+
+// ServicesDiff lists services added, removed or changed between two compose files.
+type ServicesDiff struct {
+	Added   []string        `json:"added"`
+	Removed []string        `json:"removed"`
+	Changed []ServiceChange `json:"changed"`
+}
+
+// ServiceChange lists the top-level settings that differ for a single service.
+type ServiceChange struct {
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// FieldChange holds the old and new value of a service setting. A nil value means the
+// setting is absent on that side.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// KeysDiff lists env var keys added, removed or changed. Values are never included.
+type KeysDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// DiffVersions computes a structured diff from one stack version to another.
+func DiffVersions(from, to *database.StackVersion) (*VersionDiff, error) {
+	fromServices, err := parseServices(from.ComposeContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse compose for version %d: %w", from.Version, err)
+	}
+	toServices, err := parseServices(to.ComposeContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse compose for version %d: %w", to.Version, err)
+	}
+
+	fromEnv, err := DecryptEnvVars(from.EnvVars)
+	if err != nil {
+		return nil, err
+	}
+	toEnv, err := DecryptEnvVars(to.EnvVars)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VersionDiff{
+		From:     versionContent(from),
+		To:       versionContent(to),
+		Services: diffServices(fromServices, toServices),
+		Env:      diffKeys(fromEnv, toEnv),
+	}, nil
+}
+
+func versionContent(v *database.StackVersion) VersionContent {
+	return VersionContent{
+		Version:        v.Version,
+		Action:         v.Action,
+		ComposeHash:    v.ComposeHash,
+		ComposeContent: v.ComposeContent,
+	}
+}
+
+// parseServices extracts the services section of a compose file keyed by service name.
+func parseServices(compose string) (map[string]map[string]any, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal([]byte(compose), &doc); err != nil {
+		return nil, err
+	}
+
+	services := map[string]map[string]any{}
+	raw, ok := doc["services"].(map[string]any)
+	if !ok {
+		return services, nil
+	}
+	for name, svc := range raw {
+		if cfg, ok := svc.(map[string]any); ok {
+			services[name] = cfg
+		} else {
+			services[name] = map[string]any{}
+		}
+	}
+	return services, nil
+}
+
+func diffServices(from, to map[string]map[string]any) ServicesDiff {
+	diff := ServicesDiff{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []ServiceChange{},
+	}
+
+	for _, name := range sortedKeys(to) {
+		if _, ok := from[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+	for _, name := range sortedKeys(from) {
+		toCfg, ok := to[name]
+		if !ok {
+			diff.Removed = append(diff.Removed, name)
+			continue
+		}
+		if fields := diffFields(from[name], toCfg); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ServiceChange{Name: name, Fields: fields})
+		}
+	}
+	return diff
+}
+
+func diffFields(from, to map[string]any) []FieldChange {
+	keys := map[string]struct{}{}
+	for k := range from {
+		keys[k] = struct{}{}
+	}
+	for k := range to {
+		keys[k] = struct{}{}
+	}
+
+	var changes []FieldChange
+	for _, k := range sortedKeys(keys) {
+		fromVal, toVal := from[k], to[k]
+		if reflect.DeepEqual(fromVal, toVal) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: k, From: fromVal, To: toVal})
+	}
+	return changes
+}
+
+func diffKeys(from, to map[string]any) KeysDiff {
+	diff := KeysDiff{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []string{},
+	}
+	for _, k := range sortedKeys(to) {
+		if _, ok := from[k]; !ok {
+			diff.Added = append(diff.Added, k)
+		}
+	}
+	for _, k := range sortedKeys(from) {
+		toVal, ok := to[k]
+		if !ok {
+			diff.Removed = append(diff.Removed, k)
+			continue
+		}
+		if !reflect.DeepEqual(from[k], toVal) {
+			diff.Changed = append(diff.Changed, k)
+		}
+	}
+	return diff
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package stacks
+
+import (
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+)
+
+func TestDiffVersions(t *testing.T) {
+	fromEnv, err := encryptEnvVars(map[string]any{"KEEP": "1", "DROP": "x", "TOKEN": "old"})
+	if err != nil {
+		t.Fatalf("encryptEnvVars returned error: %v", err)
+	}
+	toEnv, err := encryptEnvVars(map[string]any{"KEEP": "1", "NEW": "y", "TOKEN": "new"})
+	if err != nil {
+		t.Fatalf("encryptEnvVars returned error: %v", err)
+	}
+
+	from := &database.StackVersion{
+		Version: 1,
+		ComposeContent: `
+services:
+  web:
+    image: nginx:1.25
+    ports:
+      - "80:80"
+  worker:
+    image: alpine
+`,
+		EnvVars: fromEnv,
+	}
+	to := &database.StackVersion{
+		Version: 2,
+		ComposeContent: `
+services:
+  web:
+    image: nginx:1.27
+    ports:
+      - "80:80"
+  cache:
+    image: redis
+`,
+		EnvVars: toEnv,
+	}
+
+	diff, err := DiffVersions(from, to)
+	if err != nil {
+		t.Fatalf("DiffVersions returned error: %v", err)
+	}
+
+	if len(diff.Services.Added) != 1 || diff.Services.Added[0] != "cache" {
+		t.Fatalf("unexpected added services: %#v", diff.Services.Added)
+	}
+	if len(diff.Services.Removed) != 1 || diff.Services.Removed[0] != "worker" {
+		t.Fatalf("unexpected removed services: %#v", diff.Services.Removed)
+	}
+	if len(diff.Services.Changed) != 1 || diff.Services.Changed[0].Name != "web" {
+		t.Fatalf("unexpected changed services: %#v", diff.Services.Changed)
+	}
+	fields := diff.Services.Changed[0].Fields
+	if len(fields) != 1 || fields[0].Field != "image" || fields[0].From != "nginx:1.25" || fields[0].To != "nginx:1.27" {
+		t.Fatalf("unexpected field changes: %#v", fields)
+	}
+
+	if len(diff.Env.Added) != 1 || diff.Env.Added[0] != "NEW" {
+		t.Fatalf("unexpected added env: %#v", diff.Env.Added)
+	}
+	if len(diff.Env.Removed) != 1 || diff.Env.Removed[0] != "DROP" {
+		t.Fatalf("unexpected removed env: %#v", diff.Env.Removed)
+	}
+	if len(diff.Env.Changed) != 1 || diff.Env.Changed[0] != "TOKEN" {
+		t.Fatalf("unexpected changed env: %#v", diff.Env.Changed)
+	}
+	if diff.From.Version != 1 || diff.To.Version != 2 {
+		t.Fatalf("unexpected versions: from=%d to=%d", diff.From.Version, diff.To.Version)
+	}
+}
+
+func TestDiffVersionsInvalidCompose(t *testing.T) {
+	from := &database.StackVersion{Version: 1, ComposeContent: "services: ["}
+	to := &database.StackVersion{Version: 2, ComposeContent: "services: {}"}
+	if _, err := DiffVersions(from, to); err == nil {
+		t.Fatal("expected error for invalid compose content")
+	}
+}
@@ -0,0 +1,280 @@
+package stacks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	sharedconfig "github.com/mikeysoft/flotilla/internal/shared/config"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHistoryLimit = 10
+
+	ActionDeploy   = "deploy"
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+	// ActionSnapshot marks a version captured from the host because no history existed yet.
+	ActionSnapshot = "snapshot"
+	// ActionRemove marks a stack that was removed through Flotilla; it carries no compose content.
+	ActionRemove = "remove"
+
+	stackScopeQuery = "host_id = ? AND stack_name = ?"
+)
+
+// ErrHistoryUnavailable is returned when the history store has no database configured.
+var ErrHistoryUnavailable = errors.New("stack history not available")
+
+// ErrVersionNotRestorable is returned for a version that has no compose content to redeploy,
+// such as one recording the stack's removal.
+var ErrVersionNotRestorable = errors.New("stack version cannot be restored")
+
+// History persists every deployed version of a stack so changes can be audited and rolled back.
+type History struct {
+	db    *gorm.DB
+	limit int
+}
+
+// VersionInput captures the fields needed to record a stack version.
+type VersionInput struct {
+	HostID       uuid.UUID
+	StackName    string
+	Action       string
+	Compose      string
+	EnvVars      map[string]any
+	RestoredFrom *int
+	CreatedBy    *uuid.UUID
+}
+
+// NewHistory constructs a history store that keeps at most limit versions per stack.
+func NewHistory(db *gorm.DB, limit int) *History {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	return &History{
+		db:    db,
+		limit: limit,
+	}
+}
+
+// Record stores a new version of a stack and prunes versions beyond the configured limit.
+// Env values are encrypted before being stored.
+func (h *History) Record(ctx context.Context, input VersionInput) (*database.StackVersion, error) {
+	if h == nil || h.db == nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	encrypted, err := encryptEnvVars(input.EnvVars)
+	if err != nil {
+		return nil, err
+	}
+
+	action := input.Action
+	if action == "" {
+		action = ActionDeploy
+	}
+
+	version := database.StackVersion{
+		HostID:         input.HostID,
+		StackName:      input.StackName,
+		Action:         action,
+		ComposeContent: input.Compose,
+		ComposeHash:    ComposeHash(input.Compose),
+		EnvVars:        encrypted,
+		RestoredFrom:   input.RestoredFrom,
+		CreatedBy:      input.CreatedBy,
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&database.StackVersion{}).
+			Where(stackScopeQuery, input.HostID, input.StackName).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&latest).Error; err != nil {
+			return fmt.Errorf("failed to determine latest stack version: %w", err)
+		}
+		version.Version = latest + 1
+
+		if err := tx.Create(&version).Error; err != nil {
+			return fmt.Errorf("failed to store stack version: %w", err)
+		}
+
+		if err := tx.Where(stackScopeQuery+" AND version <= ?", input.HostID, input.StackName, version.Version-h.limit).
+			Delete(&database.StackVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to prune stack versions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// DeleteHostTx removes every stored version of the stacks on a host within tx. The SQL
+// migrations cascade host deletes to stack versions, but databases created by AutoMigrate
+// alone have no such constraint since the StackVersion model declares none, so host
+// deletion removes them explicitly.
+func (h *History) DeleteHostTx(tx *gorm.DB, hostID uuid.UUID) error {
+	if err := tx.Where("host_id = ?", hostID).Delete(&database.StackVersion{}).Error; err != nil {
+		return fmt.Errorf("failed to delete stack versions: %w", err)
+	}
+	return nil
+}
+
+// List returns the stored versions of a stack, newest first.
+func (h *History) List(ctx context.Context, hostID uuid.UUID, stackName string) ([]database.StackVersion, error) {
+	if h == nil || h.db == nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	var versions []database.StackVersion
+	if err := h.db.WithContext(ctx).
+		Where(stackScopeQuery, hostID, stackName).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Get returns a specific version of a stack. It returns gorm.ErrRecordNotFound when the
+// version does not exist.
+func (h *History) Get(ctx context.Context, hostID uuid.UUID, stackName string, version int) (*database.StackVersion, error) {
+	if h == nil || h.db == nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	var record database.StackVersion
+	if err := h.db.WithContext(ctx).
+		Where(stackScopeQuery+" AND version = ?", hostID, stackName, version).
+		First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// HasVersions reports whether any version of a stack has been recorded.
+func (h *History) HasVersions(ctx context.Context, hostID uuid.UUID, stackName string) (bool, error) {
+	if h == nil || h.db == nil {
+		return false, ErrHistoryUnavailable
+	}
+
+	var count int64
+	if err := h.db.WithContext(ctx).
+		Model(&database.StackVersion{}).
+		Where(stackScopeQuery, hostID, stackName).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Latest returns the newest recorded version of every stack on a host.
+func (h *History) Latest(ctx context.Context, hostID uuid.UUID) ([]database.StackVersion, error) {
+	if h == nil || h.db == nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	latest := h.db.Model(&database.StackVersion{}).
+		Select("stack_name, MAX(version)").
+		Where("host_id = ?", hostID).
+		Group("stack_name")
+
+	var versions []database.StackVersion
+	if err := h.db.WithContext(ctx).
+		Where("host_id = ? AND (stack_name, version) IN (?)", hostID, latest).
+		Order("stack_name").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// RollbackTarget returns the version preceding the one currently deployed. When the latest
+// version is itself a rollback, the search continues from the version it restored so that
+// repeated rollbacks walk further back instead of toggling. Removals carry no compose content
+// and are never a target. It returns gorm.ErrRecordNotFound when there is nothing to roll
+// back to.
+func (h *History) RollbackTarget(ctx context.Context, hostID uuid.UUID, stackName string) (*database.StackVersion, error) {
+	if h == nil || h.db == nil {
+		return nil, ErrHistoryUnavailable
+	}
+
+	var latest database.StackVersion
+	if err := h.db.WithContext(ctx).
+		Where(stackScopeQuery, hostID, stackName).
+		Order("version DESC").
+		First(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	current := latest.Version
+	if latest.RestoredFrom != nil {
+		current = *latest.RestoredFrom
+	}
+
+	var target database.StackVersion
+	if err := h.db.WithContext(ctx).
+		Where(stackScopeQuery+" AND version < ? AND action <> ?", hostID, stackName, current, ActionRemove).
+		Order("version DESC").
+		First(&target).Error; err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// CheckRestorable returns ErrVersionNotRestorable when a version cannot be rolled back to:
+// removals and versions without compose content would redeploy an empty compose file.
+func CheckRestorable(version *database.StackVersion) error {
+	if version.Action == ActionRemove {
+		return fmt.Errorf("%w: version %d records the stack's removal", ErrVersionNotRestorable, version.Version)
+	}
+	if strings.TrimSpace(version.ComposeContent) == "" {
+		return fmt.Errorf("%w: version %d has no compose content", ErrVersionNotRestorable, version.Version)
+	}
+	return nil
+}
+
+// ComposeHash returns the hex-encoded SHA-256 of compose content.
+func ComposeHash(compose string) string {
+	sum := sha256.Sum256([]byte(compose))
+	return hex.EncodeToString(sum[:])
+}
+
+// DecryptEnvVars returns the plaintext env vars stored with a version.
+func DecryptEnvVars(envVars database.JSONB) (map[string]any, error) {
+	out := make(map[string]any, len(envVars))
+	for k, v := range envVars {
+		s, ok := v.(string)
+		if !ok {
+			out[k] = v
+			continue
+		}
+		pt, err := sharedconfig.DecryptValue(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt env var %s: %w", k, err)
+		}
+		out[k] = pt
+	}
+	return out, nil
+}
+
+func encryptEnvVars(envVars map[string]any) (database.JSONB, error) {
+	out := make(database.JSONB, len(envVars))
+	for k, v := range envVars {
+		ct, err := sharedconfig.EncryptValue(fmt.Sprintf("%v", v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt env var %s: %w", k, err)
+		}
+		out[k] = ct
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package stacks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mikeysoft/flotilla/internal/server/database"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestNewHistoryDefaults(t *testing.T) {
+	history := NewHistory(nil, 0)
+	if history.limit != defaultHistoryLimit {
+		t.Fatalf("expected default limit %d, got %d", defaultHistoryLimit, history.limit)
+	}
+	if NewHistory(nil, 3).limit != 3 {
+		t.Fatal("expected explicit limit to be kept")
+	}
+}
+
+func TestHistoryRequiresDB(t *testing.T) {
+	history := NewHistory(nil, 5)
+	if _, err := history.Record(context.Background(), VersionInput{HostID: uuid.New(), StackName: "app"}); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable from Record, got %v", err)
+	}
+	if _, err := history.List(context.Background(), uuid.New(), "app"); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable from List, got %v", err)
+	}
+	if _, err := history.RollbackTarget(context.Background(), uuid.New(), "app"); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable from RollbackTarget, got %v", err)
+	}
+	if _, err := history.Latest(context.Background(), uuid.New()); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("expected ErrHistoryUnavailable from Latest, got %v", err)
+	}
+}
+
+func TestRollbackTargetSkipsRemovals(t *testing.T) {
+	// Dry run builds the SQL without a database
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=flotilla"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open dry run database: %v", err)
+	}
+	type query struct {
+		sql  string
+		vars []any
+	}
+	var queries []query
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		queries = append(queries, query{sql: tx.Statement.SQL.String(), vars: tx.Statement.Vars})
+	}); err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	if _, err := NewHistory(db, 5).RollbackTarget(context.Background(), uuid.New(), "app"); err != nil {
+		t.Fatalf("RollbackTarget returned error: %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("expected the latest version and the target to be queried, got %d queries", len(queries))
+	}
+	target := queries[1]
+	if !strings.Contains(target.sql, "action <> ") || !slices.Contains(target.vars, any(ActionRemove)) {
+		t.Fatalf("expected removals to be excluded from the target, got %s %v", target.sql, target.vars)
+	}
+}
+
+func TestEnvVarsRoundTrip(t *testing.T) {
+	encrypted, err := encryptEnvVars(map[string]any{"TOKEN": "secret", "PORT": 8080})
+	if err != nil {
+		t.Fatalf("encryptEnvVars returned error: %v", err)
+	}
+	if encrypted["TOKEN"] == "secret" {
+		t.Fatal("expected env value to be encrypted")
+	}
+
+	decrypted, err := DecryptEnvVars(encrypted)
+	if err != nil {
+		t.Fatalf("DecryptEnvVars returned error: %v", err)
+	}
+	if decrypted["TOKEN"] != "secret" || decrypted["PORT"] != "8080" {
+		t.Fatalf("unexpected decrypted env vars: %#v", decrypted)
+	}
+}
+
+func TestComposeHashIsStable(t *testing.T) {
+	a := ComposeHash("services:\n  app:\n    image: nginx\n")
+	b := ComposeHash("services:\n  app:\n    image: nginx\n")
+	if a != b {
+		t.Fatal("expected identical content to hash identically")
+	}
+	if len(a) != 64 {
+		t.Fatalf("expected 64 hex characters, got %d", len(a))
+	}
+	if a == ComposeHash("services: {}") {
+		t.Fatal("expected different content to hash differently")
+	}
+}
+
+func TestCheckRestorableRejectsRemovals(t *testing.T) {
+	cases := []struct {
+		version database.StackVersion
+		ok      bool
+	}{
+		{database.StackVersion{Version: 1, Action: ActionDeploy, ComposeContent: "services: {}"}, true},
+		{database.StackVersion{Version: 2, Action: ActionRollback, ComposeContent: "services: {}"}, true},
+		{database.StackVersion{Version: 3, Action: ActionRemove}, false},
+		{database.StackVersion{Version: 4, Action: ActionUpdate, ComposeContent: "  \n"}, false},
+	}
+	for _, tc := range cases {
+		err := CheckRestorable(&tc.version)
+		if tc.ok && err != nil {
+			t.Fatalf("expected version %d to be restorable, got %v", tc.version.Version, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrVersionNotRestorable) {
+			t.Fatalf("expected version %d to be rejected, got %v", tc.version.Version, err)
+		}
+	}
+}
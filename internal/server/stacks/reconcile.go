@@ -0,0 +1,133 @@
+package stacks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+)
+
+// RunningService is the observed state of one compose service as reported by the agent.
+type RunningService struct {
+	Name       string
+	Containers int
+	Running    int
+	Images     []string
+}
+
+// ImageDrift records a service whose running containers use a different image than the
+// recorded compose file declares.
+type ImageDrift struct {
+	Service  string   `json:"service"`
+	Expected string   `json:"expected"`
+	Running  []string `json:"running"`
+}
+
+// Drift describes how a host's running stack differs from its latest recorded version.
+type Drift struct {
+	StackMissing    bool         `json:"stack_missing"`
+	MissingServices []string     `json:"missing_services"`
+	ExtraServices   []string     `json:"extra_services"`
+	ImageDrift      []ImageDrift `json:"image_drift"`
+}
+
+// HasDrift reports whether any difference was found.
+func (d Drift) HasDrift() bool {
+	return d.StackMissing || len(d.MissingServices) > 0 || len(d.ExtraServices) > 0 || len(d.ImageDrift) > 0
+}
+
+// Summary renders the drift as a short human-readable sentence.
+func (d Drift) Summary() string {
+	if d.StackMissing {
+		return "stack is no longer present on the host"
+	}
+	var parts []string
+	if len(d.MissingServices) > 0 {
+		parts = append(parts, "services missing: "+strings.Join(d.MissingServices, ", "))
+	}
+	if len(d.ExtraServices) > 0 {
+		parts = append(parts, "services not in compose file: "+strings.Join(d.ExtraServices, ", "))
+	}
+	for _, drift := range d.ImageDrift {
+		parts = append(parts, fmt.Sprintf("service %s runs %s instead of %s", drift.Service, strings.Join(drift.Running, ", "), drift.Expected))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// DetectDrift compares the latest recorded version of a stack with the services the agent
+// reports as running. present is false when the agent no longer lists the stack at all.
+// Services behind compose profiles are not required to be running, and services built
+// from source are not checked for image drift.
+func DetectDrift(version *database.StackVersion, running []RunningService, present bool) (Drift, error) {
+	drift := Drift{
+		MissingServices: []string{},
+		ExtraServices:   []string{},
+		ImageDrift:      []ImageDrift{},
+	}
+	if !present {
+		drift.StackMissing = true
+		return drift, nil
+	}
+
+	declared, err := parseServices(version.ComposeContent)
+	if err != nil {
+		return drift, fmt.Errorf("failed to parse compose for version %d: %w", version.Version, err)
+	}
+
+	observed := make(map[string]RunningService, len(running))
+	for _, svc := range running {
+		observed[svc.Name] = svc
+	}
+
+	for _, name := range sortedKeys(declared) {
+		cfg := declared[name]
+		svc, ok := observed[name]
+		if !ok || svc.Containers == 0 {
+			if _, optional := cfg["profiles"]; !optional {
+				drift.MissingServices = append(drift.MissingServices, name)
+			}
+			continue
+		}
+
+		expected, _ := cfg["image"].(string)
+		if expected == "" {
+			continue
+		}
+		var mismatched []string
+		for _, image := range svc.Images {
+			// Containers whose tag has since moved to a newer image report the bare image ID,
+			// which cannot be compared with the compose reference
+			if strings.HasPrefix(image, "sha256:") {
+				continue
+			}
+			if normalizeImageRef(image) != normalizeImageRef(expected) {
+				mismatched = append(mismatched, image)
+			}
+		}
+		if len(mismatched) > 0 {
+			drift.ImageDrift = append(drift.ImageDrift, ImageDrift{Service: name, Expected: expected, Running: mismatched})
+		}
+	}
+
+	for _, name := range sortedKeys(observed) {
+		if _, ok := declared[name]; !ok {
+			drift.ExtraServices = append(drift.ExtraServices, name)
+		}
+	}
+	sort.Strings(drift.ExtraServices)
+
+	return drift, nil
+}
+
+// normalizeImageRef adds the implicit latest tag so "nginx" and "nginx:latest" compare equal.
+func normalizeImageRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if strings.Contains(ref, "@") {
+		return ref
+	}
+	if strings.LastIndex(ref, ":") <= strings.LastIndex(ref, "/") {
+		return ref + ":latest"
+	}
+	return ref
+}
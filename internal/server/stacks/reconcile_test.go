@@ -0,0 +1,77 @@
+package stacks
+
+import (
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/server/database"
+)
+
+const reconcileCompose = `services:
+  web:
+    image: nginx
+  api:
+    image: example/api:1.2
+  worker:
+    build: ./worker
+  debug:
+    image: busybox
+    profiles: ["debug"]
+`
+
+func TestDetectDrift(t *testing.T) {
+	version := &database.StackVersion{Version: 3, ComposeContent: reconcileCompose}
+	running := []RunningService{
+		{Name: "web", Containers: 1, Running: 1, Images: []string{"nginx:latest"}},
+		{Name: "api", Containers: 2, Running: 2, Images: []string{"example/api:1.1"}},
+		{Name: "worker", Containers: 1, Running: 1, Images: []string{"app-worker"}},
+		{Name: "adminer", Containers: 1, Running: 1, Images: []string{"adminer"}},
+	}
+
+	drift, err := DetectDrift(version, running, true)
+	if err != nil {
+		t.Fatalf("DetectDrift returned error: %v", err)
+	}
+	if !drift.HasDrift() {
+		t.Fatal("expected drift to be detected")
+	}
+	if len(drift.MissingServices) != 0 {
+		t.Fatalf("expected profiled services not to be reported missing, got %v", drift.MissingServices)
+	}
+	if len(drift.ExtraServices) != 1 || drift.ExtraServices[0] != "adminer" {
+		t.Fatalf("unexpected extra services: %v", drift.ExtraServices)
+	}
+	if len(drift.ImageDrift) != 1 || drift.ImageDrift[0].Service != "api" || drift.ImageDrift[0].Running[0] != "example/api:1.1" {
+		t.Fatalf("unexpected image drift: %#v", drift.ImageDrift)
+	}
+}
+
+func TestDetectDriftMissingServicesAndStack(t *testing.T) {
+	version := &database.StackVersion{Version: 1, ComposeContent: reconcileCompose}
+
+	drift, err := DetectDrift(version, []RunningService{{Name: "web", Containers: 1, Images: []string{"nginx"}}}, true)
+	if err != nil {
+		t.Fatalf("DetectDrift returned error: %v", err)
+	}
+	if len(drift.MissingServices) != 2 || drift.MissingServices[0] != "api" || drift.MissingServices[1] != "worker" {
+		t.Fatalf("unexpected missing services: %v", drift.MissingServices)
+	}
+
+	drift, err = DetectDrift(version, nil, false)
+	if err != nil {
+		t.Fatalf("DetectDrift returned error: %v", err)
+	}
+	if !drift.StackMissing || drift.Summary() != "stack is no longer present on the host" {
+		t.Fatalf("expected missing stack drift, got %#v", drift)
+	}
+}
+
+func TestDetectDriftInSync(t *testing.T) {
+	version := &database.StackVersion{ComposeContent: "services:\n  web:\n    image: nginx:1.25\n"}
+	drift, err := DetectDrift(version, []RunningService{{Name: "web", Containers: 1, Running: 1, Images: []string{"nginx:1.25"}}}, true)
+	if err != nil {
+		t.Fatalf("DetectDrift returned error: %v", err)
+	}
+	if drift.HasDrift() {
+		t.Fatalf("expected no drift, got %#v", drift)
+	}
+}
@@ -238,15 +238,21 @@ func (m *Manager) IsStale(refreshedAt time.Time) bool {
 
 // PurgeHost removes cached topology for the specified host.
 func (m *Manager) PurgeHost(hostID string) error {
+	return m.PurgeHostTx(m.db, hostID)
+}
+
+// PurgeHostTx removes cached topology for the specified host within tx, so the purge can be
+// part of a larger transaction such as a host deletion.
+func (m *Manager) PurgeHostTx(tx *gorm.DB, hostID string) error {
 	hostUUID, err := uuid.Parse(hostID)
 	if err != nil {
 		return err
 	}
 
-	if err := m.db.Where("host_id = ?", hostUUID).Delete(&database.NetworkTopology{}).Error; err != nil {
+	if err := tx.Where("host_id = ?", hostUUID).Delete(&database.NetworkTopology{}).Error; err != nil {
 		return err
 	}
-	if err := m.db.Where("host_id = ?", hostUUID).Delete(&database.VolumeTopology{}).Error; err != nil {
+	if err := tx.Where("host_id = ?", hostUUID).Delete(&database.VolumeTopology{}).Error; err != nil {
 		return err
 	}
 	return nil
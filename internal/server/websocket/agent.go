@@ -3,6 +3,7 @@ package websocket
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -106,6 +107,14 @@ func (c *AgentConnection) writePump() {
 
 	for {
 		select {
+		case <-c.done:
+			if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err == nil {
+				if err := c.Conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+					logrus.WithError(err).Debugf("Failed to send close message to agent %s", c.ID)
+				}
+			}
+			return
+
 		case message, ok := <-c.Send:
 			if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				logrus.WithError(err).Warnf("Failed to set write deadline for agent %s", c.ID)
@@ -188,12 +197,21 @@ func (c *AgentConnection) handleResponse(msg *protocol.Message) {
 		}).Info("agent response")
 	}
 
+	// Responses to commands for an endpoint are attributed to the endpoint's connection, which
+	// is the one callers sent the command through
 	cmdResp := &CommandResponse{
 		CommandID: msg.ID,
-		AgentID:   c.ID,
+		AgentID:   c.endpointConnection(msg.Payload).ID,
 		Response:  msg,
 		Error:     nil,
 	}
+	// A busy agent did not run the command; surface that as an error so callers can back off
+	if response.Code == protocol.ErrorCodeAgentBusy {
+		cmdResp.Error = fmt.Errorf("%w: %s", protocol.ErrAgentBusy, response.Error)
+	}
+	if response.Code == protocol.ErrorCodeCommandPanic {
+		cmdResp.Error = fmt.Errorf("%w: %s", protocol.ErrCommandPanic, response.Error)
+	}
 
 	if waiter, ok := c.Hub.getResponseWaiter(msg.ID); ok {
 		select {
@@ -247,8 +265,17 @@ func (c *AgentConnection) handleEvent(msg *protocol.Message) {
 		return
 	}
 
+	// Progress of a running command goes to whoever waits on the command, and to the UI
+	if event.EventType == protocol.EventTypeCommandProgress {
+		if progress, err := msg.GetProgress(); err == nil {
+			c.Hub.deliverProgress(*progress)
+		} else {
+			logrus.Debugf("Invalid progress event from agent %s: %v", c.ID, err)
+		}
+	}
+
 	// Broadcast other events to UI clients
-	c.broadcastEventToUI(msg)
+	c.broadcastEventToUI(msg, c.eventHostID(event.Data))
 }
 
 // handleLogDataEvent handles log data events from agents and forwards them to UI clients
@@ -265,7 +292,7 @@ func (c *AgentConnection) handleLogDataEvent(event *protocol.Event) {
 	}
 
 	// Forward log event to UI clients
-	c.Hub.ForwardLogEvent(c.HostID, containerID, data, stream, timestamp)
+	c.Hub.ForwardLogEvent(c.eventHostID(event.Data), containerID, data, stream, timestamp)
 }
 
 // handleHeartbeat handles a heartbeat message from the agent
@@ -277,6 +304,14 @@ func (c *AgentConnection) handleHeartbeat(msg *protocol.Message) {
 	}
 
 	c.LastSeen = time.Now()
+	c.mu.Lock()
+	wasHealthy := c.dockerHealth == nil || c.dockerHealth.Healthy
+	c.dockerHealth = heartbeat.DockerHealth
+	c.hostname = heartbeat.Hostname
+	c.mu.Unlock()
+	if health := heartbeat.DockerHealth; health != nil && !health.Healthy && wasHealthy {
+		logrus.Warnf("Agent %s reports an unhealthy Docker daemon: %s", c.ID, strings.Join(health.Reasons, "; "))
+	}
 
 	logrus.Debugf("Received heartbeat from agent %s: status=%s, uptime=%ds, containers=%d",
 		c.ID, heartbeat.Status, heartbeat.Uptime, heartbeat.ContainersRunning)
@@ -288,7 +323,12 @@ func (c *AgentConnection) handleHeartbeat(msg *protocol.Message) {
 	}
 
 	// Create or update host with metadata from heartbeat
-	c.Hub.createOrUpdateHostWithMetadata(c.HostID, c.ID, heartbeat.AgentName, heartbeat.Hostname, status)
+	c.Hub.createOrUpdateHostWithMetadata(c.HostID, c.ID, heartbeat.AgentName, heartbeat.Hostname, status, heartbeat.PingLatencyMs)
+
+	// Each additional Docker endpoint is listed as a host of its own
+	if len(heartbeat.Endpoints) > 0 || c.hasEndpoints() {
+		c.Hub.syncEndpoints(c, heartbeat)
+	}
 }
 
 // handleMetrics handles a metrics message from the agent
@@ -338,15 +378,15 @@ func (c *AgentConnection) handleMetrics(msg *protocol.Message) { // NOSONAR
 	}
 }
 
-// broadcastEventToUI broadcasts an event to all connected UI clients
-func (c *AgentConnection) broadcastEventToUI(msg *protocol.Message) {
+// broadcastEventToUI broadcasts an event of a host to all connected UI clients
+func (c *AgentConnection) broadcastEventToUI(msg *protocol.Message, hostID string) {
 	c.Hub.mu.RLock()
 	defer c.Hub.mu.RUnlock()
 
 	// Create a UI event message
 	uiEvent := map[string]interface{}{
 		"type":      "event",
-		"host_id":   c.HostID,
+		"host_id":   hostID,
 		"agent_id":  c.ID,
 		"timestamp": msg.Timestamp,
 		"payload":   msg.Payload,
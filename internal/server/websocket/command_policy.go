@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"fmt"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+// policyExemptActions only release what an allowed command started, so a policy never
+// strands them
+var policyExemptActions = map[string]bool{
+	"stop_stream": true,
+}
+
+// readOnlyActions are the commands sent while the server is in read-only mode: they only
+// read Docker state, or stream and release logs
+var readOnlyActions = map[string]bool{
+	"list_containers":       true,
+	"get_container":         true,
+	"get_container_logs":    true,
+	"get_container_stats":   true,
+	"stream_container_logs": true,
+	"stop_stream":           true,
+	"list_streams":          true,
+	"get_docker_info":       true,
+	"get_agent_config":      true,
+	"get_runtime_info":      true,
+	"get_live_metrics":      true,
+	"list_images":           true,
+	"list_networks":         true,
+	"inspect_networks":      true,
+	"list_volumes":          true,
+	"inspect_volumes":       true,
+	"list_stacks":           true,
+	"get_stack":             true,
+	"get_stack_containers":  true,
+	"list_sandboxes":        true,
+	"discover_stacks":       true,
+}
+
+// CommandPolicy restricts the command actions the server sends to agents. A non-empty
+// allowlist admits only its actions; the denylist takes precedence over it.
+type CommandPolicy struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+// NewCommandPolicy builds a policy from allowed and denied actions. It returns nil, which
+// allows every action, when both lists are empty.
+func NewCommandPolicy(allow, deny []string) *CommandPolicy {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	policy := &CommandPolicy{deny: make(map[string]bool, len(deny))}
+	if len(allow) > 0 {
+		policy.allow = make(map[string]bool, len(allow))
+		for _, action := range allow {
+			policy.allow[action] = true
+		}
+	}
+	for _, action := range deny {
+		policy.deny[action] = true
+	}
+	return policy
+}
+
+// Allows reports whether action may be sent to agents.
+func (p *CommandPolicy) Allows(action string) bool {
+	if p == nil || policyExemptActions[action] {
+		return true
+	}
+	if p.deny[action] {
+		return false
+	}
+	return p.allow == nil || p.allow[action]
+}
+
+// check returns ErrCommandNotAllowed when message is a command the policy forbids.
+func (p *CommandPolicy) check(message *protocol.Message) error {
+	if p == nil || message.Type != protocol.MessageTypeCommand {
+		return nil
+	}
+	action, _ := message.Payload["action"].(string)
+	if !p.Allows(action) {
+		return fmt.Errorf("%w: %s", ErrCommandNotAllowed, action)
+	}
+	return nil
+}
+
+// checkReadOnly returns ErrServerReadOnly when message is a command that could change
+// Docker state.
+func checkReadOnly(message *protocol.Message) error {
+	if message.Type != protocol.MessageTypeCommand {
+		return nil
+	}
+	action, _ := message.Payload["action"].(string)
+	if !readOnlyActions[action] {
+		return fmt.Errorf("%w: %s", ErrServerReadOnly, action)
+	}
+	return nil
+}
+
+// SetCommandPolicy sets the command actions the hub sends to agents. A nil policy allows
+// every action.
+func (h *Hub) SetCommandPolicy(policy *CommandPolicy) {
+	h.mu.Lock()
+	h.commandPolicy = policy
+	h.mu.Unlock()
+}
+
+// SetReadOnly puts the hub in read-only mode, in which only commands that read Docker state
+// are sent to agents.
+func (h *Hub) SetReadOnly(readOnly bool) {
+	h.mu.Lock()
+	h.readOnly = readOnly
+	h.mu.Unlock()
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestCommandPolicyAllows(t *testing.T) {
+	if !(*CommandPolicy)(nil).Allows("remove_volumes") {
+		t.Fatal("expected a nil policy to allow every action")
+	}
+	if NewCommandPolicy(nil, nil) != nil {
+		t.Fatal("expected empty lists to yield no policy")
+	}
+
+	deny := NewCommandPolicy(nil, []string{"remove_volumes"})
+	if deny.Allows("remove_volumes") || !deny.Allows("list_containers") {
+		t.Fatal("expected the denylist to block only its actions")
+	}
+
+	allow := NewCommandPolicy([]string{"list_containers", "remove_volumes"}, []string{"remove_volumes"})
+	if !allow.Allows("list_containers") || allow.Allows("remove_volumes") || allow.Allows("start_container") {
+		t.Fatal("expected the allowlist to admit only its actions, minus denied ones")
+	}
+	if !allow.Allows("stop_stream") {
+		t.Fatal("expected stop_stream to be exempt from the policy")
+	}
+}
+
+func TestSendCommandEnforcesPolicy(t *testing.T) {
+	hub := NewHub()
+	agent := &AgentConnection{ID: "agent-1", HostID: "host-1", Send: make(chan []byte, 2), done: make(chan struct{})}
+	hub.agents[agent.ID] = agent
+	hub.SetCommandPolicy(NewCommandPolicy(nil, []string{"remove_volumes"}))
+
+	err := hub.SendCommand(agent.ID, protocol.NewCommandWithAction("remove_volumes", map[string]any{}))
+	if !errors.Is(err, ErrCommandNotAllowed) {
+		t.Fatalf("expected ErrCommandNotAllowed, got %v", err)
+	}
+	if len(agent.Send) != 0 {
+		t.Fatal("expected the denied command not to be queued")
+	}
+	if err := hub.SendCommand(agent.ID, protocol.NewCommandWithAction("list_volumes", map[string]any{})); err != nil {
+		t.Fatalf("expected list_volumes to be sent, got %v", err)
+	}
+	if len(agent.Send) != 1 {
+		t.Fatal("expected the allowed command to be queued")
+	}
+}
+
+func TestSendCommandReadOnly(t *testing.T) {
+	hub := NewHub()
+	agent := &AgentConnection{ID: "agent-1", HostID: "host-1", Send: make(chan []byte, 2), done: make(chan struct{})}
+	hub.agents[agent.ID] = agent
+	hub.SetReadOnly(true)
+
+	for _, action := range []string{"remove_container", "deploy_stack", "prune_dangling_images"} {
+		err := hub.SendCommand(agent.ID, protocol.NewCommandWithAction(action, map[string]any{}))
+		if !errors.Is(err, ErrServerReadOnly) {
+			t.Fatalf("expected %s to be refused in read-only mode, got %v", action, err)
+		}
+	}
+	if err := hub.SendCommand(agent.ID, protocol.NewCommandWithAction("list_containers", map[string]any{})); err != nil {
+		t.Fatalf("expected list_containers to be sent in read-only mode, got %v", err)
+	}
+	if len(agent.Send) != 1 {
+		t.Fatalf("expected only the read to be queued, got %d", len(agent.Send))
+	}
+}
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// EndpointHostID derives the host ID of an additional Docker endpoint of an agent. It only
+// depends on the agent's host ID and the endpoint name, so an endpoint keeps its host record,
+// stacks and history across reconnects.
+func EndpointHostID(agentHostID, endpoint string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("flotilla-endpoint:"+agentHostID+"/"+endpoint)).String()
+}
+
+// endpointHostUpdate is a host record change made after syncing an agent's endpoints.
+type endpointHostUpdate struct {
+	hostID string
+	name   string
+	status string
+}
+
+// syncEndpoints registers a connection for each endpoint in an agent's heartbeat and drops
+// the connections of endpoints it no longer reports.
+func (h *Hub) syncEndpoints(agent *AgentConnection, heartbeat *protocol.Heartbeat) {
+	var online, offline []endpointHostUpdate
+
+	h.mu.Lock()
+	// The agent may have disconnected while its heartbeat was handled
+	if h.agents[agent.ID] != agent {
+		h.mu.Unlock()
+		return
+	}
+	reported := make(map[string]bool, len(heartbeat.Endpoints))
+	for _, status := range heartbeat.Endpoints {
+		if status.Name == "" || reported[status.Name] {
+			continue
+		}
+		reported[status.Name] = true
+
+		endpoint, exists := agent.endpoints[status.Name]
+		if !exists {
+			hostID := EndpointHostID(agent.HostID, status.Name)
+			endpoint = &AgentConnection{
+				ID:           hostID,
+				HostID:       hostID,
+				RemoteIP:     agent.RemoteIP,
+				Conn:         agent.Conn,
+				Send:         agent.Send,
+				Hub:          h,
+				Protocol:     agent.Protocol,
+				PumpsStarted: true,
+				Endpoint:     status.Name,
+				parent:       agent,
+				done:         agent.done,
+			}
+			if agent.endpoints == nil {
+				agent.endpoints = make(map[string]*AgentConnection)
+			}
+			agent.endpoints[status.Name] = endpoint
+			h.agents[endpoint.ID] = endpoint
+			logrus.Infof("Agent %s reports Docker endpoint %s as host %s", agent.ID, status.Name, hostID)
+		}
+		endpoint.LastSeen = time.Now()
+		endpoint.mu.Lock()
+		endpoint.hostname = heartbeat.Hostname
+		endpoint.mu.Unlock()
+
+		hostStatus := "online"
+		if status.Status != "healthy" {
+			hostStatus = "error"
+		}
+		online = append(online, endpointHostUpdate{
+			hostID: endpoint.HostID,
+			name:   fmt.Sprintf("%s/%s", heartbeat.AgentName, status.Name),
+			status: hostStatus,
+		})
+	}
+	for name, endpoint := range agent.endpoints {
+		if reported[name] {
+			continue
+		}
+		delete(agent.endpoints, name)
+		if h.agents[endpoint.ID] == endpoint {
+			delete(h.agents, endpoint.ID)
+		}
+		offline = append(offline, endpointHostUpdate{hostID: endpoint.HostID, status: "offline"})
+		logrus.Infof("Agent %s no longer reports Docker endpoint %s", agent.ID, name)
+	}
+	h.mu.Unlock()
+
+	for _, update := range online {
+		h.createOrUpdateHostWithMetadata(update.hostID, agent.ID, update.name, heartbeat.Hostname, update.status, heartbeat.PingLatencyMs)
+	}
+	for _, update := range offline {
+		h.updateHostStatus(update.hostID, update.status)
+	}
+}
+
+// endpointConnection returns the connection of the endpoint named in a message payload or
+// event data, or the agent's own connection when no known endpoint is named.
+func (c *AgentConnection) endpointConnection(data map[string]any) *AgentConnection {
+	name, _ := data["endpoint"].(string)
+	if name == "" {
+		return c
+	}
+	c.Hub.mu.RLock()
+	defer c.Hub.mu.RUnlock()
+	if endpoint, ok := c.endpoints[name]; ok {
+		return endpoint
+	}
+	return c
+}
+
+// eventHostID returns the host an agent event belongs to: the endpoint named in the event
+// data, or the agent's own host.
+func (c *AgentConnection) eventHostID(data map[string]any) string {
+	return c.endpointConnection(data).HostID
+}
+
+// hasEndpoints reports whether endpoint connections are registered for an agent.
+func (c *AgentConnection) hasEndpoints() bool {
+	c.Hub.mu.RLock()
+	defer c.Hub.mu.RUnlock()
+	return len(c.endpoints) > 0
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestSyncEndpointsRoutesCommands(t *testing.T) {
+	hub := NewHub()
+	agent := &AgentConnection{ID: "agent-1", HostID: "host-1", Hub: hub, Send: make(chan []byte, 4), done: make(chan struct{})}
+	hub.agents[agent.ID] = agent
+
+	hub.syncEndpoints(agent, &protocol.Heartbeat{
+		AgentName: "edge",
+		Endpoints: []protocol.EndpointStatus{{Name: "build", Status: "healthy"}},
+	})
+
+	hostID := EndpointHostID("host-1", "build")
+	if hostID != EndpointHostID("host-1", "build") || hostID == EndpointHostID("host-2", "build") {
+		t.Fatalf("expected endpoint host IDs to be stable and agent specific")
+	}
+	endpoint, ok := hub.GetAgentByHost(hostID)
+	if !ok || endpoint.Endpoint != "build" {
+		t.Fatalf("expected the endpoint to be listed as host %s, got %+v", hostID, endpoint)
+	}
+	if stats := hub.SendQueueStats(); len(stats) != 1 || stats[0].AgentID != "agent-1" {
+		t.Fatalf("expected only the agent's own queue in the stats, got %+v", stats)
+	}
+
+	if err := hub.SendCommand(endpoint.ID, protocol.NewCommand("cmd-1", "list_containers", nil)); err != nil {
+		t.Fatalf("SendCommand returned error: %v", err)
+	}
+	msg, err := protocol.DeserializeMessage(<-agent.Send)
+	if err != nil {
+		t.Fatalf("failed to decode queued command: %v", err)
+	}
+	if cmd, err := msg.GetCommand(); err != nil || cmd.Endpoint != "build" {
+		t.Fatalf("expected the command to target the build endpoint, got %+v (err %v)", cmd, err)
+	}
+
+	waiter := hub.SubscribeResponse("cmd-1")
+	response := protocol.NewResponse("cmd-1", "success", map[string]any{}, nil)
+	protocol.SetResponseEndpoint(response, "build")
+	agent.handleResponse(response)
+	if got := <-waiter; got.AgentID != endpoint.ID {
+		t.Fatalf("expected the response to be attributed to the endpoint, got agent %s", got.AgentID)
+	}
+
+	if got := agent.eventHostID(map[string]any{"endpoint": "build"}); got != hostID {
+		t.Fatalf("expected endpoint events to belong to %s, got %s", hostID, got)
+	}
+	if got := agent.eventHostID(map[string]any{}); got != "host-1" {
+		t.Fatalf("expected other events to belong to the agent's host, got %s", got)
+	}
+
+	hub.syncEndpoints(agent, &protocol.Heartbeat{AgentName: "edge"})
+	if _, ok := hub.GetAgentByHost(hostID); ok {
+		t.Fatal("expected the endpoint to be dropped once the agent stops reporting it")
+	}
+}
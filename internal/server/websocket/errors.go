@@ -8,4 +8,9 @@ var (
 	ErrAgentNotReady = errors.New("agent not ready")
 	ErrInvalidAPIKey = errors.New("invalid API key")
 	ErrUnauthorized  = errors.New("unauthorized")
+	// ErrCommandNotAllowed is returned for commands the server's command policy forbids
+	ErrCommandNotAllowed = errors.New("command not allowed by server policy")
+	// ErrServerReadOnly is returned for commands that would change Docker state while the
+	// server is in read-only mode
+	ErrServerReadOnly = errors.New("server is in read-only mode")
 )
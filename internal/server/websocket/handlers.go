@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -12,17 +13,71 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/mikeysoft/flotilla/internal/server/auth"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
 	"github.com/sirupsen/logrus"
 )
 
+// supportedAgentProtocolVersions lists the agent protocol versions this server speaks,
+// most preferred first.
+var supportedAgentProtocolVersions = []int{protocol.ProtocolVersion}
+
+// negotiateAgentProtocol selects the agent protocol version from the subprotocols offered in
+// the handshake. Agents that offer no version predate negotiation and are accepted with
+// version 0; agents that only offer versions this server does not speak are rejected.
+func negotiateAgentProtocol(r *http.Request) (AgentProtocol, error) {
+	versions, capabilities := protocol.ParseAgentSubprotocols(websocket.Subprotocols(r))
+	if len(versions) == 0 {
+		return AgentProtocol{}, nil
+	}
+	for _, supported := range supportedAgentProtocolVersions {
+		for _, offered := range versions {
+			if offered == supported {
+				return AgentProtocol{Version: supported, Capabilities: capabilities}, nil
+			}
+		}
+	}
+	return AgentProtocol{}, fmt.Errorf("unsupported agent protocol versions %v; server supports %v", versions, supportedAgentProtocolVersions)
+}
+
+// compressionNegotiated reports whether upgrading r with u negotiates permessage-deflate,
+// which gorilla/websocket does when compression is enabled and the client offers it.
+func compressionNegotiated(u websocket.Upgrader, r *http.Request) bool {
+	if !u.EnableCompression {
+		return false
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // AgentWebSocketHandler handles WebSocket connections from agents
 func (h *Hub) AgentWebSocketHandler(c *gin.Context) {
+	negotiated, err := negotiateAgentProtocol(c.Request)
+	if err != nil {
+		logrus.Warnf("Agent connection rejected: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Copy upgrader so the selected subprotocol is echoed back only for this connection
+	agentUpgrader := upgrader
+	if negotiated.Version > 0 {
+		agentUpgrader.Subprotocols = []string{protocol.AgentSubprotocol(negotiated.Version)}
+	}
+
 	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := agentUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logrus.Errorf("Failed to upgrade WebSocket connection: %v", err)
 		return
 	}
+	negotiated.Compression = compressionNegotiated(agentUpgrader, c.Request)
 
 	// Get API key and host ID from query parameters
 	apiKey := strings.TrimSpace(c.Query("api_key"))
@@ -30,18 +85,20 @@ func (h *Hub) AgentWebSocketHandler(c *gin.Context) {
 
 	if apiKey == "" {
 		logrus.Warn("Agent connection rejected: missing API key")
-		if err := conn.Close(); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
-			logrus.WithError(err).Debug("failed to close rejected agent connection")
-		}
+		rejectAgent(conn, protocol.CloseAuthenticationFailed, "authentication failed: missing API key")
 		return
 	}
 
 	apiKeyRecord, err := auth.ValidateAPIKey(apiKey)
 	if err != nil {
 		logrus.Warnf("Agent authentication failed: %v", err)
-		if err := conn.Close(); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
-			logrus.WithError(err).Debug("failed to close unauthenticated agent connection")
-		}
+		rejectAgent(conn, protocol.CloseAuthenticationFailed, "authentication failed: invalid or revoked API key")
+		return
+	}
+
+	if !auth.HasScope(apiKeyRecord, auth.APIKeyScopeAgent) {
+		logrus.Warnf("Agent authentication failed: API key %s is not scoped for agents", apiKeyRecord.ID)
+		rejectAgent(conn, protocol.CloseAuthenticationFailed, "authentication failed: API key is not scoped for agents")
 		return
 	}
 
@@ -57,10 +114,26 @@ func (h *Hub) AgentWebSocketHandler(c *gin.Context) {
 
 	agentID := hostID
 
-	logrus.Infof("Agent %s connecting for host %s", agentID, hostID)
+	logrus.WithFields(logrus.Fields{
+		"protocol_version": negotiated.Version,
+		"capabilities":     negotiated.Capabilities,
+		"compression":      negotiated.Compression,
+	}).Infof("Agent %s connecting for host %s", agentID, hostID)
 
 	// Register the agent connection (this will start the read/write pumps)
-	h.RegisterAgent(conn, agentID, hostID)
+	h.RegisterAgent(conn, agentID, hostID, c.ClientIP(), negotiated)
+}
+
+// rejectAgent closes an upgraded agent connection with a close code and reason, so the agent
+// can tell the rejection apart from a network failure.
+func rejectAgent(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		logrus.WithError(err).Debug("failed to send close frame to rejected agent")
+	}
+	if err := conn.Close(); err != nil {
+		logrus.WithError(err).Debug("failed to close rejected agent connection")
+	}
 }
 
 // UIWebSocketHandler handles WebSocket connections from UI clients
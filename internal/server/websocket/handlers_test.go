@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestNegotiateAgentProtocol(t *testing.T) {
+	cases := []struct {
+		name    string
+		offered []string
+		version int
+		wantErr bool
+	}{
+		{"legacy agent", nil, 0, false},
+		{"current agent", protocol.AgentSubprotocols(protocol.AgentCapabilities), protocol.ProtocolVersion, false},
+		{"newer and current", []string{"flotilla-agent.v99", protocol.AgentSubprotocol(protocol.ProtocolVersion)}, protocol.ProtocolVersion, false},
+		{"unsupported only", []string{"flotilla-agent.v99"}, 0, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws/agent", nil)
+			if len(tc.offered) > 0 {
+				req.Header.Set("Sec-WebSocket-Protocol", strings.Join(tc.offered, ", "))
+			}
+			negotiated, err := negotiateAgentProtocol(req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("negotiateAgentProtocol() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if negotiated.Version != tc.version {
+				t.Fatalf("negotiated version = %d, want %d", negotiated.Version, tc.version)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/ws/agent", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocol.AgentSubprotocols(protocol.AgentCapabilities), ", "))
+	negotiated, _ := negotiateAgentProtocol(req)
+	conn := &AgentConnection{Protocol: negotiated}
+	if !conn.HasCapability(protocol.CapabilityBusyResponses) || conn.HasCapability("unknown") {
+		t.Fatalf("unexpected capabilities: %v", negotiated.Capabilities)
+	}
+}
+
+func TestRejectAgentSendsCloseCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		rejectAgent(conn, protocol.CloseAuthenticationFailed, "authentication failed: missing API key")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok || closeErr.Code != protocol.CloseAuthenticationFailed || !strings.Contains(closeErr.Text, "missing API key") {
+		t.Fatalf("expected authentication close frame, got %v", err)
+	}
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	offer := httptest.NewRequest("GET", "/ws/agent", nil)
+	offer.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits")
+	plain := httptest.NewRequest("GET", "/ws/agent", nil)
+
+	compressing := websocket.Upgrader{EnableCompression: true}
+	if !compressionNegotiated(compressing, offer) {
+		t.Fatal("expected compression when the server enables it and the client offers it")
+	}
+	if compressionNegotiated(compressing, plain) {
+		t.Fatal("expected no compression when the client does not offer it")
+	}
+	if compressionNegotiated(upgrader, offer) {
+		t.Fatal("expected no compression when the server does not enable it")
+	}
+
+	conn := &AgentConnection{RemoteIP: "10.0.0.5", Protocol: AgentProtocol{Version: 2, Compression: true}}
+	if info := conn.ConnectionInfo(); !info.Compression || info.ProtocolVersion != 2 || info.RemoteIP != "10.0.0.5" {
+		t.Fatalf("unexpected connection info %+v", info)
+	}
+}
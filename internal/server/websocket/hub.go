@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,6 +37,9 @@ type Hub struct {
 	// Response waiters keyed by command ID
 	responseWaiters map[string]chan *CommandResponse
 
+	// Progress waiters keyed by command ID
+	progressWaiters map[string]chan protocol.Progress
+
 	// Metrics client for InfluxDB
 	metricsClient *metrics.Client
 
@@ -46,6 +51,15 @@ type Hub struct {
 	registerLogStream   chan *LogStreamConnection
 	unregisterLogStream chan *LogStreamConnection
 
+	// Outbound queue size for new agent connections and how long a send waits on a full one
+	agentSendQueueSize int
+	agentSendTimeout   time.Duration
+
+	// Command actions the server may send to agents; nil allows all
+	commandPolicy *CommandPolicy
+	// readOnly limits commands to those that only read Docker state
+	readOnly bool
+
 	// Mutex for thread-safe access
 	mu sync.RWMutex
 
@@ -59,12 +73,97 @@ type Hub struct {
 type AgentConnection struct {
 	ID           string
 	HostID       string
+	RemoteIP     string // Client IP of the agent's WebSocket handshake, honouring trusted proxies
 	Conn         *websocket.Conn
 	Send         chan []byte
 	Hub          *Hub
 	LastSeen     time.Time
-	PumpsStarted bool         // Track if pumps have been started
-	mu           sync.RWMutex // Protect pump state
+	Protocol     AgentProtocol // Negotiated during the handshake; fixed for the connection
+	PumpsStarted bool          // Track if pumps have been started
+	mu           sync.RWMutex  // Protect pump state, dockerHealth and hostname
+
+	// dockerHealth is the daemon health from the agent's latest heartbeat, if it reports one
+	dockerHealth *protocol.DockerHealth
+	// hostname is the host name from the agent's latest heartbeat
+	hostname string
+
+	// Endpoint is set on the connection of an additional Docker endpoint of a multi-endpoint
+	// agent. Such a connection shares the agent's socket and send queue, is listed as a host
+	// of its own and targets the commands sent through it at the endpoint.
+	Endpoint string
+	// parent is the agent's own connection for an endpoint connection
+	parent *AgentConnection
+	// endpoints are the endpoint connections of an agent keyed by endpoint name; guarded by
+	// the hub lock
+	endpoints map[string]*AgentConnection
+
+	// done is closed when the connection is unregistered; Send itself is never closed so
+	// that senders racing the disconnect cannot panic
+	done           chan struct{}
+	peakQueueDepth atomic.Int64
+	sendTimeouts   atomic.Uint64
+}
+
+// DockerHealth returns the Docker daemon health from the agent's latest heartbeat, or nil
+// when the agent does not report it.
+func (c *AgentConnection) DockerHealth() *protocol.DockerHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dockerHealth
+}
+
+// Address returns the address clients can reach the agent's host on: the IP the agent
+// connected from, or the host name it reports when that IP is unknown or loopback.
+func (c *AgentConnection) Address() string {
+	if ip := net.ParseIP(c.RemoteIP); ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+		return c.RemoteIP
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.hostname != "" {
+		return c.hostname
+	}
+	return c.RemoteIP
+}
+
+// AgentProtocol is the protocol version and capabilities an agent negotiated through the
+// WebSocket subprotocol.
+type AgentProtocol struct {
+	Version      int // 0 for agents that connect without subprotocol negotiation
+	Capabilities []string
+	// Compression is set when the handshake negotiated permessage-deflate
+	Compression bool
+}
+
+// ConnectionInfo describes how an agent is connected, for operators inspecting a host.
+type ConnectionInfo struct {
+	RemoteIP        string   `json:"remote_ip"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+	Compression     bool     `json:"compression"`
+	// Endpoint names the Docker endpoint of a multi-endpoint agent the host is reached through
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// ConnectionInfo returns the negotiated settings of the agent's WebSocket connection.
+func (c *AgentConnection) ConnectionInfo() ConnectionInfo {
+	return ConnectionInfo{
+		RemoteIP:        c.RemoteIP,
+		ProtocolVersion: c.Protocol.Version,
+		Capabilities:    append([]string{}, c.Protocol.Capabilities...),
+		Compression:     c.Protocol.Compression,
+		Endpoint:        c.Endpoint,
+	}
+}
+
+// HasCapability reports whether the agent advertised a capability during the handshake.
+func (c *AgentConnection) HasCapability(capability string) bool {
+	for _, advertised := range c.Protocol.Capabilities {
+		if advertised == capability {
+			return true
+		}
+	}
+	return false
 }
 
 // UIConnection represents a WebSocket connection from a UI client
@@ -93,6 +192,7 @@ func NewHub() *Hub {
 		logStreams:          make(map[string]*LogStreamConnection),
 		responses:           make(chan *CommandResponse, 256),
 		responseWaiters:     make(map[string]chan *CommandResponse),
+		progressWaiters:     make(map[string]chan protocol.Progress),
 		metricsClient:       nil, // Will be set later
 		registerAgent:       make(chan *AgentConnection),
 		unregisterAgent:     make(chan *AgentConnection),
@@ -100,6 +200,8 @@ func NewHub() *Hub {
 		unregisterUI:        make(chan *UIConnection),
 		registerLogStream:   make(chan *LogStreamConnection),
 		unregisterLogStream: make(chan *LogStreamConnection),
+		agentSendQueueSize:  defaultAgentSendQueueSize,
+		agentSendTimeout:    defaultAgentSendTimeout,
 	}
 }
 
@@ -151,14 +253,21 @@ func (h *Hub) Run(ctx context.Context) {
 }
 
 // RegisterAgent registers a new agent connection
-func (h *Hub) RegisterAgent(conn *websocket.Conn, agentID, hostID string) *AgentConnection {
+func (h *Hub) RegisterAgent(conn *websocket.Conn, agentID, hostID, remoteIP string, negotiated AgentProtocol) *AgentConnection {
+	h.mu.RLock()
+	queueSize := h.agentSendQueueSize
+	h.mu.RUnlock()
+
 	agent := &AgentConnection{
 		ID:       agentID,
 		HostID:   hostID,
+		RemoteIP: remoteIP,
 		Conn:     conn,
-		Send:     make(chan []byte, 256),
+		Send:     make(chan []byte, queueSize),
 		Hub:      h,
 		LastSeen: time.Now(),
+		Protocol: negotiated,
+		done:     make(chan struct{}),
 	}
 
 	h.registerAgent <- agent
@@ -182,38 +291,47 @@ func (h *Hub) RegisterUI(conn *websocket.Conn, clientID string) *UIConnection {
 func (h *Hub) SendCommand(agentID string, command *protocol.Message) error {
 	h.mu.RLock()
 	agent, exists := h.agents[agentID]
+	timeout := h.agentSendTimeout
+	policy := h.commandPolicy
+	readOnly := h.readOnly
 	h.mu.RUnlock()
 
 	if !exists {
 		return ErrAgentNotFound
 	}
+	if readOnly {
+		if err := checkReadOnly(command); err != nil {
+			logrus.Warnf("Refused to send command to agent %s: %v", agentID, err)
+			return err
+		}
+	}
+	if err := policy.check(command); err != nil {
+		logrus.Warnf("Refused to send command to agent %s: %v", agentID, err)
+		return err
+	}
 
+	if agent.Endpoint != "" {
+		protocol.SetCommandEndpoint(command, agent.Endpoint)
+	}
 	data, err := command.Serialize()
 	if err != nil {
 		return err
 	}
 
-	// Send command via channel to avoid concurrent writes
-	select {
-	case agent.Send <- data:
-		return nil
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("timeout sending command to agent %s", agentID)
-	}
+	// Queue the command for the agent's write pump to avoid concurrent writes; a full queue
+	// only delays senders to this agent
+	return agent.enqueue(data, timeout)
 }
 
 // SendCommandToHost sends a command to the agent managing a specific host
 func (h *Hub) SendCommandToHost(hostID string, command *protocol.Message) error {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	for _, agent := range h.agents {
-		if agent.HostID == hostID {
-			return h.SendCommand(agent.ID, command)
-		}
+	// Release the lock before sending: a send may wait on a slow agent's queue, and holding
+	// the hub lock meanwhile would stall every other send and registration
+	agent, exists := h.GetAgentByHost(hostID)
+	if !exists {
+		return ErrHostNotFound
 	}
-
-	return ErrHostNotFound
+	return h.SendCommand(agent.ID, command)
 }
 
 // GetResponses returns the responses channel
@@ -320,10 +438,16 @@ func (h *Hub) unregisterAgentConnection(agent *AgentConnection) {
 
 	if _, exists := h.agents[agent.ID]; exists {
 		delete(h.agents, agent.ID)
-		close(agent.Send)
+		close(agent.done)
 
 		// Update host status in database
 		h.updateHostStatus(agent.HostID, "offline")
+		for _, endpoint := range agent.endpoints {
+			if h.agents[endpoint.ID] == endpoint {
+				delete(h.agents, endpoint.ID)
+				h.updateHostStatus(endpoint.HostID, "offline")
+			}
+		}
 
 		logrus.Infof("Agent %s disconnected", agent.ID)
 	}
@@ -372,7 +496,7 @@ func (h *Hub) unregisterLogStreamConnection(logStream *LogStreamConnection) {
 
 	if _, exists := h.logStreams[logStream.ID]; exists {
 		delete(h.logStreams, logStream.ID)
-		close(logStream.Send)
+		close(logStream.done)
 		logrus.Infof("Log stream %s disconnected", logStream.ID)
 	}
 }
@@ -427,7 +551,10 @@ func (h *Hub) checkAgentHeartbeats() {
 	h.mu.RLock()
 	agents := make([]*AgentConnection, 0, len(h.agents))
 	for _, agent := range h.agents {
-		agents = append(agents, agent)
+		// Endpoint connections go with their agent's connection
+		if agent.parent == nil {
+			agents = append(agents, agent)
+		}
 	}
 	h.mu.RUnlock()
 
@@ -442,8 +569,9 @@ func (h *Hub) checkAgentHeartbeats() {
 	}
 }
 
-// createOrUpdateHostWithMetadata creates or updates a host with metadata from heartbeat
-func (h *Hub) createOrUpdateHostWithMetadata(hostID, agentID, agentName, hostname, status string) {
+// createOrUpdateHostWithMetadata creates or updates a host with metadata from heartbeat. A nil
+// pingLatencyMs leaves the stored latency unchanged.
+func (h *Hub) createOrUpdateHostWithMetadata(hostID, agentID, agentName, hostname, status string, pingLatencyMs *float64) {
 	if database.DB == nil {
 		return
 	}
@@ -463,14 +591,15 @@ func (h *Hub) createOrUpdateHostWithMetadata(hostID, agentID, agentName, hostnam
 		}
 
 		host = database.Host{
-			ID:           hostUUID,
-			Name:         agentName,
-			Description:  fmt.Sprintf("Agent running on %s", hostname),
-			AgentVersion: "1.0.0",
-			Status:       status,
-			LastSeen:     &now,
-			CreatedAt:    now,
-			UpdatedAt:    now,
+			ID:            hostUUID,
+			Name:          agentName,
+			Description:   fmt.Sprintf("Agent running on %s", hostname),
+			AgentVersion:  "1.0.0",
+			Status:        status,
+			LastSeen:      &now,
+			PingLatencyMs: pingLatencyMs,
+			CreatedAt:     now,
+			UpdatedAt:     now,
 		}
 
 		if err := database.DB.Create(&host).Error; err != nil {
@@ -494,6 +623,9 @@ func (h *Hub) createOrUpdateHostWithMetadata(hostID, agentID, agentName, hostnam
 		if hostname != "" {
 			updates["description"] = fmt.Sprintf("Agent running on %s", hostname)
 		}
+		if pingLatencyMs != nil {
+			updates["ping_latency_ms"] = *pingLatencyMs
+		}
 
 		database.DB.Model(&host).Updates(updates)
 
@@ -3,6 +3,7 @@ package websocket
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestExtractContainersCount(t *testing.T) {
@@ -38,6 +39,7 @@ func TestForwardLogEvent(t *testing.T) {
 		ContainerID: "cont-123",
 		HostID:      "host-abc",
 		Hub:         hub,
+		done:        make(chan struct{}),
 	}
 
 	// Register directly into map under lock
@@ -69,3 +71,43 @@ func TestForwardLogEvent(t *testing.T) {
 		t.Fatal("no message received on log stream channel")
 	}
 }
+
+func TestLogStreamErrorAfterDisconnect(t *testing.T) {
+	hub := NewHub()
+	ls := newLogStreamConnection(hub, "host-abc", "cont-123")
+	hub.registerLogStreamConnection(ls)
+	// Fill the queue so the error can only give up once the client is gone
+	for i := 0; i < cap(ls.Send); i++ {
+		ls.Send <- nil
+	}
+	hub.unregisterLogStreamConnection(ls)
+
+	select {
+	case <-ls.Done():
+	default:
+		t.Fatal("expected unregistering to close the done channel")
+	}
+	done := make(chan struct{})
+	go func() {
+		ls.sendLogError("agent went away")
+		// Forwarding to a disconnected stream must not panic either
+		hub.ForwardLogEvent("host-abc", "cont-123", "late", "stdout", "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected sending an error to a disconnected stream to return at once")
+	}
+}
+
+func TestAgentConnectionAddress(t *testing.T) {
+	agent := &AgentConnection{RemoteIP: "192.168.1.20", hostname: "docker-1"}
+	if got := agent.Address(); got != "192.168.1.20" {
+		t.Fatalf("Address() = %q, want the remote IP", got)
+	}
+	agent.RemoteIP = "127.0.0.1"
+	if got := agent.Address(); got != "docker-1" {
+		t.Fatalf("Address() = %q, want the hostname for a loopback connection", got)
+	}
+}
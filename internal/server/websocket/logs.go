@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,8 +24,21 @@ type LogStreamConnection struct {
 	HostID       string
 	Hub          *Hub
 	PumpsStarted bool
+
+	// done is closed when the connection is unregistered. Send is never closed, since the
+	// hub and the stream starter may still be sending to it.
+	done chan struct{}
+
+	// streamMu guards the agent-side stream, which is stopped when the client disconnects
+	streamMu      sync.Mutex
+	agentStreamID string
+	agentID       string
+	closed        bool
 }
 
+// logStreamStartTimeout bounds how long the server waits for the agent to accept a stream
+const logStreamStartTimeout = 10 * time.Second
+
 // LogStreamHandler handles WebSocket connections for log streaming
 func (h *Hub) LogStreamHandler(c *gin.Context) {
 	// Validate access JWT from Authorization header or token query param
@@ -88,14 +102,8 @@ func (h *Hub) LogStreamHandler(c *gin.Context) {
 	}
 
 	// Create log stream connection
-	logConn := &LogStreamConnection{
-		ID:          generateID(),
-		Conn:        conn,
-		Send:        make(chan []byte, 256),
-		ContainerID: containerID,
-		HostID:      hostID,
-		Hub:         h,
-	}
+	logConn := newLogStreamConnection(h, hostID, containerID)
+	logConn.Conn = conn
 
 	// Register the connection
 	h.registerLogStream <- logConn
@@ -113,10 +121,50 @@ func (h *Hub) LogStreamHandler(c *gin.Context) {
 	logrus.Infof("Log stream connection established for container %s on host %s", containerID, hostID)
 }
 
+// OpenLogStream streams a container's logs without a WebSocket client, for relays such as
+// Server-Sent Events. Messages arrive on the connection's Send channel in the same format as
+// on /ws/logs, and Close stops the stream.
+func (h *Hub) OpenLogStream(hostID, containerID string, follow bool, tail string, timestamps bool) *LogStreamConnection {
+	logConn := newLogStreamConnection(h, hostID, containerID)
+	h.registerLogStream <- logConn
+
+	timestampsStr := "false"
+	if timestamps {
+		timestampsStr = "true"
+	}
+	go logConn.startLogStream(follow, tail, timestampsStr)
+
+	logrus.Infof("Log stream relay established for container %s on host %s", containerID, hostID)
+	return logConn
+}
+
+func newLogStreamConnection(h *Hub, hostID, containerID string) *LogStreamConnection {
+	return &LogStreamConnection{
+		ID:          generateID(),
+		Send:        make(chan []byte, 256),
+		ContainerID: containerID,
+		HostID:      hostID,
+		Hub:         h,
+		done:        make(chan struct{}),
+	}
+}
+
+// Done returns a channel that is closed once the connection has been unregistered.
+func (c *LogStreamConnection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close unregisters a log stream opened with OpenLogStream and stops the agent's stream.
+func (c *LogStreamConnection) Close() {
+	c.Hub.unregisterLogStream <- c
+	c.stopAgentStream()
+}
+
 // startPumps starts the read and write pumps for the log stream connection
 func (c *LogStreamConnection) startPumps() {
 	defer func() {
 		c.Hub.unregisterLogStream <- c
+		c.stopAgentStream()
 		if err := c.Conn.Close(); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
 			logrus.WithError(err).Debugf("Failed to close log stream connection %s", c.ID)
 		}
@@ -140,18 +188,20 @@ func (c *LogStreamConnection) startPumps() {
 
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case <-c.done:
 			if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				logrus.WithError(err).Warnf("Failed to set write deadline for log stream %s", c.ID)
 				return
 			}
-			if !ok {
-				if err := c.Conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
-					logrus.WithError(err).Debugf("Failed to send close message for log stream %s", c.ID)
-				}
+			if err := c.Conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+				logrus.WithError(err).Debugf("Failed to send close message for log stream %s", c.ID)
+			}
+			return
+		case message := <-c.Send:
+			if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+				logrus.WithError(err).Warnf("Failed to set write deadline for log stream %s", c.ID)
 				return
 			}
-
 			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
@@ -193,6 +243,8 @@ func (c *LogStreamConnection) startLogStream(follow bool, tail, timestamps strin
 	if data, err := json.Marshal(initialMessage); err == nil {
 		select {
 		case c.Send <- data:
+		case <-c.done:
+			return
 		case <-time.After(5 * time.Second):
 			logrus.Warnf("Failed to send initial message to log stream client %s", c.ID)
 		}
@@ -213,30 +265,93 @@ func (c *LogStreamConnection) startLogStream(follow bool, tail, timestamps strin
 	agent := c.Hub.GetAgentByHostID(c.HostID)
 	if agent == nil {
 		logrus.Errorf("No agent found for host %s", c.HostID)
-		errorMessage := map[string]interface{}{
-			"type": "log_error",
-			"payload": map[string]interface{}{
-				"error": "No agent connected for this host",
-			},
+		c.sendLogError("No agent connected for this host")
+		return
+	}
+
+	// Send command to agent and wait for it to accept the stream, which it declines once it
+	// has too many open
+	waiter := c.Hub.SubscribeResponse(command.ID)
+	defer c.Hub.UnsubscribeResponse(command.ID)
+	if err := c.Hub.SendCommand(agent.ID, command); err != nil {
+		logrus.Errorf("Failed to send log stream command: %v", err)
+		c.sendLogError("Failed to start log stream")
+		return
+	}
+	logrus.Infof("Sent log stream command to agent %s for container %s", agent.ID, c.ContainerID)
+
+	select {
+	case resp := <-waiter:
+		if resp.Error != nil {
+			c.sendLogError(resp.Error.Error())
+			return
 		}
-		if data, err := json.Marshal(errorMessage); err == nil {
-			select {
-			case c.Send <- data:
-			case <-time.After(5 * time.Second):
-			}
+		result, err := resp.Response.GetResponse()
+		if err != nil {
+			c.sendLogError("Invalid response from agent")
+			return
 		}
+		if result.Status != "success" {
+			c.sendLogError(result.Error)
+			return
+		}
+		data, _ := result.Data.(map[string]interface{})
+		streamID, _ := data["stream_id"].(string)
+		c.setAgentStream(agent.ID, streamID)
+	case <-time.After(logStreamStartTimeout):
+		c.sendLogError("Host agent did not start the log stream in time")
+	}
+}
+
+// sendLogError reports a failure to start streaming to the UI client
+func (c *LogStreamConnection) sendLogError(message string) {
+	errorMessage := map[string]interface{}{
+		"type": "log_error",
+		"payload": map[string]interface{}{
+			"error": message,
+		},
+	}
+	if data, err := json.Marshal(errorMessage); err == nil {
+		select {
+		case c.Send <- data:
+		case <-c.done:
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// setAgentStream records the stream the agent opened for this connection, stopping it right
+// away when the client disconnected while it was starting.
+func (c *LogStreamConnection) setAgentStream(agentID, streamID string) {
+	if streamID == "" {
 		return
 	}
+	c.streamMu.Lock()
+	c.agentID = agentID
+	c.agentStreamID = streamID
+	closed := c.closed
+	c.streamMu.Unlock()
+	if closed {
+		c.stopAgentStream()
+	}
+}
 
-	// Send command to agent
-	commandData, err := command.Serialize()
-	if err != nil {
-		logrus.Errorf("Failed to serialize log stream command: %v", err)
+// stopAgentStream asks the agent to stop the stream backing this connection so it frees the
+// agent's stream slot.
+func (c *LogStreamConnection) stopAgentStream() {
+	c.streamMu.Lock()
+	c.closed = true
+	agentID, streamID := c.agentID, c.agentStreamID
+	c.agentStreamID = ""
+	c.streamMu.Unlock()
+	if streamID == "" {
 		return
 	}
 
-	agent.Send <- commandData
-	logrus.Infof("Sent log stream command to agent %s for container %s", agent.ID, c.ContainerID)
+	command := protocol.NewCommandWithAction("stop_stream", map[string]any{"stream_id": streamID})
+	if err := c.Hub.SendCommand(agentID, command); err != nil {
+		logrus.WithError(err).Debugf("Failed to stop agent log stream %s", streamID)
+	}
 }
 
 // generateID generates a unique ID for log stream connections
@@ -0,0 +1,42 @@
+package websocket
+
+import (
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// progressBufferSize is how many progress reports a waiter may fall behind before reports
+// are dropped; the final response is delivered separately and is never lost this way
+const progressBufferSize = 64
+
+// SubscribeProgress registers a channel receiving the progress reports of a command until
+// UnsubscribeProgress is called.
+func (h *Hub) SubscribeProgress(commandID string) <-chan protocol.Progress {
+	ch := make(chan protocol.Progress, progressBufferSize)
+	h.mu.Lock()
+	h.progressWaiters[commandID] = ch
+	h.mu.Unlock()
+	return ch
+}
+
+// UnsubscribeProgress removes the progress channel of a command.
+func (h *Hub) UnsubscribeProgress(commandID string) {
+	h.mu.Lock()
+	delete(h.progressWaiters, commandID)
+	h.mu.Unlock()
+}
+
+// deliverProgress hands a progress report to the waiter of its command, if any.
+func (h *Hub) deliverProgress(progress protocol.Progress) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ch, ok := h.progressWaiters[progress.CommandID]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- progress:
+	default:
+		logrus.Debugf("Progress waiter for command %s is behind, dropping report", progress.CommandID)
+	}
+}
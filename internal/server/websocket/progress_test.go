@@ -0,0 +1,37 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/mikeysoft/flotilla/internal/shared/protocol"
+)
+
+func TestDeliverProgress(t *testing.T) {
+	hub := NewHub()
+	ch := hub.SubscribeProgress("cmd-1")
+
+	hub.deliverProgress(protocol.Progress{CommandID: "cmd-1", Stage: "pull", Current: 1, Total: 2})
+	hub.deliverProgress(protocol.Progress{CommandID: "cmd-2", Stage: "pull"})
+
+	select {
+	case progress := <-ch:
+		if progress.Stage != "pull" || progress.Current != 1 {
+			t.Fatalf("unexpected progress: %+v", progress)
+		}
+	default:
+		t.Fatal("expected progress for the subscribed command")
+	}
+	select {
+	case progress := <-ch:
+		t.Fatalf("expected no progress for other commands, got %+v", progress)
+	default:
+	}
+
+	hub.UnsubscribeProgress("cmd-1")
+	for i := 0; i < progressBufferSize+1; i++ {
+		hub.deliverProgress(protocol.Progress{CommandID: "cmd-1"})
+	}
+	if len(ch) != 0 {
+		t.Fatalf("expected no delivery after unsubscribing, got %d reports", len(ch))
+	}
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	defaultAgentSendQueueSize = 256
+	// defaultAgentSendTimeout is how long a send waits for room in a full agent queue
+	defaultAgentSendTimeout = 10 * time.Second
+)
+
+// SendQueueStats describes the outbound queue of one agent connection. Each agent has its
+// own queue drained by its own write pump, so a deep queue points at a slow agent rather
+// than a slow server.
+type SendQueueStats struct {
+	AgentID      string `json:"agent_id"`
+	HostID       string `json:"host_id"`
+	Depth        int    `json:"depth"`
+	Capacity     int    `json:"capacity"`
+	PeakDepth    int64  `json:"peak_depth"`
+	SendTimeouts uint64 `json:"send_timeouts"`
+}
+
+// SetAgentSendQueue sets the outbound queue size of agent connections registered from now
+// on and how long a send waits when an agent's queue is full. Non-positive values keep the
+// current settings.
+func (h *Hub) SetAgentSendQueue(size int, timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size > 0 {
+		h.agentSendQueueSize = size
+	}
+	if timeout > 0 {
+		h.agentSendTimeout = timeout
+	}
+}
+
+// enqueue queues data for the agent's write pump, waiting up to timeout for room.
+func (c *AgentConnection) enqueue(data []byte, timeout time.Duration) error {
+	select {
+	case c.Send <- data:
+		c.recordQueueDepth()
+		return nil
+	case <-c.done:
+		return ErrAgentNotFound
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c.Send <- data:
+		c.recordQueueDepth()
+		return nil
+	case <-c.done:
+		return ErrAgentNotFound
+	case <-timer.C:
+		c.sendTimeouts.Add(1)
+		return fmt.Errorf("timeout sending command to agent %s: send queue full (%d messages)", c.ID, cap(c.Send))
+	}
+}
+
+func (c *AgentConnection) recordQueueDepth() {
+	depth := int64(len(c.Send))
+	for {
+		peak := c.peakQueueDepth.Load()
+		if depth <= peak || c.peakQueueDepth.CompareAndSwap(peak, depth) {
+			return
+		}
+	}
+}
+
+// SendQueueStats reports the outbound queue of every connected agent, deepest first.
+func (h *Hub) SendQueueStats() []SendQueueStats {
+	h.mu.RLock()
+	stats := make([]SendQueueStats, 0, len(h.agents))
+	for _, agent := range h.agents {
+		// Endpoint connections share their agent's queue
+		if agent.parent != nil {
+			continue
+		}
+		stats = append(stats, SendQueueStats{
+			AgentID:      agent.ID,
+			HostID:       agent.HostID,
+			Depth:        len(agent.Send),
+			Capacity:     cap(agent.Send),
+			PeakDepth:    agent.peakQueueDepth.Load(),
+			SendTimeouts: agent.sendTimeouts.Load(),
+		})
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Depth != stats[j].Depth {
+			return stats[i].Depth > stats[j].Depth
+		}
+		return stats[i].AgentID < stats[j].AgentID
+	})
+	return stats
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAgentEnqueue(t *testing.T) {
+	agent := &AgentConnection{ID: "agent-1", Send: make(chan []byte, 2), done: make(chan struct{})}
+
+	for i := 0; i < 2; i++ {
+		if err := agent.enqueue([]byte("cmd"), 10*time.Millisecond); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+	}
+	if err := agent.enqueue([]byte("cmd"), 10*time.Millisecond); err == nil {
+		t.Fatal("expected enqueue on a full queue to time out")
+	}
+	if got := agent.sendTimeouts.Load(); got != 1 {
+		t.Fatalf("send timeouts = %d, want 1", got)
+	}
+	if got := agent.peakQueueDepth.Load(); got != 2 {
+		t.Fatalf("peak depth = %d, want 2", got)
+	}
+
+	close(agent.done)
+	if err := agent.enqueue([]byte("cmd"), time.Second); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("expected ErrAgentNotFound after disconnect, got %v", err)
+	}
+}
+
+func TestSendQueueStatsOrdersByDepth(t *testing.T) {
+	hub := NewHub()
+	shallow := &AgentConnection{ID: "a", HostID: "host-a", Send: make(chan []byte, 4)}
+	deep := &AgentConnection{ID: "b", HostID: "host-b", Send: make(chan []byte, 4)}
+	deep.Send <- []byte("one")
+	deep.Send <- []byte("two")
+	hub.agents[shallow.ID] = shallow
+	hub.agents[deep.ID] = deep
+
+	stats := hub.SendQueueStats()
+	if len(stats) != 2 || stats[0].AgentID != "b" || stats[0].Depth != 2 || stats[0].Capacity != 4 {
+		t.Fatalf("unexpected send queue stats: %+v", stats)
+	}
+}
@@ -28,6 +28,9 @@ type ServerConfig struct {
 	WSReadBufferSize   int           `json:"ws_read_buffer_size"`
 	WSWriteBufferSize  int           `json:"ws_write_buffer_size"`
 	WSHandshakeTimeout time.Duration `json:"ws_handshake_timeout"`
+	// Outbound message queue per agent connection, and how long a send waits when it is full
+	WSAgentSendQueueSize int           `json:"ws_agent_send_queue_size"`
+	WSAgentSendTimeout   time.Duration `json:"ws_agent_send_timeout"`
 	// InfluxDB configuration
 	InfluxDBEnabled         bool          `json:"influxdb_enabled"`
 	InfluxDBURL             string        `json:"influxdb_url"`
@@ -37,32 +40,90 @@ type ServerConfig struct {
 	TopologyRefreshInterval time.Duration `json:"topology_refresh_interval"`
 	TopologyStaleAfter      time.Duration `json:"topology_stale_after"`
 	TopologyBatchSize       int           `json:"topology_batch_size"`
+	// StackHistoryLimit caps how many previous versions are kept per stack for rollback
+	StackHistoryLimit int `json:"stack_history_limit"`
+	// MaxStackPayloadSize caps, in bytes, the compose content and env vars of a stack deploy
+	MaxStackPayloadSize int `json:"max_stack_payload_size"`
+	// PublishedURLScheme is the scheme of container URLs for ports not conventionally served over TLS
+	PublishedURLScheme string `json:"published_url_scheme"`
+	// LogBufferSize is how many application log entries the server keeps in memory
+	LogBufferSize int `json:"log_buffer_size"`
+	// Comma separated command actions the server may send to agents; see server config
+	CommandAllowlist string `json:"command_allowlist"`
+	CommandDenylist  string `json:"command_denylist"`
+	// ReadOnly disables every endpoint and agent command that changes Docker state
+	ReadOnly bool `json:"read_only"`
 }
 
+// Metrics collection modes select which metrics an agent collects.
+const (
+	MetricsModeBoth       = "both"
+	MetricsModeHost       = "host"
+	MetricsModeContainers = "containers"
+)
+
 // AgentConfig contains agent-specific configuration
 type AgentConfig struct {
 	BaseConfig
-	ServerAddress        string        `json:"server_address"`
-	ServerPort           int           `json:"server_port"`
-	ServerUseTLS         bool          `json:"server_use_tls"`
-	APIKey               string        `json:"api_key"`
-	AgentID              string        `json:"agent_id"`
-	AgentName            string        `json:"agent_name"`
-	DockerSocket         string        `json:"docker_socket"`
-	HeartbeatInterval    time.Duration `json:"heartbeat_interval"`
-	ReconnectInterval    time.Duration `json:"reconnect_interval"`
+	ServerAddress string `json:"server_address"`
+	ServerPort    int    `json:"server_port"`
+	ServerUseTLS  bool   `json:"server_use_tls"`
+	APIKey        string `json:"api_key"`
+	AgentID       string `json:"agent_id"`
+	AgentName     string `json:"agent_name"`
+	DockerSocket  string `json:"docker_socket"`
+	// Additional Docker daemons managed by the agent as name=host pairs; see agent config
+	// ParseDockerEndpoints for the syntax
+	DockerEndpoints   string        `json:"docker_endpoints"`
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+	ReconnectInterval time.Duration `json:"reconnect_interval"`
+	// Consecutive failed connection attempts, and time spent disconnected, after which the
+	// agent exits so its supervisor can handle the failure; zero retries forever
 	MaxReconnectAttempts int           `json:"max_reconnect_attempts"`
+	MaxReconnectDuration time.Duration `json:"max_reconnect_duration"`
+	// ExitOnAuthFailure makes the agent exit when the server rejects its API key instead of
+	// retrying with the same key
+	ExitOnAuthFailure bool `json:"exit_on_auth_failure"`
+	// Grace period before SIGKILL when stopping or restarting containers without an explicit timeout
+	StopTimeout time.Duration `json:"stop_timeout"`
+	// Maximum number of server commands executed at once; further commands are queued
+	MaxConcurrentCommands int `json:"max_concurrent_commands"`
+	// Maximum number of commands waiting for a free slot; beyond it the agent answers busy
+	MaxQueuedCommands int `json:"max_queued_commands"`
+	// Maximum number of log streams open at once; further stream requests are rejected
+	MaxConcurrentStreams int `json:"max_concurrent_streams"`
+	// Maximum number of metrics messages held while disconnected and sent after
+	// reconnecting; the oldest are dropped beyond it and zero disables buffering
+	OutboundBufferSize int `json:"outbound_buffer_size"`
+	// Host directory whose existing compose projects may be adopted by reading their files in
+	// place, in addition to the agent's compose working directory
+	ComposeImportRoot string `json:"compose_import_root"`
+	// How long the agent waits for any message or pong from the server before dropping the
+	// connection, and how long a single WebSocket write may take
+	WSReadTimeout  time.Duration `json:"ws_read_timeout"`
+	WSWriteTimeout time.Duration `json:"ws_write_timeout"`
 	// Metrics collection configuration
 	MetricsEnabled            bool          `json:"metrics_enabled"`
 	MetricsCollectionInterval time.Duration `json:"metrics_collection_interval"`
+	// MetricsMode limits collection to host metrics, container metrics, or both
+	MetricsMode string `json:"metrics_mode"`
 	// Host stats collection: false|true|auto (auto enables if required mounts/caps present)
 	MetricsCollectHostStats     bool `json:"metrics_collect_host_stats"`
 	MetricsCollectHostStatsAuto bool `json:"metrics_collect_host_stats_auto"`
 	MetricsCollectNetwork       bool `json:"metrics_collect_network"`
+	// Label selectors limiting which containers metrics are collected for; see
+	// agent config ParseLabelSelector for the syntax
+	MetricsIncludeLabels string `json:"metrics_include_labels"`
+	MetricsExcludeLabels string `json:"metrics_exclude_labels"`
 	// Disk I/O fallback for cgroup v2 environments where Docker blkio is missing
 	MetricsCollectDiskIOFallback bool   `json:"metrics_collect_disk_io_fallback"`
 	HostCgroupRoot               string `json:"host_cgroup_root"`
 	HostProcRoot                 string `json:"host_proc_root"`
+	// Container log export to an external syslog or HTTP endpoint; see agent config
+	// LogExportTarget for the URL forms. Containers are selected by label.
+	LogExportURL        string `json:"log_export_url"`
+	LogExportLabels     string `json:"log_export_labels"`
+	LogExportBufferSize int    `json:"log_export_buffer_size"`
 }
 
 // GetServerURL constructs the WebSocket URL from address, port, and TLS settings
@@ -94,6 +155,8 @@ func LoadServerConfig() *ServerConfig {
 		WSReadBufferSize:        getEnvAsInt("WS_READ_BUFFER_SIZE", 1024),
 		WSWriteBufferSize:       getEnvAsInt("WS_WRITE_BUFFER_SIZE", 1024),
 		WSHandshakeTimeout:      getEnvAsDuration("WS_HANDSHAKE_TIMEOUT", 10*time.Second),
+		WSAgentSendQueueSize:    getEnvAsInt("WS_AGENT_SEND_QUEUE_SIZE", 256),
+		WSAgentSendTimeout:      getEnvAsDuration("WS_AGENT_SEND_TIMEOUT", 10*time.Second),
 		InfluxDBEnabled:         getEnvAsBool("INFLUXDB_ENABLED", false),
 		InfluxDBURL:             getEnv("INFLUXDB_URL", "http://localhost:8086"),
 		InfluxDBToken:           getEnv("INFLUXDB_TOKEN", ""),
@@ -102,6 +165,13 @@ func LoadServerConfig() *ServerConfig {
 		TopologyRefreshInterval: getEnvAsDuration("TOPOLOGY_REFRESH_INTERVAL", 5*time.Minute),
 		TopologyStaleAfter:      getEnvAsDuration("TOPOLOGY_STALE_AFTER", 10*time.Minute),
 		TopologyBatchSize:       getEnvAsInt("TOPOLOGY_BATCH_SIZE", 20),
+		StackHistoryLimit:       getEnvAsInt("STACK_HISTORY_LIMIT", 10),
+		MaxStackPayloadSize:     getEnvAsInt("MAX_STACK_PAYLOAD_SIZE", 1<<20),
+		PublishedURLScheme:      getEnv("PUBLISHED_URL_SCHEME", "http"),
+		LogBufferSize:           getEnvAsInt("LOG_BUFFER_SIZE", 1000),
+		CommandAllowlist:        getEnv("COMMAND_ALLOWLIST", ""),
+		CommandDenylist:         getEnv("COMMAND_DENYLIST", ""),
+		ReadOnly:                getEnvAsBool("READ_ONLY", false),
 	}
 }
 
@@ -127,17 +197,34 @@ func LoadAgentConfig() *AgentConfig {
 		AgentID:                      getEnv("AGENT_ID", ""),
 		AgentName:                    getEnv("AGENT_NAME", getHostname()),
 		DockerSocket:                 getEnv("DOCKER_SOCKET", "/var/run/docker.sock"),
+		DockerEndpoints:              getEnv("DOCKER_ENDPOINTS", ""),
 		HeartbeatInterval:            getEnvAsDuration("AGENT_HEARTBEAT_INTERVAL", 30*time.Second),
 		ReconnectInterval:            getEnvAsDuration("AGENT_RECONNECT_INTERVAL", 5*time.Second),
 		MaxReconnectAttempts:         getEnvAsInt("AGENT_MAX_RECONNECT_ATTEMPTS", 10),
+		MaxReconnectDuration:         getEnvAsDuration("AGENT_MAX_RECONNECT_DURATION", 0),
+		ExitOnAuthFailure:            getEnvAsBool("AGENT_EXIT_ON_AUTH_FAILURE", false),
+		StopTimeout:                  getEnvAsDuration("AGENT_STOP_TIMEOUT", 30*time.Second),
+		MaxConcurrentCommands:        getEnvAsInt("AGENT_MAX_CONCURRENT_COMMANDS", 8),
+		MaxQueuedCommands:            getEnvAsInt("AGENT_MAX_QUEUED_COMMANDS", 32),
+		MaxConcurrentStreams:         getEnvAsInt("AGENT_MAX_CONCURRENT_STREAMS", 16),
+		OutboundBufferSize:           getEnvAsInt("AGENT_OUTBOUND_BUFFER_SIZE", 100),
+		ComposeImportRoot:            getEnv("AGENT_COMPOSE_IMPORT_ROOT", ""),
+		WSReadTimeout:                getEnvAsDuration("AGENT_WS_READ_TIMEOUT", 60*time.Second),
+		WSWriteTimeout:               getEnvAsDuration("AGENT_WS_WRITE_TIMEOUT", 10*time.Second),
 		MetricsEnabled:               getEnvAsBool("METRICS_ENABLED", true),
 		MetricsCollectionInterval:    getEnvAsDuration("METRICS_COLLECTION_INTERVAL", 30*time.Second),
+		MetricsMode:                  getEnv("METRICS_MODE", MetricsModeBoth),
 		MetricsCollectHostStats:      getEnvAsBool("METRICS_COLLECT_HOST_STATS", false),
 		MetricsCollectHostStatsAuto:  hostStatsAuto,
 		MetricsCollectNetwork:        getEnvAsBool("METRICS_COLLECT_NETWORK", true),
+		MetricsIncludeLabels:         getEnv("METRICS_INCLUDE_LABELS", ""),
+		MetricsExcludeLabels:         getEnv("METRICS_EXCLUDE_LABELS", ""),
 		MetricsCollectDiskIOFallback: getEnvAsBool("METRICS_COLLECT_DISK_IO_FALLBACK", false),
 		HostCgroupRoot:               getEnv("HOST_CGROUP_ROOT", "/host/sys/fs/cgroup"),
 		HostProcRoot:                 getEnv("HOST_PROC_ROOT", "/host/proc"),
+		LogExportURL:                 getEnv("LOG_EXPORT_URL", ""),
+		LogExportLabels:              getEnv("LOG_EXPORT_LABELS", "io.flotilla.log-export=true"),
+		LogExportBufferSize:          getEnvAsInt("LOG_EXPORT_BUFFER_SIZE", 1000),
 	}
 }
 
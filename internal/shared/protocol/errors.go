@@ -7,4 +7,10 @@ var (
 	ErrInvalidPayload     = errors.New("invalid payload format")
 	ErrCommandTimeout     = errors.New("command timeout")
 	ErrConnectionClosed   = errors.New("connection closed")
+	// ErrAgentBusy reports that the agent rejected a command because its queue was full;
+	// the command was not run and may be retried later
+	ErrAgentBusy = errors.New("agent busy")
+	// ErrCommandPanic reports that the agent's handler panicked while running a command, so
+	// the command may have been left half done
+	ErrCommandPanic = errors.New("agent command panicked")
 )
@@ -2,7 +2,12 @@ package protocol
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -30,6 +35,9 @@ type Message struct {
 type Command struct {
 	Action string         `json:"action"`
 	Params map[string]any `json:"params"`
+	// Endpoint names the Docker endpoint of a multi-endpoint agent the command targets; empty
+	// targets the agent's own daemon
+	Endpoint string `json:"endpoint,omitempty"`
 }
 
 // Response represents a response sent from agent to server
@@ -37,8 +45,16 @@ type Response struct {
 	Status string      `json:"status"` // success, error
 	Data   interface{} `json:"data,omitempty"`
 	Error  string      `json:"error,omitempty"`
+	Code   string      `json:"code,omitempty"` // machine-readable reason for an error status
 }
 
+// ErrorCodeAgentBusy marks an error response for a command the agent declined to run
+// because too many commands were already queued
+const ErrorCodeAgentBusy = "agent_busy"
+
+// ErrorCodeCommandPanic marks an error response for a command whose handler panicked
+const ErrorCodeCommandPanic = "command_panic"
+
 // Event represents an event sent from agent to server
 type Event struct {
 	EventType string         `json:"event_type"`
@@ -53,6 +69,33 @@ type Heartbeat struct {
 	Status            string `json:"status"` // healthy, unhealthy
 	Uptime            int64  `json:"uptime"` // seconds
 	ContainersRunning int    `json:"containers_running"`
+	// DockerHealth is absent in heartbeats from agents that do not monitor the daemon
+	DockerHealth *DockerHealth `json:"docker_health,omitempty"`
+	// Endpoints lists the additional Docker endpoints of a multi-endpoint agent
+	Endpoints []EndpointStatus `json:"endpoints,omitempty"`
+	// PingLatencyMs is the agent's rolling average websocket ping round trip to the server,
+	// absent until a pong has been received
+	PingLatencyMs *float64 `json:"ping_latency_ms,omitempty"`
+}
+
+// EndpointStatus is the state of one additional Docker endpoint managed by an agent. Each
+// endpoint is shown as a host of its own.
+type EndpointStatus struct {
+	Name              string `json:"name"`
+	Status            string `json:"status"` // healthy, unhealthy
+	ContainersRunning int    `json:"containers_running"`
+	Error             string `json:"error,omitempty"`
+}
+
+// DockerHealth summarises the Docker daemon's health as observed by an agent
+type DockerHealth struct {
+	Healthy          bool     `json:"healthy"`
+	Reasons          []string `json:"reasons,omitempty"`
+	EventStreamAlive bool     `json:"event_stream_alive"`
+	EventsReceived   uint64   `json:"events_received"`
+	PingLatencyMs    int64    `json:"ping_latency_ms"`
+	PingError        string   `json:"ping_error,omitempty"`
+	RecentErrors     []string `json:"recent_errors,omitempty"`
 }
 
 // MetricsPayload represents metrics data sent from agent to server
@@ -111,6 +154,16 @@ func NewCommandWithAction(action string, params map[string]any) *Message {
 	return NewCommand(uuid.NewString(), action, params)
 }
 
+// SetCommandEndpoint targets a command at a Docker endpoint of a multi-endpoint agent. An
+// empty endpoint targets the agent's own daemon.
+func SetCommandEndpoint(command *Message, endpoint string) {
+	if endpoint == "" {
+		delete(command.Payload, "endpoint")
+		return
+	}
+	command.Payload["endpoint"] = endpoint
+}
+
 // NewResponse creates a new response message
 func NewResponse(id string, status string, data interface{}, err error) *Message {
 	payload := map[string]any{
@@ -128,6 +181,21 @@ func NewResponse(id string, status string, data interface{}, err error) *Message
 	return NewMessage(MessageTypeResponse, id, payload)
 }
 
+// NewBusyResponse creates an error response telling the server the command was not run
+// because the agent is saturated and should be retried later
+func NewBusyResponse(id string, err error) *Message {
+	msg := NewResponse(id, "error", nil, err)
+	msg.Payload["code"] = ErrorCodeAgentBusy
+	return msg
+}
+
+// NewPanicResponse creates an error response for a command whose handler panicked
+func NewPanicResponse(id string, err error) *Message {
+	msg := NewResponse(id, "error", nil, err)
+	msg.Payload["code"] = ErrorCodeCommandPanic
+	return msg
+}
+
 // NewEvent creates a new event message
 func NewEvent(eventType string, data map[string]any) *Message {
 	return NewMessage(MessageTypeEvent, "", map[string]any{
@@ -148,6 +216,55 @@ func NewHeartbeat(agentID, agentName, hostname, status string, uptime int64, con
 	})
 }
 
+// SetDockerHealth attaches the daemon health observed by the agent to a heartbeat message
+func SetDockerHealth(heartbeat *Message, health *DockerHealth) {
+	if health != nil {
+		heartbeat.Payload["docker_health"] = health
+	}
+}
+
+// SetPingLatency attaches the agent's average ping round trip to a heartbeat message
+func SetPingLatency(heartbeat *Message, latency time.Duration) {
+	heartbeat.Payload["ping_latency_ms"] = math.Round(float64(latency.Microseconds())/10) / 100
+}
+
+// SetResponseEndpoint marks a response as coming from a Docker endpoint of a multi-endpoint
+// agent, echoing the endpoint of the command it answers.
+func SetResponseEndpoint(response *Message, endpoint string) {
+	if endpoint != "" {
+		response.Payload["endpoint"] = endpoint
+	}
+}
+
+// SetEndpoints attaches the state of a multi-endpoint agent's additional endpoints to a
+// heartbeat message
+func SetEndpoints(heartbeat *Message, endpoints []EndpointStatus) {
+	if len(endpoints) > 0 {
+		heartbeat.Payload["endpoints"] = endpoints
+	}
+}
+
+// MaxAgentNameLength bounds the display name an agent reports in its heartbeats
+const MaxAgentNameLength = 64
+
+// NormalizeAgentName trims an agent display name and checks that it is not empty, is at most
+// MaxAgentNameLength characters long and contains no control characters.
+func NormalizeAgentName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("agent name must not be empty")
+	}
+	if utf8.RuneCountInString(name) > MaxAgentNameLength {
+		return "", fmt.Errorf("agent name must be at most %d characters", MaxAgentNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("agent name must not contain control characters")
+		}
+	}
+	return name, nil
+}
+
 // NewMetrics creates a new metrics message
 func NewMetrics(hostID string, payload *MetricsPayload) *Message {
 	return NewMessage(MessageTypeMetrics, "", map[string]any{
@@ -186,9 +303,12 @@ func (m *Message) GetCommand() (*Command, error) {
 		params = make(map[string]any)
 	}
 
+	endpoint, _ := m.Payload["endpoint"].(string)
+
 	return &Command{
-		Action: action,
-		Params: params,
+		Action:   action,
+		Params:   params,
+		Endpoint: endpoint,
 	}, nil
 }
 
@@ -211,6 +331,9 @@ func (m *Message) GetResponse() (*Response, error) {
 	if err, ok := m.Payload["error"].(string); ok {
 		response.Error = err
 	}
+	if code, ok := m.Payload["code"].(string); ok {
+		response.Code = code
+	}
 
 	return response, nil
 }
@@ -250,14 +373,30 @@ func (m *Message) GetHeartbeat() (*Heartbeat, error) {
 	uptime, _ := m.Payload["uptime"].(float64)
 	containersRunning, _ := m.Payload["containers_running"].(float64)
 
-	return &Heartbeat{
+	heartbeat := &Heartbeat{
 		AgentID:           agentID,
 		AgentName:         agentName,
 		Hostname:          hostname,
 		Status:            status,
 		Uptime:            int64(uptime),
 		ContainersRunning: int(containersRunning),
-	}, nil
+	}
+	if raw, ok := m.Payload["docker_health"]; ok && raw != nil {
+		var health DockerHealth
+		if data, err := json.Marshal(raw); err == nil && json.Unmarshal(data, &health) == nil {
+			heartbeat.DockerHealth = &health
+		}
+	}
+	if raw, ok := m.Payload["endpoints"]; ok && raw != nil {
+		var endpoints []EndpointStatus
+		if data, err := json.Marshal(raw); err == nil && json.Unmarshal(data, &endpoints) == nil {
+			heartbeat.Endpoints = endpoints
+		}
+	}
+	if latency, ok := m.Payload["ping_latency_ms"].(float64); ok && latency >= 0 {
+		heartbeat.PingLatencyMs = &latency
+	}
+	return heartbeat, nil
 }
 
 // GetMetrics extracts metrics data from message payload
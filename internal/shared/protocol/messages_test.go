@@ -1,7 +1,9 @@
 package protocol
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 const (
@@ -158,3 +160,116 @@ func TestHeartbeatMessage(t *testing.T) {
 		t.Errorf("Expected containers running 5, got %d", hb.ContainersRunning)
 	}
 }
+
+func TestCommandEndpoint(t *testing.T) {
+	command := NewCommand(testID, "list_containers", map[string]any{})
+	SetCommandEndpoint(command, "build")
+
+	data, err := command.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize command: %v", err)
+	}
+	msg, err := DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf(errDeserializeFmt, err)
+	}
+	cmd, err := msg.GetCommand()
+	if err != nil || cmd.Endpoint != "build" {
+		t.Fatalf("Expected endpoint build, got %+v (err %v)", cmd, err)
+	}
+
+	SetCommandEndpoint(command, "")
+	if cmd, _ := command.GetCommand(); cmd.Endpoint != "" {
+		t.Errorf("Expected the endpoint to be cleared, got %q", cmd.Endpoint)
+	}
+}
+
+func TestHeartbeatEndpoints(t *testing.T) {
+	heartbeat := NewHeartbeat("agent-123", "agent-name", "host-1", "healthy", 60, 1)
+	SetEndpoints(heartbeat, []EndpointStatus{
+		{Name: "build", Status: "healthy", ContainersRunning: 3},
+		{Name: "edge", Status: "unhealthy", Error: "connection refused"},
+	})
+
+	data, err := heartbeat.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize heartbeat: %v", err)
+	}
+	msg, err := DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf(errDeserializeFmt, err)
+	}
+	hb, err := msg.GetHeartbeat()
+	if err != nil {
+		t.Fatalf("Failed to get heartbeat: %v", err)
+	}
+	if len(hb.Endpoints) != 2 || hb.Endpoints[0].ContainersRunning != 3 || hb.Endpoints[1].Error != "connection refused" {
+		t.Errorf("Unexpected endpoints: %+v", hb.Endpoints)
+	}
+}
+
+func TestHeartbeatPingLatency(t *testing.T) {
+	heartbeat := NewHeartbeat("agent-123", "agent-name", "host-1", "healthy", 60, 1)
+	data, err := heartbeat.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize heartbeat: %v", err)
+	}
+	msg, _ := DeserializeMessage(data)
+	if hb, _ := msg.GetHeartbeat(); hb.PingLatencyMs != nil {
+		t.Errorf("Expected no latency before a pong, got %v", *hb.PingLatencyMs)
+	}
+
+	SetPingLatency(heartbeat, 12345*time.Microsecond)
+	data, err = heartbeat.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize heartbeat: %v", err)
+	}
+	msg, err = DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf(errDeserializeFmt, err)
+	}
+	hb, err := msg.GetHeartbeat()
+	if err != nil {
+		t.Fatalf("Failed to get heartbeat: %v", err)
+	}
+	if hb.PingLatencyMs == nil || *hb.PingLatencyMs != 12.35 {
+		t.Errorf("Expected latency of 12.35ms, got %v", hb.PingLatencyMs)
+	}
+}
+
+func TestBusyResponseMessage(t *testing.T) {
+	data, err := NewBusyResponse(testID, errors.New("agent busy, retry later")).Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize response: %v", err)
+	}
+	msg, err := DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf(errDeserializeFmt, err)
+	}
+
+	resp, err := msg.GetResponse()
+	if err != nil {
+		t.Fatalf("Failed to get response: %v", err)
+	}
+	if resp.Status != "error" || resp.Code != ErrorCodeAgentBusy {
+		t.Errorf("Expected busy error response, got status=%s code=%s", resp.Status, resp.Code)
+	}
+	if resp.Error != "agent busy, retry later" {
+		t.Errorf("Unexpected error message: %s", resp.Error)
+	}
+}
+
+func TestNormalizeAgentName(t *testing.T) {
+	if name, err := NormalizeAgentName("  edge-01 "); err != nil || name != "edge-01" {
+		t.Fatalf("NormalizeAgentName = %q, %v", name, err)
+	}
+	long := make([]byte, MaxAgentNameLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	for _, name := range []string{"", "   ", "line\nbreak", string(long)} {
+		if _, err := NormalizeAgentName(name); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
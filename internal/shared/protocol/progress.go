@@ -0,0 +1,53 @@
+package protocol
+
+const (
+	// EventTypeCommandProgress is the event type of a progress report for a running command
+	EventTypeCommandProgress = "command_progress"
+	// ParamStreamProgress is the command parameter asking the agent to report progress while
+	// the command runs; agents that do not support it only send the final response
+	ParamStreamProgress = "stream_progress"
+)
+
+// Progress is an incremental report from a long running command such as an image pull or a
+// stack deployment. It is correlated with the command by CommandID and followed by the
+// command's final response.
+type Progress struct {
+	CommandID string `json:"command_id"`
+	Stage     string `json:"stage"`
+	Message   string `json:"message,omitempty"`
+	// Current and Total count completed and overall steps when the stage has them
+	Current int `json:"current,omitempty"`
+	Total   int `json:"total,omitempty"`
+}
+
+// NewProgress creates a progress event for the command named by progress.CommandID
+func NewProgress(progress Progress) *Message {
+	msg := NewEvent(EventTypeCommandProgress, map[string]any{
+		"command_id": progress.CommandID,
+		"stage":      progress.Stage,
+		"message":    progress.Message,
+		"current":    progress.Current,
+		"total":      progress.Total,
+	})
+	msg.ID = progress.CommandID
+	return msg
+}
+
+// GetProgress extracts a command progress report from an event message
+func (m *Message) GetProgress() (*Progress, error) {
+	event, err := m.GetEvent()
+	if err != nil {
+		return nil, err
+	}
+	if event.EventType != EventTypeCommandProgress {
+		return nil, ErrInvalidMessageType
+	}
+	var progress Progress
+	if err := DecodeResult(event.Data, &progress); err != nil {
+		return nil, err
+	}
+	if progress.CommandID == "" {
+		progress.CommandID = m.ID
+	}
+	return &progress, nil
+}
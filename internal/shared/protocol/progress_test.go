@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProgressMessage(t *testing.T) {
+	msg := NewProgress(Progress{CommandID: testID, Stage: "pull", Message: "Pulled nginx:1.27", Current: 1, Total: 3})
+
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize progress: %v", err)
+	}
+	decoded, err := DeserializeMessage(data)
+	if err != nil {
+		t.Fatalf(errDeserializeFmt, err)
+	}
+	if decoded.Type != MessageTypeEvent || decoded.ID != testID {
+		t.Fatalf("unexpected progress message: %+v", decoded)
+	}
+
+	progress, err := decoded.GetProgress()
+	if err != nil {
+		t.Fatalf("GetProgress returned error: %v", err)
+	}
+	if progress.CommandID != testID || progress.Stage != "pull" || progress.Current != 1 || progress.Total != 3 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+
+	if _, err := NewEvent("log_data", nil).GetProgress(); !errors.Is(err, ErrInvalidMessageType) {
+		t.Fatalf("expected ErrInvalidMessageType for other events, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ResourceRemovalResult is the data returned by the remove_images, remove_volumes and
+// remove_networks commands.
+type ResourceRemovalResult struct {
+	Removed   []string                  `json:"removed"`
+	Conflicts []ResourceRemovalConflict `json:"conflicts,omitempty"`
+	Errors    []ResourceRemovalError    `json:"errors,omitempty"`
+}
+
+// ImagePruneResult is the data returned by the prune_dangling_images command.
+type ImagePruneResult struct {
+	Removed        []string `json:"removed"`
+	SpaceReclaimed uint64   `json:"space_reclaimed"`
+}
+
+// ContainerListResult is the data returned by the list_containers and get_stack_containers
+// commands. Containers are kept as generic records so callers can enrich and filter them.
+type ContainerListResult struct {
+	Containers []map[string]any `json:"containers"`
+}
+
+// ImageListResult is the data returned by the list_images command.
+type ImageListResult struct {
+	Images []map[string]any `json:"images"`
+}
+
+// LiveMetricsResult is the data returned by the get_live_metrics command.
+type LiveMetricsResult struct {
+	Metrics *MetricsPayload `json:"metrics"`
+}
+
+// DecodeResult decodes a response data payload into a typed result. A payload that is
+// missing or does not match the result shape is reported as ErrInvalidPayload.
+func DecodeResult(data any, result any) error {
+	if data == nil {
+		return ErrInvalidPayload
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeResultRemoval(t *testing.T) {
+	data := map[string]any{
+		"removed": []string{"img-1"},
+		"conflicts": []any{map[string]any{
+			"resource_type":   "image",
+			"resource_id":     "img-2",
+			"reason":          "in use",
+			"force_supported": true,
+			"blockers":        []any{map[string]any{"kind": "container", "name": "web"}},
+		}},
+	}
+
+	var result ResourceRemovalResult
+	if err := DecodeResult(data, &result); err != nil {
+		t.Fatalf("DecodeResult returned error: %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != "img-1" {
+		t.Fatalf("unexpected removed list: %#v", result.Removed)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].ResourceType != ResourceTypeImage || !result.Conflicts[0].ForceSupported {
+		t.Fatalf("unexpected conflicts: %#v", result.Conflicts)
+	}
+	if len(result.Conflicts[0].Blockers) != 1 || result.Conflicts[0].Blockers[0].Name != "web" {
+		t.Fatalf("unexpected blockers: %#v", result.Conflicts[0].Blockers)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("expected no errors, got %#v", result.Errors)
+	}
+}
+
+func TestDecodeResultInvalidShape(t *testing.T) {
+	var result ContainerListResult
+	err := DecodeResult(map[string]any{"containers": "not-a-list"}, &result)
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+
+	if err := DecodeResult(nil, &result); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected ErrInvalidPayload for nil data, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the agent protocol version spoken by this build. It is negotiated
+// through the WebSocket subprotocol during the agent handshake.
+const ProtocolVersion = 1
+
+const (
+	agentSubprotocolPrefix = "flotilla-agent.v"
+	capabilityPrefix       = "flotilla-cap."
+)
+
+// Close codes the server sends when it drops an agent connection right after the handshake.
+// They are in the 4000-4999 range reserved for applications.
+const (
+	// CloseAuthenticationFailed means the agent's API key is missing, invalid or not scoped
+	// for agents; retrying with the same key will not succeed
+	CloseAuthenticationFailed = 4401
+)
+
+// Capabilities an agent advertises alongside its protocol version.
+const (
+	// CapabilityBusyResponses means the agent answers with ErrorCodeAgentBusy when saturated
+	CapabilityBusyResponses = "busy-responses"
+	// CapabilityConcurrentCommands means the agent runs commands concurrently
+	CapabilityConcurrentCommands = "concurrent-commands"
+	// CapabilityMultiEndpoint means the agent manages additional Docker endpoints, reported
+	// in heartbeats and targeted through the command endpoint
+	CapabilityMultiEndpoint = "multi-endpoint"
+	// CapabilityCompose means the agent can run stack commands; agents whose compose setup
+	// failed leave it out
+	CapabilityCompose = "compose"
+)
+
+// AgentCapabilities lists the capabilities advertised by this build of the agent.
+var AgentCapabilities = []string{CapabilityBusyResponses, CapabilityConcurrentCommands}
+
+// AgentSubprotocol returns the subprotocol name for an agent protocol version.
+func AgentSubprotocol(version int) string {
+	return agentSubprotocolPrefix + strconv.Itoa(version)
+}
+
+// AgentSubprotocols returns the Sec-WebSocket-Protocol values an agent offers: its protocol
+// version, which the server selects, followed by one entry per capability.
+func AgentSubprotocols(capabilities []string) []string {
+	offered := []string{AgentSubprotocol(ProtocolVersion)}
+	for _, capability := range capabilities {
+		offered = append(offered, capabilityPrefix+capability)
+	}
+	return offered
+}
+
+// ParseAgentSubprotocols splits the subprotocols offered by an agent into the protocol
+// versions and capabilities it announced. Entries that are neither are ignored.
+func ParseAgentSubprotocols(offered []string) (versions []int, capabilities []string) {
+	for _, entry := range offered {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case strings.HasPrefix(entry, agentSubprotocolPrefix):
+			if version, err := strconv.Atoi(strings.TrimPrefix(entry, agentSubprotocolPrefix)); err == nil && version > 0 {
+				versions = append(versions, version)
+			}
+		case strings.HasPrefix(entry, capabilityPrefix):
+			if capability := strings.TrimPrefix(entry, capabilityPrefix); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	return versions, capabilities
+}
@@ -0,0 +1,18 @@
+package protocol
+
+import "testing"
+
+func TestAgentSubprotocolsRoundTrip(t *testing.T) {
+	offered := AgentSubprotocols([]string{CapabilityBusyResponses})
+	if offered[0] != "flotilla-agent.v1" || offered[1] != "flotilla-cap.busy-responses" {
+		t.Fatalf("unexpected subprotocols: %v", offered)
+	}
+
+	versions, capabilities := ParseAgentSubprotocols(append(offered, "flotilla-ui", "flotilla-agent.vX"))
+	if len(versions) != 1 || versions[0] != ProtocolVersion {
+		t.Fatalf("unexpected versions: %v", versions)
+	}
+	if len(capabilities) != 1 || capabilities[0] != CapabilityBusyResponses {
+		t.Fatalf("unexpected capabilities: %v", capabilities)
+	}
+}